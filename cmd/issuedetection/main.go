@@ -16,6 +16,7 @@ import (
 	"github.com/pierrec/lz4"
 
 	"github.com/getsentry/vroom/internal/occurrence"
+	"github.com/getsentry/vroom/internal/platform"
 	"github.com/getsentry/vroom/internal/profile"
 )
 
@@ -26,6 +27,7 @@ const (
 func main() {
 	debug := flag.Bool("debug", false, "activate debug logs")
 	root := flag.String("path", ".", "path to a profile or a directory with profiles")
+	rules := flag.String("rules", "", "path to a detection rules file replacing the default rules")
 
 	flag.Parse()
 
@@ -37,6 +39,15 @@ func main() {
 		slog.SetDefault(slog.New(handler))
 	}
 
+	detectionRules := occurrence.DefaultDetectionRules()
+	if *rules != "" {
+		var err error
+		detectionRules, err = occurrence.LoadDetectionRules(*rules)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	f, err := os.Open(*root)
 	if err != nil {
 		log.Fatal(err)
@@ -56,7 +67,7 @@ func main() {
 
 	for w := 0; w < workersCount; w++ {
 		wg.Add(1)
-		go AnalyzeProfile(pathChannel, errChannel, &wg)
+		go AnalyzeProfile(pathChannel, errChannel, &wg, detectionRules)
 	}
 
 	err = filepath.WalkDir(*root, func(path string, d fs.DirEntry, err error) error {
@@ -78,7 +89,12 @@ func main() {
 	close(errChannel)
 }
 
-func AnalyzeProfile(pathChannel chan string, errChan chan error, wg *sync.WaitGroup) {
+func AnalyzeProfile(
+	pathChannel chan string,
+	errChan chan error,
+	wg *sync.WaitGroup,
+	detectionRules map[platform.Platform][]occurrence.DetectFrameOptions,
+) {
 	defer wg.Done()
 
 	for path := range pathChannel {
@@ -103,7 +119,7 @@ func AnalyzeProfile(pathChannel chan string, errChan chan error, wg *sync.WaitGr
 			errChan <- err
 			continue
 		}
-		for _, o := range occurrence.Find(p, callTrees) {
+		for _, o := range occurrence.Find(p, callTrees, detectionRules) {
 			fmt.Println( // nolint
 				o.Event.Platform,
 				o.Event.ProjectID,
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/getsentry/vroom/internal/chunk"
+	"github.com/getsentry/vroom/internal/httputil"
+	"github.com/getsentry/vroom/internal/profile"
+	"github.com/getsentry/vroom/internal/storageutil"
+)
+
+const (
+	// maxBatchObjects is the highest number of profiles and chunks read in
+	// a single request.
+	maxBatchObjects = 1000
+	// maxBatchInFlight is the highest number of objects read but not written
+	// yet, so a slow client doesn't keep the whole batch in memory.
+	maxBatchInFlight = 16
+
+	ndjsonContentType    = "application/x-ndjson"
+	multipartContentType = "multipart/mixed"
+
+	batchObjectProfile = "profile"
+	batchObjectChunk   = "chunk"
+)
+
+var errTooManyBatchObjects = fmt.Errorf("can't read more than %d profiles and chunks at once", maxBatchObjects)
+
+type (
+	postRawBatchRequest struct {
+		ProfileIDs []string          `json:"profile_ids"`
+		Chunks     []rawBatchChunkID `json:"chunks"`
+	}
+
+	rawBatchChunkID struct {
+		ProfilerID string `json:"profiler_id"`
+		ChunkID    string `json:"chunk_id"`
+	}
+
+	// rawBatchObject is a line of the NDJSON response or a part of the
+	// multipart one, either the object or the error reading it.
+	rawBatchObject struct {
+		Type       string           `json:"type"`
+		ProfileID  string           `json:"profile_id,omitempty"`
+		ProfilerID string           `json:"profiler_id,omitempty"`
+		ChunkID    string           `json:"chunk_id,omitempty"`
+		Profile    *profile.Profile `json:"profile,omitempty"`
+		Chunk      *chunk.Chunk     `json:"chunk,omitempty"`
+		Error      *httputil.Error  `json:"error,omitempty"`
+	}
+
+	// rawBatchWriter writes the objects of a batch as they're read.
+	rawBatchWriter interface {
+		Write(o rawBatchObject) error
+		Close() error
+	}
+
+	ndjsonBatchWriter struct {
+		w   http.ResponseWriter
+		enc *json.Encoder
+	}
+
+	multipartBatchWriter struct {
+		w  http.ResponseWriter
+		mw *multipart.Writer
+	}
+)
+
+// postRawBatch streams the raw profiles and chunks of a project as NDJSON, or
+// as a multipart response when asked for, in the order they're read. An
+// object that can't be read is replaced by its error.
+func (env *environment) postRawBatch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	hub := sentry.GetHubFromContext(ctx)
+	ps := httprouter.ParamsFromContext(ctx)
+	rawOrganizationID := ps.ByName("organization_id")
+	organizationID, err := strconv.ParseUint(rawOrganizationID, 10, 64)
+	if err != nil {
+		if hub != nil {
+			hub.CaptureException(err)
+		}
+		writeInvalidID(w, "organization_id")
+		return
+	}
+
+	hub.Scope().SetTag("organization_id", rawOrganizationID)
+
+	rawProjectID := ps.ByName("project_id")
+	projectID, err := strconv.ParseUint(rawProjectID, 10, 64)
+	if err != nil {
+		if hub != nil {
+			hub.CaptureException(err)
+		}
+		writeInvalidID(w, "project_id")
+		return
+	}
+
+	hub.Scope().SetTag("project_id", rawProjectID)
+
+	var requestBody postRawBatchRequest
+	s := sentry.StartSpan(ctx, "processing")
+	s.Description = "Decoding data"
+	err = json.NewDecoder(r.Body).Decode(&requestBody)
+	s.Finish()
+	if err != nil {
+		if hub != nil {
+			hub.CaptureException(err)
+		}
+		writeInvalidBody(w, err)
+		return
+	}
+
+	numObjects := len(requestBody.ProfileIDs) + len(requestBody.Chunks)
+	if numObjects > maxBatchObjects {
+		writeInvalidBody(w, errTooManyBatchObjects)
+		return
+	}
+	for _, profileID := range requestBody.ProfileIDs {
+		if _, err := uuid.Parse(profileID); err != nil {
+			writeInvalidID(w, "profile_ids")
+			return
+		}
+	}
+	for _, c := range requestBody.Chunks {
+		if _, err := uuid.Parse(c.ProfilerID); err != nil {
+			writeInvalidID(w, "profiler_id")
+			return
+		}
+		if _, err := uuid.Parse(c.ChunkID); err != nil {
+			writeInvalidID(w, "chunk_id")
+			return
+		}
+	}
+
+	hub.Scope().SetTag("num_objects", strconv.Itoa(numObjects))
+
+	results := make(chan storageutil.ReadJobResult, maxBatchInFlight)
+	defer close(results)
+	inFlight := make(chan struct{}, maxBatchInFlight)
+
+	// send a task to the workers pool for each object, once an object is
+	// written if too many are in flight
+	go func() {
+		for _, profileID := range requestBody.ProfileIDs {
+			inFlight <- struct{}{}
+			readJobs <- profile.ReadJob{
+				Ctx:            ctx,
+				Storage:        env.storage,
+				OrganizationID: organizationID,
+				ProjectID:      projectID,
+				ProfileID:      profileID,
+				Result:         results,
+			}
+		}
+		for _, c := range requestBody.Chunks {
+			inFlight <- struct{}{}
+			readJobs <- chunk.ReadJob{
+				Ctx:            ctx,
+				Storage:        env.storage,
+				OrganizationID: organizationID,
+				ProjectID:      projectID,
+				ProfilerID:     c.ProfilerID,
+				ChunkID:        c.ChunkID,
+				Result:         results,
+			}
+		}
+	}()
+
+	var bw rawBatchWriter
+	if wantsMultipart(r) {
+		bw = newMultipartBatchWriter(w)
+	} else {
+		bw = newNDJSONBatchWriter(w)
+	}
+	w.WriteHeader(http.StatusOK)
+
+	s = sentry.StartSpan(ctx, "objects.read")
+	s.Description = "Read profiles and chunks from GCS"
+	defer s.Finish()
+	var writeErr error
+	// All the results are read, even once the client is gone, since the
+	// workers write them until all the objects were dispatched.
+	for i := 0; i < numObjects; i++ {
+		res := <-results
+		o, ok := newRawBatchObject(hub, res)
+		if ok && writeErr == nil {
+			writeErr = bw.Write(o)
+		}
+		<-inFlight
+	}
+	if writeErr == nil {
+		_ = bw.Close()
+	}
+}
+
+// newRawBatchObject returns the object read or the error reading it.
+func newRawBatchObject(hub *sentry.Hub, res storageutil.ReadJobResult) (rawBatchObject, bool) {
+	switch result := res.(type) {
+	case profile.ReadJobResult:
+		o := rawBatchObject{Type: batchObjectProfile, ProfileID: result.ProfileID}
+		if result.Err != nil {
+			_, e := storageError(hub, result.Err, "profile_ids", "profile not found")
+			o.Error = &e
+		} else {
+			o.Profile = result.Profile
+		}
+		return o, true
+	case chunk.ReadJobResult:
+		o := rawBatchObject{
+			Type:       batchObjectChunk,
+			ProfilerID: result.ProfilerID,
+			ChunkID:    result.ChunkID,
+		}
+		if result.Err != nil {
+			_, e := storageError(hub, result.Err, "chunks", fmt.Sprintf("chunk %s not found", result.ChunkID))
+			o.Error = &e
+		} else {
+			o.Chunk = result.Chunk
+		}
+		return o, true
+	default:
+		// This should never happen
+		return rawBatchObject{}, false
+	}
+}
+
+// wantsMultipart returns true when a multipart response is requested with
+// the format query parameter or the Accept header.
+func wantsMultipart(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "multipart" {
+		return true
+	}
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+			if err == nil && mediaType == multipartContentType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func newNDJSONBatchWriter(w http.ResponseWriter) *ndjsonBatchWriter {
+	w.Header().Set("Content-Type", ndjsonContentType)
+	return &ndjsonBatchWriter{w: w, enc: json.NewEncoder(w)}
+}
+
+func (bw *ndjsonBatchWriter) Write(o rawBatchObject) error {
+	if err := bw.enc.Encode(o); err != nil {
+		return err
+	}
+	flush(bw.w)
+	return nil
+}
+
+func (bw *ndjsonBatchWriter) Close() error {
+	return nil
+}
+
+func newMultipartBatchWriter(w http.ResponseWriter) *multipartBatchWriter {
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", mime.FormatMediaType(multipartContentType, map[string]string{
+		"boundary": mw.Boundary(),
+	}))
+	return &multipartBatchWriter{w: w, mw: mw}
+}
+
+func (bw *multipartBatchWriter) Write(o rawBatchObject) error {
+	id := o.ProfileID
+	if o.Type == batchObjectChunk {
+		id = o.ProfilerID + "/" + o.ChunkID
+	}
+	part, err := bw.mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"application/json"},
+		"Content-Id":   {fmt.Sprintf("<%s:%s>", o.Type, id)},
+	})
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(part).Encode(o); err != nil {
+		return err
+	}
+	flush(bw.w)
+	return nil
+}
+
+func (bw *multipartBatchWriter) Close() error {
+	return bw.mw.Close()
+}
+
+// flush sends what was written so far to the client.
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
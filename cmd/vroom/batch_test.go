@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/getsentry/vroom/internal/frame"
+	"github.com/getsentry/vroom/internal/httputil"
+	"github.com/getsentry/vroom/internal/platform"
+	"github.com/getsentry/vroom/internal/sample"
+	"github.com/getsentry/vroom/internal/storageutil"
+	"github.com/getsentry/vroom/internal/testutil"
+)
+
+func TestPostRawBatch(t *testing.T) {
+	readJobs = make(chan storageutil.ReadJob)
+	go storageutil.ReadWorker(readJobs, nil)
+	defer func() {
+		close(readJobs)
+		readJobs = nil
+	}()
+
+	p := sample.Profile{
+		RawProfile: sample.RawProfile{
+			EventID:        "5d1c2b0e7a9f4c3e8b6a0d2f4e6c8a1b",
+			OrganizationID: 1,
+			ProjectID:      4,
+			Platform:       platform.Cocoa,
+			Version:        "1",
+			Trace: sample.Trace{
+				Frames: []frame.Frame{
+					{Function: "main", InstructionAddr: "0x10"},
+				},
+				Samples: []sample.Sample{
+					{StackID: 0, ThreadID: 1},
+					{StackID: 0, ThreadID: 1, ElapsedSinceStartNS: 10},
+				},
+				Stacks: []sample.Stack{{0}},
+			},
+		},
+	}
+	rec := postJSON(t, "/organizations/1/projects/4/raw_profiles", p)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+
+	body := postRawBatchRequest{
+		ProfileIDs: []string{p.EventID, "0f1e2d3c4b5a69788796a5b4c3d2e1f0"},
+		Chunks: []rawBatchChunkID{
+			{ProfilerID: "8a6f8c4b2f3a4d0e9b1c7d6e5f4a3b2c", ChunkID: "c1bd7f5cbb0d4e1fa4ad19a8b0e2f9d4"},
+		},
+	}
+	want := []batchObjectSummary{
+		{Type: batchObjectChunk, ID: "c1bd7f5cbb0d4e1fa4ad19a8b0e2f9d4", Error: &httputil.Error{
+			Code:      httputil.ErrorCodeNotFound,
+			Message:   "chunk c1bd7f5cbb0d4e1fa4ad19a8b0e2f9d4 not found",
+			Parameter: "chunks",
+		}},
+		{Type: batchObjectProfile, ID: "0f1e2d3c4b5a69788796a5b4c3d2e1f0", Error: &httputil.Error{
+			Code:      httputil.ErrorCodeNotFound,
+			Message:   "profile not found",
+			Parameter: "profile_ids",
+		}},
+		{Type: batchObjectProfile, ID: p.EventID, Found: true},
+	}
+
+	t.Run("ndjson", func(t *testing.T) {
+		rec := postJSON(t, "/organizations/1/projects/4/raw_batch", body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+		if contentType := rec.Header().Get("Content-Type"); contentType != ndjsonContentType {
+			t.Fatalf("expected %s, got %s", ndjsonContentType, contentType)
+		}
+		var got []batchObjectSummary
+		scanner := bufio.NewScanner(rec.Body)
+		scanner.Buffer(nil, 1024*1024)
+		for scanner.Scan() {
+			got = append(got, summarizeBatchObject(t, scanner.Bytes()))
+		}
+		sortBatchObjects(got)
+		if diff := testutil.Diff(got, want); diff != "" {
+			t.Fatalf("Result mismatch: got - want +\n%s", diff)
+		}
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		rec := postJSON(t, "/organizations/1/projects/4/raw_batch?format=multipart", body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+		mediaType, params, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+		if err != nil || mediaType != multipartContentType {
+			t.Fatalf("expected %s, got %s", multipartContentType, rec.Header().Get("Content-Type"))
+		}
+		var got []batchObjectSummary
+		mr := multipart.NewReader(rec.Body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("couldn't read the part: %v", err)
+			}
+			b, err := io.ReadAll(part)
+			if err != nil {
+				t.Fatalf("couldn't read the part: %v", err)
+			}
+			got = append(got, summarizeBatchObject(t, b))
+		}
+		sortBatchObjects(got)
+		if diff := testutil.Diff(got, want); diff != "" {
+			t.Fatalf("Result mismatch: got - want +\n%s", diff)
+		}
+	})
+
+	t.Run("more objects than in flight", func(t *testing.T) {
+		var profileIDs []string
+		for i := 0; i < 3*maxBatchInFlight; i++ {
+			profileIDs = append(profileIDs, uuid.New().String())
+		}
+		rec := postJSON(t, "/organizations/1/projects/4/raw_batch", postRawBatchRequest{ProfileIDs: profileIDs})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+		lines := 0
+		scanner := bufio.NewScanner(rec.Body)
+		for scanner.Scan() {
+			lines++
+		}
+		if lines != len(profileIDs) {
+			t.Fatalf("expected %d objects, got %d", len(profileIDs), lines)
+		}
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		rec := postJSON(t, "/organizations/1/projects/4/raw_batch", postRawBatchRequest{
+			ProfileIDs: []string{"not-an-id"},
+		})
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusBadRequest, rec.Code, rec.Body.String())
+		}
+	})
+}
+
+// batchObjectSummary is what identifies an object of a batch response and
+// whether it was found.
+type batchObjectSummary struct {
+	Type  string
+	ID    string
+	Found bool
+	Error *httputil.Error
+}
+
+func summarizeBatchObject(t *testing.T, b []byte) batchObjectSummary {
+	t.Helper()
+
+	var o struct {
+		Type      string          `json:"type"`
+		ProfileID string          `json:"profile_id"`
+		ChunkID   string          `json:"chunk_id"`
+		Profile   json.RawMessage `json:"profile"`
+		Chunk     json.RawMessage `json:"chunk"`
+		Error     *httputil.Error `json:"error"`
+	}
+	if err := json.Unmarshal(b, &o); err != nil {
+		t.Fatalf("couldn't decode the object: %v: %s", err, b)
+	}
+	s := batchObjectSummary{
+		Type:  o.Type,
+		ID:    o.ProfileID,
+		Found: len(o.Profile) > 0 || len(o.Chunk) > 0,
+		Error: o.Error,
+	}
+	if o.Type == batchObjectChunk {
+		s.ID = o.ChunkID
+	}
+	return s
+}
+
+func sortBatchObjects(objects []batchObjectSummary) {
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].Type != objects[j].Type {
+			return objects[i].Type < objects[j].Type
+		}
+		return objects[i].ID < objects[j].ID
+	})
+}
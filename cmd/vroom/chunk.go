@@ -2,17 +2,22 @@ package main
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/getsentry/sentry-go"
 	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
-	"google.golang.org/api/googleapi"
 
 	"github.com/getsentry/vroom/internal/chunk"
+	"github.com/getsentry/vroom/internal/flamegraph"
+	"github.com/getsentry/vroom/internal/folded"
+	"github.com/getsentry/vroom/internal/httputil"
+	"github.com/getsentry/vroom/internal/nodetree"
+	"github.com/getsentry/vroom/internal/pprof"
 	"github.com/getsentry/vroom/internal/storageutil"
 )
 
@@ -41,6 +46,7 @@ type postProfileFromChunkIDsResponse struct {
 // This is more of a GET method, but since we're receiving a list of chunk IDs as part of a
 // body request, we use a POST method instead (similarly to the flamegraph endpoint).
 func (env *environment) postProfileFromChunkIDs(w http.ResponseWriter, r *http.Request) {
+	varyOnAccept(w)
 	ctx := r.Context()
 	hub := sentry.GetHubFromContext(ctx)
 	ps := httprouter.ParamsFromContext(ctx)
@@ -48,7 +54,7 @@ func (env *environment) postProfileFromChunkIDs(w http.ResponseWriter, r *http.R
 	organizationID, err := strconv.ParseUint(rawOrganizationID, 10, 64)
 	if err != nil {
 		hub.CaptureException(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeInvalidID(w, "organization_id")
 		return
 	}
 
@@ -58,7 +64,7 @@ func (env *environment) postProfileFromChunkIDs(w http.ResponseWriter, r *http.R
 	projectID, err := strconv.ParseUint(rawProjectID, 10, 64)
 	if err != nil {
 		sentry.CaptureException(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeInvalidID(w, "project_id")
 		return
 	}
 	hub.Scope().SetTag("project_id", rawProjectID)
@@ -70,7 +76,7 @@ func (env *environment) postProfileFromChunkIDs(w http.ResponseWriter, r *http.R
 	s.Finish()
 	if err != nil {
 		hub.CaptureException(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeInvalidBody(w, err)
 		return
 	}
 	r.Body.Close()
@@ -97,6 +103,7 @@ func (env *environment) postProfileFromChunkIDs(w http.ResponseWriter, r *http.R
 		}
 	}()
 
+	var missingChunkID string
 	chunkIDs := make([]string, 0, len(requestBody.ChunkIDs))
 	chunks := make([]chunk.Chunk, 0, len(requestBody.ChunkIDs))
 	// read the output of each tasks
@@ -111,6 +118,7 @@ func (env *environment) postProfileFromChunkIDs(w http.ResponseWriter, r *http.R
 		// and then we skip
 		if result.Err != nil {
 			err = result.Err
+			missingChunkID = result.ChunkID
 			continue
 		} else if err != nil {
 			// if this specific chunk download did not produce an error,
@@ -122,29 +130,18 @@ func (env *environment) postProfileFromChunkIDs(w http.ResponseWriter, r *http.R
 	}
 	s.Finish()
 	if err != nil {
-		if errors.Is(err, storageutil.ErrObjectNotFound) {
-			w.WriteHeader(http.StatusNotFound)
-			return
-		}
-		var e *googleapi.Error
-		if ok := errors.As(err, &e); ok {
-			hub.Scope().SetContext("Google Cloud Storage Error", map[string]interface{}{
-				"body":    e.Body,
-				"code":    e.Code,
-				"details": e.Details,
-				"message": e.Message,
-			})
-		}
-		hub.CaptureException(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeStorageError(w, hub, err, "chunk_ids", fmt.Sprintf("chunk %s not found", missingChunkID))
 		return
 	}
 
 	s = sentry.StartSpan(ctx, "chunks.merge")
 	s.Description = "Merge profile chunks into a single one"
 	if len(chunks) == 0 {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "error: no chunks found to merge")
+		httputil.WriteError(w, http.StatusBadRequest, httputil.Error{
+			Code:      httputil.ErrorCodeNoChunks,
+			Message:   "no chunks found to merge",
+			Parameter: "chunk_ids",
+		})
 		return
 	}
 	var resp []byte
@@ -162,8 +159,11 @@ func (env *environment) postProfileFromChunkIDs(w http.ResponseWriter, r *http.R
 		for _, c := range chunks {
 			sc, ok := c.Chunk().(*chunk.SampleChunk)
 			if !ok {
-				w.WriteHeader(http.StatusBadRequest)
-				fmt.Fprint(w, "error: mix of sampled and android chunks")
+				httputil.WriteError(w, http.StatusBadRequest, httputil.Error{
+					Code:      httputil.ErrorCodeMixedChunkTypes,
+					Message:   "mix of sampled and android chunks",
+					Parameter: "chunk_ids",
+				})
 				return
 			}
 			chunkIDs = append(chunkIDs, sc.ID)
@@ -172,8 +172,33 @@ func (env *environment) postProfileFromChunkIDs(w http.ResponseWriter, r *http.R
 		mergedChunk, err := chunk.MergeSampleChunks(sampleChunks, requestBody.Start, requestBody.End)
 		s.Finish()
 		if err != nil {
-			hub.CaptureException(err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeInternalError(w, hub, err)
+			return
+		}
+		if asPprof, asFolded := wantsPprof(r), wantsFolded(r); asPprof || asFolded {
+			callTrees, err := mergedChunk.CallTrees(nil)
+			if err != nil {
+				writeInternalError(w, hub, err)
+				return
+			}
+			if asFolded {
+				writeFolded(ctx, w, hub, func(out io.Writer) error {
+					return folded.WriteCallTrees(out, callTrees, foldedWeight(r))
+				})
+				return
+			}
+			start := time.Unix(0, int64(mergedChunk.StartTimestamp()*1e9))
+			durationNS := uint64((mergedChunk.EndTimestamp() - mergedChunk.StartTimestamp()) * 1e9)
+			writePprof(ctx, w, hub, pprof.FromCallTrees(callTrees, start, durationNS))
+			return
+		}
+		if format := traceFormat(r); format != "" {
+			o, err := mergedChunk.Speedscope()
+			if err != nil {
+				writeInternalError(w, hub, err)
+				return
+			}
+			writeTrace(ctx, w, hub, format, o)
 			return
 		}
 		s = sentry.StartSpan(ctx, "json.marshal")
@@ -183,8 +208,7 @@ func (env *environment) postProfileFromChunkIDs(w http.ResponseWriter, r *http.R
 		})
 		s.Finish()
 		if err != nil {
-			hub.CaptureException(err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeInternalError(w, hub, err)
 			return
 		}
 
@@ -193,18 +217,50 @@ func (env *environment) postProfileFromChunkIDs(w http.ResponseWriter, r *http.R
 		for _, c := range chunks {
 			ac, ok := c.Chunk().(*chunk.AndroidChunk)
 			if !ok {
-				w.WriteHeader(http.StatusBadRequest)
-				fmt.Fprint(w, "error: mix of android and sample chunks")
+				httputil.WriteError(w, http.StatusBadRequest, httputil.Error{
+					Code:      httputil.ErrorCodeMixedChunkTypes,
+					Message:   "mix of android and sample chunks",
+					Parameter: "chunk_ids",
+				})
 				return
 			}
 			chunkIDs = append(chunkIDs, ac.ID)
 			androidChunks = append(androidChunks, *ac)
 		}
+		if asPprof, asFolded := wantsPprof(r), wantsFolded(r); asPprof || asFolded {
+			callTrees := make(map[string][]*nodetree.Node)
+			for _, c := range androidChunks {
+				chunkCallTrees, err := c.CallTrees(nil)
+				if err != nil {
+					writeInternalError(w, hub, err)
+					return
+				}
+				for threadID, callTree := range chunkCallTrees {
+					callTrees[threadID] = append(
+						callTrees[threadID],
+						flamegraph.SliceCallTree(callTree, requestBody.Start, requestBody.End)...,
+					)
+				}
+			}
+			s.Finish()
+			if asFolded {
+				writeFolded(ctx, w, hub, func(out io.Writer) error {
+					return folded.WriteCallTrees(out, callTrees, foldedWeight(r))
+				})
+				return
+			}
+			start := time.Unix(0, int64(requestBody.Start))
+			writePprof(ctx, w, hub, pprof.FromCallTrees(callTrees, start, requestBody.End-requestBody.Start))
+			return
+		}
 		sp, err := chunk.SpeedscopeFromAndroidChunks(androidChunks, requestBody.Start, requestBody.End)
 		s.Finish()
 		if err != nil {
-			hub.CaptureException(err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeInternalError(w, hub, err)
+			return
+		}
+		if format := traceFormat(r); format != "" {
+			writeTrace(ctx, w, hub, format, sp)
 			return
 		}
 		s = sentry.StartSpan(ctx, "json.marshal")
@@ -214,13 +270,12 @@ func (env *environment) postProfileFromChunkIDs(w http.ResponseWriter, r *http.R
 		})
 		s.Finish()
 		if err != nil {
-			hub.CaptureException(err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeInternalError(w, hub, err)
 			return
 		}
 	default:
 		// Should never happen.
-		w.WriteHeader(http.StatusBadRequest)
+		writeInternalError(w, hub, fmt.Errorf("unexpected chunk type %T", chunks[0].Chunk()))
 		return
 	}
 
@@ -237,7 +292,7 @@ func (env *environment) getRawChunk(w http.ResponseWriter, r *http.Request) {
 	organizationID, err := strconv.ParseUint(rawOrganizationID, 10, 64)
 	if err != nil {
 		hub.CaptureException(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeInvalidID(w, "organization_id")
 		return
 	}
 
@@ -247,7 +302,7 @@ func (env *environment) getRawChunk(w http.ResponseWriter, r *http.Request) {
 	projectID, err := strconv.ParseUint(rawProjectID, 10, 64)
 	if err != nil {
 		sentry.CaptureException(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeInvalidID(w, "project_id")
 		return
 	}
 
@@ -257,7 +312,7 @@ func (env *environment) getRawChunk(w http.ResponseWriter, r *http.Request) {
 	_, err = uuid.Parse(profilerID)
 	if err != nil {
 		hub.CaptureException(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeInvalidID(w, "profiler_id")
 		return
 	}
 
@@ -269,7 +324,7 @@ func (env *environment) getRawChunk(w http.ResponseWriter, r *http.Request) {
 	_, err = uuid.Parse(chunkID)
 	if err != nil {
 		hub.CaptureException(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeInvalidID(w, "chunk_id")
 		return
 	}
 
@@ -287,21 +342,7 @@ func (env *environment) getRawChunk(w http.ResponseWriter, r *http.Request) {
 	)
 	s.Finish()
 	if err != nil {
-		if errors.Is(err, storageutil.ErrObjectNotFound) {
-			w.WriteHeader(http.StatusNotFound)
-			return
-		}
-		var e *googleapi.Error
-		if ok := errors.As(err, &e); ok {
-			hub.Scope().SetContext("Google Cloud Storage Error", map[string]interface{}{
-				"body":    e.Body,
-				"code":    e.Code,
-				"details": e.Details,
-				"message": e.Message,
-			})
-		}
-		hub.CaptureException(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeStorageError(w, hub, err, "chunk_id", "chunk not found")
 		return
 	}
 
@@ -309,8 +350,7 @@ func (env *environment) getRawChunk(w http.ResponseWriter, r *http.Request) {
 	defer s.Finish()
 	b, err := json.Marshal(c)
 	if err != nil {
-		hub.CaptureException(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeInternalError(w, hub, err)
 		return
 	}
 
@@ -19,6 +19,40 @@ type (
 
 		OccurrencesKafkaTopic string `env:"SENTRY_KAFKA_TOPIC_OCCURRENCES" env-default:"ingest-occurrences"`
 
+		ProfilesKafkaBrokers       []string `env:"SENTRY_KAFKA_BROKERS_PROFILES"        env-default:"localhost:9092"`
+		ProfilesKafkaTopic         string   `env:"SENTRY_KAFKA_TOPIC_PROFILES"          env-default:"processed-profiles"`
+		ProfilesKafkaConsumerGroup string   `env:"SENTRY_KAFKA_CONSUMER_GROUP_PROFILES" env-default:"vroom-consumer"`
+
 		BucketURL string `env:"SENTRY_BUCKET_PROFILES" env-default:"file://./test/gcs/sentry-profiles"`
+
+		// The cache of profiles and chunks read by workers is off unless
+		// SENTRY_PROFILES_CACHE_MAX_BYTES sizes its memory tier or
+		// SENTRY_PROFILES_CACHE_DIR sets the directory of its disk tier,
+		// sized by SENTRY_PROFILES_CACHE_DISK_MAX_BYTES. The memory tier
+		// keeps decoded profiles, chunks and their call trees, sized by an
+		// estimate of their memory use, while the disk tier keeps
+		// decompressed bytes. Cached objects are expected to never change, which
+		// doesn't hold when the raw ingest routes overwrite an object in a
+		// bucket other than GCS.
+		CacheMaxBytes     int64  `env:"SENTRY_PROFILES_CACHE_MAX_BYTES"      env-default:"0"`
+		CacheDir          string `env:"SENTRY_PROFILES_CACHE_DIR"`
+		CacheDiskMaxBytes int64  `env:"SENTRY_PROFILES_CACHE_DISK_MAX_BYTES" env-default:"4294967296"`
+
+		DetectionRulesPath string `env:"SENTRY_DETECTION_RULES_PATH"`
+
+		ProguardMappingsURL string `env:"SENTRY_PROGUARD_MAPPINGS_URL"`
+		ProguardMaxMappings int    `env:"SENTRY_PROGUARD_MAX_MAPPINGS" env-default:"16"`
+
+		SourceMapsEnabled bool `env:"SENTRY_SOURCEMAPS_ENABLED"`
+		SourceMapsMaxMaps int  `env:"SENTRY_SOURCEMAPS_MAX_MAPS" env-default:"64"`
+
+		FlamegraphMemoryBudget int64 `env:"SENTRY_FLAMEGRAPH_MEMORY_BUDGET_BYTES" env-default:"536870912"`
+
+		MaxBodyBytes int64 `env:"SENTRY_MAX_BODY_BYTES" env-default:"52428800"`
+
+		AuthConfigPath  string `env:"SENTRY_AUTH_CONFIG_PATH"`
+		TLSCertPath     string `env:"SENTRY_TLS_CERT_PATH"`
+		TLSKeyPath      string `env:"SENTRY_TLS_KEY_PATH"`
+		TLSClientCAPath string `env:"SENTRY_TLS_CLIENT_CA_PATH"`
 	}
 )
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/getsentry/vroom/internal/chunk"
+	"github.com/getsentry/vroom/internal/monitoring"
+	"github.com/getsentry/vroom/internal/occurrence"
+	"github.com/getsentry/vroom/internal/profile"
+)
+
+// consumedMessage is used to tell chunks apart from transaction profiles,
+// only chunks have a chunk ID.
+type consumedMessage struct {
+	ChunkID string `json:"chunk_id"`
+}
+
+func runConsumer(env *environment) {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: env.config.ProfilesKafkaBrokers,
+		GroupID: env.config.ProfilesKafkaConsumerGroup,
+		Topic:   env.config.ProfilesKafkaTopic,
+		Dialer:  createKafkaDialer(env.config),
+	})
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	// The consumer serves no API, only its metrics.
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", monitoring.Handler())
+	server := http.Server{
+		Addr:              fmt.Sprintf(":%d", env.config.Port),
+		ReadHeaderTimeout: time.Second,
+		Handler:           mux,
+	}
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			sentry.CaptureException(err)
+			slog.Error("metrics server failed", "err", err)
+		}
+	}()
+
+	slog.Info("vroom consumer started")
+
+	err := env.consume(ctx, reader)
+	if errors.Is(err, context.Canceled) {
+		err = nil
+	}
+	if err != nil {
+		sentry.CaptureException(err)
+		slog.Error("consumer failed", "err", err)
+	}
+
+	if err := server.Close(); err != nil {
+		sentry.CaptureException(err)
+	}
+	if err := reader.Close(); err != nil {
+		sentry.CaptureException(err)
+	}
+	env.shutdown()
+	slog.Info("vroom consumer graceful shutdown")
+
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// consume processes messages until the context is canceled or the reader is
+// closed. Offsets are committed once a message is stored so a message is
+// never lost if storage fails, in which case consume stops and returns the
+// error once retries are exhausted. A message delivered again after being
+// stored is processed as if it had just been stored. A message being processed when the
+// context is canceled is still stored and committed.
+func (env *environment) consume(ctx context.Context, reader KafkaReader) error {
+	for {
+		m, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		processCtx := context.WithoutCancel(ctx)
+		err = env.processMessage(processCtx, m)
+		if err != nil {
+			return err
+		}
+		err = reader.CommitMessages(processCtx, m)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// processMessage stores the profile or the chunk contained in the message.
+// Messages we can't decode or validate are reported and skipped, they will
+// never succeed. Only storage errors are returned.
+func (env *environment) processMessage(ctx context.Context, m kafka.Message) error {
+	hub := sentry.CurrentHub().Clone()
+	ctx = sentry.SetHubOnContext(ctx, hub)
+
+	var cm consumedMessage
+	err := json.Unmarshal(m.Value, &cm)
+	if err != nil {
+		hub.CaptureException(err)
+		return nil
+	}
+
+	if cm.ChunkID != "" {
+		return env.processChunk(ctx, hub, m.Value)
+	}
+	return env.processProfile(ctx, hub, m.Value)
+}
+
+func (env *environment) processProfile(ctx context.Context, hub *sentry.Hub, b []byte) error {
+	var p profile.Profile
+	s := sentry.StartSpan(ctx, "processing")
+	s.Description = "Decoding data"
+	start := time.Now()
+	err := json.Unmarshal(b, &p)
+	monitoring.ObserveStage(monitoring.StageDecode, "profile", start)
+	s.Finish()
+	if err != nil {
+		hub.CaptureException(err)
+		return nil
+	}
+
+	hub.Scope().SetTag("organization_id", strconv.FormatUint(p.OrganizationID(), 10))
+	hub.Scope().SetTag("project_id", strconv.FormatUint(p.ProjectID(), 10))
+	hub.Scope().SetTag("profile_id", p.ID())
+	hub.Scope().SetTag("platform", string(p.Platform()))
+
+	err = env.storeProfile(ctx, hub, &p)
+	// A redelivered message is already stored but its occurrences may not
+	// have been written yet.
+	if err != nil && !isAlreadyStored(err) {
+		return skipInvalid(hub, err)
+	}
+
+	s = sentry.StartSpan(ctx, "processing")
+	s.Description = "Generate call trees"
+	start = time.Now()
+	callTrees, err := p.CallTrees()
+	monitoring.ObserveStage(monitoring.StageCallTrees, "profile", start)
+	s.Finish()
+	if err != nil {
+		hub.CaptureException(err)
+		return nil
+	}
+
+	s = sentry.StartSpan(ctx, "processing")
+	s.Description = "Find occurrences"
+	occurrences := occurrence.Find(p, callTrees, env.detectionRules)
+	s.Finish()
+
+	env.writeOccurrences(ctx, hub, occurrences)
+	return nil
+}
+
+func (env *environment) processChunk(ctx context.Context, hub *sentry.Hub, b []byte) error {
+	var c chunk.Chunk
+	s := sentry.StartSpan(ctx, "processing")
+	s.Description = "Decoding data"
+	start := time.Now()
+	err := json.Unmarshal(b, &c)
+	monitoring.ObserveStage(monitoring.StageDecode, "chunk", start)
+	s.Finish()
+	if err != nil {
+		hub.CaptureException(err)
+		return nil
+	}
+
+	hub.Scope().SetTag("organization_id", strconv.FormatUint(c.GetOrganizationID(), 10))
+	hub.Scope().SetTag("project_id", strconv.FormatUint(c.GetProjectID(), 10))
+	hub.Scope().SetTag("profiler_id", c.GetProfilerID())
+	hub.Scope().SetTag("chunk_id", c.GetID())
+	hub.Scope().SetTag("platform", string(c.GetPlatform()))
+
+	err = env.storeChunk(ctx, hub, c)
+	// A redelivered message is already stored but its occurrences may not
+	// have been written yet.
+	if err != nil && !isAlreadyStored(err) {
+		return skipInvalid(hub, err)
+	}
+
+	s = sentry.StartSpan(ctx, "processing")
+	s.Description = "Generate call trees"
+	start = time.Now()
+	callTrees, err := c.CallTrees(nil)
+	monitoring.ObserveStage(monitoring.StageCallTrees, "chunk", start)
+	s.Finish()
+	if err != nil {
+		hub.CaptureException(err)
+		return nil
+	}
+
+	s = sentry.StartSpan(ctx, "processing")
+	s.Description = "Find occurrences"
+	occurrences, err := occurrence.FindInChunk(c, callTrees, env.detectionRules)
+	s.Finish()
+	if err != nil {
+		hub.CaptureException(err)
+		return nil
+	}
+
+	env.writeOccurrences(ctx, hub, occurrences)
+	return nil
+}
+
+// skipInvalid reports and skips an invalid profile or chunk, it will never be
+// stored. Other errors are returned.
+func skipInvalid(hub *sentry.Hub, err error) error {
+	var invalid *invalidError
+	if errors.As(err, &invalid) {
+		hub.CaptureException(invalid.err)
+		return nil
+	}
+	return err
+}
+
+// writeOccurrences sends occurrences to Kafka. Errors are only reported since
+// the profile is already stored.
+func (env *environment) writeOccurrences(
+	ctx context.Context,
+	hub *sentry.Hub,
+	occurrences []*occurrence.Occurrence,
+) {
+	err := env.sendOccurrences(ctx, occurrences)
+	if err != nil {
+		hub.CaptureException(err)
+	}
+}
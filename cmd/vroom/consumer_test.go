@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"gocloud.dev/blob"
+
+	"github.com/getsentry/vroom/internal/chunk"
+	"github.com/getsentry/vroom/internal/frame"
+	"github.com/getsentry/vroom/internal/platform"
+	"github.com/getsentry/vroom/internal/sample"
+	"github.com/getsentry/vroom/internal/storageutil"
+	"github.com/getsentry/vroom/internal/transaction"
+)
+
+type KafkaReaderMock struct {
+	messages  []kafka.Message
+	committed []kafka.Message
+}
+
+func (k *KafkaReaderMock) FetchMessage(_ context.Context) (kafka.Message, error) {
+	if len(k.messages) == 0 {
+		return kafka.Message{}, io.EOF
+	}
+	m := k.messages[0]
+	k.messages = k.messages[1:]
+	return m, nil
+}
+
+func (k *KafkaReaderMock) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	k.committed = append(k.committed, msgs...)
+	return nil
+}
+
+func (k *KafkaReaderMock) Close() error {
+	return nil
+}
+
+type KafkaWriterRecorder struct {
+	messages []kafka.Message
+}
+
+func (k *KafkaWriterRecorder) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	k.messages = append(k.messages, msgs...)
+	return nil
+}
+
+func (k *KafkaWriterRecorder) Close() error {
+	return nil
+}
+
+func TestConsume(t *testing.T) {
+	p := sample.Profile{
+		RawProfile: sample.RawProfile{
+			EventID:        "9d7fbc8e5b9a4c6f8e2d1a0b3c4d5e6f",
+			OrganizationID: 1,
+			ProjectID:      2,
+			Platform:       platform.Node,
+			Version:        "1",
+			Transaction: transaction.Transaction{
+				ActiveThreadID: 1,
+				Name:           "/api/index",
+			},
+			Trace: sample.Trace{
+				Frames: []frame.Frame{
+					{Function: "main", Module: "app"},
+					{Function: "readFileSync", Module: "node:fs"},
+				},
+				Samples: []sample.Sample{
+					{StackID: 0, ThreadID: 1},
+					{StackID: 0, ThreadID: 1, ElapsedSinceStartNS: 10_000_000},
+					{StackID: 0, ThreadID: 1, ElapsedSinceStartNS: 20_000_000},
+				},
+				Stacks: []sample.Stack{{1, 0}},
+			},
+		},
+	}
+	c := chunk.SampleChunk{
+		ID:             "0432a0a4c25f4697bf9f0a2fcbe6a814",
+		ProfilerID:     "71f3d1f3b2f44d0a9b4e2f5c6d7e8f90",
+		OrganizationID: 1,
+		ProjectID:      2,
+		Platform:       platform.Python,
+		Version:        "2",
+		Profile: chunk.SampleData{
+			Frames:  []frame.Frame{{Function: "main"}},
+			Samples: []chunk.Sample{{StackID: 0, ThreadID: "1", Timestamp: 1.0}},
+			Stacks:  [][]int{{0}},
+		},
+	}
+	invalidChunk := c
+	invalidChunk.ID = "7d1c4d0e1f2a4b3c8d9e0f1a2b3c4d5e"
+	invalidChunk.Profile.Stacks = nil
+
+	var messages []kafka.Message
+	for _, v := range []interface{}{p, c, invalidChunk} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("couldn't marshal the message: %v", err)
+		}
+		messages = append(messages, kafka.Message{Value: b})
+	}
+	messages = append(messages, kafka.Message{Value: []byte("not json")})
+
+	reader := &KafkaReaderMock{messages: messages}
+	writer := &KafkaWriterRecorder{}
+	env := environment{storage: fileBlobBucket, occurrencesWriter: writer}
+
+	err := env.consume(context.Background(), reader)
+	if err != nil {
+		t.Fatalf("consume failed: %v", err)
+	}
+
+	if len(reader.committed) != len(messages) {
+		t.Fatalf("expected %d committed messages, got %d", len(messages), len(reader.committed))
+	}
+	if len(writer.messages) != 1 {
+		t.Fatalf("expected 1 occurrence, got %d", len(writer.messages))
+	}
+
+	for _, path := range []string{p.StoragePath(), c.StoragePath()} {
+		exists, err := fileBlobBucket.Exists(context.Background(), path)
+		if err != nil || !exists {
+			t.Fatalf("expected %s to be stored: %v", path, err)
+		}
+	}
+	exists, err := fileBlobBucket.Exists(context.Background(), invalidChunk.StoragePath())
+	if err != nil || exists {
+		t.Fatalf("expected %s to not be stored: %v", invalidChunk.StoragePath(), err)
+	}
+}
+
+func TestConsumeStopsOnStorageError(t *testing.T) {
+	c := chunk.SampleChunk{
+		ID:             "5e8f0a1b2c3d4e5f6a7b8c9d0e1f2a3b",
+		ProfilerID:     "71f3d1f3b2f44d0a9b4e2f5c6d7e8f90",
+		OrganizationID: 1,
+		ProjectID:      2,
+		Platform:       platform.Python,
+		Version:        "2",
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("couldn't marshal the message: %v", err)
+	}
+
+	// Writing to a closed bucket fails and isn't retried.
+	bucket, err := blob.OpenBucket(context.Background(), "file://localhost/"+t.TempDir())
+	if err != nil {
+		t.Fatalf("couldn't open a local filesystem bucket: %v", err)
+	}
+	if err := bucket.Close(); err != nil {
+		t.Fatalf("couldn't close the bucket: %v", err)
+	}
+
+	reader := &KafkaReaderMock{messages: []kafka.Message{{Value: b}}}
+	env := environment{storage: bucket, occurrencesWriter: &KafkaWriterRecorder{}}
+	err = env.consume(context.Background(), reader)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(reader.committed) != 0 {
+		t.Fatalf("expected no committed message, got %d", len(reader.committed))
+	}
+
+	var stored chunk.Chunk
+	err = storageutil.UnmarshalCompressed(context.Background(), fileBlobBucket, c.StoragePath(), &stored)
+	if err == nil {
+		t.Fatal("expected the chunk to not be stored")
+	}
+}
+
+func TestConsumeFinishesMessageOnShutdown(t *testing.T) {
+	c := chunk.SampleChunk{
+		ID:             "2c9e1f0a3b4d4e5f8a7b6c5d4e3f2a1b",
+		ProfilerID:     "71f3d1f3b2f44d0a9b4e2f5c6d7e8f90",
+		OrganizationID: 1,
+		ProjectID:      2,
+		Platform:       platform.Python,
+		Version:        "2",
+		Profile: chunk.SampleData{
+			Frames:  []frame.Frame{{Function: "main"}},
+			Samples: []chunk.Sample{{StackID: 0, ThreadID: "1", Timestamp: 1.0}},
+			Stacks:  [][]int{{0}},
+		},
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("couldn't marshal the message: %v", err)
+	}
+
+	// The message was fetched before the shutdown canceled the context.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	reader := &KafkaReaderMock{messages: []kafka.Message{{Value: b}}}
+	env := environment{storage: fileBlobBucket, occurrencesWriter: &KafkaWriterRecorder{}}
+	err = env.consume(ctx, reader)
+	if err != nil {
+		t.Fatalf("consume failed: %v", err)
+	}
+	if len(reader.committed) != 1 {
+		t.Fatalf("expected 1 committed message, got %d", len(reader.committed))
+	}
+	exists, err := fileBlobBucket.Exists(context.Background(), c.StoragePath())
+	if err != nil || !exists {
+		t.Fatalf("expected %s to be stored: %v", c.StoragePath(), err)
+	}
+}
+
+func TestConsumeRedeliveredMessage(t *testing.T) {
+	p := sample.Profile{
+		RawProfile: sample.RawProfile{
+			EventID:        "3f6b8a2c1d4e4f5a9b0c7d8e1f2a3b4c",
+			OrganizationID: 1,
+			ProjectID:      2,
+			Platform:       platform.Node,
+			Version:        "1",
+			Transaction: transaction.Transaction{
+				ActiveThreadID: 1,
+				Name:           "/api/index",
+			},
+			Trace: sample.Trace{
+				Frames: []frame.Frame{
+					{Function: "main", Module: "app"},
+					{Function: "readFileSync", Module: "node:fs"},
+				},
+				Samples: []sample.Sample{
+					{StackID: 0, ThreadID: 1},
+					{StackID: 0, ThreadID: 1, ElapsedSinceStartNS: 10_000_000},
+					{StackID: 0, ThreadID: 1, ElapsedSinceStartNS: 20_000_000},
+				},
+				Stacks: []sample.Stack{{1, 0}},
+			},
+		},
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("couldn't marshal the message: %v", err)
+	}
+
+	// Kafka delivers the message again, as after a crash before the commit.
+	reader := &KafkaReaderMock{messages: []kafka.Message{{Value: b}, {Value: b}}}
+	writer := &KafkaWriterRecorder{}
+	bucket := newPreconditionBucket()
+	env := environment{storage: bucket, occurrencesWriter: writer}
+
+	err = env.consume(context.Background(), reader)
+	if err != nil {
+		t.Fatalf("consume failed: %v", err)
+	}
+	if len(reader.committed) != 2 {
+		t.Fatalf("expected 2 committed messages, got %d", len(reader.committed))
+	}
+	if len(writer.messages) != 2 {
+		t.Fatalf("expected the occurrence to be written for each delivery, got %d", len(writer.messages))
+	}
+	exists, err := bucket.Exists(context.Background(), p.StoragePath())
+	if err != nil || !exists {
+		t.Fatalf("expected %s to be stored: %v", p.StoragePath(), err)
+	}
+}
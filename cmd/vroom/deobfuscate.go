@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/getsentry/sentry-go"
+
+	"github.com/getsentry/vroom/internal/proguard"
+)
+
+// deobfuscatable is an Android profile or chunk whose methods can be
+// deobfuscated with a ProGuard mapping.
+type deobfuscatable interface {
+	MappingID() string
+	Deobfuscate(m *proguard.Mapping)
+}
+
+// deobfuscate rewrites the methods of an Android profile or chunk when
+// mappings are configured and its mapping is found. Profiles and chunks are
+// still stored as they are otherwise.
+func (env *environment) deobfuscate(ctx context.Context, hub *sentry.Hub, d deobfuscatable) {
+	if env.mappings == nil {
+		return
+	}
+	id := d.MappingID()
+	if id == "" {
+		return
+	}
+
+	s := sentry.StartSpan(ctx, "processing")
+	s.Description = "Deobfuscate methods"
+	defer s.Finish()
+
+	m, err := env.mappings.Load(ctx, id)
+	if err != nil {
+		if !errors.Is(err, proguard.ErrMappingNotFound) && hub != nil {
+			hub.CaptureException(err)
+		}
+		return
+	}
+	d.Deobfuscate(m)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/getsentry/sentry-go"
+	"gocloud.dev/gcerrors"
+	"google.golang.org/api/googleapi"
+
+	"github.com/getsentry/vroom/internal/httputil"
+	"github.com/getsentry/vroom/internal/storageutil"
+)
+
+// writeInvalidID reports an ID in the path, the query or the body that can't
+// be parsed.
+func writeInvalidID(w http.ResponseWriter, parameter string) {
+	httputil.WriteError(w, http.StatusBadRequest, httputil.Error{
+		Code:      httputil.ErrorCodeInvalidID,
+		Message:   fmt.Sprintf("invalid %s", parameter),
+		Parameter: parameter,
+	})
+}
+
+// writeInvalidBody reports a body that can't be decoded or fails validation.
+// A body over the size limit is reported as too large.
+func writeInvalidBody(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		httputil.WriteError(w, http.StatusRequestEntityTooLarge, httputil.Error{
+			Code:    httputil.ErrorCodeInvalidBody,
+			Message: fmt.Sprintf("body is larger than %d bytes", maxBytesErr.Limit),
+		})
+		return
+	}
+	httputil.WriteError(w, http.StatusBadRequest, httputil.Error{
+		Code:    httputil.ErrorCodeInvalidBody,
+		Message: err.Error(),
+	})
+}
+
+// writeInvalidParameter reports a query parameter with an unexpected value.
+func writeInvalidParameter(w http.ResponseWriter, parameter string, err error) {
+	httputil.WriteError(w, http.StatusBadRequest, httputil.Error{
+		Code:      httputil.ErrorCodeInvalidParameter,
+		Message:   err.Error(),
+		Parameter: parameter,
+	})
+}
+
+// writeStorageError reports an error reading an object from the bucket. A
+// missing object is reported as not found with a message naming it, parameter
+// being what identifies it in the request.
+func writeStorageError(w http.ResponseWriter, hub *sentry.Hub, err error, parameter, notFound string) {
+	status, e := storageError(hub, err, parameter, notFound)
+	httputil.WriteError(w, status, e)
+}
+
+// storageError returns the status and the error reported for an error
+// reading an object from the bucket, capturing unexpected ones. A read
+// canceled because the client went away isn't captured.
+func storageError(hub *sentry.Hub, err error, parameter, notFound string) (int, httputil.Error) {
+	if errors.Is(err, storageutil.ErrObjectNotFound) {
+		return http.StatusNotFound, httputil.Error{
+			Code:      httputil.ErrorCodeNotFound,
+			Message:   notFound,
+			Parameter: parameter,
+		}
+	}
+	if isTimeout(err) {
+		return http.StatusGatewayTimeout, timeoutError
+	}
+	var e *googleapi.Error
+	if ok := errors.As(err, &e); ok && hub != nil {
+		hub.Scope().SetContext("Google Cloud Storage Error", map[string]interface{}{
+			"body":    e.Body,
+			"code":    e.Code,
+			"details": e.Details,
+			"message": e.Message,
+		})
+	}
+	if hub != nil && !errors.Is(err, context.Canceled) {
+		hub.CaptureException(err)
+	}
+	return http.StatusInternalServerError, httputil.Error{
+		Code:    httputil.ErrorCodeStorageError,
+		Message: "couldn't read from storage",
+	}
+}
+
+// writeInternalError reports an unexpected error. Profiles are read under a
+// deadline so running out of time is reported as a storage timeout.
+func writeInternalError(w http.ResponseWriter, hub *sentry.Hub, err error) {
+	if isTimeout(err) {
+		writeTimeout(w)
+		return
+	}
+	if hub != nil {
+		hub.CaptureException(err)
+	}
+	httputil.WriteError(w, http.StatusInternalServerError, httputil.Error{
+		Code:    httputil.ErrorCodeInternalError,
+		Message: "internal error",
+	})
+}
+
+var timeoutError = httputil.Error{
+	Code:    httputil.ErrorCodeStorageTimeout,
+	Message: "timed out reading from storage",
+}
+
+func writeTimeout(w http.ResponseWriter) {
+	httputil.WriteError(w, http.StatusGatewayTimeout, timeoutError)
+}
+
+func isTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || gcerrors.Code(err) == gcerrors.DeadlineExceeded
+}
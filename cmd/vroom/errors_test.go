@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+
+	"github.com/getsentry/vroom/internal/httputil"
+	"github.com/getsentry/vroom/internal/importer"
+	"github.com/getsentry/vroom/internal/storageutil"
+	"github.com/getsentry/vroom/internal/testutil"
+)
+
+func TestErrorResponses(t *testing.T) {
+	readJobs = make(chan storageutil.ReadJob)
+	go storageutil.ReadWorker(readJobs, nil)
+	defer func() {
+		close(readJobs)
+		readJobs = nil
+	}()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       interface{}
+		wantStatus int
+		want       httputil.Error
+	}{
+		{
+			name:       "organization id not numeric",
+			method:     http.MethodGet,
+			path:       "/organizations/sentry/projects/1/profiles/c1bd7f5cbb0d4e1fa4ad19a8b0e2f9d4",
+			wantStatus: http.StatusBadRequest,
+			want: httputil.Error{
+				Code:      httputil.ErrorCodeInvalidID,
+				Message:   "invalid organization_id",
+				Parameter: "organization_id",
+			},
+		},
+		{
+			name:       "profile missing",
+			method:     http.MethodGet,
+			path:       "/organizations/1/projects/1/profiles/c1bd7f5cbb0d4e1fa4ad19a8b0e2f9d4",
+			wantStatus: http.StatusNotFound,
+			want: httputil.Error{
+				Code:      httputil.ErrorCodeNotFound,
+				Message:   "profile not found",
+				Parameter: "profile_id",
+			},
+		},
+		{
+			name:   "chunk missing",
+			method: http.MethodPost,
+			path:   "/organizations/1/projects/1/chunks",
+			body: postProfileFromChunkIDsRequest{
+				ProfilerID: "8a6f8c4b2f3a4d0e9b1c7d6e5f4a3b2c",
+				ChunkIDs:   []string{"c1bd7f5cbb0d4e1fa4ad19a8b0e2f9d4"},
+			},
+			wantStatus: http.StatusNotFound,
+			want: httputil.Error{
+				Code:      httputil.ErrorCodeNotFound,
+				Message:   "chunk c1bd7f5cbb0d4e1fa4ad19a8b0e2f9d4 not found",
+				Parameter: "chunk_ids",
+			},
+		},
+		{
+			name:   "no chunks",
+			method: http.MethodPost,
+			path:   "/organizations/1/projects/1/chunks",
+			body: postProfileFromChunkIDsRequest{
+				ProfilerID: "8a6f8c4b2f3a4d0e9b1c7d6e5f4a3b2c",
+			},
+			wantStatus: http.StatusBadRequest,
+			want: httputil.Error{
+				Code:      httputil.ErrorCodeNoChunks,
+				Message:   "no chunks found to merge",
+				Parameter: "chunk_ids",
+			},
+		},
+		{
+			name:       "invalid import format",
+			method:     http.MethodPost,
+			path:       "/organizations/1/projects/1/raw_chunks/import?format=json",
+			body:       map[string]interface{}{},
+			wantStatus: http.StatusBadRequest,
+			want: httputil.Error{
+				Code:      httputil.ErrorCodeInvalidParameter,
+				Message:   importer.ErrInvalidFormat.Error(),
+				Parameter: "format",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var rec *httptest.ResponseRecorder
+			if test.method == http.MethodPost {
+				rec = postJSON(t, test.path, test.body)
+			} else {
+				rec = get(t, test.path)
+			}
+			if rec.Code != test.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", test.wantStatus, rec.Code, rec.Body.String())
+			}
+			var got httputil.ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("couldn't decode the error: %v: %s", err, rec.Body.String())
+			}
+			if diff := testutil.Diff(got.Error, test.want); diff != "" {
+				t.Fatalf("Result mismatch: got - want +\n%s", diff)
+			}
+		})
+	}
+}
+
+func get(t *testing.T, path string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	env := environment{storage: fileBlobBucket}
+	router, err := env.newRouter()
+	if err != nil {
+		t.Fatalf("couldn't create the router: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req = req.WithContext(sentry.SetHubOnContext(req.Context(), sentry.CurrentHub().Clone()))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestStorageErrorCapture(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		captured bool
+	}{
+		{
+			name:     "unexpected error",
+			err:      errors.New("unexpected"),
+			captured: true,
+		},
+		{
+			name:     "read canceled",
+			err:      fmt.Errorf("reading object: %w", context.Canceled),
+			captured: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var captured bool
+			client, err := sentry.NewClient(sentry.ClientOptions{
+				BeforeSend: func(event *sentry.Event, _ *sentry.EventHint) *sentry.Event {
+					captured = true
+					return nil
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			hub := sentry.NewHub(client, sentry.NewScope())
+			status, _ := storageError(hub, test.err, "profile_ids", "profile not found")
+			if status != http.StatusInternalServerError {
+				t.Fatalf("expected status %d, got %d", http.StatusInternalServerError, status)
+			}
+			if captured != test.captured {
+				t.Fatalf("expected captured to be %v, got %v", test.captured, captured)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/google/pprof/profile"
+
+	"github.com/getsentry/vroom/internal/chrometrace"
+	"github.com/getsentry/vroom/internal/firefox"
+	"github.com/getsentry/vroom/internal/folded"
+	"github.com/getsentry/vroom/internal/pprof"
+	"github.com/getsentry/vroom/internal/speedscope"
+)
+
+const (
+	traceFormatChrome  = "chrome"
+	traceFormatFirefox = "firefox"
+)
+
+// wantsPprof returns true when the request asks for a pprof profile, either
+// with a format=pprof query parameter or with the Accept header.
+func wantsPprof(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "pprof" {
+		return true
+	}
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+			if err == nil && mediaType == pprof.ContentType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// varyOnAccept tells caches the response depends on the Accept header, read by
+// wantsPprof, so a cached pprof profile isn't served to a JSON client.
+func varyOnAccept(w http.ResponseWriter) {
+	w.Header().Add("Vary", "Accept")
+}
+
+// writePprof writes a gzipped profile.proto in the response.
+func writePprof(ctx context.Context, w http.ResponseWriter, hub *sentry.Hub, p *profile.Profile) {
+	s := sentry.StartSpan(ctx, "pprof.marshal")
+	defer s.Finish()
+
+	var b bytes.Buffer
+	err := p.Write(&b)
+	if err != nil {
+		writeInternalError(w, hub, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", pprof.ContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="profile.pb.gz"`)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b.Bytes())
+}
+
+// wantsFolded returns true when the request asks for collapsed stacks with a
+// format=folded query parameter.
+func wantsFolded(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "folded"
+}
+
+// foldedWeight returns the weight requested with the weight query parameter,
+// sample count by default.
+func foldedWeight(r *http.Request) folded.Weight {
+	if r.URL.Query().Get("weight") == "duration" {
+		return folded.WeightDuration
+	}
+	return folded.WeightSampleCount
+}
+
+// writeFolded writes collapsed stacks in the response, produced by write.
+func writeFolded(ctx context.Context, w http.ResponseWriter, hub *sentry.Hub, write func(io.Writer) error) {
+	s := sentry.StartSpan(ctx, "folded.marshal")
+	defer s.Finish()
+
+	var b bytes.Buffer
+	err := write(&b)
+	if err != nil {
+		writeInternalError(w, hub, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", folded.ContentType)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b.Bytes())
+}
+
+// traceFormat returns the timeline format requested with the format query
+// parameter, chrome or firefox, or an empty string.
+func traceFormat(r *http.Request) string {
+	switch format := r.URL.Query().Get("format"); format {
+	case traceFormatChrome, traceFormatFirefox:
+		return format
+	}
+	return ""
+}
+
+// writeTrace writes a profile in the response as a Chrome trace or a Firefox
+// Profiler profile, keeping a track for each thread.
+func writeTrace(ctx context.Context, w http.ResponseWriter, hub *sentry.Hub, format string, o speedscope.Output) {
+	s := sentry.StartSpan(ctx, "json.marshal")
+	s.Description = format
+	defer s.Finish()
+
+	var i interface{}
+	var contentType string
+	switch format {
+	case traceFormatChrome:
+		i, contentType = chrometrace.FromSpeedscope(o), chrometrace.ContentType
+	default:
+		i, contentType = firefox.FromSpeedscope(o), firefox.ContentType
+	}
+	b, err := json.Marshal(i)
+	if err != nil {
+		writeInternalError(w, hub, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
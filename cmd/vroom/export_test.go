@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+
+	"github.com/getsentry/vroom/internal/frame"
+	"github.com/getsentry/vroom/internal/platform"
+	"github.com/getsentry/vroom/internal/pprof"
+	"github.com/getsentry/vroom/internal/sample"
+)
+
+func TestGetProfileVariesOnAccept(t *testing.T) {
+	p := sample.Profile{
+		RawProfile: sample.RawProfile{
+			EventID:        "5b2e0b9e6c8a4a0f9d3c2b1a0f9e8d7c",
+			OrganizationID: 1,
+			ProjectID:      2,
+			Platform:       platform.Python,
+			Version:        "1",
+			Trace: sample.Trace{
+				Frames: []frame.Frame{
+					{Function: "main", Path: "/app/main.py"},
+				},
+				Samples: []sample.Sample{
+					{StackID: 0, ThreadID: 1},
+					{StackID: 0, ThreadID: 1, ElapsedSinceStartNS: 10},
+				},
+				Stacks: []sample.Stack{{0}},
+			},
+		},
+	}
+	rec := postJSON(t, "/organizations/1/projects/2/raw_profiles", p)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+
+	env := environment{storage: fileBlobBucket}
+	router, err := env.newRouter()
+	if err != nil {
+		t.Fatalf("couldn't create the router: %v", err)
+	}
+	for _, test := range []struct {
+		accept      string
+		contentType string
+	}{
+		{accept: "application/json", contentType: "application/json"},
+		{accept: pprof.ContentType, contentType: pprof.ContentType},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/organizations/1/projects/2/profiles/"+p.EventID, nil)
+		req.Header.Set("Accept", test.accept)
+		req = req.WithContext(sentry.SetHubOnContext(req.Context(), sentry.CurrentHub().Clone()))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d: %s", test.accept, http.StatusOK, rec.Code, rec.Body.String())
+		}
+		if contentType := rec.Header().Get("Content-Type"); contentType != test.contentType {
+			t.Fatalf("%s: expected %s, got %s", test.accept, test.contentType, contentType)
+		}
+		if !slices.Contains(rec.Header().Values("Vary"), "Accept") {
+			t.Fatalf("%s: expected the response to vary on Accept, got %v", test.accept, rec.Header().Values("Vary"))
+		}
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"time"
@@ -12,18 +14,41 @@ import (
 
 	"github.com/getsentry/vroom/internal/examples"
 	"github.com/getsentry/vroom/internal/flamegraph"
+	"github.com/getsentry/vroom/internal/folded"
 	"github.com/getsentry/vroom/internal/metrics"
+	"github.com/getsentry/vroom/internal/pprof"
 )
 
+// partialResultHeader is set on formats without a field to report that the
+// flamegraph or the function metrics don't include all the candidates.
+const partialResultHeader = "X-Vroom-Partial-Result"
+
 type (
 	postFlamegraphBody struct {
 		Transaction     []examples.TransactionProfileCandidate `json:"transaction"`
 		Continuous      []examples.ContinuousProfileCandidate  `json:"continuous"`
 		GenerateMetrics bool                                   `json:"generate_metrics"`
+
+		flamegraph.Options
+	}
+
+	postDifferentialFlamegraphBody struct {
+		Baseline flamegraph.Candidates `json:"baseline"`
+		Target   flamegraph.Candidates `json:"target"`
+
+		flamegraph.Options
+	}
+
+	postFlamegraphTimelineBody struct {
+		Continuous []examples.ContinuousProfileCandidate `json:"continuous"`
+
+		flamegraph.TimelineOptions
+		flamegraph.Options
 	}
 )
 
 func (env *environment) postFlamegraph(w http.ResponseWriter, r *http.Request) {
+	varyOnAccept(w)
 	ctx := r.Context()
 	downloadContext, cancel := context.WithTimeout(ctx, time.Second*10)
 	defer cancel()
@@ -35,7 +60,7 @@ func (env *environment) postFlamegraph(w http.ResponseWriter, r *http.Request) {
 		if hub != nil {
 			hub.CaptureException(err)
 		}
-		w.WriteHeader(http.StatusBadRequest)
+		writeInvalidID(w, "organization_id")
 		return
 	}
 
@@ -50,7 +75,47 @@ func (env *environment) postFlamegraph(w http.ResponseWriter, r *http.Request) {
 		if hub != nil {
 			hub.CaptureException(err)
 		}
-		w.WriteHeader(http.StatusBadRequest)
+		writeInvalidBody(w, err)
+		return
+	}
+
+	err = body.Options.Validate()
+	if err != nil {
+		writeInvalidBody(w, err)
+		return
+	}
+	body.Options.MemoryBudget = env.config.FlamegraphMemoryBudget
+
+	if asPprof, asFolded := wantsPprof(r), wantsFolded(r); asPprof || asFolded {
+		s = sentry.StartSpan(ctx, "processing")
+		flamegraphTree, partial, err := flamegraph.GetFlamegraphTreeFromCandidates(
+			downloadContext,
+			env.storage,
+			organizationID,
+			body.Transaction,
+			body.Continuous,
+			readJobs,
+			body.Options,
+			s,
+		)
+		s.Finish()
+		if err != nil {
+			writeInternalError(w, hub, err)
+			return
+		}
+		if partial != nil {
+			w.Header().Set(
+				partialResultHeader,
+				fmt.Sprintf("%d/%d", partial.CandidatesProcessed, partial.CandidatesTotal),
+			)
+		}
+		if asFolded {
+			writeFolded(ctx, w, hub, func(out io.Writer) error {
+				return folded.WriteFlamegraph(out, flamegraphTree, foldedWeight(r))
+			})
+			return
+		}
+		writePprof(ctx, w, hub, pprof.FromFlamegraph(flamegraphTree))
 		return
 	}
 
@@ -68,25 +133,161 @@ func (env *environment) postFlamegraph(w http.ResponseWriter, r *http.Request) {
 		body.Continuous,
 		readJobs,
 		ma,
+		body.Options,
 		s,
 	)
 	s.Finish()
+	if err != nil {
+		writeInternalError(w, hub, err)
+		return
+	}
+
+	s = sentry.StartSpan(ctx, "json.marshal")
+	defer s.Finish()
+	b, err := json.Marshal(speedscope)
+	if err != nil {
+		writeInternalError(w, hub, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
+
+func (env *environment) postDifferentialFlamegraph(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	downloadContext, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	hub := sentry.GetHubFromContext(ctx)
+	ps := httprouter.ParamsFromContext(ctx)
+	rawOrganizationID := ps.ByName("organization_id")
+	organizationID, err := strconv.ParseUint(rawOrganizationID, 10, 64)
 	if err != nil {
 		if hub != nil {
 			hub.CaptureException(err)
 		}
-		w.WriteHeader(http.StatusInternalServerError)
+		writeInvalidID(w, "organization_id")
+		return
+	}
+
+	hub.Scope().SetTag("organization_id", rawOrganizationID)
+
+	var body postDifferentialFlamegraphBody
+	s := sentry.StartSpan(ctx, "processing")
+	s.Description = "Decoding data"
+	err = json.NewDecoder(r.Body).Decode(&body)
+	s.Finish()
+	if err != nil {
+		if hub != nil {
+			hub.CaptureException(err)
+		}
+		writeInvalidBody(w, err)
+		return
+	}
+
+	err = body.Options.Validate()
+	if err != nil {
+		writeInvalidBody(w, err)
+		return
+	}
+	body.Options.MemoryBudget = env.config.FlamegraphMemoryBudget
+
+	s = sentry.StartSpan(ctx, "processing")
+	speedscope, err := flamegraph.GetDifferentialFlamegraphFromCandidates(
+		downloadContext,
+		env.storage,
+		organizationID,
+		body.Baseline,
+		body.Target,
+		readJobs,
+		body.Options,
+		s,
+	)
+	s.Finish()
+	if err != nil {
+		writeInternalError(w, hub, err)
 		return
 	}
 
 	s = sentry.StartSpan(ctx, "json.marshal")
 	defer s.Finish()
 	b, err := json.Marshal(speedscope)
+	if err != nil {
+		writeInternalError(w, hub, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
+
+func (env *environment) postFlamegraphTimeline(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	downloadContext, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	hub := sentry.GetHubFromContext(ctx)
+	ps := httprouter.ParamsFromContext(ctx)
+	rawOrganizationID := ps.ByName("organization_id")
+	organizationID, err := strconv.ParseUint(rawOrganizationID, 10, 64)
+	if err != nil {
+		if hub != nil {
+			hub.CaptureException(err)
+		}
+		writeInvalidID(w, "organization_id")
+		return
+	}
+
+	hub.Scope().SetTag("organization_id", rawOrganizationID)
+
+	var body postFlamegraphTimelineBody
+	s := sentry.StartSpan(ctx, "processing")
+	s.Description = "Decoding data"
+	err = json.NewDecoder(r.Body).Decode(&body)
+	s.Finish()
 	if err != nil {
 		if hub != nil {
 			hub.CaptureException(err)
 		}
-		w.WriteHeader(http.StatusInternalServerError)
+		writeInvalidBody(w, err)
+		return
+	}
+
+	err = body.TimelineOptions.Validate()
+	if err != nil {
+		writeInvalidBody(w, err)
+		return
+	}
+	err = body.Options.Validate()
+	if err != nil {
+		writeInvalidBody(w, err)
+		return
+	}
+	body.Options.MemoryBudget = env.config.FlamegraphMemoryBudget
+
+	s = sentry.StartSpan(ctx, "processing")
+	timeline, err := flamegraph.GetTimelineFromCandidates(
+		downloadContext,
+		env.storage,
+		organizationID,
+		body.Continuous,
+		readJobs,
+		body.TimelineOptions,
+		body.Options,
+		s,
+	)
+	s.Finish()
+	if err != nil {
+		writeInternalError(w, hub, err)
+		return
+	}
+
+	s = sentry.StartSpan(ctx, "json.marshal")
+	defer s.Finish()
+	b, err := json.Marshal(timeline)
+	if err != nil {
+		writeInternalError(w, hub, err)
 		return
 	}
 
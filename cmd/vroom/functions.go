@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/getsentry/vroom/internal/examples"
+	"github.com/getsentry/vroom/internal/flamegraph"
+	"github.com/getsentry/vroom/internal/metrics"
+)
+
+const (
+	defaultExamplesPerFunction = 5
+	maxExamplesPerFunction     = 100
+)
+
+var errInvalidExamples = errors.New("examples has to be between 0 and 100")
+
+type postFunctionMetricsBody struct {
+	Transaction []examples.TransactionProfileCandidate `json:"transaction"`
+	Continuous  []examples.ContinuousProfileCandidate  `json:"continuous"`
+	// AggregationKey groups functions by fingerprint, package or package
+	// and thread.
+	AggregationKey metrics.AggregationKey `json:"aggregation_key"`
+	// Sort orders the metrics by self time, total time, count or p95.
+	Sort metrics.SortBy `json:"sort"`
+	// Examples is the number of examples kept for each function.
+	Examples uint `json:"examples"`
+}
+
+func (b postFunctionMetricsBody) validate() error {
+	if err := b.AggregationKey.Validate(); err != nil {
+		return err
+	}
+	if err := b.Sort.Validate(); err != nil {
+		return err
+	}
+	if b.Examples > maxExamplesPerFunction {
+		return errInvalidExamples
+	}
+	return nil
+}
+
+func (env *environment) postFunctionMetrics(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	downloadContext, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	hub := sentry.GetHubFromContext(ctx)
+	ps := httprouter.ParamsFromContext(ctx)
+	rawOrganizationID := ps.ByName("organization_id")
+	organizationID, err := strconv.ParseUint(rawOrganizationID, 10, 64)
+	if err != nil {
+		if hub != nil {
+			hub.CaptureException(err)
+		}
+		writeInvalidID(w, "organization_id")
+		return
+	}
+
+	hub.Scope().SetTag("organization_id", rawOrganizationID)
+
+	var body postFunctionMetricsBody
+	s := sentry.StartSpan(ctx, "processing")
+	s.Description = "Decoding data"
+	err = json.NewDecoder(r.Body).Decode(&body)
+	s.Finish()
+	if err != nil {
+		if hub != nil {
+			hub.CaptureException(err)
+		}
+		writeInvalidBody(w, err)
+		return
+	}
+
+	err = body.validate()
+	if err != nil {
+		writeInvalidBody(w, err)
+		return
+	}
+
+	numExamples := body.Examples
+	if numExamples == 0 {
+		numExamples = defaultExamplesPerFunction
+	}
+	ma := metrics.NewAggregator(maxUniqueFunctionsPerProfile, numExamples, minDepth)
+	ma.Key = body.AggregationKey
+	ma.SortBy = body.Sort
+
+	s = sentry.StartSpan(ctx, "processing")
+	functionMetrics, partial, err := flamegraph.GetFunctionMetricsFromCandidates(
+		downloadContext,
+		env.storage,
+		organizationID,
+		body.Transaction,
+		body.Continuous,
+		readJobs,
+		&ma,
+		env.config.FlamegraphMemoryBudget,
+		s,
+	)
+	s.Finish()
+	if err != nil {
+		writeInternalError(w, hub, err)
+		return
+	}
+	if partial != nil {
+		w.Header().Set(
+			partialResultHeader,
+			fmt.Sprintf("%d/%d", partial.CandidatesProcessed, partial.CandidatesTotal),
+		)
+	}
+
+	s = sentry.StartSpan(ctx, "json.marshal")
+	defer s.Finish()
+	b, err := json.Marshal(functionMetrics)
+	if err != nil {
+		writeInternalError(w, hub, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
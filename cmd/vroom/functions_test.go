@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPostFunctionMetrics(t *testing.T) {
+	tests := []struct {
+		name string
+		body map[string]interface{}
+		code int
+		want string
+	}{
+		{
+			name: "invalid aggregation key",
+			body: map[string]interface{}{"aggregation_key": "function"},
+			code: http.StatusBadRequest,
+			want: `{"error":{"code":"invalid_body","message":"aggregation key`,
+		},
+		{
+			name: "too many examples",
+			body: map[string]interface{}{"examples": 1000},
+			code: http.StatusBadRequest,
+			want: `{"error":{"code":"invalid_body","message":"examples`,
+		},
+		{
+			name: "no candidates",
+			body: map[string]interface{}{"aggregation_key": "package", "sort": "p95"},
+			code: http.StatusOK,
+			want: "[]",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := postJSON(t, "/organizations/1/functions/metrics", test.body)
+			if rec.Code != test.code {
+				t.Fatalf("expected status %d, got %d: %s", test.code, rec.Code, rec.Body.String())
+			}
+			if !strings.HasPrefix(rec.Body.String(), test.want) {
+				t.Fatalf("expected body starting with %q, got %q", test.want, rec.Body.String())
+			}
+		})
+	}
+}
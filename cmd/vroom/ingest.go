@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/getsentry/vroom/internal/chunk"
+	"github.com/getsentry/vroom/internal/httputil"
+	"github.com/getsentry/vroom/internal/importer"
+	"github.com/getsentry/vroom/internal/platform"
+	"github.com/getsentry/vroom/internal/profile"
+)
+
+// postRawProfile stores a transaction profile in the bucket. It's meant to
+// seed environments without Relay, which usually writes profiles.
+func (env *environment) postRawProfile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	hub := sentry.GetHubFromContext(ctx)
+	ps := httprouter.ParamsFromContext(ctx)
+	rawOrganizationID := ps.ByName("organization_id")
+	organizationID, err := strconv.ParseUint(rawOrganizationID, 10, 64)
+	if err != nil {
+		if hub != nil {
+			hub.CaptureException(err)
+		}
+		writeInvalidID(w, "organization_id")
+		return
+	}
+
+	hub.Scope().SetTag("organization_id", rawOrganizationID)
+
+	rawProjectID := ps.ByName("project_id")
+	projectID, err := strconv.ParseUint(rawProjectID, 10, 64)
+	if err != nil {
+		if hub != nil {
+			hub.CaptureException(err)
+		}
+		writeInvalidID(w, "project_id")
+		return
+	}
+
+	hub.Scope().SetTag("project_id", rawProjectID)
+
+	var p profile.Profile
+	s := sentry.StartSpan(ctx, "processing")
+	s.Description = "Decoding data"
+	err = json.NewDecoder(env.limitBody(w, r)).Decode(&p)
+	s.Finish()
+	if err != nil {
+		if hub != nil {
+			hub.CaptureException(err)
+		}
+		writeInvalidBody(w, err)
+		return
+	}
+
+	if p.OrganizationID() != organizationID || p.ProjectID() != projectID {
+		httputil.WriteError(w, http.StatusBadRequest, httputil.Error{
+			Code:    httputil.ErrorCodeIDMismatch,
+			Message: "organization or project doesn't match the profile",
+		})
+		return
+	}
+
+	_, err = uuid.Parse(p.ID())
+	if err != nil {
+		writeInvalidID(w, "profile_id")
+		return
+	}
+
+	hub.Scope().SetTag("profile_id", p.ID())
+	hub.Scope().SetTag("platform", string(p.Platform()))
+
+	err = env.storeProfile(ctx, hub, &p)
+	if err != nil {
+		writeStoreError(w, hub, err, "profile")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// postRawChunk stores a continuous profile chunk in the bucket. It's meant to
+// seed environments without Relay, which usually writes chunks.
+func (env *environment) postRawChunk(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	hub := sentry.GetHubFromContext(ctx)
+	ps := httprouter.ParamsFromContext(ctx)
+	rawOrganizationID := ps.ByName("organization_id")
+	organizationID, err := strconv.ParseUint(rawOrganizationID, 10, 64)
+	if err != nil {
+		if hub != nil {
+			hub.CaptureException(err)
+		}
+		writeInvalidID(w, "organization_id")
+		return
+	}
+
+	hub.Scope().SetTag("organization_id", rawOrganizationID)
+
+	rawProjectID := ps.ByName("project_id")
+	projectID, err := strconv.ParseUint(rawProjectID, 10, 64)
+	if err != nil {
+		if hub != nil {
+			hub.CaptureException(err)
+		}
+		writeInvalidID(w, "project_id")
+		return
+	}
+
+	hub.Scope().SetTag("project_id", rawProjectID)
+
+	var c chunk.Chunk
+	s := sentry.StartSpan(ctx, "processing")
+	s.Description = "Decoding data"
+	err = json.NewDecoder(env.limitBody(w, r)).Decode(&c)
+	s.Finish()
+	if err != nil {
+		if hub != nil {
+			hub.CaptureException(err)
+		}
+		writeInvalidBody(w, err)
+		return
+	}
+
+	if c.GetOrganizationID() != organizationID || c.GetProjectID() != projectID {
+		httputil.WriteError(w, http.StatusBadRequest, httputil.Error{
+			Code:    httputil.ErrorCodeIDMismatch,
+			Message: "organization or project doesn't match the chunk",
+		})
+		return
+	}
+
+	for _, id := range []struct{ parameter, value string }{
+		{"profiler_id", c.GetProfilerID()},
+		{"chunk_id", c.GetID()},
+	} {
+		_, err = uuid.Parse(id.value)
+		if err != nil {
+			writeInvalidID(w, id.parameter)
+			return
+		}
+	}
+
+	hub.Scope().SetTag("profiler_id", c.GetProfilerID())
+	hub.Scope().SetTag("chunk_id", c.GetID())
+	hub.Scope().SetTag("platform", string(c.GetPlatform()))
+
+	err = env.storeChunk(ctx, hub, c)
+	if err != nil {
+		writeStoreError(w, hub, err, "chunk")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+type postImportedChunkResponse struct {
+	ProfilerID string `json:"profiler_id"`
+	ChunkID    string `json:"chunk_id"`
+}
+
+// postImportedChunk converts a profile recorded without a Sentry SDK, like a
+// pprof profile or perf script output, to a chunk and stores it in the
+// bucket. The format query parameter tells the format of the body, the
+// platform, release, environment and profiler_id parameters describe the
+// chunk.
+func (env *environment) postImportedChunk(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	hub := sentry.GetHubFromContext(ctx)
+	ps := httprouter.ParamsFromContext(ctx)
+	rawOrganizationID := ps.ByName("organization_id")
+	organizationID, err := strconv.ParseUint(rawOrganizationID, 10, 64)
+	if err != nil {
+		if hub != nil {
+			hub.CaptureException(err)
+		}
+		writeInvalidID(w, "organization_id")
+		return
+	}
+
+	hub.Scope().SetTag("organization_id", rawOrganizationID)
+
+	rawProjectID := ps.ByName("project_id")
+	projectID, err := strconv.ParseUint(rawProjectID, 10, 64)
+	if err != nil {
+		if hub != nil {
+			hub.CaptureException(err)
+		}
+		writeInvalidID(w, "project_id")
+		return
+	}
+
+	hub.Scope().SetTag("project_id", rawProjectID)
+
+	qs := r.URL.Query()
+	format := importer.Format(qs.Get("format"))
+	err = format.Validate()
+	if err != nil {
+		writeInvalidParameter(w, "format", err)
+		return
+	}
+
+	hub.Scope().SetTag("format", string(format))
+
+	p := platform.Platform(qs.Get("platform"))
+	if !p.IsKnown() {
+		writeInvalidParameter(w, "platform", fmt.Errorf("unknown platform %q", p))
+		return
+	}
+
+	profilerID := qs.Get("profiler_id")
+	if profilerID == "" {
+		profilerID = newID()
+	} else if _, err := uuid.Parse(profilerID); err != nil {
+		writeInvalidID(w, "profiler_id")
+		return
+	}
+
+	now := time.Now()
+	s := sentry.StartSpan(ctx, "processing")
+	s.Description = "Import profile"
+	body := env.limitBody(w, r)
+	sc, err := importer.Import(format, body, importer.Options{
+		Platform: p,
+		Start:    now,
+	})
+	s.Finish()
+	if err != nil {
+		// A body cut at the size limit usually fails to parse first.
+		var maxBytesErr *http.MaxBytesError
+		if _, readErr := body.Read(nil); errors.As(readErr, &maxBytesErr) {
+			err = readErr
+		}
+		writeInvalidBody(w, err)
+		return
+	}
+
+	sc.ID = newID()
+	sc.ProfilerID = profilerID
+	sc.OrganizationID = organizationID
+	sc.ProjectID = projectID
+	sc.Release = qs.Get("release")
+	sc.Environment = qs.Get("environment")
+	sc.Received = float64(now.UnixNano()) / 1e9
+
+	hub.Scope().SetTag("profiler_id", sc.ProfilerID)
+	hub.Scope().SetTag("chunk_id", sc.ID)
+	hub.Scope().SetTag("platform", string(sc.Platform))
+
+	err = env.storeChunk(ctx, hub, chunk.New(&sc))
+	if err != nil {
+		writeStoreError(w, hub, err, "chunk")
+		return
+	}
+
+	b, err := json.Marshal(postImportedChunkResponse{
+		ProfilerID: sc.ProfilerID,
+		ChunkID:    sc.ID,
+	})
+	if err != nil {
+		writeInternalError(w, hub, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(b)
+}
+
+// writeStoreError reports an error storing a profile or a chunk. Invalid ones
+// are the client's fault and one already stored conflicts with the request,
+// neither is captured.
+func writeStoreError(w http.ResponseWriter, hub *sentry.Hub, err error, kind string) {
+	var invalid *invalidError
+	if errors.As(err, &invalid) {
+		writeInvalidBody(w, invalid.err)
+		return
+	}
+	if isAlreadyStored(err) {
+		httputil.WriteError(w, http.StatusConflict, httputil.Error{
+			Code:    httputil.ErrorCodeAlreadyExists,
+			Message: fmt.Sprintf("%s already exists", kind),
+		})
+		return
+	}
+	writeInternalError(w, hub, err)
+}
+
+// limitBody returns the body of the request, failing reads once more than the
+// configured bytes were decompressed.
+func (env *environment) limitBody(w http.ResponseWriter, r *http.Request) io.ReadCloser {
+	maxBytes := env.config.MaxBodyBytes
+	if maxBytes <= 0 {
+		maxBytes = httputil.DefaultMaxBodyBytes
+	}
+	return http.MaxBytesReader(w, r.Body, maxBytes)
+}
+
+// newID returns a random ID formatted like the IDs of profiles and chunks.
+func newID() string {
+	return strings.ReplaceAll(uuid.New().String(), "-", "")
+}
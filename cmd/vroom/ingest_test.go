@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+
+	"github.com/getsentry/vroom/internal/chunk"
+	"github.com/getsentry/vroom/internal/frame"
+	"github.com/getsentry/vroom/internal/httputil"
+	"github.com/getsentry/vroom/internal/platform"
+	"github.com/getsentry/vroom/internal/profile"
+	"github.com/getsentry/vroom/internal/sample"
+	"github.com/getsentry/vroom/internal/storageutil"
+)
+
+func TestPostRawChunk(t *testing.T) {
+	newChunk := func(stackID int) chunk.SampleChunk {
+		return chunk.SampleChunk{
+			ID:             "c1bd7f5cbb0d4e1fa4ad19a8b0e2f9d4",
+			ProfilerID:     "8a6f8c4b2f3a4d0e9b1c7d6e5f4a3b2c",
+			OrganizationID: 1,
+			ProjectID:      2,
+			Platform:       platform.Python,
+			Version:        "2",
+			Profile: chunk.SampleData{
+				Frames: []frame.Frame{
+					{Function: "main", Path: "/app/main.py"},
+				},
+				Samples: []chunk.Sample{
+					{StackID: stackID, ThreadID: "1", Timestamp: 1.0},
+					{StackID: stackID, ThreadID: "1", Timestamp: 1.1},
+				},
+				Stacks: [][]int{{0}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		chunk      chunk.SampleChunk
+		wantStatus int
+	}{
+		{
+			name:       "valid chunk",
+			path:       "/organizations/1/projects/2/raw_chunks",
+			chunk:      newChunk(0),
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "invalid stack id",
+			path:       "/organizations/1/projects/2/raw_chunks",
+			chunk:      newChunk(1),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "project mismatch",
+			path:       "/organizations/1/projects/3/raw_chunks",
+			chunk:      newChunk(0),
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := postJSON(t, test.path, test.chunk)
+			if rec.Code != test.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", test.wantStatus, rec.Code, rec.Body.String())
+			}
+			if test.wantStatus != http.StatusCreated {
+				return
+			}
+			var c chunk.Chunk
+			err := storageutil.UnmarshalCompressed(
+				context.Background(),
+				fileBlobBucket,
+				test.chunk.StoragePath(),
+				&c,
+			)
+			if err != nil {
+				t.Fatalf("couldn't read the chunk back: %v", err)
+			}
+			if c.GetID() != test.chunk.ID {
+				t.Fatalf("expected chunk %s, got %s", test.chunk.ID, c.GetID())
+			}
+		})
+	}
+}
+
+func TestPostImportedChunk(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "folded stacks",
+			path:       "/organizations/1/projects/2/raw_chunks/import?format=folded&platform=python",
+			body:       "main;a 2\nmain 1\n",
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "unknown format",
+			path:       "/organizations/1/projects/2/raw_chunks/import?format=json",
+			body:       "{}",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "missing platform",
+			path:       "/organizations/1/projects/2/raw_chunks/import?format=folded",
+			body:       "main;a 2\n",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown platform",
+			path:       "/organizations/1/projects/2/raw_chunks/import?format=folded&platform=cobol",
+			body:       "main;a 2\n",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid profile",
+			path:       "/organizations/1/projects/2/raw_chunks/import?format=folded&platform=python",
+			body:       "main;a\n",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := post(t, test.path, []byte(test.body))
+			if rec.Code != test.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", test.wantStatus, rec.Code, rec.Body.String())
+			}
+			if test.wantStatus != http.StatusCreated {
+				return
+			}
+			var resp postImportedChunkResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("couldn't decode the response: %v", err)
+			}
+			var c chunk.Chunk
+			err := storageutil.UnmarshalCompressed(
+				context.Background(),
+				fileBlobBucket,
+				chunk.StoragePath(1, 2, resp.ProfilerID, resp.ChunkID),
+				&c,
+			)
+			if err != nil {
+				t.Fatalf("couldn't read the chunk back: %v", err)
+			}
+			callTrees, err := c.CallTrees(nil)
+			if err != nil {
+				t.Fatalf("couldn't generate call trees: %v", err)
+			}
+			if len(callTrees["1"]) != 1 || callTrees["1"][0].Name != "main" {
+				t.Fatalf("unexpected call trees: %+v", callTrees)
+			}
+		})
+	}
+}
+
+func TestPostRawProfile(t *testing.T) {
+	p := sample.Profile{
+		RawProfile: sample.RawProfile{
+			EventID:        "41fed0925670468bb0457f61a74688ec",
+			OrganizationID: 1,
+			ProjectID:      2,
+			Platform:       platform.Cocoa,
+			Version:        "1",
+			Trace: sample.Trace{
+				Frames: []frame.Frame{
+					{Function: "main", InstructionAddr: "0x10"},
+				},
+				Samples: []sample.Sample{
+					{StackID: 0, ThreadID: 1},
+					{StackID: 0, ThreadID: 1, ElapsedSinceStartNS: 10},
+				},
+				Stacks: []sample.Stack{{1}},
+			},
+		},
+	}
+
+	rec := postJSON(t, "/organizations/1/projects/2/raw_profiles", p)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	p.Trace.Stacks = []sample.Stack{{0}}
+	rec = postJSON(t, "/organizations/1/projects/2/raw_profiles", p)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+
+	var stored profile.Profile
+	err := storageutil.UnmarshalCompressed(
+		context.Background(),
+		fileBlobBucket,
+		p.StoragePath(),
+		&stored,
+	)
+	if err != nil {
+		t.Fatalf("couldn't read the profile back: %v", err)
+	}
+	if stored.ID() != p.EventID {
+		t.Fatalf("expected profile %s, got %s", p.EventID, stored.ID())
+	}
+}
+
+func TestPostRawBodyTooLarge(t *testing.T) {
+	env := &environment{
+		config:  ServiceConfig{MaxBodyBytes: 16},
+		storage: fileBlobBucket,
+	}
+	for _, test := range []struct{ path, body string }{
+		{"/organizations/1/projects/2/raw_profiles", `{"event_id":"41fed0925670468bb0457f61a74688ec"}`},
+		{"/organizations/1/projects/2/raw_chunks", `{"chunk_id":"c1bd7f5cbb0d4e1fa4ad19a8b0e2f9d4"}`},
+		{"/organizations/1/projects/2/raw_chunks/import?format=folded&platform=python", "main;a 2\nmain;b 3\nmain;c 4\n"},
+	} {
+		rec := postWithEnvironment(t, env, test.path, []byte(test.body))
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("%s: expected status %d, got %d: %s", test.path, http.StatusRequestEntityTooLarge, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestPostRawProfileAlreadyStored(t *testing.T) {
+	p := sample.Profile{
+		RawProfile: sample.RawProfile{
+			EventID:        "5b2e8c1f0d3a4b6e9f7a8c0d1e2f3a4b",
+			OrganizationID: 1,
+			ProjectID:      2,
+			Platform:       platform.Cocoa,
+			Version:        "1",
+			Trace: sample.Trace{
+				Frames: []frame.Frame{
+					{Function: "main", InstructionAddr: "0x10"},
+				},
+				Samples: []sample.Sample{
+					{StackID: 0, ThreadID: 1},
+					{StackID: 0, ThreadID: 1, ElapsedSinceStartNS: 10},
+				},
+				Stacks: []sample.Stack{{0}},
+			},
+		},
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("couldn't marshal the body: %v", err)
+	}
+
+	var captured bool
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		BeforeSend: func(event *sentry.Event, _ *sentry.EventHint) *sentry.Event {
+			captured = true
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &environment{storage: newPreconditionBucket()}
+	router, err := env.newRouter()
+	if err != nil {
+		t.Fatalf("couldn't create the router: %v", err)
+	}
+
+	for _, wantStatus := range []int{http.StatusCreated, http.StatusConflict} {
+		req := httptest.NewRequest(http.MethodPost, "/organizations/1/projects/2/raw_profiles", bytes.NewReader(b))
+		req = req.WithContext(sentry.SetHubOnContext(req.Context(), sentry.NewHub(client, sentry.NewScope())))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != wantStatus {
+			t.Fatalf("expected status %d, got %d: %s", wantStatus, rec.Code, rec.Body.String())
+		}
+		if wantStatus != http.StatusConflict {
+			continue
+		}
+		var resp httputil.ErrorResponse
+		err := json.Unmarshal(rec.Body.Bytes(), &resp)
+		if err != nil {
+			t.Fatalf("couldn't decode the error: %v", err)
+		}
+		if resp.Error.Code != httputil.ErrorCodeAlreadyExists {
+			t.Fatalf("expected code %s, got %s", httputil.ErrorCodeAlreadyExists, resp.Error.Code)
+		}
+	}
+	if captured {
+		t.Fatal("expected the duplicate profile to not be captured")
+	}
+}
+
+func postJSON(t *testing.T, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("couldn't marshal the body: %v", err)
+	}
+	return post(t, path, b)
+}
+
+func post(t *testing.T, path string, b []byte) *httptest.ResponseRecorder {
+	t.Helper()
+
+	return postWithEnvironment(t, &environment{storage: fileBlobBucket}, path, b)
+}
+
+func postWithEnvironment(t *testing.T, env *environment, path string, b []byte) *httptest.ResponseRecorder {
+	t.Helper()
+
+	router, err := env.newRouter()
+	if err != nil {
+		t.Fatalf("couldn't create the router: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(b))
+	req = req.WithContext(sentry.SetHubOnContext(req.Context(), sentry.CurrentHub().Clone()))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
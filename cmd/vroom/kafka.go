@@ -3,10 +3,47 @@ package main
 import (
 	"context"
 
+	"github.com/getsentry/sentry-go"
 	"github.com/segmentio/kafka-go"
+
+	"github.com/getsentry/vroom/internal/monitoring"
+	"github.com/getsentry/vroom/internal/occurrence"
 )
 
 type KafkaWriter interface {
 	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
 	Close() error
 }
+
+type KafkaReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// sendOccurrences queues occurrences to be sent to Kafka and counts them once
+// they were queued. The writer is asynchronous so errors delivering them are
+// not returned.
+func (env *environment) sendOccurrences(ctx context.Context, occurrences []*occurrence.Occurrence) error {
+	if len(occurrences) == 0 {
+		return nil
+	}
+
+	occurrenceMessages, err := occurrence.GenerateKafkaMessageBatch(occurrences)
+	if err != nil {
+		return err
+	}
+
+	s := sentry.StartSpan(ctx, "processing")
+	s.Description = "Send occurrences to Kafka"
+	err = env.occurrencesWriter.WriteMessages(ctx, occurrenceMessages...)
+	s.Finish()
+	if err != nil {
+		return err
+	}
+
+	for _, o := range occurrences {
+		monitoring.OccurrencesQueued.WithLabelValues(string(o.Category()), string(o.Event.Platform)).Inc()
+	}
+	return nil
+}
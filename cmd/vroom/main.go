@@ -2,6 +2,10 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
@@ -26,6 +30,11 @@ import (
 
 	"github.com/getsentry/vroom/internal/httputil"
 	"github.com/getsentry/vroom/internal/logutil"
+	"github.com/getsentry/vroom/internal/monitoring"
+	"github.com/getsentry/vroom/internal/occurrence"
+	"github.com/getsentry/vroom/internal/platform"
+	"github.com/getsentry/vroom/internal/proguard"
+	"github.com/getsentry/vroom/internal/sourcemap"
 	"github.com/getsentry/vroom/internal/storageutil"
 )
 
@@ -35,6 +44,15 @@ type environment struct {
 	occurrencesWriter KafkaWriter
 
 	storage *blob.Bucket
+	cache   *storageutil.Cache
+	auth    *httputil.Authenticator
+
+	mappingsBucket *blob.Bucket
+	mappings       *proguard.Loader
+
+	sourceMaps *sourcemap.Loader
+
+	detectionRules map[platform.Platform][]occurrence.DetectFrameOptions
 }
 
 var (
@@ -49,12 +67,54 @@ func newEnvironment() (*environment, error) {
 		return nil, err
 	}
 
+	e.detectionRules = occurrence.DefaultDetectionRules()
+	if e.config.DetectionRulesPath != "" {
+		e.detectionRules, err = occurrence.LoadDetectionRules(e.config.DetectionRulesPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if e.config.AuthConfigPath != "" {
+		c, err := httputil.LoadAuthConfig(e.config.AuthConfigPath)
+		if err != nil {
+			return nil, err
+		}
+		e.auth, err = httputil.NewAuthenticator(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	ctx := context.Background()
-	e.storage, err = blob.OpenBucket(ctx, e.config.BucketURL)
+	e.storage, err = storageutil.OpenBucket(ctx, e.config.BucketURL)
 	if err != nil {
 		return nil, err
 	}
 
+	if e.config.SourceMapsEnabled {
+		e.sourceMaps = sourcemap.NewLoader(e.storage, e.config.SourceMapsMaxMaps)
+	}
+
+	if e.config.ProguardMappingsURL != "" {
+		e.mappingsBucket, err = blob.OpenBucket(ctx, e.config.ProguardMappingsURL)
+		if err != nil {
+			return nil, err
+		}
+		e.mappings = proguard.NewLoader(e.mappingsBucket, e.config.ProguardMaxMappings)
+	}
+
+	if e.config.CacheMaxBytes > 0 || e.config.CacheDir != "" {
+		e.cache, err = storageutil.NewCache(
+			e.config.CacheMaxBytes,
+			e.config.CacheDir,
+			e.config.CacheDiskMaxBytes,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	e.occurrencesWriter = &kafka.Writer{
 		Addr:         kafka.TCP(e.config.OccurrencesKafkaBrokers...),
 		Async:        true,
@@ -73,6 +133,12 @@ func (e *environment) shutdown() {
 	if err != nil {
 		sentry.CaptureException(err)
 	}
+	if e.mappingsBucket != nil {
+		err = e.mappingsBucket.Close()
+		if err != nil {
+			sentry.CaptureException(err)
+		}
+	}
 	err = e.occurrencesWriter.Close()
 	if err != nil {
 		sentry.CaptureException(err)
@@ -106,17 +172,57 @@ func (e *environment) newRouter() (*httprouter.Router, error) {
 			"/organizations/:organization_id/projects/:project_id/raw_chunks/:profiler_id/:chunk_id",
 			e.getRawChunk,
 		},
+		{
+			http.MethodPost,
+			"/organizations/:organization_id/projects/:project_id/raw_profiles",
+			e.postRawProfile,
+		},
+		{
+			http.MethodPost,
+			"/organizations/:organization_id/projects/:project_id/raw_chunks",
+			e.postRawChunk,
+		},
+		{
+			http.MethodPost,
+			"/organizations/:organization_id/projects/:project_id/raw_chunks/import",
+			e.postImportedChunk,
+		},
 		{
 			http.MethodPost,
 			"/organizations/:organization_id/projects/:project_id/chunks",
 			e.postProfileFromChunkIDs,
 		},
+		{
+			http.MethodPost,
+			"/organizations/:organization_id/projects/:project_id/raw_batch",
+			e.postRawBatch,
+		},
 		{
 			http.MethodPost,
 			"/organizations/:organization_id/flamegraph",
 			e.postFlamegraph,
 		},
-		{http.MethodGet, "/health", e.getHealth},
+		{
+			http.MethodPost,
+			"/organizations/:organization_id/flamegraph/diff",
+			e.postDifferentialFlamegraph,
+		},
+		{
+			http.MethodPost,
+			"/organizations/:organization_id/flamegraph/timeline",
+			e.postFlamegraphTimeline,
+		},
+		{
+			http.MethodPost,
+			"/organizations/:organization_id/functions/metrics",
+			e.postFunctionMetrics,
+		},
+		{
+			http.MethodPost,
+			"/organizations/:organization_id/functions/regressions",
+			e.postDetectRegressions,
+		},
+		{http.MethodGet, "/cache/stats", e.getCacheStats},
 		{http.MethodPost, "/regressed", e.postRegressed},
 	}
 
@@ -125,10 +231,17 @@ func (e *environment) newRouter() (*httprouter.Router, error) {
 	for _, route := range routes {
 		handlerFunc := httputil.AnonymizeTransactionName(route.handler)
 		handlerFunc = httputil.DecompressPayload(handlerFunc)
+		// Signatures cover the body as sent, before it's decompressed.
+		if e.auth != nil {
+			handlerFunc = e.auth.Authenticate(handlerFunc)
+		}
 		handler := compress(handlerFunc)
 
-		router.Handler(route.method, route.path, handler)
+		router.Handler(route.method, route.path, monitoring.InstrumentRoute(route.path, handler))
 	}
+	// Health checks and metrics are served to anyone.
+	router.Handler(http.MethodGet, "/health", monitoring.InstrumentRoute("/health", http.HandlerFunc(e.getHealth)))
+	router.Handler(http.MethodGet, "/metrics", monitoring.Handler())
 
 	return router, nil
 }
@@ -166,6 +279,11 @@ func main() {
 		log.Fatal("can't initialize sentry", err)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "consumer" {
+		runConsumer(env)
+		return
+	}
+
 	router, err := env.newRouter()
 	if err != nil {
 		sentry.CaptureException(err)
@@ -177,6 +295,11 @@ func main() {
 		ReadHeaderTimeout: time.Second,
 		Handler:           sentryhttp.New(sentryhttp.Options{}).Handle(router),
 	}
+	server.TLSConfig, err = env.tlsConfig()
+	if err != nil {
+		sentry.CaptureException(err)
+		log.Fatal("error setting up tls", err)
+	}
 
 	waitForShutdown := make(chan os.Signal)
 	go func() {
@@ -199,10 +322,15 @@ func main() {
 
 	readJobs = make(chan storageutil.ReadJob, 10*env.config.WorkerPoolSize)
 	for i := 0; i < env.config.WorkerPoolSize; i++ {
-		go storageutil.ReadWorker(readJobs)
+		go storageutil.ReadWorker(readJobs, env.cache)
 	}
+	env.registerMetrics()
 
-	err = server.ListenAndServe()
+	if server.TLSConfig != nil {
+		err = server.ListenAndServeTLS(env.config.TLSCertPath, env.config.TLSKeyPath)
+	} else {
+		err = server.ListenAndServe()
+	}
 	if err != nil && err != http.ErrServerClosed {
 		sentry.CaptureException(err)
 		slog.Error("server failed", "err", err)
@@ -216,6 +344,32 @@ func main() {
 	slog.Info("vroom graceful shutdown")
 }
 
+// tlsConfig returns the TLS config of the server when a certificate is set.
+// With a client CA, client certificates are verified and identify clients
+// but aren't required so clients can sign requests instead.
+func (e *environment) tlsConfig() (*tls.Config, error) {
+	if e.config.TLSCertPath == "" && e.config.TLSKeyPath == "" {
+		if e.config.TLSClientCAPath != "" {
+			return nil, errors.New("a client CA requires a server certificate and key")
+		}
+		return nil, nil
+	}
+	c := &tls.Config{MinVersion: tls.VersionTLS12}
+	if e.config.TLSClientCAPath == "" {
+		return c, nil
+	}
+	b, err := os.ReadFile(e.config.TLSClientCAPath)
+	if err != nil {
+		return nil, err
+	}
+	c.ClientCAs = x509.NewCertPool()
+	if !c.ClientCAs.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("%s: no certificate found", e.config.TLSClientCAPath)
+	}
+	c.ClientAuth = tls.VerifyClientCertIfGiven
+	return c, nil
+}
+
 func (e *environment) getHealth(w http.ResponseWriter, _ *http.Request) {
 	if _, err := os.Stat("/tmp/vroom.down"); err != nil {
 		w.WriteHeader(http.StatusOK)
@@ -223,3 +377,52 @@ func (e *environment) getHealth(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusBadGateway)
 	}
 }
+
+// registerMetrics registers the metrics computed from the state of the
+// environment when they're scraped.
+func (e *environment) registerMetrics() {
+	monitoring.ReadWorkers.Set(float64(e.config.WorkerPoolSize))
+	monitoring.RegisterGaugeFunc(
+		"read_jobs_queue_depth",
+		"Number of read jobs waiting for a worker.",
+		func() float64 { return float64(len(readJobs)) },
+	)
+	if e.cache == nil {
+		return
+	}
+	monitoring.RegisterCounterFunc(
+		"cache_hits_total",
+		"Decoded objects read from the memory tier of the cache.",
+		func() float64 { return float64(e.cache.Stats().Hits) },
+	)
+	monitoring.RegisterCounterFunc(
+		"cache_disk_hits_total",
+		"Objects read from the disk tier of the cache.",
+		func() float64 { return float64(e.cache.Stats().DiskHits) },
+	)
+	monitoring.RegisterCounterFunc(
+		"cache_misses_total",
+		"Objects read from storage because they were not cached.",
+		func() float64 { return float64(e.cache.Stats().Misses) },
+	)
+	monitoring.RegisterGaugeFunc(
+		"cache_bytes",
+		"Estimated size of the decoded objects in the memory tier of the cache.",
+		func() float64 { return float64(e.cache.Stats().Bytes) },
+	)
+}
+
+func (e *environment) getCacheStats(w http.ResponseWriter, _ *http.Request) {
+	var stats storageutil.CacheStats
+	if e.cache != nil {
+		stats = e.cache.Stats()
+	}
+	b, err := json.Marshal(stats)
+	if err != nil {
+		writeInternalError(w, nil, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
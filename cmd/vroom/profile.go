@@ -2,15 +2,16 @@ package main
 
 import (
 	"encoding/json"
-	"errors"
+	"io"
 	"net/http"
 	"strconv"
 
 	"github.com/getsentry/sentry-go"
 	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
-	"google.golang.org/api/googleapi"
 
+	"github.com/getsentry/vroom/internal/folded"
+	"github.com/getsentry/vroom/internal/pprof"
 	"github.com/getsentry/vroom/internal/profile"
 	"github.com/getsentry/vroom/internal/storageutil"
 )
@@ -28,7 +29,7 @@ func (env *environment) getRawProfile(w http.ResponseWriter, r *http.Request) {
 	organizationID, err := strconv.ParseUint(rawOrganizationID, 10, 64)
 	if err != nil {
 		hub.CaptureException(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeInvalidID(w, "organization_id")
 		return
 	}
 
@@ -38,7 +39,7 @@ func (env *environment) getRawProfile(w http.ResponseWriter, r *http.Request) {
 	projectID, err := strconv.ParseUint(rawProjectID, 10, 64)
 	if err != nil {
 		sentry.CaptureException(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeInvalidID(w, "project_id")
 		return
 	}
 
@@ -48,7 +49,7 @@ func (env *environment) getRawProfile(w http.ResponseWriter, r *http.Request) {
 	_, err = uuid.Parse(profileID)
 	if err != nil {
 		hub.CaptureException(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeInvalidID(w, "profile_id")
 		return
 	}
 
@@ -65,21 +66,7 @@ func (env *environment) getRawProfile(w http.ResponseWriter, r *http.Request) {
 	)
 	s.Finish()
 	if err != nil {
-		if errors.Is(err, storageutil.ErrObjectNotFound) {
-			w.WriteHeader(http.StatusNotFound)
-			return
-		}
-		var e *googleapi.Error
-		if ok := errors.As(err, &e); ok {
-			hub.Scope().SetContext("Google Cloud Storage Error", map[string]interface{}{
-				"body":    e.Body,
-				"code":    e.Code,
-				"details": e.Details,
-				"message": e.Message,
-			})
-		}
-		hub.CaptureException(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeStorageError(w, hub, err, "profile_id", "profile not found")
 		return
 	}
 
@@ -87,8 +74,7 @@ func (env *environment) getRawProfile(w http.ResponseWriter, r *http.Request) {
 	defer s.Finish()
 	b, err := json.Marshal(p)
 	if err != nil {
-		hub.CaptureException(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeInternalError(w, hub, err)
 		return
 	}
 
@@ -99,6 +85,7 @@ func (env *environment) getRawProfile(w http.ResponseWriter, r *http.Request) {
 }
 
 func (env *environment) getProfile(w http.ResponseWriter, r *http.Request) {
+	varyOnAccept(w)
 	ctx := r.Context()
 	qs := r.URL.Query()
 	hub := sentry.GetHubFromContext(ctx)
@@ -107,7 +94,7 @@ func (env *environment) getProfile(w http.ResponseWriter, r *http.Request) {
 	organizationID, err := strconv.ParseUint(rawOrganizationID, 10, 64)
 	if err != nil {
 		hub.CaptureException(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeInvalidID(w, "organization_id")
 		return
 	}
 
@@ -117,7 +104,7 @@ func (env *environment) getProfile(w http.ResponseWriter, r *http.Request) {
 	projectID, err := strconv.ParseUint(rawProjectID, 10, 64)
 	if err != nil {
 		sentry.CaptureException(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeInvalidID(w, "project_id")
 		return
 	}
 
@@ -127,7 +114,7 @@ func (env *environment) getProfile(w http.ResponseWriter, r *http.Request) {
 	_, err = uuid.Parse(profileID)
 	if err != nil {
 		hub.CaptureException(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeInvalidID(w, "profile_id")
 		return
 	}
 
@@ -144,25 +131,45 @@ func (env *environment) getProfile(w http.ResponseWriter, r *http.Request) {
 	)
 	s.Finish()
 	if err != nil {
-		if errors.Is(err, storageutil.ErrObjectNotFound) {
-			w.WriteHeader(http.StatusNotFound)
+		writeStorageError(w, hub, err, "profile_id", "profile not found")
+		return
+	}
+
+	hub.Scope().SetTag("platform", string(p.Platform()))
+
+	if asPprof, asFolded := wantsPprof(r), wantsFolded(r); asPprof || asFolded {
+		s = sentry.StartSpan(ctx, "processing")
+		s.Description = "Generate call trees"
+		callTrees, err := p.CallTrees()
+		s.Finish()
+		if err != nil {
+			writeInternalError(w, hub, err)
 			return
 		}
-		var e *googleapi.Error
-		if ok := errors.As(err, &e); ok {
-			hub.Scope().SetContext("Google Cloud Storage Error", map[string]interface{}{
-				"body":    e.Body,
-				"code":    e.Code,
-				"details": e.Details,
-				"message": e.Message,
+		w.Header().Set("Cache-Control", "public, max-age=3600, immutable")
+		if asFolded {
+			hub.Scope().SetTag("format", "folded")
+			writeFolded(ctx, w, hub, func(out io.Writer) error {
+				return folded.WriteCallTrees(out, callTrees, foldedWeight(r))
 			})
+			return
 		}
-		hub.CaptureException(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		hub.Scope().SetTag("format", "pprof")
+		writePprof(ctx, w, hub, pprof.FromCallTrees(callTrees, p.Timestamp(), p.DurationNS()))
 		return
 	}
 
-	hub.Scope().SetTag("platform", string(p.Platform()))
+	if format := traceFormat(r); format != "" {
+		hub.Scope().SetTag("format", format)
+		o, err := p.Speedscope()
+		if err != nil {
+			writeInternalError(w, hub, err)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=3600, immutable")
+		writeTrace(ctx, w, hub, format, o)
+		return
+	}
 
 	s = sentry.StartSpan(ctx, "json.marshal")
 	defer s.Finish()
@@ -176,8 +183,7 @@ func (env *environment) getProfile(w http.ResponseWriter, r *http.Request) {
 		hub.Scope().SetTag("format", "speedscope")
 		o, err := p.Speedscope()
 		if err != nil {
-			hub.CaptureException(err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeInternalError(w, hub, err)
 			return
 		}
 		i = o
@@ -185,8 +191,7 @@ func (env *environment) getProfile(w http.ResponseWriter, r *http.Request) {
 
 	b, err := json.Marshal(i)
 	if err != nil {
-		hub.CaptureException(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeInternalError(w, hub, err)
 		return
 	}
 
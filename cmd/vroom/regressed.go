@@ -3,10 +3,51 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/getsentry/sentry-go"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/getsentry/vroom/internal/examples"
+	"github.com/getsentry/vroom/internal/flamegraph"
+	"github.com/getsentry/vroom/internal/metrics"
 	"github.com/getsentry/vroom/internal/occurrence"
+	"github.com/getsentry/vroom/internal/regression"
+)
+
+const (
+	// maxRegressionBuckets is the highest number of buckets aggregated in a
+	// single request, all of them sharing the same download deadline.
+	maxRegressionBuckets = 100
+
+	// regressionDownloadTimeout is the time given to read the candidates of
+	// all the buckets.
+	regressionDownloadTimeout = 10 * time.Second
+)
+
+var errTooManyRegressionBuckets = fmt.Errorf("can't aggregate more than %d buckets at once", maxRegressionBuckets)
+
+type (
+	postDetectRegressionsBody struct {
+		// Series are durations already aggregated by the caller.
+		Series []regression.Series `json:"series"`
+		// Buckets are candidates whose functions are aggregated here, each
+		// bucket being a point of the series.
+		Buckets []regressionBucket `json:"buckets"`
+
+		regression.Options
+	}
+
+	regressionBucket struct {
+		Timestamp   uint64                                 `json:"timestamp"`
+		Transaction []examples.TransactionProfileCandidate `json:"transaction"`
+		Continuous  []examples.ContinuousProfileCandidate  `json:"continuous"`
+	}
 )
 
 func (env *environment) postRegressed(w http.ResponseWriter, r *http.Request) {
@@ -16,7 +57,7 @@ func (env *environment) postRegressed(w http.ResponseWriter, r *http.Request) {
 	regressedFunctions, err := decodeRegressedFunctionPayload(ctx, r)
 	if err != nil {
 		hub.CaptureException(err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeInvalidBody(w, err)
 		return
 	}
 
@@ -45,25 +86,13 @@ func (env *environment) postRegressed(w http.ResponseWriter, r *http.Request) {
 	b, err := json.Marshal(data)
 	s.Finish()
 	if err != nil {
-		hub.CaptureException(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeInternalError(w, hub, err)
 		return
 	}
 
-	occurrenceMessages, err := occurrence.GenerateKafkaMessageBatch(occurrences)
-	if err != nil {
-		hub.CaptureException(err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	s = sentry.StartSpan(ctx, "processing")
-	s.Description = "Send occurrences to Kafka"
-	err = env.occurrencesWriter.WriteMessages(ctx, occurrenceMessages...)
-	s.Finish()
+	err = env.sendOccurrences(ctx, occurrences)
 	if err != nil {
-		hub.CaptureException(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeInternalError(w, hub, err)
 		return
 	}
 
@@ -81,3 +110,167 @@ func decodeRegressedFunctionPayload(ctx context.Context, r *http.Request) ([]occ
 	err := json.NewDecoder(r.Body).Decode(&regressedFunctions)
 	return regressedFunctions, err
 }
+
+// postDetectRegressions looks for functions getting slower over time and
+// returns them in the format expected by postRegressed.
+func (env *environment) postDetectRegressions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	hub := sentry.GetHubFromContext(ctx)
+	ps := httprouter.ParamsFromContext(ctx)
+	rawOrganizationID := ps.ByName("organization_id")
+	organizationID, err := strconv.ParseUint(rawOrganizationID, 10, 64)
+	if err != nil {
+		if hub != nil {
+			hub.CaptureException(err)
+		}
+		writeInvalidID(w, "organization_id")
+		return
+	}
+
+	hub.Scope().SetTag("organization_id", rawOrganizationID)
+
+	var body postDetectRegressionsBody
+	s := sentry.StartSpan(ctx, "processing")
+	s.Description = "Decoding data"
+	err = json.NewDecoder(r.Body).Decode(&body)
+	s.Finish()
+	if err != nil {
+		if hub != nil {
+			hub.CaptureException(err)
+		}
+		writeInvalidBody(w, err)
+		return
+	}
+
+	err = body.Options.Validate()
+	if err != nil {
+		writeInvalidBody(w, err)
+		return
+	}
+	if len(body.Buckets) > maxRegressionBuckets {
+		writeInvalidBody(w, errTooManyRegressionBuckets)
+		return
+	}
+
+	var bucketSeries []regression.Series
+	if len(body.Buckets) > 0 {
+		bucketSeries, err = env.seriesFromBuckets(ctx, organizationID, body.Buckets)
+		if err != nil {
+			writeInternalError(w, hub, err)
+			return
+		}
+	}
+	// Series sent by the caller and aggregated from buckets may share a key.
+	series := regression.Merge(body.Series, bucketSeries)
+
+	s = sentry.StartSpan(ctx, "processing")
+	s.Description = "Detecting regressions"
+	regressedFunctions := regression.Detect(organizationID, series, body.Options)
+	s.Finish()
+
+	s = sentry.StartSpan(ctx, "json.marshal")
+	defer s.Finish()
+	b, err := json.Marshal(regressedFunctions)
+	if err != nil {
+		writeInternalError(w, hub, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
+
+// seriesFromBuckets aggregates the functions of each project in each bucket
+// and returns the p95 of each function over time. Reads skipped once the
+// deadline is exceeded would leave the series partial, so the deadline is
+// returned as an error instead.
+func (env *environment) seriesFromBuckets(
+	ctx context.Context,
+	organizationID uint64,
+	buckets []regressionBucket,
+) ([]regression.Series, error) {
+	downloadContext, cancel := context.WithTimeout(ctx, regressionDownloadTimeout)
+	defer cancel()
+	seriesByKey := make(map[regression.SeriesKey]*regression.Series)
+	for _, bucket := range buckets {
+		for _, projectBucket := range bucket.byProject() {
+			if errors.Is(downloadContext.Err(), context.DeadlineExceeded) {
+				return nil, downloadContext.Err()
+			}
+			ma := metrics.NewAggregator(maxUniqueFunctionsPerProfile, 1, minDepth)
+			s := sentry.StartSpan(ctx, "processing")
+			// Buckets over the memory budget are compared on the candidates
+			// aggregated before it was exceeded.
+			functionMetrics, _, err := flamegraph.GetFunctionMetricsFromCandidates(
+				downloadContext,
+				env.storage,
+				organizationID,
+				projectBucket.transaction,
+				projectBucket.continuous,
+				readJobs,
+				&ma,
+				env.config.FlamegraphMemoryBudget,
+				s,
+			)
+			s.Finish()
+			if err != nil {
+				return nil, err
+			}
+			regression.AddMetrics(seriesByKey, projectBucket.projectID, bucket.Timestamp, functionMetrics)
+		}
+	}
+	if errors.Is(downloadContext.Err(), context.DeadlineExceeded) {
+		return nil, downloadContext.Err()
+	}
+	series := make([]regression.Series, 0, len(seriesByKey))
+	for _, s := range seriesByKey {
+		series = append(series, *s)
+	}
+	// Regressions are returned in the order of the series, it shouldn't
+	// depend on the iteration order of the map.
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].ProjectID != series[j].ProjectID {
+			return series[i].ProjectID < series[j].ProjectID
+		}
+		return series[i].Fingerprint < series[j].Fingerprint
+	})
+	return series, nil
+}
+
+// projectBucket holds the candidates of a bucket belonging to a project.
+type projectBucket struct {
+	projectID   uint64
+	transaction []examples.TransactionProfileCandidate
+	continuous  []examples.ContinuousProfileCandidate
+}
+
+// byProject splits the candidates of the bucket by project, sorted by
+// project ID, so functions are only aggregated with others of their project.
+func (b regressionBucket) byProject() []*projectBucket {
+	buckets := make(map[uint64]*projectBucket)
+	get := func(projectID uint64) *projectBucket {
+		pb, ok := buckets[projectID]
+		if !ok {
+			pb = &projectBucket{projectID: projectID}
+			buckets[projectID] = pb
+		}
+		return pb
+	}
+	for _, c := range b.Transaction {
+		pb := get(c.ProjectID)
+		pb.transaction = append(pb.transaction, c)
+	}
+	for _, c := range b.Continuous {
+		pb := get(c.ProjectID)
+		pb.continuous = append(pb.continuous, c)
+	}
+	sorted := make([]*projectBucket, 0, len(buckets))
+	for _, pb := range buckets {
+		sorted = append(sorted, pb)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].projectID < sorted[j].projectID
+	})
+	return sorted
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/getsentry/vroom/internal/examples"
+	"github.com/getsentry/vroom/internal/frame"
+	"github.com/getsentry/vroom/internal/httputil"
+	"github.com/getsentry/vroom/internal/monitoring"
+	"github.com/getsentry/vroom/internal/occurrence"
+	"github.com/getsentry/vroom/internal/platform"
+	"github.com/getsentry/vroom/internal/regression"
+	"github.com/getsentry/vroom/internal/sample"
+	"github.com/getsentry/vroom/internal/storageutil"
+	"github.com/getsentry/vroom/internal/transaction"
+)
+
+func TestPostDetectRegressions(t *testing.T) {
+	values := []float64{100, 102, 98, 101, 99, 100, 150, 152, 149, 151, 155, 148}
+	series := regression.Series{ProjectID: 2, Fingerprint: 42}
+	for i, v := range values {
+		series.Points = append(series.Points, regression.Point{
+			Timestamp: uint64(1000 + i*60),
+			Value:     v,
+		})
+	}
+
+	rec := postJSON(t, "/organizations/1/functions/regressions", map[string]interface{}{
+		"series":              []regression.Series{series},
+		"min_points_per_side": 1,
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	rec = postJSON(t, "/organizations/1/functions/regressions", map[string]interface{}{
+		"buckets": make([]regressionBucket, maxRegressionBuckets+1),
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	rec = postJSON(t, "/organizations/1/functions/regressions", map[string]interface{}{
+		"series": []regression.Series{series},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var regressed []occurrence.RegressedFunction
+	err := json.Unmarshal(rec.Body.Bytes(), &regressed)
+	if err != nil {
+		t.Fatalf("couldn't unmarshal the response: %v", err)
+	}
+	if len(regressed) != 1 || regressed[0].Breakpoint != 1360 {
+		t.Fatalf("expected a regression at 1360, got %+v", regressed)
+	}
+}
+
+func TestPostRegressedCountsOccurrences(t *testing.T) {
+	readJobs = make(chan storageutil.ReadJob)
+	go storageutil.ReadWorker(readJobs, nil)
+	defer func() {
+		close(readJobs)
+		readJobs = nil
+	}()
+
+	slow := frame.Frame{Function: "readFileSync", Module: "node:fs"}
+	p := sample.Profile{
+		RawProfile: sample.RawProfile{
+			EventID:        "8e4c2a0b1d3f4e5a9c7b6d5e4f3a2b1c",
+			OrganizationID: 1,
+			ProjectID:      2,
+			Platform:       platform.Node,
+			Version:        "1",
+			Transaction: transaction.Transaction{
+				ActiveThreadID: 1,
+				Name:           "/api/index",
+			},
+			Trace: sample.Trace{
+				Frames: []frame.Frame{{Function: "main", Module: "app"}, slow},
+				Samples: []sample.Sample{
+					{StackID: 0, ThreadID: 1},
+					{StackID: 0, ThreadID: 1, ElapsedSinceStartNS: 10_000_000},
+				},
+				Stacks: []sample.Stack{{1, 0}},
+			},
+		},
+	}
+	rec := postJSON(t, "/organizations/1/projects/2/raw_profiles", p)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+
+	// Regressed functions have no category.
+	counter := monitoring.OccurrencesQueued.WithLabelValues("", string(platform.Node))
+	before := testutil.ToFloat64(counter)
+
+	writer := &KafkaWriterRecorder{}
+	env := &environment{storage: fileBlobBucket, occurrencesWriter: writer}
+	b, err := json.Marshal([]occurrence.RegressedFunction{{
+		OrganizationID: 1,
+		ProjectID:      2,
+		ProfileID:      p.EventID,
+		Fingerprint:    slow.Fingerprint(),
+		Breakpoint:     1360,
+	}})
+	if err != nil {
+		t.Fatalf("couldn't marshal the body: %v", err)
+	}
+	rec = postWithEnvironment(t, env, "/regressed", b)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if len(writer.messages) != 1 {
+		t.Fatalf("expected 1 occurrence sent to Kafka, got %d", len(writer.messages))
+	}
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Fatalf("expected 1 occurrence counted as queued, got %v", got)
+	}
+}
+
+func TestPostDetectRegressionsTimeout(t *testing.T) {
+	b, err := json.Marshal(map[string]interface{}{
+		"buckets": []regressionBucket{{
+			Timestamp: 1000,
+			Transaction: []examples.TransactionProfileCandidate{
+				{ProjectID: 2, ProfileID: "c1bd7f5cbb0d4e1fa4ad19a8b0e2f9d4"},
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("couldn't marshal the body: %v", err)
+	}
+
+	env := &environment{storage: fileBlobBucket}
+	router, err := env.newRouter()
+	if err != nil {
+		t.Fatalf("couldn't create the router: %v", err)
+	}
+
+	// The deadline is exceeded before any bucket is read.
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	req := httptest.NewRequest(http.MethodPost, "/organizations/1/functions/regressions", bytes.NewReader(b))
+	req = req.WithContext(sentry.SetHubOnContext(ctx, sentry.CurrentHub().Clone()))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusGatewayTimeout, rec.Code, rec.Body.String())
+	}
+	var resp httputil.ErrorResponse
+	err = json.Unmarshal(rec.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatalf("couldn't decode the error: %v", err)
+	}
+	if resp.Error.Code != httputil.ErrorCodeStorageTimeout {
+		t.Fatalf("expected code %s, got %s", httputil.ErrorCodeStorageTimeout, resp.Error.Code)
+	}
+}
+
+func TestPostDetectRegressionsFromBuckets(t *testing.T) {
+	readJobs = make(chan storageutil.ReadJob)
+	go storageutil.ReadWorker(readJobs, nil)
+	defer func() {
+		close(readJobs)
+		readJobs = nil
+	}()
+
+	// Each profile calls a and b for samples*10ms.
+	inApp := true
+	store := func(projectID uint64, samples int) examples.TransactionProfileCandidate {
+		p := sample.Profile{
+			RawProfile: sample.RawProfile{
+				EventID:        newID(),
+				OrganizationID: 1,
+				ProjectID:      projectID,
+				Platform:       platform.Python,
+				Version:        "1",
+				Transaction:    transaction.Transaction{ActiveThreadID: 1},
+				Trace: sample.Trace{
+					Frames: []frame.Frame{
+						{Function: "main", Module: "app", InApp: &inApp},
+						{Function: "a", Module: "app", InApp: &inApp},
+						{Function: "b", Module: "app", InApp: &inApp},
+					},
+					Stacks: []sample.Stack{{1, 0}, {2, 0}},
+				},
+			},
+		}
+		for i := 0; i <= 2*samples; i++ {
+			p.Trace.Samples = append(p.Trace.Samples, sample.Sample{
+				StackID:             i / (samples + 1),
+				ThreadID:            1,
+				ElapsedSinceStartNS: uint64(i) * 10_000_000,
+			})
+		}
+		err := storageutil.CompressedWrite(context.Background(), fileBlobBucket, p.StoragePath(), p)
+		if err != nil {
+			t.Fatalf("couldn't store the profile: %v", err)
+		}
+		return examples.TransactionProfileCandidate{ProjectID: projectID, ProfileID: p.EventID}
+	}
+
+	var buckets []regressionBucket
+	for i, samples := range []int{10, 11, 10, 11, 20, 21, 20, 21} {
+		buckets = append(buckets, regressionBucket{
+			Timestamp:   uint64(1000 + i*60),
+			Transaction: []examples.TransactionProfileCandidate{store(3, samples), store(2, samples)},
+		})
+	}
+
+	rec := postJSON(t, "/organizations/1/functions/regressions", map[string]interface{}{
+		"buckets": buckets,
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var regressed []occurrence.RegressedFunction
+	err := json.Unmarshal(rec.Body.Bytes(), &regressed)
+	if err != nil {
+		t.Fatalf("couldn't unmarshal the response: %v", err)
+	}
+	if len(regressed) < 4 {
+		t.Fatalf("expected functions of both projects to regress, got %+v", regressed)
+	}
+	for i := 1; i < len(regressed); i++ {
+		previous, current := regressed[i-1], regressed[i]
+		if previous.ProjectID > current.ProjectID ||
+			(previous.ProjectID == current.ProjectID && previous.Fingerprint >= current.Fingerprint) {
+			t.Fatalf("expected regressions sorted by project and fingerprint, got %+v", regressed)
+		}
+	}
+}
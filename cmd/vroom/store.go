@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"gocloud.dev/gcerrors"
+
+	"github.com/getsentry/vroom/internal/chunk"
+	"github.com/getsentry/vroom/internal/profile"
+	"github.com/getsentry/vroom/internal/storageutil"
+)
+
+const (
+	// storageWriteAttempts is the number of times a transient error writing
+	// a profile or a chunk is retried.
+	storageWriteAttempts = 5
+
+	// storageWriteBackoff is the delay before the first retry, doubled for
+	// each following one.
+	storageWriteBackoff = 100 * time.Millisecond
+)
+
+// invalidError wraps the error validating a profile or a chunk. It won't
+// ever be stored, unlike after a storage error.
+type invalidError struct {
+	err error
+}
+
+func (e *invalidError) Error() string {
+	return e.err.Error()
+}
+
+func (e *invalidError) Unwrap() error {
+	return e.err
+}
+
+// storeProfile validates, deobfuscates, symbolicates and normalizes a
+// transaction profile before writing it to the bucket.
+func (env *environment) storeProfile(ctx context.Context, hub *sentry.Hub, p *profile.Profile) error {
+	err := p.Validate()
+	if err != nil {
+		return &invalidError{err: err}
+	}
+
+	env.deobfuscate(ctx, hub, p)
+	env.symbolicateJavaScript(ctx, hub, p.OrganizationID(), p.ProjectID(), p.Release(), p.SymbolicateJavaScript)
+
+	s := sentry.StartSpan(ctx, "processing")
+	s.Description = "Normalize profile"
+	p.Normalize()
+	s.Finish()
+
+	s = sentry.StartSpan(ctx, "profile.write")
+	s.Description = "Write profile to GCS"
+	err = env.compressedWrite(ctx, p.StoragePath(), p)
+	s.Finish()
+	return err
+}
+
+// storeChunk validates, deobfuscates, symbolicates and normalizes a
+// continuous profile chunk before writing it to the bucket.
+func (env *environment) storeChunk(ctx context.Context, hub *sentry.Hub, c chunk.Chunk) error {
+	err := c.Validate()
+	if err != nil {
+		return &invalidError{err: err}
+	}
+
+	env.deobfuscate(ctx, hub, c)
+	env.symbolicateJavaScript(ctx, hub, c.GetOrganizationID(), c.GetProjectID(), c.GetRelease(), c.SymbolicateJavaScript)
+
+	s := sentry.StartSpan(ctx, "processing")
+	s.Description = "Normalize chunk"
+	c.Normalize()
+	s.Finish()
+
+	s = sentry.StartSpan(ctx, "chunk.write")
+	s.Description = "Write chunk to GCS"
+	err = env.compressedWrite(ctx, c.StoragePath(), c)
+	s.Finish()
+	return err
+}
+
+// compressedWrite writes v to the bucket, retrying transient errors.
+func (env *environment) compressedWrite(ctx context.Context, objectName string, v interface{}) error {
+	return retry(ctx, storageWriteAttempts, storageWriteBackoff, func() error {
+		return storageutil.CompressedWrite(ctx, env.storage, objectName, v)
+	})
+}
+
+// retry calls f until it succeeds, fails with an error which isn't transient
+// or was called attempts times. It waits backoff after the first failure and
+// twice as long after each following one.
+func retry(ctx context.Context, attempts int, backoff time.Duration, f func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= attempts || !isTransient(err) {
+			return err
+		}
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		backoff *= 2
+	}
+}
+
+// isTransient returns true when err may not happen again, like a timeout or
+// the storage being unavailable. Errors which don't come from the storage,
+// like failing to encode the object, are never transient.
+func isTransient(err error) bool {
+	switch gcerrors.Code(err) {
+	case gcerrors.DeadlineExceeded,
+		gcerrors.Internal,
+		gcerrors.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+// isAlreadyStored returns true when err comes from writing an object which
+// already exists, like when Kafka redelivers a message or a client posts the
+// same profile twice.
+func isAlreadyStored(err error) bool {
+	return errors.Is(err, storageutil.ErrObjectExists)
+}
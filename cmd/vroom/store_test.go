@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/driver"
+	"gocloud.dev/gcerrors"
+
+	"github.com/getsentry/vroom/internal/storageutil"
+)
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{
+			name:      "transient error",
+			errs:      []error{context.DeadlineExceeded, context.DeadlineExceeded, nil},
+			wantCalls: 3,
+		},
+		{
+			name:      "attempts exhausted",
+			errs:      []error{context.DeadlineExceeded, context.DeadlineExceeded, context.DeadlineExceeded},
+			wantCalls: 3,
+			wantErr:   context.DeadlineExceeded,
+		},
+		{
+			name:      "already stored",
+			errs:      []error{storageutil.ErrObjectExists, nil},
+			wantCalls: 1,
+			wantErr:   storageutil.ErrObjectExists,
+		},
+		{
+			name:      "not a storage error",
+			errs:      []error{errMarshal, nil},
+			wantCalls: 1,
+			wantErr:   errMarshal,
+		},
+		{
+			name:      "not transient",
+			errs:      []error{context.Canceled, nil},
+			wantCalls: 1,
+			wantErr:   context.Canceled,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls := 0
+			err := retry(context.Background(), 3, time.Millisecond, func() error {
+				err := test.errs[calls]
+				calls++
+				return err
+			})
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("expected %v, got %v", test.wantErr, err)
+			}
+			if calls != test.wantCalls {
+				t.Fatalf("expected %d calls, got %d", test.wantCalls, calls)
+			}
+		})
+	}
+}
+
+var (
+	errMarshal       = errors.New("couldn't marshal the profile")
+	errObjectExists  = errors.New("object already exists")
+	errObjectMissing = errors.New("object doesn't exist")
+)
+
+// preconditionBucket is an in-memory bucket refusing to overwrite an object,
+// like GCS does with the precondition set by storageutil.CompressedWrite.
+// Only writing and checking the existence of objects is supported.
+type preconditionBucket struct {
+	driver.Bucket
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newPreconditionBucket() *blob.Bucket {
+	return blob.NewBucket(&preconditionBucket{objects: make(map[string][]byte)})
+}
+
+func (b *preconditionBucket) NewTypedWriter(
+	_ context.Context,
+	key, _ string,
+	_ *driver.WriterOptions,
+) (driver.Writer, error) {
+	return &preconditionWriter{bucket: b, key: key}, nil
+}
+
+func (b *preconditionBucket) Attributes(_ context.Context, key string) (*driver.Attributes, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	o, ok := b.objects[key]
+	if !ok {
+		return nil, errObjectMissing
+	}
+	return &driver.Attributes{Size: int64(len(o))}, nil
+}
+
+func (b *preconditionBucket) ErrorCode(err error) gcerrors.ErrorCode {
+	switch {
+	case errors.Is(err, errObjectExists):
+		return gcerrors.FailedPrecondition
+	case errors.Is(err, errObjectMissing):
+		return gcerrors.NotFound
+	}
+	return gcerrors.Unknown
+}
+
+func (b *preconditionBucket) As(_ interface{}) bool {
+	return false
+}
+
+func (b *preconditionBucket) ErrorAs(_ error, _ interface{}) bool {
+	return false
+}
+
+func (b *preconditionBucket) Close() error {
+	return nil
+}
+
+type preconditionWriter struct {
+	bucket *preconditionBucket
+	key    string
+	buf    bytes.Buffer
+}
+
+func (w *preconditionWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *preconditionWriter) Close() error {
+	w.bucket.mu.Lock()
+	defer w.bucket.mu.Unlock()
+	if _, ok := w.bucket.objects[w.key]; ok {
+		return errObjectExists
+	}
+	w.bucket.objects[w.key] = w.buf.Bytes()
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+
+	"github.com/getsentry/sentry-go"
+
+	"github.com/getsentry/vroom/internal/frame"
+)
+
+// symbolicateJavaScript resolves the minified frames of a browser or Node
+// profile or chunk with the source maps of its release, when enabled.
+// Profiles and chunks are still stored if it fails.
+func (env *environment) symbolicateJavaScript(
+	ctx context.Context,
+	hub *sentry.Hub,
+	organizationID uint64,
+	projectID uint64,
+	release string,
+	symbolicate func(func(*frame.Frame) error) error,
+) {
+	if env.sourceMaps == nil {
+		return
+	}
+
+	s := sentry.StartSpan(ctx, "processing")
+	s.Description = "Symbolicate JavaScript frames"
+	defer s.Finish()
+
+	symbolicator := env.sourceMaps.Symbolicator(ctx, organizationID, projectID, release)
+	err := symbolicate(symbolicator.Symbolicate)
+	if err != nil && hub != nil {
+		hub.CaptureException(err)
+	}
+}
@@ -16,6 +16,28 @@ import (
 )
 
 func createKafkaRoundTripper(e ServiceConfig) kafka.RoundTripper {
+	saslMechanism, tlsConfig := createKafkaSecurityConfig(e)
+	return &kafka.Transport{
+		SASL: saslMechanism,
+		TLS:  tlsConfig,
+		Dial: (&net.Dialer{
+			Timeout:   3 * time.Second,
+			DualStack: true,
+		}).DialContext,
+	}
+}
+
+func createKafkaDialer(e ServiceConfig) *kafka.Dialer {
+	saslMechanism, tlsConfig := createKafkaSecurityConfig(e)
+	return &kafka.Dialer{
+		SASLMechanism: saslMechanism,
+		TLS:           tlsConfig,
+		Timeout:       3 * time.Second,
+		DualStack:     true,
+	}
+}
+
+func createKafkaSecurityConfig(e ServiceConfig) (sasl.Mechanism, *tls.Config) {
 	var saslMechanism sasl.Mechanism
 	var tlsConfig *tls.Config
 
@@ -29,7 +51,7 @@ func createKafkaRoundTripper(e ServiceConfig) kafka.RoundTripper {
 		mechanism, err := scram.Mechanism(scram.SHA256, e.KafkaSaslUsername, e.KafkaSaslPassword)
 		if err != nil {
 			log.Fatal("unable to create scram-sha-256 mechanism", err)
-			return nil
+			return nil, nil
 		}
 
 		saslMechanism = mechanism
@@ -37,7 +59,7 @@ func createKafkaRoundTripper(e ServiceConfig) kafka.RoundTripper {
 		mechanism, err := scram.Mechanism(scram.SHA512, e.KafkaSaslUsername, e.KafkaSaslPassword)
 		if err != nil {
 			log.Fatal("unable to create scram-sha-512 mechanism", err)
-			return nil
+			return nil, nil
 		}
 
 		saslMechanism = mechanism
@@ -47,7 +69,7 @@ func createKafkaRoundTripper(e ServiceConfig) kafka.RoundTripper {
 		certs, err := tls.LoadX509KeyPair(e.KafkaSslCertPath, e.KafkaSslKeyPath)
 		if err != nil {
 			log.Fatal("unable to load certificate key pair", err)
-			return nil
+			return nil, nil
 		}
 
 		caCertificatePool, err := x509.SystemCertPool()
@@ -58,12 +80,12 @@ func createKafkaRoundTripper(e ServiceConfig) kafka.RoundTripper {
 			caFile, err := os.ReadFile(e.KafkaSslCaPath)
 			if err != nil {
 				log.Fatal("unable to read ca file", err)
-				return nil
+				return nil, nil
 			}
 
 			if ok := caCertificatePool.AppendCertsFromPEM(caFile); !ok {
 				log.Fatal("unable to append ca certificate to pool")
-				return nil
+				return nil, nil
 			}
 		}
 
@@ -73,12 +95,5 @@ func createKafkaRoundTripper(e ServiceConfig) kafka.RoundTripper {
 		}
 	}
 
-	return &kafka.Transport{
-		SASL: saslMechanism,
-		TLS:  tlsConfig,
-		Dial: (&net.Dialer{
-			Timeout:   3 * time.Second,
-			DualStack: true,
-		}).DialContext,
-	}
+	return saslMechanism, tlsConfig
 }
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/getsentry/vroom/internal/chrometrace"
+	"github.com/getsentry/vroom/internal/chunk"
+	"github.com/getsentry/vroom/internal/examples"
+	"github.com/getsentry/vroom/internal/firefox"
+	"github.com/getsentry/vroom/internal/folded"
+	"github.com/getsentry/vroom/internal/importer"
+	"github.com/getsentry/vroom/internal/metrics"
+	"github.com/getsentry/vroom/internal/nodetree"
+	"github.com/getsentry/vroom/internal/occurrence"
+	"github.com/getsentry/vroom/internal/platform"
+	"github.com/getsentry/vroom/internal/speedscope"
+)
+
+func runInfo(args []string) error {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	in, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	callTrees, err := in.callTrees()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if c := in.chunk; c != nil {
+		fmt.Fprintf(tw, "type:\tcontinuous profile chunk\n")
+		fmt.Fprintf(tw, "chunk_id:\t%s\n", c.GetID())
+		fmt.Fprintf(tw, "profiler_id:\t%s\n", c.GetProfilerID())
+		fmt.Fprintf(tw, "organization_id:\t%d\n", c.GetOrganizationID())
+		fmt.Fprintf(tw, "project_id:\t%d\n", c.GetProjectID())
+		fmt.Fprintf(tw, "platform:\t%s\n", c.GetPlatform())
+		fmt.Fprintf(tw, "release:\t%s\n", c.GetRelease())
+		fmt.Fprintf(tw, "environment:\t%s\n", c.GetEnvironment())
+		fmt.Fprintf(tw, "sdk:\t%s %s\n", c.SDKName(), c.SDKVersion())
+		fmt.Fprintf(tw, "start:\t%s\n", epochToTime(c.StartTimestamp()).Format(time.RFC3339Nano))
+		fmt.Fprintf(tw, "end:\t%s\n", epochToTime(c.EndTimestamp()).Format(time.RFC3339Nano))
+		fmt.Fprintf(tw, "duration:\t%s\n", time.Duration(c.DurationMS())*time.Millisecond)
+	} else {
+		p := in.profile
+		t := p.Transaction()
+		fmt.Fprintf(tw, "type:\ttransaction profile\n")
+		fmt.Fprintf(tw, "profile_id:\t%s\n", p.ID())
+		fmt.Fprintf(tw, "organization_id:\t%d\n", p.OrganizationID())
+		fmt.Fprintf(tw, "project_id:\t%d\n", p.ProjectID())
+		fmt.Fprintf(tw, "platform:\t%s\n", p.Platform())
+		fmt.Fprintf(tw, "release:\t%s\n", p.Release())
+		fmt.Fprintf(tw, "environment:\t%s\n", p.Environment())
+		fmt.Fprintf(tw, "transaction:\t%s (%s)\n", t.Name, t.ID)
+		fmt.Fprintf(tw, "timestamp:\t%s\n", p.Timestamp().Format(time.RFC3339Nano))
+		fmt.Fprintf(tw, "duration:\t%s\n", time.Duration(p.DurationNS()))
+		fmt.Fprintf(tw, "sample format:\t%t\n", p.IsSampleFormat())
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "THREAD\tCALL TREES\tSAMPLES\tDURATION\t")
+	mainThreadID := in.mainThreadID()
+	for _, tid := range sortedThreadIDs(callTrees) {
+		var samples int
+		var durationNS uint64
+		for _, root := range callTrees[tid] {
+			samples += root.SampleCount
+			durationNS += root.DurationNS
+		}
+		name := tid
+		if tid == mainThreadID {
+			name += " (main)"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t\n", name, len(callTrees[tid]), samples, time.Duration(durationNS))
+	}
+	return tw.Flush()
+}
+
+func runConvert(args []string) (err error) {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	format := fs.String("format", "speedscope", "output format: speedscope, chrome, firefox, folded or sample")
+	weight := fs.String("weight", "samples", "weight of folded stacks: samples or duration")
+	output := fs.String("o", "", "path of the output file, stdout if empty")
+	in, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	w, closeOutput, err := createOutput(*output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := closeOutput(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	switch *format {
+	case "speedscope", "chrome", "firefox":
+		o, err := in.speedscope()
+		if err != nil {
+			return err
+		}
+		switch *format {
+		case "chrome":
+			return json.NewEncoder(w).Encode(chrometrace.FromSpeedscope(o))
+		case "firefox":
+			return json.NewEncoder(w).Encode(firefox.FromSpeedscope(o))
+		}
+		return json.NewEncoder(w).Encode(o)
+	case "folded":
+		callTrees, err := in.callTrees()
+		if err != nil {
+			return err
+		}
+		fw := folded.WeightSampleCount
+		if *weight == "duration" {
+			fw = folded.WeightDuration
+		}
+		return folded.WriteCallTrees(w, callTrees, fw)
+	case "sample":
+		if in.chunk != nil {
+			if _, ok := in.chunk.Chunk().(*chunk.SampleChunk); !ok {
+				return fmt.Errorf("android chunks have no sample format")
+			}
+			return json.NewEncoder(w).Encode(in.chunk)
+		}
+		if !in.profile.IsSampleFormat() {
+			return fmt.Errorf("profile isn't in the sample format")
+		}
+		return json.NewEncoder(w).Encode(in.profile)
+	default:
+		return fmt.Errorf("unknown format: %s", *format)
+	}
+}
+
+// speedscope converts the input to the speedscope format, a chunk covering
+// its whole duration.
+func (in input) speedscope() (speedscope.Output, error) {
+	if in.chunk == nil {
+		return in.profile.Speedscope()
+	}
+	switch c := in.chunk.Chunk().(type) {
+	case *chunk.SampleChunk:
+		return c.Speedscope()
+	case *chunk.AndroidChunk:
+		return chunk.SpeedscopeFromAndroidChunks(
+			[]chunk.AndroidChunk{*c},
+			uint64(c.StartTimestamp()*1e9),
+			uint64(c.EndTimestamp()*1e9),
+		)
+	default:
+		return speedscope.Output{}, fmt.Errorf("unknown chunk type")
+	}
+}
+
+// runImport converts a profile recorded without a Sentry SDK to a sample
+// chunk.
+func runImport(args []string) (err error) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", "pprof", "input format: pprof, perf, cpuprofile or folded")
+	platformName := fs.String("platform", "", "platform of the chunk")
+	interval := fs.Duration("interval", importer.DefaultSampleInterval, "duration of a sample for profiles counting samples")
+	output := fs.String("o", "", "path of the output file, stdout if empty")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: vroomctl %s [flags] <file>\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected a single file")
+	}
+	if err := importer.Format(*format).Validate(); err != nil {
+		return err
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	c, err := importer.Import(importer.Format(*format), f, importer.Options{
+		Platform:       platform.Platform(*platformName),
+		SampleInterval: *interval,
+	})
+	if err != nil {
+		return err
+	}
+	c.ID = strings.ReplaceAll(uuid.New().String(), "-", "")
+	c.ProfilerID = strings.ReplaceAll(uuid.New().String(), "-", "")
+	c.Normalize()
+
+	w, closeOutput, err := createOutput(*output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := closeOutput(); err == nil {
+			err = closeErr
+		}
+	}()
+	return json.NewEncoder(w).Encode(c)
+}
+
+// createOutput creates the output file at path, stdout when path is empty.
+// The returned function closes it, its error tells if the file was written.
+func createOutput(path string) (io.Writer, func() error, error) {
+	if path == "" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.Close, nil
+}
+
+func runCallTree(args []string) error {
+	fs := flag.NewFlagSet("calltree", flag.ExitOnError)
+	threadID := fs.String("thread", "", "only print the call trees of this thread")
+	maxDepth := fs.Int("max-depth", 0, "only print frames up to this depth, 0 for no limit")
+	in, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	callTrees, err := in.callTrees()
+	if err != nil {
+		return err
+	}
+	for _, tid := range sortedThreadIDs(callTrees) {
+		if *threadID != "" && tid != *threadID {
+			continue
+		}
+		fmt.Printf("thread %s\n", tid)
+		for _, root := range callTrees[tid] {
+			printNode(os.Stdout, root, 1, *maxDepth)
+		}
+	}
+	return nil
+}
+
+func printNode(w io.Writer, n *nodetree.Node, depth, maxDepth int) {
+	name := n.Name
+	if name == "" {
+		name = "unknown"
+	}
+	if n.Package != "" {
+		name = fmt.Sprintf("%s [%s]", name, n.Package)
+	}
+	fmt.Fprintf(
+		w,
+		"%s%s %s (self %s, %d samples)\n",
+		strings.Repeat("  ", depth),
+		name,
+		time.Duration(n.DurationNS),
+		time.Duration(n.SelfTimeNS),
+		n.SampleCount,
+	)
+	if maxDepth > 0 && depth >= maxDepth {
+		return
+	}
+	for _, c := range n.Children {
+		printNode(w, c, depth+1, maxDepth)
+	}
+}
+
+func runFunctions(args []string) error {
+	fs := flag.NewFlagSet("functions", flag.ExitOnError)
+	limit := fs.Uint("limit", 100, "maximum number of functions to print")
+	minDepth := fs.Uint("min-depth", 0, "minimum depth of a frame to be aggregated")
+	system := fs.Bool("system", false, "include system functions")
+	asJSON := fs.Bool("json", false, "print the metrics as JSON")
+	in, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	callTrees, err := in.callTrees()
+	if err != nil {
+		return err
+	}
+
+	var example examples.ExampleMetadata
+	if c := in.chunk; c != nil {
+		example = examples.NewExampleFromProfilerChunk(
+			c.GetProjectID(),
+			c.GetProfilerID(),
+			c.GetID(),
+			"",
+			nil,
+			uint64(c.StartTimestamp()*1e9),
+			uint64(c.EndTimestamp()*1e9),
+		)
+	} else {
+		start, end := in.profile.StartAndEndEpoch()
+		example = examples.NewExampleFromProfileID(in.profile.ProjectID(), in.profile.ID(), start, end)
+	}
+
+	ma := metrics.NewAggregator(*limit, 1, *minDepth)
+	functions := metrics.CapAndFilterFunctions(
+		metrics.ExtractFunctionsFromCallTrees(callTrees, *minDepth),
+		int(*limit),
+		!*system,
+	)
+	ma.AddFunctions(functions, example)
+	fm := ma.ToMetrics()
+
+	if *asJSON {
+		return json.NewEncoder(os.Stdout).Encode(fm)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FINGERPRINT\tFUNCTION\tPACKAGE\tIN APP\tCOUNT\tP75\tP95\tP99\tSUM\tSELF\t")
+	for _, f := range fm {
+		fmt.Fprintf(
+			tw,
+			"%d\t%s\t%s\t%t\t%d\t%s\t%s\t%s\t%s\t%s\t\n",
+			f.Fingerprint,
+			f.Name,
+			f.Package,
+			f.InApp,
+			f.Count,
+			time.Duration(f.P75),
+			time.Duration(f.P95),
+			time.Duration(f.P99),
+			time.Duration(f.Sum),
+			time.Duration(f.SumSelfTime),
+		)
+	}
+	return tw.Flush()
+}
+
+func runDetect(args []string) error {
+	fs := flag.NewFlagSet("detect", flag.ExitOnError)
+	rules := fs.String("rules", "", "path to a detection rules file replacing the default rules")
+	asJSON := fs.Bool("json", false, "print the occurrences as JSON")
+	in, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	detectionRules := occurrence.DefaultDetectionRules()
+	if *rules != "" {
+		detectionRules, err = occurrence.LoadDetectionRules(*rules)
+		if err != nil {
+			return err
+		}
+	}
+
+	var occurrences []*occurrence.Occurrence
+	if in.chunk != nil {
+		callTrees, err := in.chunk.CallTrees(nil)
+		if err != nil {
+			return err
+		}
+		occurrences, err = occurrence.FindInChunk(*in.chunk, callTrees, detectionRules)
+		if err != nil {
+			return err
+		}
+	} else {
+		callTrees, err := in.profile.CallTrees()
+		if err != nil {
+			return err
+		}
+		occurrences = occurrence.Find(*in.profile, callTrees, detectionRules)
+	}
+
+	if *asJSON {
+		return json.NewEncoder(os.Stdout).Encode(occurrences)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ISSUE\tCULPRIT\tSUBTITLE\tDURATION\t")
+	for _, o := range occurrences {
+		var d time.Duration
+		if ns, ok := o.EvidenceData["frame_duration_ns"].(uint64); ok {
+			d = time.Duration(ns)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t\n", o.IssueTitle, o.Culprit, o.Subtitle, d)
+	}
+	return tw.Flush()
+}
+
+func epochToTime(ts float64) time.Time {
+	return time.Unix(0, int64(ts*1e9)).UTC()
+}
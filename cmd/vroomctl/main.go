@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/pierrec/lz4/v4"
+
+	"github.com/getsentry/vroom/internal/chunk"
+	"github.com/getsentry/vroom/internal/nodetree"
+	"github.com/getsentry/vroom/internal/profile"
+)
+
+type (
+	command struct {
+		description string
+		run         func(args []string) error
+	}
+
+	// input is either a transaction profile or a continuous profile chunk.
+	input struct {
+		profile *profile.Profile
+		chunk   *chunk.Chunk
+	}
+
+	// inputKind is used to tell chunks apart from transaction profiles, only
+	// chunks have a chunk ID.
+	inputKind struct {
+		ChunkID string `json:"chunk_id"`
+	}
+)
+
+// lz4Magic starts every lz4 frame, like the objects stored in the bucket.
+var lz4Magic = []byte{0x04, 0x22, 0x4d, 0x18}
+
+var commands = map[string]command{
+	"info":      {description: "print metadata and threads", run: runInfo},
+	"convert":   {description: "convert to speedscope, chrome, firefox, folded or sample format", run: runConvert},
+	"calltree":  {description: "print call trees with durations", run: runCallTree},
+	"functions": {description: "print the slowest functions", run: runFunctions},
+	"detect":    {description: "run issue detection", run: runDetect},
+	"import":    {description: "import pprof, perf, cpuprofile or folded stacks as a chunk", run: runImport},
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	c, exists := commands[os.Args[1]]
+	if !exists {
+		usage()
+		os.Exit(2)
+	}
+	if err := c.run(os.Args[2:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(os.Stderr, "usage: vroomctl <command> [flags] <file>")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].description)
+	}
+}
+
+// parseArgs parses the flags of a command and reads the file passed as its
+// only argument.
+func parseArgs(fs *flag.FlagSet, args []string) (input, error) {
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: vroomctl %s [flags] <file>\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return input{}, err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return input{}, errors.New("expected a single file")
+	}
+	return readFile(fs.Arg(0))
+}
+
+func readFile(path string) (input, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return input{}, err
+	}
+	return decode(b)
+}
+
+// decode decodes a profile or a chunk, either raw JSON or lz4 compressed.
+func decode(b []byte) (input, error) {
+	if bytes.HasPrefix(b, lz4Magic) {
+		d, err := io.ReadAll(lz4.NewReader(bytes.NewReader(b)))
+		if err != nil {
+			return input{}, err
+		}
+		b = d
+	}
+	var k inputKind
+	err := json.Unmarshal(b, &k)
+	if err != nil {
+		return input{}, err
+	}
+	if k.ChunkID != "" {
+		var c chunk.Chunk
+		err = json.Unmarshal(b, &c)
+		if err != nil {
+			return input{}, err
+		}
+		return input{chunk: &c}, nil
+	}
+	var p profile.Profile
+	err = json.Unmarshal(b, &p)
+	if err != nil {
+		return input{}, err
+	}
+	return input{profile: &p}, nil
+}
+
+// callTrees returns the call trees of the input by thread ID.
+func (in input) callTrees() (map[string][]*nodetree.Node, error) {
+	if in.chunk != nil {
+		return in.chunk.CallTrees(nil)
+	}
+	callTrees, err := in.profile.CallTrees()
+	if err != nil {
+		return nil, err
+	}
+	byThread := make(map[string][]*nodetree.Node, len(callTrees))
+	for tid, callTree := range callTrees {
+		byThread[strconv.FormatUint(tid, 10)] = callTree
+	}
+	return byThread, nil
+}
+
+// mainThreadID returns the ID of the thread the profile is focused on.
+func (in input) mainThreadID() string {
+	if in.chunk != nil {
+		return in.chunk.MainThreadID()
+	}
+	return strconv.FormatUint(in.profile.Transaction().ActiveThreadID, 10)
+}
+
+func sortedThreadIDs(callTrees map[string][]*nodetree.Node) []string {
+	threadIDs := make([]string, 0, len(callTrees))
+	for tid := range callTrees {
+		threadIDs = append(threadIDs, tid)
+	}
+	sort.Strings(threadIDs)
+	return threadIDs
+}
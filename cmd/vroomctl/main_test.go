@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/pierrec/lz4/v4"
+)
+
+func TestDecode(t *testing.T) {
+	raw, err := os.ReadFile("../../test/data/node.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var compressed bytes.Buffer
+	zw := lz4.NewWriter(&compressed)
+	if _, err := zw.Write(raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{name: "raw JSON", input: raw},
+		{name: "lz4", input: compressed.Bytes()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			in, err := decode(test.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if in.profile == nil || in.chunk != nil {
+				t.Fatal("expected a transaction profile")
+			}
+			if id := in.profile.ID(); id != "18bc5f6674d9432a8d30daf22a0c16bc" {
+				t.Fatalf("unexpected profile ID: %s", id)
+			}
+			callTrees, err := in.callTrees()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(callTrees["0"]) != 1 {
+				t.Fatalf("expected 1 call tree on the main thread, got %d", len(callTrees["0"]))
+			}
+		})
+	}
+}
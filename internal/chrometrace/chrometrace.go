@@ -0,0 +1,186 @@
+// Package chrometrace converts profiles to the Chrome Trace Event format,
+// opened by Perfetto and chrome://tracing.
+package chrometrace
+
+import (
+	"strconv"
+
+	"github.com/getsentry/vroom/internal/speedscope"
+)
+
+// ContentType is the content type of a trace.
+const ContentType = "application/json"
+
+const (
+	phaseBegin    = "B"
+	phaseEnd      = "E"
+	phaseComplete = "X"
+	phaseMetadata = "M"
+
+	// profilePID is the process holding the threads of the profile and
+	// queuesPID the one holding a track of queues for each thread.
+	profilePID = 1
+	queuesPID  = 2
+
+	categoryQueue = "queue"
+)
+
+type (
+	// Trace is a trace in the JSON object format.
+	Trace struct {
+		TraceEvents     []Event           `json:"traceEvents"`
+		DisplayTimeUnit string            `json:"displayTimeUnit"`
+		Metadata        map[string]string `json:"metadata,omitempty"`
+	}
+
+	// Event is a trace event. Timestamps and durations are in microseconds.
+	Event struct {
+		Name     string                 `json:"name"`
+		Category string                 `json:"cat,omitempty"`
+		Phase    string                 `json:"ph"`
+		TS       float64                `json:"ts"`
+		Duration float64                `json:"dur,omitempty"`
+		PID      int                    `json:"pid"`
+		TID      uint64                 `json:"tid"`
+		Args     map[string]interface{} `json:"args,omitempty"`
+	}
+)
+
+// FromSpeedscope converts a profile to a trace. Each thread is a track with
+// begin and end events for each frame, named after the thread metadata.
+// Queues served by a thread are complete events on a track of their own.
+func FromSpeedscope(o speedscope.Output) Trace {
+	t := Trace{
+		TraceEvents:     []Event{},
+		DisplayTimeUnit: "ns",
+		Metadata: map[string]string{
+			"platform":   string(o.Platform),
+			"profile_id": o.ProfileID,
+			"chunk_id":   o.ChunkID,
+		},
+	}
+	t.metadata(profilePID, 0, "process_name", processName(o))
+
+	var hasQueues bool
+	for i, track := range o.Tracks() {
+		t.metadata(profilePID, track.ThreadID, "thread_name", threadName(track))
+		t.TraceEvents = append(t.TraceEvents, Event{
+			Name:  "thread_sort_index",
+			Phase: phaseMetadata,
+			PID:   profilePID,
+			TID:   track.ThreadID,
+			Args:  map[string]interface{}{"sort_index": i},
+		})
+		t.addStacks(o.Shared.Frames, track)
+
+		if len(track.Queues) == 0 {
+			continue
+		}
+		if !hasQueues {
+			t.metadata(queuesPID, 0, "process_name", "Queues")
+			hasQueues = true
+		}
+		t.metadata(queuesPID, track.ThreadID, "thread_name", threadName(track))
+		for _, q := range track.Queues {
+			t.TraceEvents = append(t.TraceEvents, Event{
+				Name:     q.Label,
+				Category: categoryQueue,
+				Phase:    phaseComplete,
+				TS:       microseconds(q.StartNS),
+				Duration: microseconds(q.EndNS - q.StartNS),
+				PID:      queuesPID,
+				TID:      track.ThreadID,
+			})
+		}
+	}
+	return t
+}
+
+// addStacks adds events for the frames starting and ending between
+// consecutive samples. Frames still running at the end are closed with the
+// last sample.
+func (t *Trace) addStacks(frames []speedscope.Frame, track speedscope.Track) {
+	var current []int
+	var end uint64
+	for _, s := range track.Samples {
+		// Frames aren't closed between contiguous samples with a common
+		// prefix.
+		common := 0
+		if s.StartNS == end {
+			for common < len(current) && common < len(s.Stack) && current[common] == s.Stack[common] {
+				common++
+			}
+		}
+		t.closeFrames(frames, track.ThreadID, current[common:], end)
+		for _, f := range s.Stack[common:] {
+			t.TraceEvents = append(t.TraceEvents, frameEvent(frames, f, phaseBegin, track.ThreadID, s.StartNS))
+		}
+		current = s.Stack
+		end = s.StartNS + s.DurationNS
+	}
+	t.closeFrames(frames, track.ThreadID, current, end)
+}
+
+// closeFrames adds end events for frames, the leaf frame first.
+func (t *Trace) closeFrames(frames []speedscope.Frame, threadID uint64, stack []int, ts uint64) {
+	for i := len(stack) - 1; i >= 0; i-- {
+		t.TraceEvents = append(t.TraceEvents, frameEvent(frames, stack[i], phaseEnd, threadID, ts))
+	}
+}
+
+func (t *Trace) metadata(pid int, tid uint64, name, value string) {
+	t.TraceEvents = append(t.TraceEvents, Event{
+		Name:  name,
+		Phase: phaseMetadata,
+		PID:   pid,
+		TID:   tid,
+		Args:  map[string]interface{}{"name": value},
+	})
+}
+
+func frameEvent(frames []speedscope.Frame, i int, phase string, threadID uint64, ts uint64) Event {
+	e := Event{
+		Phase: phase,
+		TS:    microseconds(ts),
+		PID:   profilePID,
+		TID:   threadID,
+	}
+	if i < 0 || i >= len(frames) {
+		e.Name = "unknown"
+		return e
+	}
+	f := frames[i]
+	e.Name = f.Name
+	e.Category = f.Image
+	if phase == phaseBegin {
+		e.Args = map[string]interface{}{"is_application": f.IsApplication}
+		if f.File != "" {
+			e.Args["file"] = f.File
+		}
+		if f.Line != 0 {
+			e.Args["line"] = f.Line
+		}
+	}
+	return e
+}
+
+func processName(o speedscope.Output) string {
+	if o.TransactionName != "" {
+		return o.TransactionName
+	}
+	return string(o.Platform)
+}
+
+func threadName(track speedscope.Track) string {
+	if track.Name != "" {
+		return track.Name
+	}
+	if track.IsMainThread {
+		return "main"
+	}
+	return strconv.FormatUint(track.ThreadID, 10)
+}
+
+func microseconds(ns uint64) float64 {
+	return float64(ns) / 1e3
+}
@@ -0,0 +1,82 @@
+package chrometrace
+
+import (
+	"testing"
+
+	"github.com/getsentry/vroom/internal/platform"
+	"github.com/getsentry/vroom/internal/speedscope"
+	"github.com/getsentry/vroom/internal/testutil"
+)
+
+func TestFromSpeedscope(t *testing.T) {
+	o := speedscope.Output{
+		Platform:  platform.Cocoa,
+		ProfileID: "profile",
+		Shared: speedscope.SharedData{
+			Frames: []speedscope.Frame{
+				{Name: "main", Image: "app", IsApplication: true, File: "main.swift", Line: 3},
+				{Name: "a", Image: "lib"},
+				{Name: "b", Image: "lib"},
+			},
+		},
+		Profiles: []interface{}{
+			&speedscope.SampledProfile{
+				ThreadID:     1,
+				IsMainThread: true,
+				Samples:      [][]int{{0, 1}, {0, 2}, {0}},
+				Weights:      []uint64{1000, 1000, 0},
+				Queues: map[string]speedscope.Queue{
+					"0x1": {Label: "com.apple.main-thread", StartNS: 0, EndNS: 2000},
+				},
+			},
+			&speedscope.SampledProfile{
+				ThreadID: 2,
+				Name:     "worker",
+				Samples:  [][]int{{1}},
+				Weights:  []uint64{500},
+			},
+		},
+	}
+
+	want := Trace{
+		DisplayTimeUnit: "ns",
+		Metadata: map[string]string{
+			"platform":   "cocoa",
+			"profile_id": "profile",
+			"chunk_id":   "",
+		},
+		TraceEvents: []Event{
+			{Name: "process_name", Phase: "M", PID: 1, Args: map[string]interface{}{"name": "cocoa"}},
+			{Name: "thread_name", Phase: "M", PID: 1, TID: 1, Args: map[string]interface{}{"name": "main"}},
+			{Name: "thread_sort_index", Phase: "M", PID: 1, TID: 1, Args: map[string]interface{}{"sort_index": 0}},
+			{
+				Name:     "main",
+				Category: "app",
+				Phase:    "B",
+				PID:      1,
+				TID:      1,
+				Args: map[string]interface{}{
+					"is_application": true,
+					"file":           "main.swift",
+					"line":           uint32(3),
+				},
+			},
+			{Name: "a", Category: "lib", Phase: "B", PID: 1, TID: 1, Args: map[string]interface{}{"is_application": false}},
+			{Name: "a", Category: "lib", Phase: "E", TS: 1, PID: 1, TID: 1},
+			{Name: "b", Category: "lib", Phase: "B", TS: 1, PID: 1, TID: 1, Args: map[string]interface{}{"is_application": false}},
+			{Name: "b", Category: "lib", Phase: "E", TS: 2, PID: 1, TID: 1},
+			{Name: "main", Category: "app", Phase: "E", TS: 2, PID: 1, TID: 1},
+			{Name: "process_name", Phase: "M", PID: 2, Args: map[string]interface{}{"name": "Queues"}},
+			{Name: "thread_name", Phase: "M", PID: 2, TID: 1, Args: map[string]interface{}{"name": "main"}},
+			{Name: "com.apple.main-thread", Category: "queue", Phase: "X", Duration: 2, PID: 2, TID: 1},
+			{Name: "thread_name", Phase: "M", PID: 1, TID: 2, Args: map[string]interface{}{"name": "worker"}},
+			{Name: "thread_sort_index", Phase: "M", PID: 1, TID: 2, Args: map[string]interface{}{"sort_index": 1}},
+			{Name: "a", Category: "lib", Phase: "B", PID: 1, TID: 2, Args: map[string]interface{}{"is_application": false}},
+			{Name: "a", Category: "lib", Phase: "E", TS: 0.5, PID: 1, TID: 2},
+		},
+	}
+
+	if diff := testutil.Diff(FromSpeedscope(o), want); diff != "" {
+		t.Fatalf("Result mismatch: got - want +\n%s", diff)
+	}
+}
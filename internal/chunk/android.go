@@ -8,10 +8,12 @@ import (
 	"github.com/getsentry/vroom/internal/clientsdk"
 	"github.com/getsentry/vroom/internal/debugmeta"
 	"github.com/getsentry/vroom/internal/frame"
+	"github.com/getsentry/vroom/internal/measurements"
 	"github.com/getsentry/vroom/internal/nodetree"
 	"github.com/getsentry/vroom/internal/options"
 	"github.com/getsentry/vroom/internal/platform"
 	"github.com/getsentry/vroom/internal/profile"
+	"github.com/getsentry/vroom/internal/proguard"
 )
 
 type (
@@ -66,6 +68,12 @@ func (c AndroidChunk) CallTrees(_ *string) (map[string][]*nodetree.Node, error)
 	return stringThreadCallTrees, nil
 }
 
+// Validate does nothing since methods referenced by events but missing
+// from the list of methods are created when generating call trees.
+func (c AndroidChunk) Validate() error {
+	return nil
+}
+
 func (c AndroidChunk) SDKName() string {
 	return c.ClientSDK.Name
 }
@@ -78,6 +86,24 @@ func (c AndroidChunk) EndTimestamp() float64 {
 	return c.Timestamp + float64(c.DurationNS)*1e-9
 }
 
+func (c AndroidChunk) GetDebugMeta() debugmeta.DebugMeta {
+	return c.DebugMeta
+}
+
+func (c AndroidChunk) GetMeasurements() (map[string]measurements.MeasurementV2, error) {
+	return unmarshalMeasurements(c.Measurements)
+}
+
+// MainThreadID returns the ID of the thread named main, or an empty
+// string if there's none.
+func (c AndroidChunk) MainThreadID() string {
+	tid := c.Profile.ActiveThreadID()
+	if tid == 0 {
+		return ""
+	}
+	return strconv.FormatUint(tid, 10)
+}
+
 func (c AndroidChunk) GetEnvironment() string {
 	return c.Environment
 }
@@ -132,5 +158,15 @@ func (c AndroidChunk) GetFrameWithFingerprint(target uint32) (frame.Frame, error
 	return frame.Frame{}, frame.ErrFrameNotFound
 }
 
+// MappingID returns the ID of the ProGuard mapping of the chunk, if any.
+func (c AndroidChunk) MappingID() string {
+	return proguard.MappingID(c.BuildID, c.DebugMeta)
+}
+
+// Deobfuscate rewrites the methods of the chunk with a mapping.
+func (c *AndroidChunk) Deobfuscate(m *proguard.Mapping) {
+	c.Profile.Deobfuscate(m)
+}
+
 func (c *AndroidChunk) Normalize() {
 }
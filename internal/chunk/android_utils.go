@@ -2,6 +2,7 @@ package chunk
 
 import (
 	"encoding/json"
+	"slices"
 	"sort"
 	"time"
 
@@ -77,6 +78,7 @@ func SpeedscopeFromAndroidChunks(chunks []AndroidChunk, startTS, endTS uint64) (
 		events = append(events, event)
 		maxTsNS = max(maxTsNS, ts)
 	}
+	chunk.Profile.Threads = slices.Clone(chunk.Profile.Threads)
 	for _, thread := range chunk.Profile.Threads {
 		threadSet[thread.ID] = member
 	}
@@ -141,7 +143,7 @@ func SpeedscopeFromAndroidChunks(chunks []AndroidChunk, startTS, endTS uint64) (
 		// Update threads.
 		for _, thread := range c.Profile.Threads {
 			if _, ok := threadSet[thread.ID]; !ok {
-				chunk.Profile.Threads = append(c.Profile.Threads, thread)
+				chunk.Profile.Threads = append(chunk.Profile.Threads, thread)
 				threadSet[thread.ID] = member
 			}
 		}
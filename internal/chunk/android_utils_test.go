@@ -358,3 +358,57 @@ func TestSpeedscopeFromAndroidChunks(t *testing.T) {
 		})
 	}
 }
+
+func TestSpeedscopeFromAndroidChunksThreads(t *testing.T) {
+	newChunk := func(id string, timestamp float64, threads ...profile.AndroidThread) AndroidChunk {
+		var events []profile.AndroidEvent
+		for _, thread := range threads {
+			for i, action := range []profile.Action{profile.EnterAction, profile.ExitAction} {
+				events = append(events, profile.AndroidEvent{
+					Action:   action,
+					ThreadID: thread.ID,
+					MethodID: 1,
+					Time: profile.EventTime{
+						Monotonic: profile.EventMonotonic{
+							Wall: profile.Duration{Nanos: uint64(100 * (i + 1))},
+						},
+					},
+				})
+			}
+		}
+		return AndroidChunk{
+			Timestamp: timestamp,
+			ID:        id,
+			Platform:  platform.Android,
+			Profile: profile.Android{
+				Clock:   "Dual",
+				Events:  events,
+				Methods: []profile.AndroidMethod{{ClassName: "class1", ID: 1, Name: "method1", Signature: "()"}},
+				Threads: threads,
+			},
+		}
+	}
+	main := profile.AndroidThread{ID: 1, Name: "main"}
+	worker := profile.AndroidThread{ID: 2, Name: "worker"}
+	render := profile.AndroidThread{ID: 3, Name: "render"}
+	chunks := []AndroidChunk{
+		newChunk("1a009sd87", 0, main),
+		newChunk("ee3409d8", 1e-6, main, worker),
+		newChunk("8f2c01ab", 2e-6, render),
+	}
+
+	s, err := SpeedscopeFromAndroidChunks(chunks, 0, 6000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range s.Profiles {
+		names = append(names, p.(*speedscope.EventedProfile).Name)
+	}
+	if diff := testutil.Diff(names, []string{"main", "worker", "render"}); diff != "" {
+		t.Fatalf("Result mismatch: got - want +\n%s", diff)
+	}
+	if diff := testutil.Diff(chunks[1].Profile.Threads, []profile.AndroidThread{main, worker}); diff != "" {
+		t.Fatalf("expected the threads of the chunk to not be modified: got - want +\n%s", diff)
+	}
+}
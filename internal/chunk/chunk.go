@@ -4,14 +4,18 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/getsentry/vroom/internal/debugmeta"
 	"github.com/getsentry/vroom/internal/frame"
+	"github.com/getsentry/vroom/internal/measurements"
 	"github.com/getsentry/vroom/internal/nodetree"
 	"github.com/getsentry/vroom/internal/options"
 	"github.com/getsentry/vroom/internal/platform"
+	"github.com/getsentry/vroom/internal/proguard"
 )
 
 type (
 	chunkInterface interface {
+		GetDebugMeta() debugmeta.DebugMeta
 		GetEnvironment() string
 		GetID() string
 		GetOrganizationID() uint64
@@ -23,7 +27,9 @@ type (
 		GetRetentionDays() int
 		GetOptions() options.Options
 		GetFrameWithFingerprint(uint32) (frame.Frame, error)
+		GetMeasurements() (map[string]measurements.MeasurementV2, error)
 		CallTrees(activeThreadID *string) (map[string][]*nodetree.Node, error)
+		MainThreadID() string
 
 		DurationMS() uint64
 		EndTimestamp() float64
@@ -33,6 +39,7 @@ type (
 		StoragePath() string
 
 		Normalize()
+		Validate() error
 	}
 
 	Chunk struct {
@@ -87,6 +94,35 @@ func StoragePath(OrganizationID uint64, ProjectID uint64, ProfilerID string, ID
 	)
 }
 
+// MappingID returns the ID of the ProGuard mapping of an Android chunk, if
+// any.
+func (c Chunk) MappingID() string {
+	if ac, ok := c.chunk.(*AndroidChunk); ok {
+		return ac.MappingID()
+	}
+	return ""
+}
+
+// Deobfuscate rewrites the methods of an Android chunk with a mapping.
+func (c Chunk) Deobfuscate(m *proguard.Mapping) {
+	if ac, ok := c.chunk.(*AndroidChunk); ok {
+		ac.Deobfuscate(m)
+	}
+}
+
+// SymbolicateJavaScript calls symbolicate on the frames of a browser or Node
+// chunk needing a source map.
+func (c Chunk) SymbolicateJavaScript(symbolicate func(*frame.Frame) error) error {
+	if sc, ok := c.chunk.(*SampleChunk); ok {
+		return sc.SymbolicateJavaScript(symbolicate)
+	}
+	return nil
+}
+
+func (c Chunk) GetDebugMeta() debugmeta.DebugMeta {
+	return c.chunk.GetDebugMeta()
+}
+
 func (c Chunk) GetEnvironment() string {
 	return c.chunk.GetEnvironment()
 }
@@ -131,6 +167,14 @@ func (c Chunk) GetFrameWithFingerprint(f uint32) (frame.Frame, error) {
 	return c.chunk.GetFrameWithFingerprint(f)
 }
 
+func (c Chunk) GetMeasurements() (map[string]measurements.MeasurementV2, error) {
+	return c.chunk.GetMeasurements()
+}
+
+func (c Chunk) MainThreadID() string {
+	return c.chunk.MainThreadID()
+}
+
 func (c Chunk) CallTrees(activeThreadID *string) (map[string][]*nodetree.Node, error) {
 	return c.chunk.CallTrees(activeThreadID)
 }
@@ -157,3 +201,16 @@ func (c Chunk) StoragePath() string {
 func (c *Chunk) Normalize() {
 	c.chunk.Normalize()
 }
+
+func (c Chunk) Validate() error {
+	return c.chunk.Validate()
+}
+
+func unmarshalMeasurements(raw json.RawMessage) (map[string]measurements.MeasurementV2, error) {
+	m := make(map[string]measurements.MeasurementV2)
+	if len(raw) == 0 {
+		return m, nil
+	}
+	err := json.Unmarshal(raw, &m)
+	return m, err
+}
@@ -2,23 +2,33 @@ package chunk
 
 import (
 	"encoding/json"
-	"errors"
 	"hash/fnv"
 	"math"
+	"slices"
 	"sort"
+	"strconv"
 
 	"github.com/getsentry/vroom/internal/clientsdk"
 	"github.com/getsentry/vroom/internal/debugmeta"
 	"github.com/getsentry/vroom/internal/frame"
+	"github.com/getsentry/vroom/internal/measurements"
 	"github.com/getsentry/vroom/internal/nodetree"
 	"github.com/getsentry/vroom/internal/options"
 	"github.com/getsentry/vroom/internal/platform"
 	"github.com/getsentry/vroom/internal/sample"
+	"github.com/getsentry/vroom/internal/speedscope"
 )
 
 var (
-	ErrInvalidStackID = errors.New("profile contains invalid stack id")
-	ErrInvalidFrameID = errors.New("profile contains invalid frame id")
+	ErrInvalidStackID = sample.ErrInvalidStackID
+	ErrInvalidFrameID = sample.ErrInvalidFrameID
+
+	// mainThreadNames are the names SDKs give to the main thread.
+	mainThreadNames = map[string]struct{}{
+		"main":                  {},
+		"MainThread":            {},
+		"com.apple.main-thread": {},
+	}
 )
 
 type (
@@ -71,6 +81,22 @@ func (c SampleChunk) StoragePath() string {
 	)
 }
 
+// SymbolicateJavaScript calls symbolicate on every frame needing a source
+// map and returns the first error, the other frames being symbolicated
+// anyway.
+func (c *SampleChunk) SymbolicateJavaScript(symbolicate func(*frame.Frame) error) error {
+	var firstErr error
+	for i := range c.Profile.Frames {
+		if !c.Profile.Frames[i].NeedsSourceMap(c.Platform) {
+			continue
+		}
+		if err := symbolicate(&c.Profile.Frames[i]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
 func (c *SampleChunk) Normalize() {
 	for i := range c.Profile.Frames {
 		f := c.Profile.Frames[i]
@@ -78,16 +104,39 @@ func (c *SampleChunk) Normalize() {
 		c.Profile.Frames[i] = f
 	}
 
-	if c.Platform == platform.Python {
+	switch c.Platform {
+	case platform.Python:
 		c.Profile.trimPythonStacks()
+	case platform.Go:
+		c.Profile.trimGoStacks()
+	}
+}
+
+// Validate checks the samples only reference existing stacks and the stacks
+// only reference existing frames.
+func (c SampleChunk) Validate() error {
+	return sample.ValidateIndexes(c.Profile.Stacks, c.Profile.Frames, c.Profile.Samples, func(s Sample) int {
+		return s.StackID
+	})
+}
+
+// sortedSamples returns samples sorted by time. Unsorted samples are sorted in
+// a copy since chunks read from the cache are shared.
+func sortedSamples(samples []Sample) []Sample {
+	less := func(i, j int) bool {
+		return samples[i].Timestamp < samples[j].Timestamp
+	}
+	if sort.SliceIsSorted(samples, less) {
+		return samples
 	}
+	samples = slices.Clone(samples)
+	sort.SliceStable(samples, less)
+	return samples
 }
 
 // CallTrees generates call trees from samples.
 func (c SampleChunk) CallTrees(activeThreadID *string) (map[string][]*nodetree.Node, error) {
-	sort.SliceStable(c.Profile.Samples, func(i, j int) bool {
-		return c.Profile.Samples[i].Timestamp < c.Profile.Samples[j].Timestamp
-	})
+	c.Profile.Samples = sortedSamples(c.Profile.Samples)
 
 	treesByThreadID := make(map[string][]*nodetree.Node)
 	samplesByThreadID := make(map[string][]Sample)
@@ -157,6 +206,105 @@ func (c SampleChunk) CallTrees(activeThreadID *string) (map[string][]*nodetree.N
 	return treesByThreadID, nil
 }
 
+// Speedscope returns a sampled profile for each thread of the chunk. Times
+// are relative to the first sample of the chunk and the last sample of each
+// thread is only used for its timestamp, like in the call trees.
+func (c SampleChunk) Speedscope() (speedscope.Output, error) {
+	c.Profile.Samples = sortedSamples(c.Profile.Samples)
+
+	start := c.StartTimestamp()
+	mainThreadID := c.MainThreadID()
+	frames := make([]speedscope.Frame, 0, len(c.Profile.Frames))
+	for _, f := range c.Profile.Frames {
+		frames = append(frames, speedscope.Frame{
+			Col:           f.Column,
+			File:          f.File,
+			Image:         f.ModuleOrPackage(),
+			Inline:        f.IsInline(),
+			IsApplication: f.IsInApp(),
+			Line:          f.Line,
+			Name:          f.Function,
+			Path:          f.Path,
+			Fingerprint:   f.Fingerprint(),
+		})
+	}
+
+	profiles := make(map[string]*speedscope.SampledProfile)
+	threadIDs := make([]string, 0)
+	previousTimestamps := make(map[string]uint64)
+	for _, s := range c.Profile.Samples {
+		if len(c.Profile.Stacks) <= s.StackID {
+			return speedscope.Output{}, ErrInvalidStackID
+		}
+		ts := uint64((s.Timestamp - start) * 1e9)
+		p, exists := profiles[s.ThreadID]
+		if !exists {
+			threadID, _ := strconv.ParseUint(s.ThreadID, 10, 64)
+			p = &speedscope.SampledProfile{
+				IsMainThread: s.ThreadID == mainThreadID,
+				StartValue:   ts,
+				ThreadID:     threadID,
+				Type:         speedscope.ProfileTypeSampled,
+				Unit:         speedscope.ValueUnitNanoseconds,
+			}
+			if m, exists := c.Profile.ThreadMetadata[s.ThreadID]; exists {
+				p.Name = m.Name
+				p.Priority = m.Priority
+			}
+			profiles[s.ThreadID] = p
+			threadIDs = append(threadIDs, s.ThreadID)
+		} else {
+			p.Weights = append(p.Weights, ts-previousTimestamps[s.ThreadID])
+		}
+		p.EndValue = ts
+		previousTimestamps[s.ThreadID] = ts
+
+		stack := c.Profile.Stacks[s.StackID]
+		sample := make([]int, 0, len(stack))
+		for i := len(stack) - 1; i >= 0; i-- {
+			if len(c.Profile.Frames) <= stack[i] {
+				return speedscope.Output{}, ErrInvalidFrameID
+			}
+			sample = append(sample, stack[i])
+		}
+		p.Samples = append(p.Samples, sample)
+	}
+
+	var activeProfileIndex int
+	allProfiles := make([]interface{}, 0, len(profiles))
+	for _, threadID := range threadIDs {
+		p := profiles[threadID]
+		if p.IsMainThread {
+			activeProfileIndex = len(allProfiles)
+		}
+		// The last sample only marks the end of the previous one.
+		p.Samples = p.Samples[:len(p.Samples)-1]
+		allProfiles = append(allProfiles, p)
+	}
+
+	return speedscope.Output{
+		ActiveProfileIndex: activeProfileIndex,
+		ChunkID:            c.ID,
+		DurationNS:         uint64((c.EndTimestamp() - start) * 1e9),
+		Images:             c.DebugMeta.Images,
+		Metadata: speedscope.ProfileMetadata{
+			ProfileView: speedscope.ProfileView{
+				DurationNS:     uint64((c.EndTimestamp() - start) * 1e9),
+				Environment:    c.Environment,
+				OrganizationID: c.OrganizationID,
+				Platform:       c.Platform,
+				ProjectID:      c.ProjectID,
+			},
+			Version: c.Release,
+		},
+		Platform:  c.Platform,
+		Profiles:  allProfiles,
+		ProjectID: c.ProjectID,
+		Shared:    speedscope.SharedData{Frames: frames},
+		Version:   c.Release,
+	}, nil
+}
+
 func (d *SampleData) trimPythonStacks() {
 	// Find the module frame index in frames
 	mfi := -1
@@ -186,6 +334,43 @@ func (d *SampleData) trimPythonStacks() {
 	}
 }
 
+// trimGoStacks removes the root frame of goroutines and the scheduler frames
+// at the top of the stacks of parked goroutines. Stacks only made of
+// scheduler frames become empty so the thread is considered idle.
+func (d *SampleData) trimGoStacks() {
+	exits := make(map[int]struct{})
+	schedulers := make(map[int]struct{})
+	for i, f := range d.Frames {
+		if f.IsGoExitFrame() {
+			exits[i] = struct{}{}
+		} else if f.IsGoSchedulerFrame() {
+			schedulers[i] = struct{}{}
+		}
+	}
+
+	// We do nothing if there are no runtime frames
+	if len(exits) == 0 && len(schedulers) == 0 {
+		return
+	}
+
+	for si, s := range d.Stacks {
+		l := len(s)
+		if l > 0 {
+			if _, exists := exits[s[l-1]]; exists {
+				l--
+			}
+		}
+		i := 0
+		for i < l {
+			if _, exists := schedulers[s[i]]; !exists {
+				break
+			}
+			i++
+		}
+		d.Stacks[si] = s[i:l]
+	}
+}
+
 func (c SampleChunk) DurationMS() uint64 {
 	return uint64(math.Round((c.EndTimestamp() - c.StartTimestamp()) * 1e3))
 }
@@ -206,6 +391,30 @@ func (c SampleChunk) EndTimestamp() float64 {
 	return c.Profile.Samples[count-1].Timestamp
 }
 
+func (c SampleChunk) GetDebugMeta() debugmeta.DebugMeta {
+	return c.DebugMeta
+}
+
+func (c SampleChunk) GetMeasurements() (map[string]measurements.MeasurementV2, error) {
+	return unmarshalMeasurements(c.Measurements)
+}
+
+// MainThreadID looks up the main thread in the thread metadata and returns
+// its ID, or an empty string if there's none.
+func (c SampleChunk) MainThreadID() string {
+	threadIDs := make([]string, 0, len(c.Profile.ThreadMetadata))
+	for tid, m := range c.Profile.ThreadMetadata {
+		if _, exists := mainThreadNames[m.Name]; exists {
+			threadIDs = append(threadIDs, tid)
+		}
+	}
+	if len(threadIDs) == 0 {
+		return ""
+	}
+	sort.Strings(threadIDs)
+	return threadIDs[0]
+}
+
 func (c SampleChunk) GetEnvironment() string {
 	return c.Environment
 }
@@ -2,7 +2,11 @@ package chunk
 
 import (
 	"context"
+	"encoding/json"
+	"io"
+	"time"
 
+	"github.com/getsentry/vroom/internal/monitoring"
 	"github.com/getsentry/vroom/internal/nodetree"
 	"github.com/getsentry/vroom/internal/storageutil"
 	"gocloud.dev/blob"
@@ -26,6 +30,8 @@ type (
 	ReadJobResult struct {
 		Err           error
 		Chunk         *Chunk
+		ProfilerID    string
+		ChunkID       string
 		TransactionID string
 		ThreadID      *string
 		Start         uint64
@@ -33,19 +39,14 @@ type (
 	}
 )
 
-func (job ReadJob) Read() {
-	var chunk Chunk
-
-	err := storageutil.UnmarshalCompressed(
-		job.Ctx,
-		job.Storage,
-		StoragePath(job.OrganizationID, job.ProjectID, job.ProfilerID, job.ChunkID),
-		&chunk,
-	)
+func (job ReadJob) Read(cache *storageutil.Cache) {
+	chunk, err := readChunk(job, cache)
 
 	job.Result <- ReadJobResult{
 		Err:           err,
-		Chunk:         &chunk,
+		Chunk:         chunk,
+		ProfilerID:    job.ProfilerID,
+		ChunkID:       job.ChunkID,
 		TransactionID: job.TransactionID,
 		ThreadID:      job.ThreadID,
 		Start:         job.Start,
@@ -53,6 +54,27 @@ func (job ReadJob) Read() {
 	}
 }
 
+// readChunk reads a chunk from the cache or the bucket. The chunk can be
+// shared with other reads and mustn't be modified.
+func readChunk(job ReadJob, cache *storageutil.Cache) (*Chunk, error) {
+	objectName := StoragePath(job.OrganizationID, job.ProjectID, job.ProfilerID, job.ChunkID)
+	v, _, err := storageutil.ReadDecoded(job.Ctx, cache, job.Storage, objectName, objectName, decodeChunk)
+	return v, err
+}
+
+// decodeChunk decodes a chunk as it's read. The decoded chunk takes about
+// as much memory as its JSON, counted by storageutil.ReadDecoded.
+func decodeChunk(r io.Reader) (*Chunk, int64, error) {
+	var chunk Chunk
+	start := time.Now()
+	err := json.NewDecoder(r).Decode(&chunk)
+	monitoring.ObserveStage(monitoring.StageDecode, "chunk", start)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &chunk, 0, nil
+}
+
 func (result ReadJobResult) Error() error {
 	return result.Err
 }
@@ -69,28 +91,49 @@ type (
 		Start         uint64
 		End           uint64
 	}
-)
 
-func (job CallTreesReadJob) Read() {
-	var chunk Chunk
+	// callTreesEntry is what the cache keeps for a CallTreesReadJob, the
+	// call trees being computed once.
+	callTreesEntry struct {
+		chunk     *Chunk
+		callTrees map[string][]*nodetree.Node
+	}
+)
 
-	err := storageutil.UnmarshalCompressed(
+func (job CallTreesReadJob) Read(cache *storageutil.Cache) {
+	objectName := StoragePath(job.OrganizationID, job.ProjectID, job.ProfilerID, job.ChunkID)
+	// Call trees depend on the active thread.
+	key := objectName + "#calltrees"
+	if job.ThreadID != nil {
+		key += "#" + *job.ThreadID
+	}
+	entry, shared, err := storageutil.ReadDecoded(
 		job.Ctx,
+		cache,
 		job.Storage,
-		StoragePath(job.OrganizationID, job.ProjectID, job.ProfilerID, job.ChunkID),
-		&chunk,
+		objectName,
+		key,
+		func(r io.Reader) (callTreesEntry, int64, error) {
+			return decodeCallTrees(r, job.ThreadID)
+		},
 	)
 	if err != nil {
 		job.Result <- CallTreesReadJobResult{Err: err}
 		return
 	}
 
-	callTrees, err := chunk.CallTrees(job.ThreadID)
-
+	// Call trees are modified when aggregated, each read of cached ones gets
+	// its own copy.
+	callTrees := entry.callTrees
+	if shared {
+		callTrees = make(map[string][]*nodetree.Node, len(entry.callTrees))
+		for threadID, trees := range entry.callTrees {
+			callTrees[threadID] = nodetree.DeepCopyTrees(trees)
+		}
+	}
 	job.Result <- CallTreesReadJobResult{
-		Err:           err,
 		CallTrees:     callTrees,
-		Chunk:         &chunk,
+		Chunk:         entry.chunk,
 		TransactionID: job.TransactionID,
 		ThreadID:      job.ThreadID,
 		Start:         job.Start,
@@ -98,6 +141,24 @@ func (job CallTreesReadJob) Read() {
 	}
 }
 
+func decodeCallTrees(r io.Reader, threadID *string) (callTreesEntry, int64, error) {
+	chunk, size, err := decodeChunk(r)
+	if err != nil {
+		return callTreesEntry{}, 0, err
+	}
+
+	start := time.Now()
+	callTrees, err := chunk.CallTrees(threadID)
+	monitoring.ObserveStage(monitoring.StageCallTrees, "chunk", start)
+	if err != nil {
+		return callTreesEntry{}, 0, err
+	}
+	for _, trees := range callTrees {
+		size += nodetree.TreeSizeBytes(trees)
+	}
+	return callTreesEntry{chunk: chunk, callTrees: callTrees}, size, nil
+}
+
 func (result CallTreesReadJobResult) Error() error {
 	return result.Err
 }
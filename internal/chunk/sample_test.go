@@ -7,6 +7,8 @@ import (
 	"github.com/getsentry/vroom/internal/frame"
 	"github.com/getsentry/vroom/internal/nodetree"
 	"github.com/getsentry/vroom/internal/platform"
+	"github.com/getsentry/vroom/internal/sample"
+	"github.com/getsentry/vroom/internal/speedscope"
 	"github.com/getsentry/vroom/internal/testutil"
 )
 
@@ -40,7 +42,6 @@ func TestCallTrees(t *testing.T) {
 				"1": {
 					{
 						DurationNS:    40_000_000,
-						DurationsNS:   []uint64{40_000_000},
 						EndNS:         50_000_000,
 						Fingerprint:   15444731332182868858,
 						IsApplication: true,
@@ -53,7 +54,6 @@ func TestCallTrees(t *testing.T) {
 						Children: []*nodetree.Node{
 							{
 								DurationNS:    40_000_000,
-								DurationsNS:   []uint64{40_000_000},
 								EndNS:         50_000_000,
 								StartNS:       10_000_000,
 								Fingerprint:   14164357600995800812,
@@ -66,7 +66,6 @@ func TestCallTrees(t *testing.T) {
 								Children: []*nodetree.Node{
 									{
 										DurationNS:    10_000_000,
-										DurationsNS:   []uint64{10_000_000},
 										EndNS:         50_000_000,
 										Fingerprint:   9531802423075301657,
 										IsApplication: true,
@@ -107,7 +106,6 @@ func TestCallTrees(t *testing.T) {
 				"1": {
 					{
 						DurationNS:    30_000_000,
-						DurationsNS:   []uint64{30_000_000},
 						EndNS:         40_000_000,
 						Fingerprint:   15444731332182868858,
 						IsApplication: true,
@@ -120,7 +118,6 @@ func TestCallTrees(t *testing.T) {
 						Children: []*nodetree.Node{
 							{
 								DurationNS:    30_000_000,
-								DurationsNS:   []uint64{30_000_000},
 								EndNS:         40_000_000,
 								Fingerprint:   14164357600995800812,
 								IsApplication: true,
@@ -161,7 +158,6 @@ func TestCallTrees(t *testing.T) {
 				"1": {
 					{
 						DurationNS:    10_000_000,
-						DurationsNS:   []uint64{10_000_000},
 						EndNS:         20_000_000,
 						Fingerprint:   15444731332182868858,
 						IsApplication: true,
@@ -174,7 +170,6 @@ func TestCallTrees(t *testing.T) {
 					},
 					{
 						DurationNS:    10_000_000,
-						DurationsNS:   []uint64{10_000_000},
 						EndNS:         30_000_000,
 						Fingerprint:   15444731332182868859,
 						IsApplication: true,
@@ -203,6 +198,59 @@ func TestCallTrees(t *testing.T) {
 	}
 }
 
+func TestSpeedscopeTracks(t *testing.T) {
+	c := SampleChunk{
+		Profile: SampleData{
+			Samples: []Sample{
+				{StackID: 1, Timestamp: 1.030, ThreadID: "2"},
+				{StackID: 0, Timestamp: 1.000, ThreadID: "1"},
+				{StackID: 1, Timestamp: 1.010, ThreadID: "1"},
+				{StackID: 0, Timestamp: 1.010, ThreadID: "2"},
+				{StackID: 0, Timestamp: 1.020, ThreadID: "1"},
+			},
+			Stacks: [][]int{
+				{0},
+				{1, 0},
+			},
+			Frames: []frame.Frame{
+				{Function: "main"},
+				{Function: "work"},
+			},
+			ThreadMetadata: map[string]sample.ThreadMetadata{
+				"1": {Name: "main", Priority: 31},
+				"2": {Name: "worker"},
+			},
+		},
+	}
+	want := []speedscope.Track{
+		{
+			ThreadID:     1,
+			Name:         "main",
+			IsMainThread: true,
+			Priority:     31,
+			Samples: []speedscope.TrackSample{
+				{StartNS: 0, DurationNS: 10_000_000, Stack: []int{0}},
+				{StartNS: 10_000_000, DurationNS: 10_000_000, Stack: []int{0, 1}},
+			},
+		},
+		{
+			ThreadID: 2,
+			Name:     "worker",
+			Samples: []speedscope.TrackSample{
+				{StartNS: 10_000_000, DurationNS: 20_000_000, Stack: []int{0}},
+			},
+		},
+	}
+
+	o, err := c.Speedscope()
+	if err != nil {
+		t.Fatalf("error while generating speedscope: %+v\n", err)
+	}
+	if diff := testutil.Diff(o.Tracks(), want); diff != "" {
+		t.Fatalf("Result mismatch: got - want +\n%s", diff)
+	}
+}
+
 func TestTrimPythonStacks(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -279,3 +327,37 @@ func TestTrimPythonStacks(t *testing.T) {
 		})
 	}
 }
+
+func TestTrimGoStacks(t *testing.T) {
+	c := SampleChunk{
+		Platform: platform.Go,
+		Profile: SampleData{
+			Frames: []frame.Frame{
+				{Function: "runtime.goexit"},
+				{Function: "main.worker"},
+				{Function: "runtime.chanrecv1"},
+				{Function: "runtime.gopark"},
+				{Function: "runtime.mstart"},
+				{Function: "runtime.schedule"},
+				{Function: "runtime.findRunnable"},
+			},
+			Stacks: [][]int{
+				{1, 0},
+				{3, 2, 1, 0},
+				{6, 5, 4},
+				{},
+			},
+		},
+	}
+	want := [][]int{
+		{1},
+		{2, 1},
+		{},
+		{},
+	}
+
+	c.Normalize()
+	if diff := testutil.Diff(c.Profile.Stacks, want); diff != "" {
+		t.Fatalf("Result mismatch: got - want +\n%s", diff)
+	}
+}
@@ -3,9 +3,12 @@ package chunk
 import (
 	"context"
 	"encoding/json"
+	"maps"
+	"slices"
 	"sort"
 
 	"github.com/getsentry/vroom/internal/measurements"
+	"github.com/getsentry/vroom/internal/sample"
 	"gocloud.dev/blob"
 )
 
@@ -22,7 +25,15 @@ func MergeSampleChunks(chunks []SampleChunk, startTS, endTS uint64) (SampleChunk
 	start := float64(startTS) / 1e9
 	end := float64(endTS) / 1e9
 
+	// Chunks read from the cache are shared, everything modified while
+	// merging is copied first.
 	chunk := chunks[0]
+	chunk.Profile.Frames = slices.Clone(chunk.Profile.Frames)
+	chunk.Profile.Stacks = slices.Clone(chunk.Profile.Stacks)
+	chunk.Profile.ThreadMetadata = maps.Clone(chunk.Profile.ThreadMetadata)
+	if chunk.Profile.ThreadMetadata == nil {
+		chunk.Profile.ThreadMetadata = make(map[string]sample.ThreadMetadata)
+	}
 	if len(chunk.Measurements) > 0 {
 		err := json.Unmarshal(chunk.Measurements, &mergedMeasurement)
 		if err != nil {
@@ -47,22 +58,22 @@ func MergeSampleChunks(chunks []SampleChunk, startTS, endTS uint64) (SampleChunk
 		// If the first chunk had a couple of frames, and the second chunk too,
 		// then all the stacks in the second chunk that refers to frames at index
 		// fr[0] and fr[1], once merged should refer to frames at index fr[2], fr[3].
-		for j, stack := range c.Profile.Stacks {
+		for _, stack := range c.Profile.Stacks {
+			shifted := make([]int, len(stack))
 			for z, frameID := range stack {
-				c.Profile.Stacks[j][z] = frameID + len(chunk.Profile.Frames)
+				shifted[z] = frameID + len(chunk.Profile.Frames)
 			}
+			chunk.Profile.Stacks = append(chunk.Profile.Stacks, shifted)
 		}
 		chunk.Profile.Frames = append(chunk.Profile.Frames, c.Profile.Frames...)
 		// The same goes for chunk samples stack IDs
-		for j, sample := range c.Profile.Samples {
-			c.Profile.Samples[j].StackID = sample.StackID + len(chunk.Profile.Stacks)
-		}
-		chunk.Profile.Stacks = append(chunk.Profile.Stacks, c.Profile.Stacks...)
+		stackOffset := len(chunk.Profile.Stacks) - len(c.Profile.Stacks)
 		for _, sample := range c.Profile.Samples {
 			if sample.Timestamp < start || sample.Timestamp > end {
 				// sample from chunk lies outside start/end range so skip it
 				continue
 			}
+			sample.StackID += stackOffset
 			samples = append(samples, sample)
 		}
 
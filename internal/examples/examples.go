@@ -51,6 +51,8 @@ type (
 		Count       uint64            `json:"count"`
 		Worst       ExampleMetadata   `json:"worst"`
 		Examples    []ExampleMetadata `json:"examples"`
+		// ThreadID is only set when functions are aggregated by thread.
+		ThreadID string `json:"thread_id,omitempty"`
 	}
 )
 
@@ -0,0 +1,410 @@
+// Package firefox converts profiles to the processed format of the Firefox
+// Profiler.
+package firefox
+
+import (
+	"strconv"
+
+	"github.com/getsentry/vroom/internal/speedscope"
+)
+
+// ContentType is the content type of a processed profile.
+const ContentType = "application/json"
+
+const (
+	// processedProfileVersion is the version of the format written, the
+	// profiler upgrades older versions when loading them.
+	processedProfileVersion = 47
+	geckoProfileVersion     = 27
+
+	// weightTypeTracing weighs each sample by its duration in milliseconds
+	// so sampled and evented profiles are both represented.
+	weightTypeTracing = "tracing-ms"
+
+	categoryOther       = 0
+	categoryApplication = 1
+	categorySystem      = 2
+
+	markerPhaseInterval = 1
+)
+
+var categories = []Category{
+	{Name: "Other", Color: "grey", Subcategories: []string{"Other"}},
+	{Name: "Application", Color: "yellow", Subcategories: []string{"Other"}},
+	{Name: "System", Color: "blue", Subcategories: []string{"Other"}},
+}
+
+type (
+	// Profile is a processed profile.
+	Profile struct {
+		Meta    Meta          `json:"meta"`
+		Libs    []interface{} `json:"libs"`
+		Threads []Thread      `json:"threads"`
+	}
+
+	Meta struct {
+		Interval                   float64        `json:"interval"`
+		StartTime                  float64        `json:"startTime"`
+		ProcessType                int            `json:"processType"`
+		Product                    string         `json:"product"`
+		Stackwalk                  int            `json:"stackwalk"`
+		Version                    int            `json:"version"`
+		PreprocessedProfileVersion int            `json:"preprocessedProfileVersion"`
+		Symbolicated               bool           `json:"symbolicated"`
+		Categories                 []Category     `json:"categories"`
+		MarkerSchema               []MarkerSchema `json:"markerSchema"`
+	}
+
+	Category struct {
+		Name          string   `json:"name"`
+		Color         string   `json:"color"`
+		Subcategories []string `json:"subcategories"`
+	}
+
+	MarkerSchema struct {
+		Name       string        `json:"name"`
+		Display    []string      `json:"display"`
+		Data       []interface{} `json:"data"`
+		Graphs     []interface{} `json:"graphs,omitempty"`
+		TableLabel string        `json:"tableLabel,omitempty"`
+	}
+
+	Thread struct {
+		ProcessType         string        `json:"processType"`
+		ProcessStartupTime  float64       `json:"processStartupTime"`
+		ProcessShutdownTime *float64      `json:"processShutdownTime"`
+		RegisterTime        float64       `json:"registerTime"`
+		UnregisterTime      *float64      `json:"unregisterTime"`
+		PausedRanges        []interface{} `json:"pausedRanges"`
+		Name                string        `json:"name"`
+		IsMainThread        bool          `json:"isMainThread"`
+		PID                 string        `json:"pid"`
+		TID                 uint64        `json:"tid"`
+		Samples             SamplesTable  `json:"samples"`
+		Markers             MarkersTable  `json:"markers"`
+		StackTable          StackTable    `json:"stackTable"`
+		FrameTable          FrameTable    `json:"frameTable"`
+		FuncTable           FuncTable     `json:"funcTable"`
+		ResourceTable       ResourceTable `json:"resourceTable"`
+		NativeSymbols       NativeSymbols `json:"nativeSymbols"`
+		StringArray         []string      `json:"stringArray"`
+
+		strings map[string]int
+		funcs   map[int]int
+		stacks  map[[2]int]int
+	}
+
+	SamplesTable struct {
+		Length     int       `json:"length"`
+		Stack      []*int    `json:"stack"`
+		Time       []float64 `json:"time"`
+		Weight     []float64 `json:"weight"`
+		WeightType string    `json:"weightType"`
+	}
+
+	MarkersTable struct {
+		Length    int           `json:"length"`
+		Data      []interface{} `json:"data"`
+		Name      []int         `json:"name"`
+		StartTime []float64     `json:"startTime"`
+		EndTime   []*float64    `json:"endTime"`
+		Phase     []int         `json:"phase"`
+		Category  []int         `json:"category"`
+	}
+
+	StackTable struct {
+		Length      int    `json:"length"`
+		Frame       []int  `json:"frame"`
+		Prefix      []*int `json:"prefix"`
+		Category    []int  `json:"category"`
+		Subcategory []int  `json:"subcategory"`
+	}
+
+	FrameTable struct {
+		Length         int       `json:"length"`
+		Address        []int     `json:"address"`
+		InlineDepth    []int     `json:"inlineDepth"`
+		Category       []int     `json:"category"`
+		Subcategory    []int     `json:"subcategory"`
+		Func           []int     `json:"func"`
+		NativeSymbol   []*int    `json:"nativeSymbol"`
+		InnerWindowID  []*int    `json:"innerWindowID"`
+		Implementation []*string `json:"implementation"`
+		Line           []*uint32 `json:"line"`
+		Column         []*uint32 `json:"column"`
+	}
+
+	FuncTable struct {
+		Length        int       `json:"length"`
+		Name          []int     `json:"name"`
+		IsJS          []bool    `json:"isJS"`
+		RelevantForJS []bool    `json:"relevantForJS"`
+		Resource      []int     `json:"resource"`
+		FileName      []*int    `json:"fileName"`
+		LineNumber    []*uint32 `json:"lineNumber"`
+		ColumnNumber  []*uint32 `json:"columnNumber"`
+	}
+
+	ResourceTable struct {
+		Length int   `json:"length"`
+		Lib    []int `json:"lib"`
+		Name   []int `json:"name"`
+		Host   []int `json:"host"`
+		Type   []int `json:"type"`
+	}
+
+	NativeSymbols struct {
+		Length       int   `json:"length"`
+		LibIndex     []int `json:"libIndex"`
+		Address      []int `json:"address"`
+		Name         []int `json:"name"`
+		FunctionSize []int `json:"functionSize"`
+	}
+
+	// queueMarker is the payload of the markers of the queues served by a
+	// thread.
+	queueMarker struct {
+		Type  string `json:"type"`
+		Label string `json:"label"`
+	}
+)
+
+// FromSpeedscope converts a profile to a processed profile with a thread for
+// each thread of the profile. Samples are weighted by their duration and
+// queues served by a thread are interval markers.
+func FromSpeedscope(o speedscope.Output) Profile {
+	p := Profile{
+		Meta: Meta{
+			Interval:                   1,
+			StartTime:                  float64(o.Metadata.Timestamp.UnixNano()) / 1e6,
+			Product:                    product(o),
+			Version:                    geckoProfileVersion,
+			PreprocessedProfileVersion: processedProfileVersion,
+			Symbolicated:               true,
+			Categories:                 categories,
+			MarkerSchema: []MarkerSchema{
+				{
+					Name:       "Queue",
+					Display:    []string{"marker-chart", "marker-table", "timeline-overview"},
+					TableLabel: "{marker.data.label}",
+					Data: []interface{}{
+						map[string]string{"key": "label", "label": "Label", "format": "string"},
+					},
+				},
+			},
+		},
+		Libs:    []interface{}{},
+		Threads: []Thread{},
+	}
+	if o.Metadata.Timestamp.IsZero() {
+		p.Meta.StartTime = 0
+	}
+	for _, track := range o.Tracks() {
+		p.Threads = append(p.Threads, newThread(o.Shared.Frames, track))
+	}
+	return p
+}
+
+func newThread(frames []speedscope.Frame, track speedscope.Track) Thread {
+	t := Thread{
+		ProcessType:  "default",
+		PausedRanges: []interface{}{},
+		Name:         threadName(track),
+		IsMainThread: track.IsMainThread,
+		PID:          "0",
+		TID:          track.ThreadID,
+		Samples: SamplesTable{
+			Stack:      []*int{},
+			Time:       []float64{},
+			Weight:     []float64{},
+			WeightType: weightTypeTracing,
+		},
+		Markers: MarkersTable{
+			Data:      []interface{}{},
+			Name:      []int{},
+			StartTime: []float64{},
+			EndTime:   []*float64{},
+			Phase:     []int{},
+			Category:  []int{},
+		},
+		StackTable: StackTable{
+			Frame:       []int{},
+			Prefix:      []*int{},
+			Category:    []int{},
+			Subcategory: []int{},
+		},
+		FrameTable: FrameTable{
+			Address:        []int{},
+			InlineDepth:    []int{},
+			Category:       []int{},
+			Subcategory:    []int{},
+			Func:           []int{},
+			NativeSymbol:   []*int{},
+			InnerWindowID:  []*int{},
+			Implementation: []*string{},
+			Line:           []*uint32{},
+			Column:         []*uint32{},
+		},
+		FuncTable: FuncTable{
+			Name:          []int{},
+			IsJS:          []bool{},
+			RelevantForJS: []bool{},
+			Resource:      []int{},
+			FileName:      []*int{},
+			LineNumber:    []*uint32{},
+			ColumnNumber:  []*uint32{},
+		},
+		ResourceTable: ResourceTable{
+			Lib:  []int{},
+			Name: []int{},
+			Host: []int{},
+			Type: []int{},
+		},
+		NativeSymbols: NativeSymbols{
+			LibIndex:     []int{},
+			Address:      []int{},
+			Name:         []int{},
+			FunctionSize: []int{},
+		},
+		StringArray: []string{},
+		strings:     make(map[string]int),
+		funcs:       make(map[int]int),
+		stacks:      make(map[[2]int]int),
+	}
+
+	for _, s := range track.Samples {
+		var stack *int
+		for _, f := range s.Stack {
+			i := t.stack(frames, stack, f)
+			stack = &i
+		}
+		t.Samples.Stack = append(t.Samples.Stack, stack)
+		t.Samples.Time = append(t.Samples.Time, milliseconds(s.StartNS))
+		t.Samples.Weight = append(t.Samples.Weight, milliseconds(s.DurationNS))
+		t.Samples.Length++
+	}
+
+	for _, q := range track.Queues {
+		end := milliseconds(q.EndNS)
+		t.Markers.Data = append(t.Markers.Data, queueMarker{Type: "Queue", Label: q.Label})
+		t.Markers.Name = append(t.Markers.Name, t.string(q.Label))
+		t.Markers.StartTime = append(t.Markers.StartTime, milliseconds(q.StartNS))
+		t.Markers.EndTime = append(t.Markers.EndTime, &end)
+		t.Markers.Phase = append(t.Markers.Phase, markerPhaseInterval)
+		t.Markers.Category = append(t.Markers.Category, categoryOther)
+		t.Markers.Length++
+	}
+	return t
+}
+
+// stack returns the index of the stack made of frame f called by prefix,
+// adding it if needed. Each frame of the profile has a single function and a
+// single frame in the thread.
+func (t *Thread) stack(frames []speedscope.Frame, prefix *int, f int) int {
+	prefixIndex := -1
+	if prefix != nil {
+		prefixIndex = *prefix
+	}
+	key := [2]int{prefixIndex, f}
+	if i, exists := t.stacks[key]; exists {
+		return i
+	}
+	frameIndex := t.frame(frames, f)
+	i := t.StackTable.Length
+	t.StackTable.Frame = append(t.StackTable.Frame, frameIndex)
+	t.StackTable.Prefix = append(t.StackTable.Prefix, prefix)
+	t.StackTable.Category = append(t.StackTable.Category, t.FrameTable.Category[frameIndex])
+	t.StackTable.Subcategory = append(t.StackTable.Subcategory, 0)
+	t.StackTable.Length++
+	t.stacks[key] = i
+	return i
+}
+
+func (t *Thread) frame(frames []speedscope.Frame, f int) int {
+	if i, exists := t.funcs[f]; exists {
+		return i
+	}
+	var sf speedscope.Frame
+	if f >= 0 && f < len(frames) {
+		sf = frames[f]
+	} else {
+		sf.Name = "unknown"
+	}
+	category := categorySystem
+	if sf.IsApplication {
+		category = categoryApplication
+	}
+	var line, column *uint32
+	if sf.Line != 0 {
+		line = &sf.Line
+	}
+	if sf.Col != 0 {
+		column = &sf.Col
+	}
+	var fileName *int
+	if sf.File != "" {
+		i := t.string(sf.File)
+		fileName = &i
+	} else if sf.Path != "" {
+		i := t.string(sf.Path)
+		fileName = &i
+	}
+
+	funcIndex := t.FuncTable.Length
+	t.FuncTable.Name = append(t.FuncTable.Name, t.string(sf.Name))
+	t.FuncTable.IsJS = append(t.FuncTable.IsJS, false)
+	t.FuncTable.RelevantForJS = append(t.FuncTable.RelevantForJS, false)
+	t.FuncTable.Resource = append(t.FuncTable.Resource, -1)
+	t.FuncTable.FileName = append(t.FuncTable.FileName, fileName)
+	t.FuncTable.LineNumber = append(t.FuncTable.LineNumber, line)
+	t.FuncTable.ColumnNumber = append(t.FuncTable.ColumnNumber, column)
+	t.FuncTable.Length++
+
+	// Functions and frames are added together so they share indexes.
+	frameIndex := t.FrameTable.Length
+	t.FrameTable.Address = append(t.FrameTable.Address, -1)
+	t.FrameTable.InlineDepth = append(t.FrameTable.InlineDepth, 0)
+	t.FrameTable.Category = append(t.FrameTable.Category, category)
+	t.FrameTable.Subcategory = append(t.FrameTable.Subcategory, 0)
+	t.FrameTable.Func = append(t.FrameTable.Func, funcIndex)
+	t.FrameTable.NativeSymbol = append(t.FrameTable.NativeSymbol, nil)
+	t.FrameTable.InnerWindowID = append(t.FrameTable.InnerWindowID, nil)
+	t.FrameTable.Implementation = append(t.FrameTable.Implementation, nil)
+	t.FrameTable.Line = append(t.FrameTable.Line, line)
+	t.FrameTable.Column = append(t.FrameTable.Column, column)
+	t.FrameTable.Length++
+
+	t.funcs[f] = frameIndex
+	return frameIndex
+}
+
+func (t *Thread) string(s string) int {
+	if i, exists := t.strings[s]; exists {
+		return i
+	}
+	i := len(t.StringArray)
+	t.StringArray = append(t.StringArray, s)
+	t.strings[s] = i
+	return i
+}
+
+func product(o speedscope.Output) string {
+	if o.TransactionName != "" {
+		return o.TransactionName
+	}
+	return string(o.Platform)
+}
+
+func threadName(track speedscope.Track) string {
+	if track.Name != "" {
+		return track.Name
+	}
+	if track.IsMainThread {
+		return "main"
+	}
+	return strconv.FormatUint(track.ThreadID, 10)
+}
+
+func milliseconds(ns uint64) float64 {
+	return float64(ns) / 1e6
+}
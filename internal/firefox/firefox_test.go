@@ -0,0 +1,113 @@
+package firefox
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/getsentry/vroom/internal/speedscope"
+	"github.com/getsentry/vroom/internal/testutil"
+)
+
+func TestFromSpeedscope(t *testing.T) {
+	o := speedscope.Output{
+		TransactionName: "checkout",
+		Shared: speedscope.SharedData{
+			Frames: []speedscope.Frame{
+				{Name: "main", IsApplication: true, File: "main.py", Line: 3},
+				{Name: "a"},
+				{Name: "b"},
+			},
+		},
+		Profiles: []interface{}{
+			&speedscope.SampledProfile{
+				ThreadID: 2,
+				Name:     "worker",
+				Samples:  [][]int{{1}},
+				Weights:  []uint64{500_000},
+			},
+			&speedscope.SampledProfile{
+				ThreadID:     1,
+				IsMainThread: true,
+				Samples:      [][]int{{0, 1}, {0, 2}, {0, 1}},
+				Weights:      []uint64{1_000_000, 2_000_000, 1_000_000},
+				Queues: map[string]speedscope.Queue{
+					"0x1": {Label: "main-queue", StartNS: 0, EndNS: 3_000_000},
+				},
+			},
+		},
+	}
+
+	p := FromSpeedscope(o)
+
+	if p.Meta.Product != "checkout" {
+		t.Fatalf("expected product checkout, got %q", p.Meta.Product)
+	}
+	if len(p.Threads) != 2 {
+		t.Fatalf("expected 2 threads, got %d", len(p.Threads))
+	}
+
+	stack := func(i int) *int { return &i }
+	end := 3.0
+	line := uint32(3)
+	fileName := 0
+	want := Thread{
+		Name:         "main",
+		IsMainThread: true,
+		TID:          1,
+		Samples: SamplesTable{
+			Length:     3,
+			Stack:      []*int{stack(1), stack(2), stack(1)},
+			Time:       []float64{0, 1, 3},
+			Weight:     []float64{1, 2, 1},
+			WeightType: weightTypeTracing,
+		},
+		Markers: MarkersTable{
+			Length:    1,
+			Data:      []interface{}{queueMarker{Type: "Queue", Label: "main-queue"}},
+			Name:      []int{4},
+			StartTime: []float64{0},
+			EndTime:   []*float64{&end},
+			Phase:     []int{markerPhaseInterval},
+			Category:  []int{categoryOther},
+		},
+		StackTable: StackTable{
+			Length:      3,
+			Frame:       []int{0, 1, 2},
+			Prefix:      []*int{nil, stack(0), stack(0)},
+			Category:    []int{categoryApplication, categorySystem, categorySystem},
+			Subcategory: []int{0, 0, 0},
+		},
+		FuncTable: FuncTable{
+			Length:        3,
+			Name:          []int{1, 2, 3},
+			IsJS:          []bool{false, false, false},
+			RelevantForJS: []bool{false, false, false},
+			Resource:      []int{-1, -1, -1},
+			FileName:      []*int{&fileName, nil, nil},
+			LineNumber:    []*uint32{&line, nil, nil},
+			ColumnNumber:  []*uint32{nil, nil, nil},
+		},
+		StringArray: []string{"main.py", "main", "a", "b", "main-queue"},
+	}
+
+	if diff := testutil.Diff(
+		p.Threads[0],
+		want,
+		cmpopts.IgnoreUnexported(Thread{}),
+		cmpopts.IgnoreFields(
+			Thread{},
+			"ProcessType",
+			"PausedRanges",
+			"PID",
+			"FrameTable",
+			"ResourceTable",
+			"NativeSymbols",
+		),
+	); diff != "" {
+		t.Fatalf("Result mismatch: got - want +\n%s", diff)
+	}
+	if p.Threads[1].Name != "worker" || p.Threads[1].Samples.Length != 1 {
+		t.Fatalf("unexpected second thread: %+v", p.Threads[1])
+	}
+}
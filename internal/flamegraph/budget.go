@@ -0,0 +1,65 @@
+package flamegraph
+
+import (
+	"unsafe"
+
+	"github.com/getsentry/vroom/internal/examples"
+	"github.com/getsentry/vroom/internal/speedscope"
+)
+
+// PartialReasonMemoryBudget is the reason given when candidates were
+// skipped because the aggregated tree grew over the memory budget.
+const PartialReasonMemoryBudget = "memory_budget_exceeded"
+
+var exampleSize = int64(unsafe.Sizeof(examples.ExampleMetadata{}))
+
+// memoryBudget tracks an estimate of the memory used by an aggregated tree.
+// Once the limit is exceeded, the remaining candidates are not aggregated.
+type memoryBudget struct {
+	limit   int64
+	used    int64
+	skipped int
+	total   int
+}
+
+// newMemoryBudget returns a budget for total candidates. A limit of 0 means
+// there is no limit.
+func newMemoryBudget(limit int64, total int) *memoryBudget {
+	return &memoryBudget{limit: limit, total: total}
+}
+
+func (b *memoryBudget) add(bytes int64) {
+	b.used += bytes
+}
+
+func (b *memoryBudget) skip(candidates int) {
+	b.skipped += candidates
+}
+
+func (b *memoryBudget) exceeded() bool {
+	return b.limit > 0 && b.used > b.limit
+}
+
+// partialResult returns nil when all the candidates were aggregated.
+func (b *memoryBudget) partialResult() *speedscope.PartialResult {
+	if b.skipped == 0 {
+		return nil
+	}
+	return &speedscope.PartialResult{
+		Reason:              PartialReasonMemoryBudget,
+		CandidatesProcessed: b.total - b.skipped,
+		CandidatesTotal:     b.total,
+	}
+}
+
+// combinedPartialResult returns the partial result of budgets aggregating
+// candidates into the same tree, nil when all their candidates were
+// aggregated.
+func combinedPartialResult(budgets ...*memoryBudget) *speedscope.PartialResult {
+	var combined memoryBudget
+	for _, b := range budgets {
+		combined.skipped += b.skipped
+		combined.total += b.total
+	}
+	return combined.partialResult()
+}
@@ -0,0 +1,83 @@
+package flamegraph
+
+import (
+	"testing"
+
+	"github.com/getsentry/vroom/internal/examples"
+	"github.com/getsentry/vroom/internal/frame"
+	"github.com/getsentry/vroom/internal/nodetree"
+	"github.com/getsentry/vroom/internal/speedscope"
+	"github.com/getsentry/vroom/internal/testutil"
+)
+
+func TestAddCallTreeToFlamegraphSize(t *testing.T) {
+	callTree := func() []*nodetree.Node {
+		return []*nodetree.Node{
+			{
+				Name:        "main",
+				DurationNS:  20,
+				SampleCount: 2,
+				Frame:       frame.Frame{Function: "main"},
+				Profiles:    make(map[examples.ExampleMetadata]struct{}),
+				Children: []*nodetree.Node{
+					{
+						Name:        "work",
+						DurationNS:  10,
+						SampleCount: 1,
+						Frame:       frame.Frame{Function: "work"},
+						Profiles:    make(map[examples.ExampleMetadata]struct{}),
+					},
+				},
+			},
+		}
+	}
+	example := examples.ExampleMetadata{ProfileID: "1"}
+
+	nodeSize := (&nodetree.Node{}).SizeBytes()
+	var tree []*nodetree.Node
+	added := addCallTreeToFlamegraph(&tree, callTree(), annotateWithProfileExample(example), noDiffSide)
+	if added < 2*nodeSize {
+		t.Fatalf("expected at least the size of 2 nodes, got %d", added)
+	}
+	// Merging the same stacks for the same example doesn't add any node.
+	added = addCallTreeToFlamegraph(&tree, callTree(), annotateWithProfileExample(example), noDiffSide)
+	if added >= nodeSize {
+		t.Fatalf("expected less than the size of a node, got %d", added)
+	}
+}
+
+func TestMemoryBudgetPartialResult(t *testing.T) {
+	tests := []struct {
+		name   string
+		budget *memoryBudget
+		output *speedscope.PartialResult
+	}{
+		{
+			name:   "no limit",
+			budget: &memoryBudget{used: 1 << 40, total: 3},
+			output: nil,
+		},
+		{
+			name:   "exceeded on the last candidate",
+			budget: &memoryBudget{limit: 10, used: 20, total: 3},
+			output: nil,
+		},
+		{
+			name:   "candidates skipped",
+			budget: &memoryBudget{limit: 10, used: 20, skipped: 2, total: 3},
+			output: &speedscope.PartialResult{
+				Reason:              PartialReasonMemoryBudget,
+				CandidatesProcessed: 1,
+				CandidatesTotal:     3,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := testutil.Diff(test.budget.partialResult(), test.output); diff != "" {
+				t.Fatalf("Result mismatch: got - want +\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package flamegraph
+
+import (
+	"errors"
+
+	"github.com/getsentry/vroom/internal/frame"
+	"github.com/getsentry/vroom/internal/nodetree"
+)
+
+type (
+	// FunctionFilter matches a function either by its fingerprint or by its
+	// package and name.
+	FunctionFilter struct {
+		Fingerprint uint32 `json:"fingerprint"`
+		Package     string `json:"package"`
+		Function    string `json:"function"`
+	}
+
+	// ExcludeFilter removes a function from the flamegraph. By default, all
+	// the stacks going through the function are dropped. With HideFrame, only
+	// the frame is removed and its children are attached to its parent.
+	ExcludeFilter struct {
+		FunctionFilter
+
+		HideFrame bool `json:"hide_frame"`
+	}
+
+	// nodeWeights holds the weights removed from a subtree so they can be
+	// removed from its ancestors as well.
+	nodeWeights struct {
+		sampleCount int
+		durationNS  uint64
+		diff        nodetree.DiffWeights
+	}
+)
+
+var ErrInvalidFunctionFilter = errors.New("a function filter needs a fingerprint or a function")
+
+// Validate returns an error if the filter can't match any function.
+func (f FunctionFilter) Validate() error {
+	if f.Fingerprint == 0 && f.Function == "" {
+		return ErrInvalidFunctionFilter
+	}
+	return nil
+}
+
+func (f FunctionFilter) matches(n *nodetree.Node) bool {
+	if f.Fingerprint != 0 {
+		// Node.Package is already the module or the trimmed package of the
+		// frame so it hashes like the original frame.
+		return frame.Frame{Module: n.Package, Function: n.Name}.Fingerprint() == f.Fingerprint
+	}
+	return n.Name == f.Function && n.Package == f.Package
+}
+
+// focusTree re-roots the tree at every call of the focused function and
+// drops the stacks not going through it. Recursive calls are kept under the
+// outermost call.
+func focusTree(trees []*nodetree.Node, f FunctionFilter) []*nodetree.Node {
+	var roots []*nodetree.Node
+	var walk func(nodes []*nodetree.Node)
+	walk = func(nodes []*nodetree.Node) {
+		for _, n := range nodes {
+			if f.matches(n) {
+				mergeNodes(&roots, []*nodetree.Node{n}, nil)
+				continue
+			}
+			walk(n.Children)
+		}
+	}
+	walk(trees)
+	return roots
+}
+
+// excludeNodes applies the exclude filters to the nodes and returns the
+// nodes left along with the weights of the dropped stacks.
+func excludeNodes(nodes []*nodetree.Node, filters []ExcludeFilter) ([]*nodetree.Node, nodeWeights) {
+	var dropped nodeWeights
+	var kept []*nodetree.Node
+	for _, n := range nodes {
+		f := matchingExcludeFilter(filters, n)
+		if f != nil && !f.HideFrame {
+			dropped.add(n)
+			continue
+		}
+		children, d := excludeNodes(n.Children, filters)
+		dropped.addWeights(d)
+		if f != nil {
+			// Samples ending on the hidden frame now end on its parent.
+			mergeNodes(&kept, children, nil)
+			continue
+		}
+		d.subtractFrom(n)
+		if n.SampleCount <= 0 {
+			dropped.add(n)
+			continue
+		}
+		n.Children = children
+		mergeNodes(&kept, []*nodetree.Node{n}, nil)
+	}
+	return kept, dropped
+}
+
+func matchingExcludeFilter(filters []ExcludeFilter, n *nodetree.Node) *ExcludeFilter {
+	var hide *ExcludeFilter
+	for i, f := range filters {
+		if !f.matches(n) {
+			continue
+		}
+		// Dropping the stacks takes precedence over hiding the frame.
+		if !f.HideFrame {
+			return &filters[i]
+		}
+		hide = &filters[i]
+	}
+	return hide
+}
+
+func (w *nodeWeights) add(n *nodetree.Node) {
+	w.sampleCount += n.SampleCount
+	w.durationNS += n.DurationNS
+	if n.Diff != nil {
+		w.diff.BaselineSampleCount += n.Diff.BaselineSampleCount
+		w.diff.TargetSampleCount += n.Diff.TargetSampleCount
+	}
+}
+
+func (w *nodeWeights) addWeights(o nodeWeights) {
+	w.sampleCount += o.sampleCount
+	w.durationNS += o.durationNS
+	w.diff.BaselineSampleCount += o.diff.BaselineSampleCount
+	w.diff.TargetSampleCount += o.diff.TargetSampleCount
+}
+
+func (w nodeWeights) subtractFrom(n *nodetree.Node) {
+	n.SampleCount -= w.sampleCount
+	n.DurationNS -= min(n.DurationNS, w.durationNS)
+	if n.Diff != nil {
+		n.Diff.BaselineSampleCount -= w.diff.BaselineSampleCount
+		n.Diff.TargetSampleCount -= w.diff.TargetSampleCount
+	}
+}
@@ -0,0 +1,196 @@
+package flamegraph
+
+import (
+	"testing"
+
+	"github.com/getsentry/vroom/internal/frame"
+	"github.com/getsentry/vroom/internal/nodetree"
+	"github.com/getsentry/vroom/internal/testutil"
+)
+
+func TestFunctionFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		input   []*nodetree.Node
+		output  []*nodetree.Node
+	}{
+		{
+			name: "focus re-roots stacks",
+			options: Options{
+				Focus: &FunctionFilter{Package: "db", Function: "query"},
+			},
+			input: []*nodetree.Node{
+				{
+					Name:        "main",
+					SampleCount: 10,
+					DurationNS:  100,
+					Children: []*nodetree.Node{
+						{
+							Name:        "handler",
+							SampleCount: 6,
+							DurationNS:  60,
+							Children: []*nodetree.Node{
+								{
+									Name:        "query",
+									Package:     "db",
+									SampleCount: 4,
+									DurationNS:  40,
+									Children: []*nodetree.Node{
+										{
+											Name:        "query",
+											Package:     "db",
+											SampleCount: 1,
+											DurationNS:  10,
+										},
+									},
+								},
+							},
+						},
+						{
+							Name:        "query",
+							Package:     "db",
+							SampleCount: 2,
+							DurationNS:  20,
+							Children: []*nodetree.Node{
+								{Name: "read", SampleCount: 2, DurationNS: 20},
+							},
+						},
+						{Name: "render", SampleCount: 2, DurationNS: 20},
+					},
+				},
+			},
+			output: []*nodetree.Node{
+				{
+					Name:        "query",
+					Package:     "db",
+					SampleCount: 6,
+					DurationNS:  60,
+					Children: []*nodetree.Node{
+						{
+							Name:        "query",
+							Package:     "db",
+							SampleCount: 1,
+							DurationNS:  10,
+						},
+						{Name: "read", SampleCount: 2, DurationNS: 20},
+					},
+				},
+			},
+		},
+		{
+			name: "focus by fingerprint",
+			options: Options{
+				Focus: &FunctionFilter{
+					Fingerprint: frame.Frame{Module: "db", Function: "query"}.Fingerprint(),
+				},
+			},
+			input: []*nodetree.Node{
+				{
+					Name:        "main",
+					SampleCount: 3,
+					Children: []*nodetree.Node{
+						{Name: "query", Package: "db", SampleCount: 2},
+						{Name: "query", Package: "cache", SampleCount: 1},
+					},
+				},
+			},
+			output: []*nodetree.Node{
+				{Name: "query", Package: "db", SampleCount: 2},
+			},
+		},
+		{
+			name: "exclude drops stacks",
+			options: Options{
+				Exclude: []ExcludeFilter{
+					{FunctionFilter: FunctionFilter{Function: "gc"}},
+				},
+			},
+			input: []*nodetree.Node{
+				{
+					Name:        "main",
+					SampleCount: 10,
+					DurationNS:  100,
+					Children: []*nodetree.Node{
+						{
+							Name:        "handler",
+							SampleCount: 6,
+							DurationNS:  60,
+							Children: []*nodetree.Node{
+								{Name: "gc", SampleCount: 2, DurationNS: 20},
+								{Name: "render", SampleCount: 4, DurationNS: 40},
+							},
+						},
+						{
+							Name:        "idle",
+							SampleCount: 4,
+							DurationNS:  40,
+							Children: []*nodetree.Node{
+								{Name: "gc", SampleCount: 4, DurationNS: 40},
+							},
+						},
+					},
+				},
+			},
+			output: []*nodetree.Node{
+				{
+					Name:        "main",
+					SampleCount: 4,
+					DurationNS:  40,
+					Children: []*nodetree.Node{
+						{
+							Name:        "handler",
+							SampleCount: 4,
+							DurationNS:  40,
+							Children: []*nodetree.Node{
+								{Name: "render", SampleCount: 4, DurationNS: 40},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "exclude hides frame",
+			options: Options{
+				Exclude: []ExcludeFilter{
+					{FunctionFilter: FunctionFilter{Function: "wrapper"}, HideFrame: true},
+				},
+			},
+			input: []*nodetree.Node{
+				{
+					Name:        "main",
+					SampleCount: 5,
+					Children: []*nodetree.Node{
+						{
+							Name:        "wrapper",
+							SampleCount: 3,
+							Children: []*nodetree.Node{
+								{Name: "work", SampleCount: 3},
+							},
+						},
+						{Name: "work", SampleCount: 2},
+					},
+				},
+			},
+			output: []*nodetree.Node{
+				{
+					Name:        "main",
+					SampleCount: 5,
+					Children: []*nodetree.Node{
+						{Name: "work", SampleCount: 5},
+					},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output := pruneTree(test.input, test.options)
+			if diff := testutil.Diff(output, test.output, ignoreDurations); diff != "" {
+				t.Fatalf("Result mismatch: got - want +\n%s", diff)
+			}
+		})
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/getsentry/vroom/internal/metrics"
 	"github.com/getsentry/vroom/internal/nodetree"
 	"github.com/getsentry/vroom/internal/profile"
+	"github.com/getsentry/vroom/internal/quantile"
 	"github.com/getsentry/vroom/internal/speedscope"
 	"github.com/getsentry/vroom/internal/storageutil"
 )
@@ -28,6 +29,22 @@ type (
 	}
 
 	CallTrees map[uint64][]*nodetree.Node
+
+	// Candidates is a set of profiles and chunks aggregated together.
+	Candidates struct {
+		Transaction []examples.TransactionProfileCandidate `json:"transaction"`
+		Continuous  []examples.ContinuousProfileCandidate  `json:"continuous"`
+	}
+
+	// diffSide tells which set of candidates a call tree belongs to when
+	// building a differential flamegraph.
+	diffSide int
+)
+
+const (
+	noDiffSide diffSide = iota
+	baselineSide
+	targetSide
 )
 
 var void = struct{}{}
@@ -55,7 +72,18 @@ func annotateWithProfileExample(example examples.ExampleMetadata) func(n *nodetr
 	}
 }
 
-func addCallTreeToFlamegraph(flamegraphTree *[]*nodetree.Node, callTree []*nodetree.Node, annotate func(n *nodetree.Node)) {
+// addCallTreeToFlamegraph merges a call tree into the flamegraph tree and
+// returns an estimate of the bytes it added to it.
+//
+// When side is set, the sample count of each merged node is also recorded
+// for that side in order to build a differential flamegraph.
+func addCallTreeToFlamegraph(
+	flamegraphTree *[]*nodetree.Node,
+	callTree []*nodetree.Node,
+	annotate func(n *nodetree.Node),
+	side diffSide,
+) int64 {
+	var added int64
 	for _, node := range callTree {
 		var currentNode *nodetree.Node
 		if existingNode := getMatchingNode(flamegraphTree, node); existingNode != nil {
@@ -64,16 +92,37 @@ func addCallTreeToFlamegraph(flamegraphTree *[]*nodetree.Node, callTree []*nodet
 			currentNode.SampleCount += node.SampleCount
 			currentNode.DurationNS += node.DurationNS
 			currentNode.SelfTimeNS += node.SelfTimeNS
-			currentNode.DurationsNS = append(currentNode.DurationsNS, node.DurationsNS...)
+			sketchSize := currentNode.Durations.SizeBytes()
+			currentNode.AddDurations(node)
+			added += int64(currentNode.Durations.SizeBytes() - sketchSize)
 		} else {
 			currentNode = node.ShallowCopyWithoutChildren()
+			if currentNode.Durations == nil {
+				currentNode.AddDurations(node)
+			}
 			*flamegraphTree = append(*flamegraphTree, currentNode)
+			added += currentNode.SizeBytes()
 		}
-		addCallTreeToFlamegraph(&currentNode.Children, node.Children, annotate)
+		switch side {
+		case baselineSide:
+			if currentNode.Diff == nil {
+				currentNode.Diff = &nodetree.DiffWeights{}
+			}
+			currentNode.Diff.BaselineSampleCount += node.SampleCount
+		case targetSide:
+			if currentNode.Diff == nil {
+				currentNode.Diff = &nodetree.DiffWeights{}
+			}
+			currentNode.Diff.TargetSampleCount += node.SampleCount
+		}
+		added += addCallTreeToFlamegraph(&currentNode.Children, node.Children, annotate, side)
 		if node.SampleCount > sumNodesSampleCount(node.Children) {
+			profiles := len(currentNode.Profiles)
 			annotate(currentNode)
+			added += int64(len(currentNode.Profiles)-profiles) * exampleSize
 		}
 	}
+	return added
 }
 
 type (
@@ -93,13 +142,20 @@ type (
 		// including the ones that were dropped due to them exceeding
 		// the max samples limit.
 		totalSamples int
+
+		// Only filled when building a differential flamegraph.
+		differential         bool
+		sampleBaselineCounts []uint64
+		sampleTargetCounts   []uint64
 	}
 
 	flamegraphSample struct {
-		stack    []int
-		count    uint64 // count refers to the individual sample counts
-		duration uint64
-		profiles map[examples.ExampleMetadata]struct{}
+		stack         []int
+		count         uint64 // count refers to the individual sample counts
+		duration      uint64
+		profiles      map[examples.ExampleMetadata]struct{}
+		baselineCount uint64
+		targetCount   uint64
 	}
 )
 
@@ -130,6 +186,10 @@ func (f *flamegraph) Swap(i, j int) {
 	f.samplesProfiles[i], f.samplesProfiles[j] = f.samplesProfiles[j], f.samplesProfiles[i]
 	f.sampleCounts[i], f.sampleCounts[j] = f.sampleCounts[j], f.sampleCounts[i]
 	f.sampleDurationsNs[i], f.sampleDurationsNs[j] = f.sampleDurationsNs[j], f.sampleDurationsNs[i]
+	if f.differential {
+		f.sampleBaselineCounts[i], f.sampleBaselineCounts[j] = f.sampleBaselineCounts[j], f.sampleBaselineCounts[i]
+		f.sampleTargetCounts[i], f.sampleTargetCounts[j] = f.sampleTargetCounts[j], f.sampleTargetCounts[i]
+	}
 }
 
 func (f *flamegraph) Push(item any) {
@@ -139,6 +199,10 @@ func (f *flamegraph) Push(item any) {
 	f.sampleCounts = append(f.sampleCounts, sample.count)
 	f.sampleDurationsNs = append(f.sampleDurationsNs, sample.duration)
 	f.samplesProfiles = append(f.samplesProfiles, f.getProfilesIndices(sample.profiles))
+	if f.differential {
+		f.sampleBaselineCounts = append(f.sampleBaselineCounts, sample.baselineCount)
+		f.sampleTargetCounts = append(f.sampleTargetCounts, sample.targetCount)
+	}
 }
 
 func (f *flamegraph) Pop() any {
@@ -161,6 +225,13 @@ func (f *flamegraph) Pop() any {
 	f.sampleDurationsNs = f.sampleDurationsNs[0:n]
 	f.samplesProfiles = f.samplesProfiles[0:n]
 
+	if f.differential {
+		sample.baselineCount = f.sampleBaselineCounts[n]
+		sample.targetCount = f.sampleTargetCounts[n]
+		f.sampleBaselineCounts = f.sampleBaselineCounts[0:n]
+		f.sampleTargetCounts = f.sampleTargetCounts[0:n]
+	}
+
 	return sample
 }
 
@@ -182,6 +253,8 @@ func toSpeedscope(
 		profilesIndex: make(map[examples.ExampleMetadata]int),
 		samples:       make([][]int, 0),
 		sampleCounts:  make([]uint64, 0),
+		// A differential tree has weights recorded for each side on every node.
+		differential: len(trees) > 0 && trees[0].Diff != nil,
 	}
 	for _, tree := range trees {
 		stack := make([]int, 0, profile.MaxStackDepth)
@@ -189,12 +262,9 @@ func toSpeedscope(
 	}
 
 	for i, frameInfo := range fd.frameInfos {
-		sort.Slice(frameInfo.DurationsNS, func(i, j int) bool {
-			return frameInfo.DurationsNS[i] < frameInfo.DurationsNS[j]
-		})
-		frameInfo.P75Duration, _ = metrics.Quantile(frameInfo.DurationsNS, 0.75)
-		frameInfo.P95Duration, _ = metrics.Quantile(frameInfo.DurationsNS, 0.95)
-		frameInfo.P99Duration, _ = metrics.Quantile(frameInfo.DurationsNS, 0.99)
+		frameInfo.P75Duration, _ = frameInfo.Durations.Quantile(0.75)
+		frameInfo.P95Duration, _ = frameInfo.Durations.Quantile(0.95)
+		frameInfo.P99Duration, _ = frameInfo.Durations.Quantile(0.99)
 		fd.frameInfos[i] = frameInfo
 	}
 
@@ -208,6 +278,8 @@ func toSpeedscope(
 		Weights:           fd.sampleCounts,
 		SampleCounts:      fd.sampleCounts,
 		SampleDurationsNs: fd.sampleDurationsNs,
+		BaselineWeights:   fd.sampleBaselineCounts,
+		TargetWeights:     fd.sampleTargetCounts,
 		IsMainThread:      true,
 		Type:              speedscope.ProfileTypeSampled,
 		Unit:              speedscope.ValueUnitCount,
@@ -242,7 +314,16 @@ func (f *flamegraph) visitCalltree(node *nodetree.Node, currentStack *[]int) {
 		f.frameInfos[i].Weight += node.DurationNS
 		f.frameInfos[i].SumDuration += node.DurationNS
 		f.frameInfos[i].SumSelfTime += node.SelfTimeNS
-		f.frameInfos[i].DurationsNS = append(f.frameInfos[i].DurationsNS, node.DurationsNS...)
+		if node.Durations != nil {
+			f.frameInfos[i].Durations.Merge(node.Durations)
+		} else {
+			f.frameInfos[i].Durations.Add(node.DurationNS)
+		}
+		if node.Diff != nil {
+			f.frameInfos[i].BaselineWeight += uint64(node.Diff.BaselineSampleCount)
+			f.frameInfos[i].TargetWeight += uint64(node.Diff.TargetSampleCount)
+			setWeightDelta(&f.frameInfos[i])
+		}
 	} else {
 		frame := node.ToFrame()
 		sfr := speedscope.Frame{
@@ -259,30 +340,49 @@ func (f *flamegraph) visitCalltree(node *nodetree.Node, currentStack *[]int) {
 		f.framesIndex[frameID] = len(f.frames)
 		*currentStack = append(*currentStack, len(f.frames))
 		f.frames = append(f.frames, sfr)
-		f.frameInfos = append(f.frameInfos, speedscope.FrameInfo{
+		frameInfo := speedscope.FrameInfo{
 			Count:       node.Occurrence,
 			Weight:      node.DurationNS,
 			SumDuration: node.DurationNS,
 			SumSelfTime: node.SelfTimeNS,
-			DurationsNS: node.DurationsNS,
-		})
+			Durations:   node.Durations.Clone(),
+		}
+		if frameInfo.Durations == nil {
+			frameInfo.Durations = quantile.Of(node.DurationNS)
+		}
+		if node.Diff != nil {
+			frameInfo.BaselineWeight = uint64(node.Diff.BaselineSampleCount)
+			frameInfo.TargetWeight = uint64(node.Diff.TargetSampleCount)
+			setWeightDelta(&frameInfo)
+		}
+		f.frameInfos = append(f.frameInfos, frameInfo)
 	}
 
 	// base case (when we reach leaf frames)
 	if node.Children == nil {
+		var weights nodetree.DiffWeights
+		if node.Diff != nil {
+			weights = *node.Diff
+		}
 		f.addSample(
 			currentStack,
 			uint64(node.SampleCount),
 			node.DurationNS,
 			node.Profiles,
+			weights,
 		)
 	} else {
 		totChildrenSampleCount := 0
 		var totChildrenDuration uint64
+		var totChildrenWeights nodetree.DiffWeights
 		// else we call visitTree recursively on the children
 		for _, childNode := range node.Children {
 			totChildrenSampleCount += childNode.SampleCount
 			totChildrenDuration += childNode.DurationNS
+			if childNode.Diff != nil {
+				totChildrenWeights.BaselineSampleCount += childNode.Diff.BaselineSampleCount
+				totChildrenWeights.TargetSampleCount += childNode.Diff.TargetSampleCount
+			}
 			f.visitCalltree(childNode, currentStack)
 		}
 
@@ -292,11 +392,17 @@ func (f *flamegraph) visitCalltree(node *nodetree.Node, currentStack *[]int) {
 		diffCount := node.SampleCount - totChildrenSampleCount
 		diffDuration := node.DurationNS - totChildrenDuration
 		if diffCount > 0 {
+			var weights nodetree.DiffWeights
+			if node.Diff != nil {
+				weights.BaselineSampleCount = max(node.Diff.BaselineSampleCount-totChildrenWeights.BaselineSampleCount, 0)
+				weights.TargetSampleCount = max(node.Diff.TargetSampleCount-totChildrenWeights.TargetSampleCount, 0)
+			}
 			f.addSample(
 				currentStack,
 				uint64(diffCount),
 				diffDuration,
 				node.Profiles,
+				weights,
 			)
 		}
 	}
@@ -304,21 +410,31 @@ func (f *flamegraph) visitCalltree(node *nodetree.Node, currentStack *[]int) {
 	*currentStack = (*currentStack)[:len(*currentStack)-1]
 }
 
+// setWeightDelta sets the difference between the target and baseline weights
+// of a frame of a differential flamegraph.
+func setWeightDelta(frameInfo *speedscope.FrameInfo) {
+	delta := int64(frameInfo.TargetWeight) - int64(frameInfo.BaselineWeight)
+	frameInfo.WeightDelta = &delta
+}
+
 func (f *flamegraph) addSample(
 	stack *[]int,
 	count uint64,
 	duration uint64,
 	profiles map[examples.ExampleMetadata]struct{},
+	weights nodetree.DiffWeights,
 ) {
 	f.totalSamples++
 	cp := make([]int, len(*stack))
 	copy(cp, *stack)
 
 	heap.Push(f, flamegraphSample{
-		stack:    cp,
-		count:    count,
-		duration: duration,
-		profiles: profiles,
+		stack:         cp,
+		count:         count,
+		duration:      duration,
+		profiles:      profiles,
+		baselineCount: uint64(weights.BaselineSampleCount),
+		targetCount:   uint64(weights.TargetSampleCount),
 	})
 	for f.overCapacity() {
 		heap.Pop(f)
@@ -367,13 +483,232 @@ func GetFlamegraphFromCandidates(
 	continuousProfileCandidates []examples.ContinuousProfileCandidate,
 	jobs chan storageutil.ReadJob,
 	ma *metrics.Aggregator,
+	opts Options,
+	span *sentry.Span,
+) (speedscope.Output, error) {
+	var flamegraphTree []*nodetree.Node
+
+	budget := newMemoryBudget(
+		opts.MemoryBudget,
+		len(transactionProfileCandidates)+len(continuousProfileCandidates),
+	)
+	err := addCandidatesToFlamegraph(
+		ctx,
+		storage,
+		organizationID,
+		transactionProfileCandidates,
+		continuousProfileCandidates,
+		jobs,
+		ma,
+		span,
+		&flamegraphTree,
+		noDiffSide,
+		budget,
+	)
+	if err != nil {
+		return speedscope.Output{}, err
+	}
+
+	serializeSpan := span.StartChild("serialize")
+	defer serializeSpan.Finish()
+
+	flamegraphTree = pruneTree(flamegraphTree, opts)
+	sp := toSpeedscope(ctx, flamegraphTree, opts.maxSamples(), 0)
+	sp.Partial = budget.partialResult()
+	if ma != nil {
+		fm := ma.ToMetrics()
+		sp.Metrics = &fm
+	}
+	return sp, nil
+}
+
+// GetFlamegraphTreeFromCandidates merges the call trees of all the candidates
+// into a single tree without serializing it. The sample cap doesn't apply
+// since samples are only capped when serializing. A partial result is
+// returned when the memory budget was exceeded.
+func GetFlamegraphTreeFromCandidates(
+	ctx context.Context,
+	storage *blob.Bucket,
+	organizationID uint64,
+	transactionProfileCandidates []examples.TransactionProfileCandidate,
+	continuousProfileCandidates []examples.ContinuousProfileCandidate,
+	jobs chan storageutil.ReadJob,
+	opts Options,
+	span *sentry.Span,
+) ([]*nodetree.Node, *speedscope.PartialResult, error) {
+	var flamegraphTree []*nodetree.Node
+
+	budget := newMemoryBudget(
+		opts.MemoryBudget,
+		len(transactionProfileCandidates)+len(continuousProfileCandidates),
+	)
+	err := addCandidatesToFlamegraph(
+		ctx,
+		storage,
+		organizationID,
+		transactionProfileCandidates,
+		continuousProfileCandidates,
+		jobs,
+		nil,
+		span,
+		&flamegraphTree,
+		noDiffSide,
+		budget,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pruneTree(flamegraphTree, opts), budget.partialResult(), nil
+}
+
+// GetDifferentialFlamegraphFromCandidates merges the call trees of a baseline
+// and a target set of candidates into a single flamegraph where each frame
+// and sample carries the weight of each side.
+func GetDifferentialFlamegraphFromCandidates(
+	ctx context.Context,
+	storage *blob.Bucket,
+	organizationID uint64,
+	baseline Candidates,
+	target Candidates,
+	jobs chan storageutil.ReadJob,
+	opts Options,
 	span *sentry.Span,
 ) (speedscope.Output, error) {
+	var flamegraphTree []*nodetree.Node
+
+	// Each side gets half of the budget so a baseline using all of it can't
+	// leave the target out of the comparison.
+	sideBudget := (opts.MemoryBudget + 1) / 2
+	sides := []struct {
+		candidates Candidates
+		side       diffSide
+		budget     *memoryBudget
+	}{
+		{baseline, baselineSide, newMemoryBudget(sideBudget, len(baseline.Transaction)+len(baseline.Continuous))},
+		{target, targetSide, newMemoryBudget(sideBudget, len(target.Transaction)+len(target.Continuous))},
+	}
+	for _, s := range sides {
+		err := addCandidatesToFlamegraph(
+			ctx,
+			storage,
+			organizationID,
+			s.candidates.Transaction,
+			s.candidates.Continuous,
+			jobs,
+			nil,
+			span,
+			&flamegraphTree,
+			s.side,
+			s.budget,
+		)
+		if err != nil {
+			return speedscope.Output{}, err
+		}
+	}
+
+	serializeSpan := span.StartChild("serialize")
+	defer serializeSpan.Finish()
+
+	flamegraphTree = pruneTree(flamegraphTree, opts)
+	sp := toSpeedscope(ctx, flamegraphTree, opts.maxSamples(), 0)
+	sp.Partial = combinedPartialResult(sides[0].budget, sides[1].budget)
+	return sp, nil
+}
+
+// GetFunctionMetricsFromCandidates aggregates the functions of all the
+// candidates without building a flamegraph. A partial result is returned when
+// the aggregator grew over the memory budget, 0 meaning there is no limit.
+func GetFunctionMetricsFromCandidates(
+	ctx context.Context,
+	storage *blob.Bucket,
+	organizationID uint64,
+	transactionProfileCandidates []examples.TransactionProfileCandidate,
+	continuousProfileCandidates []examples.ContinuousProfileCandidate,
+	jobs chan storageutil.ReadJob,
+	ma *metrics.Aggregator,
+	memoryBudget int64,
+	span *sentry.Span,
+) ([]examples.FunctionMetrics, *speedscope.PartialResult, error) {
+	budget := newMemoryBudget(
+		memoryBudget,
+		len(transactionProfileCandidates)+len(continuousProfileCandidates),
+	)
+	err := addCandidatesToFlamegraph(
+		ctx,
+		storage,
+		organizationID,
+		transactionProfileCandidates,
+		continuousProfileCandidates,
+		jobs,
+		ma,
+		span,
+		nil,
+		noDiffSide,
+		budget,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ma.ToMetrics(), budget.partialResult(), nil
+}
+
+// addFunctionsToAggregator extracts the functions of the call trees of a
+// candidate and adds them to the aggregator, returning an estimate of the
+// bytes it grew by. When functions are aggregated
+// by thread, they're extracted for each thread on its own so they're not
+// merged across threads first. When they're aggregated by package, packages
+// are extracted from the call trees directly so calls nested in the same
+// package aren't counted twice.
+func addFunctionsToAggregator[T comparable](
+	ma *metrics.Aggregator,
+	callTrees map[T][]*nodetree.Node,
+	example examples.ExampleMetadata,
+) int64 {
+	extract := metrics.ExtractFunctionsFromCallTrees[T]
+	if ma.Key == metrics.KeyPackage || ma.Key == metrics.KeyPackageAndThread {
+		extract = metrics.ExtractPackagesFromCallTrees[T]
+	}
+	if ma.Key != metrics.KeyPackageAndThread {
+		functions := metrics.CapAndFilterFunctions(extract(callTrees, ma.MinDepth), int(ma.MaxUniqueFunctions), true)
+		return ma.AddFunctions(functions, example)
+	}
+	var added int64
+	for threadID, callTreesForThread := range callTrees {
+		threadCallTrees := map[T][]*nodetree.Node{threadID: callTreesForThread}
+		functions := metrics.CapAndFilterFunctions(extract(threadCallTrees, ma.MinDepth), int(ma.MaxUniqueFunctions), true)
+		added += ma.AddFunctions(functions, example)
+	}
+	return added
+}
+
+// addCandidatesToFlamegraph reads the call trees of the candidates and merges
+// them into the flamegraph tree. When the tree is nil, only the functions are
+// aggregated.
+func addCandidatesToFlamegraph(
+	ctx context.Context,
+	storage *blob.Bucket,
+	organizationID uint64,
+	transactionProfileCandidates []examples.TransactionProfileCandidate,
+	continuousProfileCandidates []examples.ContinuousProfileCandidate,
+	jobs chan storageutil.ReadJob,
+	ma *metrics.Aggregator,
+	span *sentry.Span,
+	flamegraphTree *[]*nodetree.Node,
+	side diffSide,
+	budget *memoryBudget,
+) error {
 	hub := sentry.GetHubFromContext(ctx)
 
+	if budget.exceeded() {
+		budget.skip(len(transactionProfileCandidates) + len(continuousProfileCandidates))
+		return nil
+	}
+	// Reads still queued are canceled once the budget is exceeded.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	results := make(chan storageutil.ReadJobResult)
 	defer close(results)
-
 	go func() {
 		dispatchSpan := span.StartChild("dispatch candidates")
 		dispatchSpan.SetData("transaction_candidates", len(transactionProfileCandidates))
@@ -409,8 +744,6 @@ func GetFlamegraphFromCandidates(
 		dispatchSpan.Finish()
 	}()
 
-	var flamegraphTree []*nodetree.Node
-
 	flamegraphSpan := span.StartChild("processing candidates")
 
 	numCandidates := len(transactionProfileCandidates) + len(continuousProfileCandidates)
@@ -418,11 +751,21 @@ func GetFlamegraphFromCandidates(
 	for i := 0; i < numCandidates; i++ {
 		res := <-results
 
+		if budget.exceeded() {
+			// Results are still drained since the workers write to the
+			// channel until all the candidates were dispatched.
+			budget.skip(1)
+			continue
+		}
+
 		err := res.Error()
 		if err != nil {
 			if errors.Is(err, storageutil.ErrObjectNotFound) {
 				continue
 			}
+			if errors.Is(err, context.Canceled) {
+				continue
+			}
 			if errors.Is(err, context.DeadlineExceeded) {
 				// Since we set an artificially lower timeout
 				// (10s < 15s), if we exceeded the deadline
@@ -451,21 +794,25 @@ func GetFlamegraphFromCandidates(
 			)
 			annotate := annotateWithProfileExample(example)
 
-			for _, callTree := range result.CallTrees {
-				addCallTreeToFlamegraph(&flamegraphTree, callTree, annotate)
+			var added int64
+			if flamegraphTree != nil {
+				for _, callTree := range result.CallTrees {
+					added += addCallTreeToFlamegraph(flamegraphTree, callTree, annotate, side)
+				}
 			}
 			// if metrics aggregator is not null, while we're at it,
 			// compute the metrics as well
 			if ma != nil {
-				functions := metrics.CapAndFilterFunctions(metrics.ExtractFunctionsFromCallTrees(result.CallTrees, ma.MinDepth), int(ma.MaxUniqueFunctions), true)
-				ma.AddFunctions(functions, example)
+				added += addFunctionsToAggregator(ma, result.CallTrees, example)
 			}
 
 			transactionProfileSpan.Finish()
+			budget.add(added)
 		} else if result, ok := res.(chunk.CallTreesReadJobResult); ok {
 			chunkProfileSpan := span.StartChild("calltree")
 			chunkProfileSpan.Description = "continuous profile"
 
+			var added int64
 			for threadID, callTree := range result.CallTrees {
 				if result.Start > 0 && result.End > 0 {
 					interval := examples.Interval{
@@ -484,33 +831,31 @@ func GetFlamegraphFromCandidates(
 					result.Start,
 					result.End,
 				)
-				annotate := annotateWithProfileExample(example)
-
-				addCallTreeToFlamegraph(&flamegraphTree, callTree, annotate)
+				if flamegraphTree != nil {
+					annotate := annotateWithProfileExample(example)
+					added += addCallTreeToFlamegraph(flamegraphTree, callTree, annotate, side)
+				}
 
 				// if metrics aggregator is not null, while we're at it,
 				// compute the metrics as well
 				if ma != nil {
-					functions := metrics.CapAndFilterFunctions(metrics.ExtractFunctionsFromCallTreesForThread(callTree, ma.MinDepth), int(ma.MaxUniqueFunctions), true)
-					ma.AddFunctions(functions, example)
+					callTrees := map[string][]*nodetree.Node{threadID: callTree}
+					added += addFunctionsToAggregator(ma, callTrees, example)
 				}
 			}
 			chunkProfileSpan.Finish()
+			budget.add(added)
 		} else {
 			// This should never happen
-			return speedscope.Output{}, errors.New("unexpected result from storage")
+			return errors.New("unexpected result from storage")
+		}
+		if budget.exceeded() {
+			cancel()
 		}
 	}
 
+	flamegraphSpan.SetData("candidates_skipped", budget.skipped)
 	flamegraphSpan.Finish()
 
-	serializeSpan := span.StartChild("serialize")
-	defer serializeSpan.Finish()
-
-	sp := toSpeedscope(ctx, flamegraphTree, 1000, 0)
-	if ma != nil {
-		fm := ma.ToMetrics()
-		sp.Metrics = &fm
-	}
-	return sp, nil
+	return nil
 }
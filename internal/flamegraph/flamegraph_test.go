@@ -2,10 +2,14 @@ package flamegraph
 
 import (
 	"context"
+	"encoding/json"
+	"strings"
 	"testing"
 
+	"github.com/getsentry/sentry-go"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"gocloud.dev/blob/memblob"
 
 	"github.com/getsentry/vroom/internal/examples"
 	"github.com/getsentry/vroom/internal/frame"
@@ -14,7 +18,9 @@ import (
 	"github.com/getsentry/vroom/internal/profile"
 	"github.com/getsentry/vroom/internal/sample"
 	"github.com/getsentry/vroom/internal/speedscope"
+	"github.com/getsentry/vroom/internal/storageutil"
 	"github.com/getsentry/vroom/internal/testutil"
+	"github.com/getsentry/vroom/internal/transaction"
 )
 
 func TestFlamegraphAggregation(t *testing.T) {
@@ -496,11 +502,11 @@ func TestFlamegraphAggregation(t *testing.T) {
 				example := examples.ExampleMetadata{
 					ProfileID: p.ID(),
 				}
-				addCallTreeToFlamegraph(&ft, callTrees[0], annotateWithProfileExample(example))
+				addCallTreeToFlamegraph(&ft, callTrees[0], annotateWithProfileExample(example), noDiffSide)
 			}
 
 			options := cmp.Options{
-				cmpopts.IgnoreFields(speedscope.FrameInfo{}, "DurationsNS"),
+				cmpopts.IgnoreFields(speedscope.FrameInfo{}, "Durations"),
 			}
 
 			speedscope := toSpeedscope(context.TODO(), ft, 10, 99)
@@ -582,8 +588,22 @@ func TestAnnotatingWithExamples(t *testing.T) {
 						{Name: "function2", Fingerprint: 3932509229, IsApplication: true},
 					},
 					FrameInfos: []speedscope.FrameInfo{
-						{Count: 4, Weight: 80_000_000, SumDuration: 80_000_000},
-						{Count: 2, Weight: 20_000_000, SumDuration: 20_000_000},
+						{
+							Count:       4,
+							Weight:      80_000_000,
+							SumDuration: 80_000_000,
+							P75Duration: 40_000_000,
+							P95Duration: 40_000_000,
+							P99Duration: 40_000_000,
+						},
+						{
+							Count:       2,
+							Weight:      20_000_000,
+							SumDuration: 20_000_000,
+							P75Duration: 10_000_000,
+							P95Duration: 10_000_000,
+							P99Duration: 10_000_000,
+						},
 					},
 					Profiles: []examples.ExampleMetadata{
 						{
@@ -608,6 +628,7 @@ func TestAnnotatingWithExamples(t *testing.T) {
 	}
 
 	options := cmp.Options{
+		cmpopts.IgnoreFields(speedscope.FrameInfo{}, "Durations"),
 		// This option will order profile examples since we only want to compare values and not order.
 		cmpopts.SortSlices(func(a, b string) bool {
 			return a < b
@@ -643,7 +664,7 @@ func TestAnnotatingWithExamples(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			var ft []*nodetree.Node
 			for _, example := range test.examples {
-				addCallTreeToFlamegraph(&ft, test.callTrees, annotateWithProfileExample(example))
+				addCallTreeToFlamegraph(&ft, test.callTrees, annotateWithProfileExample(example), noDiffSide)
 			}
 			if diff := testutil.Diff(toSpeedscope(context.TODO(), ft, 10, 99), test.output, options); diff != "" {
 				t.Fatalf("Result mismatch: got - want +\n%s", diff)
@@ -651,3 +672,176 @@ func TestAnnotatingWithExamples(t *testing.T) {
 		})
 	}
 }
+
+func TestDifferentialFlamegraph(t *testing.T) {
+	newNode := func(name string, durationNS uint64, sampleCount int, children ...*nodetree.Node) *nodetree.Node {
+		return &nodetree.Node{
+			Children:      children,
+			DurationNS:    durationNS,
+			IsApplication: true,
+			Name:          name,
+			Occurrence:    1,
+			SampleCount:   sampleCount,
+			Frame:         frame.Frame{Function: name},
+			Profiles:      make(map[examples.ExampleMetadata]struct{}),
+		}
+	}
+
+	baseline := []*nodetree.Node{
+		newNode("a", 20, 2, newNode("b", 10, 1)),
+	}
+	target := []*nodetree.Node{
+		newNode("a", 30, 3, newNode("c", 30, 3)),
+	}
+
+	var ft []*nodetree.Node
+	addCallTreeToFlamegraph(&ft, baseline, annotateWithProfileExample(examples.ExampleMetadata{ProfileID: "1"}), baselineSide)
+	addCallTreeToFlamegraph(&ft, target, annotateWithProfileExample(examples.ExampleMetadata{ProfileID: "2"}), targetSide)
+
+	output := toSpeedscope(context.TODO(), ft, 10, 99)
+
+	type frameWeights struct {
+		baseline uint64
+		target   uint64
+		delta    int64
+	}
+	wantFrameWeights := map[string]frameWeights{
+		"a": {baseline: 2, target: 3, delta: 1},
+		"b": {baseline: 1, target: 0, delta: -1},
+		"c": {baseline: 0, target: 3, delta: 3},
+	}
+	for i, f := range output.Shared.Frames {
+		want := wantFrameWeights[f.Name]
+		got := output.Shared.FrameInfos[i]
+		if got.WeightDelta == nil {
+			t.Fatalf("frame %s: expected a weight delta", f.Name)
+		}
+		if got.BaselineWeight != want.baseline ||
+			got.TargetWeight != want.target ||
+			*got.WeightDelta != want.delta {
+			t.Fatalf("frame %s: got %+v with a delta of %d, want %+v", f.Name, got, *got.WeightDelta, want)
+		}
+	}
+
+	// Flamegraphs which aren't differential don't report any delta.
+	var nonDiff []*nodetree.Node
+	addCallTreeToFlamegraph(&nonDiff, baseline, annotateWithProfileExample(examples.ExampleMetadata{ProfileID: "1"}), noDiffSide)
+	for _, fi := range toSpeedscope(context.TODO(), nonDiff, 10, 99).Shared.FrameInfos {
+		b, err := json.Marshal(fi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(b), "weightDelta") {
+			t.Fatalf("expected no weight delta, got %s", b)
+		}
+	}
+
+	type weights struct {
+		baseline uint64
+		target   uint64
+	}
+	want := map[string]weights{
+		"a;b": {baseline: 1, target: 0},
+		"a;c": {baseline: 0, target: 3},
+		"a":   {baseline: 1, target: 0},
+	}
+	sp := output.Profiles[0].(speedscope.SampledProfile)
+	got := make(map[string]weights)
+	for i, stack := range sp.Samples {
+		names := make([]string, 0, len(stack))
+		for _, fi := range stack {
+			names = append(names, output.Shared.Frames[fi].Name)
+		}
+		got[strings.Join(names, ";")] = weights{
+			baseline: sp.BaselineWeights[i],
+			target:   sp.TargetWeights[i],
+		}
+	}
+	if diff := testutil.Diff(got, want, cmp.AllowUnexported(weights{})); diff != "" {
+		t.Fatalf("Result mismatch: got - want +\n%s", diff)
+	}
+}
+
+func TestDifferentialFlamegraphMemoryBudget(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	jobs := make(chan storageutil.ReadJob)
+	go storageutil.ReadWorker(jobs, nil)
+	defer close(jobs)
+
+	store := func(profileID string, functions ...string) examples.TransactionProfileCandidate {
+		frames := make([]frame.Frame, 0, len(functions))
+		stack := make(sample.Stack, 0, len(functions))
+		for i, f := range functions {
+			frames = append(frames, frame.Frame{Function: f, InApp: &testutil.True})
+			// Stacks are ordered from the leaf to the root.
+			stack = append(sample.Stack{i}, stack...)
+		}
+		p := sample.Profile{
+			RawProfile: sample.RawProfile{
+				EventID:        profileID,
+				OrganizationID: 1,
+				ProjectID:      2,
+				Platform:       platform.Python,
+				Version:        "1",
+				Transaction:    transaction.Transaction{ActiveThreadID: 1},
+				Trace: sample.Trace{
+					Frames: frames,
+					Samples: []sample.Sample{
+						{StackID: 0, ThreadID: 1},
+						{StackID: 0, ThreadID: 1, ElapsedSinceStartNS: 10_000_000},
+						{StackID: 0, ThreadID: 1, ElapsedSinceStartNS: 20_000_000},
+					},
+					Stacks: []sample.Stack{stack},
+				},
+			},
+		}
+		err := storageutil.CompressedWrite(ctx, bucket, p.StoragePath(), p)
+		if err != nil {
+			t.Fatalf("couldn't store the profile: %v", err)
+		}
+		return examples.TransactionProfileCandidate{ProjectID: 2, ProfileID: profileID}
+	}
+	baseline := Candidates{Transaction: []examples.TransactionProfileCandidate{
+		store("7b3e1c0d2a4f4e5b8c9d0e1f2a3b4c5d", "a", "b"),
+		store("9c4f2d1e3b5a4f6c8d0e1f2a3b4c5d6e", "a", "b"),
+	}}
+	target := Candidates{Transaction: []examples.TransactionProfileCandidate{
+		store("1d5a3e2f4c6b4a7d9e0f1a2b3c4d5e6f", "a", "c"),
+	}}
+
+	// A budget of a byte is exceeded by the first candidate of each side.
+	output, err := GetDifferentialFlamegraphFromCandidates(
+		ctx,
+		bucket,
+		1,
+		baseline,
+		target,
+		jobs,
+		Options{MemoryBudget: 1},
+		sentry.StartSpan(ctx, "flamegraph"),
+	)
+	if err != nil {
+		t.Fatalf("couldn't build the flamegraph: %v", err)
+	}
+
+	var targetWeight uint64
+	for i, f := range output.Shared.Frames {
+		if f.Name == "c" {
+			targetWeight = output.Shared.FrameInfos[i].TargetWeight
+		}
+	}
+	if targetWeight == 0 {
+		t.Fatalf("expected the target to be aggregated, got frames %+v", output.Shared.FrameInfos)
+	}
+	want := &speedscope.PartialResult{
+		Reason:              PartialReasonMemoryBudget,
+		CandidatesProcessed: 2,
+		CandidatesTotal:     3,
+	}
+	if diff := testutil.Diff(output.Partial, want); diff != "" {
+		t.Fatalf("Result mismatch: got - want +\n%s", diff)
+	}
+}
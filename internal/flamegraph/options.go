@@ -0,0 +1,245 @@
+package flamegraph
+
+import (
+	"errors"
+
+	"github.com/getsentry/vroom/internal/examples"
+	"github.com/getsentry/vroom/internal/frame"
+	"github.com/getsentry/vroom/internal/nodetree"
+)
+
+const (
+	// DefaultMaxSamples is the number of samples kept in a flamegraph when
+	// not set.
+	DefaultMaxSamples = 1000
+	// MaxSamplesLimit is the highest number of samples one can request.
+	MaxSamplesLimit = 10000
+
+	otherNodeName = "other"
+)
+
+var (
+	ErrInvalidMaxSamples = errors.New("max_samples has to be between 0 and 10000")
+	ErrInvalidMaxDepth   = errors.New("max_depth can't be negative")
+)
+
+// Options controls how the aggregated tree is pruned before it's serialized.
+type Options struct {
+	// MaxSamples is the number of unique stacks kept, the heaviest ones.
+	MaxSamples int `json:"max_samples"`
+	// MaxDepth truncates stacks deeper than this number of frames.
+	MaxDepth int `json:"max_depth"`
+	// InAppOnly removes system frames, their children are attached to the
+	// closest application frame. Root frames are always kept.
+	InAppOnly bool `json:"in_app_only"`
+	// CollapseRecursion merges frames calling themselves into one frame.
+	CollapseRecursion bool `json:"collapse_recursion"`
+	// MinWeight folds frames with fewer samples into an "other" frame
+	// under their parent.
+	MinWeight int `json:"min_weight"`
+	// Focus re-roots the stacks at this function and drops the stacks not
+	// going through it.
+	Focus *FunctionFilter `json:"focus"`
+	// Exclude drops the stacks going through these functions or hides them.
+	Exclude []ExcludeFilter `json:"exclude"`
+	// MemoryBudget is the estimated number of bytes the aggregated tree can
+	// use before the remaining candidates are skipped. It's set by the
+	// server and 0 means there is no limit.
+	MemoryBudget int64 `json:"-"`
+}
+
+// Validate returns an error if the options are out of bounds.
+func (o Options) Validate() error {
+	if o.MaxSamples < 0 || o.MaxSamples > MaxSamplesLimit {
+		return ErrInvalidMaxSamples
+	}
+	if o.MaxDepth < 0 {
+		return ErrInvalidMaxDepth
+	}
+	if o.Focus != nil {
+		if err := o.Focus.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, f := range o.Exclude {
+		if err := f.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o Options) maxSamples() int {
+	if o.MaxSamples == 0 {
+		return DefaultMaxSamples
+	}
+	return o.MaxSamples
+}
+
+// pruneTree applies the options to the aggregated tree and returns it.
+func pruneTree(trees []*nodetree.Node, o Options) []*nodetree.Node {
+	if len(o.Exclude) > 0 {
+		trees, _ = excludeNodes(trees, o.Exclude)
+	}
+	if o.Focus != nil {
+		trees = focusTree(trees, *o.Focus)
+	}
+	if o.InAppOnly {
+		pruned := make([]*nodetree.Node, 0, len(trees))
+		for _, root := range trees {
+			mergeNodes(&pruned, []*nodetree.Node{root}, func(n *nodetree.Node) []*nodetree.Node {
+				return keepInAppChildren(n)
+			})
+		}
+		trees = pruned
+	}
+	for _, root := range trees {
+		if o.CollapseRecursion {
+			collapseRecursion(root)
+		}
+		if o.MaxDepth > 0 {
+			truncateDepth(root, 1, o.MaxDepth)
+		}
+		if o.MinWeight > 0 {
+			foldLightChildren(root, o.MinWeight)
+		}
+	}
+	return trees
+}
+
+// keepInAppChildren replaces the system children of a node by their
+// application descendants.
+func keepInAppChildren(n *nodetree.Node) []*nodetree.Node {
+	var children []*nodetree.Node
+	for _, c := range n.Children {
+		if c.IsApplication {
+			mergeNodes(&children, []*nodetree.Node{c}, keepInAppChildren)
+			continue
+		}
+		mergeNodes(&children, keepInAppChildren(c), nil)
+	}
+	return children
+}
+
+// mergeNodes merges nodes into dst, combining nodes of the same function.
+// When set, children returns the children to merge for a node, its own
+// children otherwise.
+func mergeNodes(
+	dst *[]*nodetree.Node,
+	nodes []*nodetree.Node,
+	children func(n *nodetree.Node) []*nodetree.Node,
+) {
+	for _, n := range nodes {
+		nodeChildren := n.Children
+		if children != nil {
+			nodeChildren = children(n)
+		}
+		existing := getMatchingNode(dst, n)
+		if existing == nil {
+			n.Children = nil
+			mergeNodes(&n.Children, nodeChildren, nil)
+			*dst = append(*dst, n)
+			continue
+		}
+		addNodeWeights(existing, n)
+		mergeNodes(&existing.Children, nodeChildren, nil)
+	}
+}
+
+func addNodeWeights(dst, src *nodetree.Node) {
+	dst.Occurrence += src.Occurrence
+	dst.SampleCount += src.SampleCount
+	dst.DurationNS += src.DurationNS
+	dst.SelfTimeNS += src.SelfTimeNS
+	dst.AddDurations(src)
+	addProfiles(dst, src)
+	if src.Diff != nil {
+		if dst.Diff == nil {
+			dst.Diff = &nodetree.DiffWeights{}
+		}
+		dst.Diff.BaselineSampleCount += src.Diff.BaselineSampleCount
+		dst.Diff.TargetSampleCount += src.Diff.TargetSampleCount
+	}
+}
+
+// collapseRecursion replaces children calling the same function as their
+// parent by their own children. The parent already accounts for their
+// weight.
+func collapseRecursion(n *nodetree.Node) {
+	pending := n.Children
+	n.Children = nil
+	for len(pending) > 0 {
+		c := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if c.Name == n.Name && c.Package == n.Package {
+			// Samples ending on the recursive call now end on the parent.
+			addProfiles(n, c)
+			pending = append(pending, c.Children...)
+			continue
+		}
+		mergeNodes(&n.Children, []*nodetree.Node{c}, nil)
+	}
+	for _, c := range n.Children {
+		collapseRecursion(c)
+	}
+}
+
+func truncateDepth(n *nodetree.Node, depth, maxDepth int) {
+	if depth >= maxDepth {
+		n.Children = nil
+		return
+	}
+	for _, c := range n.Children {
+		truncateDepth(c, depth+1, maxDepth)
+	}
+}
+
+// foldLightChildren replaces the children with less than minWeight samples
+// by a single "other" child.
+func foldLightChildren(n *nodetree.Node, minWeight int) {
+	if len(n.Children) == 0 {
+		return
+	}
+	var other *nodetree.Node
+	children := make([]*nodetree.Node, 0, len(n.Children))
+	for _, c := range n.Children {
+		if c.SampleCount >= minWeight {
+			foldLightChildren(c, minWeight)
+			children = append(children, c)
+			continue
+		}
+		if other == nil {
+			other = &nodetree.Node{
+				Name:  otherNodeName,
+				Frame: frame.Frame{Function: otherNodeName},
+			}
+		}
+		addNodeWeights(other, c)
+		addSubtreeProfiles(other, c)
+	}
+	if other != nil {
+		children = append(children, other)
+	}
+	n.Children = children
+}
+
+// addSubtreeProfiles adds the examples of all the descendants of n to dst
+// since samples of the subtree now end on dst.
+func addSubtreeProfiles(dst, n *nodetree.Node) {
+	for _, c := range n.Children {
+		addProfiles(dst, c)
+		addSubtreeProfiles(dst, c)
+	}
+}
+
+func addProfiles(dst, src *nodetree.Node) {
+	if len(src.Profiles) == 0 {
+		return
+	}
+	if dst.Profiles == nil {
+		dst.Profiles = make(map[examples.ExampleMetadata]struct{}, len(src.Profiles))
+	}
+	for example := range src.Profiles {
+		dst.Profiles[example] = void
+	}
+}
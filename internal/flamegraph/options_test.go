@@ -0,0 +1,185 @@
+package flamegraph
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/getsentry/vroom/internal/frame"
+	"github.com/getsentry/vroom/internal/nodetree"
+	"github.com/getsentry/vroom/internal/testutil"
+)
+
+// ignoreDurations ignores the sketches created when nodes are merged, their
+// percentiles are tested with the serialized flamegraph.
+var ignoreDurations = cmpopts.IgnoreFields(nodetree.Node{}, "Durations")
+
+func TestPruneTree(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		input   []*nodetree.Node
+		output  []*nodetree.Node
+	}{
+		{
+			name:    "in-app only",
+			options: Options{InAppOnly: true},
+			input: []*nodetree.Node{
+				{
+					Name:          "main",
+					IsApplication: true,
+					SampleCount:   4,
+					Children: []*nodetree.Node{
+						{
+							Name:        "syscall",
+							SampleCount: 4,
+							Children: []*nodetree.Node{
+								{Name: "handler", IsApplication: true, SampleCount: 3},
+							},
+						},
+						{Name: "handler", IsApplication: true, SampleCount: 1},
+					},
+				},
+			},
+			output: []*nodetree.Node{
+				{
+					Name:          "main",
+					IsApplication: true,
+					SampleCount:   4,
+					Children: []*nodetree.Node{
+						{Name: "handler", IsApplication: true, SampleCount: 4},
+					},
+				},
+			},
+		},
+		{
+			name:    "max depth",
+			options: Options{MaxDepth: 2},
+			input: []*nodetree.Node{
+				{
+					Name:        "a",
+					SampleCount: 2,
+					Children: []*nodetree.Node{
+						{
+							Name:        "b",
+							SampleCount: 2,
+							Children: []*nodetree.Node{
+								{Name: "c", SampleCount: 2},
+							},
+						},
+					},
+				},
+			},
+			output: []*nodetree.Node{
+				{
+					Name:        "a",
+					SampleCount: 2,
+					Children: []*nodetree.Node{
+						{Name: "b", SampleCount: 2},
+					},
+				},
+			},
+		},
+		{
+			name:    "collapse recursion",
+			options: Options{CollapseRecursion: true},
+			input: []*nodetree.Node{
+				{
+					Name:        "walk",
+					SampleCount: 5,
+					Children: []*nodetree.Node{
+						{
+							Name:        "walk",
+							SampleCount: 4,
+							Children: []*nodetree.Node{
+								{
+									Name:        "walk",
+									SampleCount: 2,
+									Children: []*nodetree.Node{
+										{Name: "visit", SampleCount: 2},
+									},
+								},
+								{Name: "visit", SampleCount: 1},
+							},
+						},
+					},
+				},
+			},
+			output: []*nodetree.Node{
+				{
+					Name:        "walk",
+					SampleCount: 5,
+					Children: []*nodetree.Node{
+						{Name: "visit", SampleCount: 3},
+					},
+				},
+			},
+		},
+		{
+			name:    "min weight",
+			options: Options{MinWeight: 3},
+			input: []*nodetree.Node{
+				{
+					Name:        "a",
+					SampleCount: 10,
+					Children: []*nodetree.Node{
+						{Name: "b", SampleCount: 6},
+						{Name: "c", SampleCount: 2},
+						{
+							Name:        "d",
+							SampleCount: 2,
+							Children: []*nodetree.Node{
+								{Name: "e", SampleCount: 1},
+							},
+						},
+					},
+				},
+			},
+			output: []*nodetree.Node{
+				{
+					Name:        "a",
+					SampleCount: 10,
+					Children: []*nodetree.Node{
+						{Name: "b", SampleCount: 6},
+						{
+							Name:        otherNodeName,
+							Frame:       frame.Frame{Function: otherNodeName},
+							SampleCount: 4,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output := pruneTree(test.input, test.options)
+			if diff := testutil.Diff(output, test.output, ignoreDurations); diff != "" {
+				t.Fatalf("Result mismatch: got - want +\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		err     error
+	}{
+		{name: "defaults", options: Options{}},
+		{name: "max samples above limit", options: Options{MaxSamples: MaxSamplesLimit + 1}, err: ErrInvalidMaxSamples},
+		{name: "negative max depth", options: Options{MaxDepth: -1}, err: ErrInvalidMaxDepth},
+		{name: "empty focus", options: Options{Focus: &FunctionFilter{Package: "db"}}, err: ErrInvalidFunctionFilter},
+		{name: "empty exclude", options: Options{Exclude: []ExcludeFilter{{HideFrame: true}}}, err: ErrInvalidFunctionFilter},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.options.Validate(); err != test.err {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+		})
+	}
+}
@@ -32,6 +32,12 @@ func mergeIntervals(intervals *[]examples.Interval) []examples.Interval {
 	return newIntervals
 }
 
+// SliceCallTree only keeps the parts of a call tree overlapping with the
+// time range between start and end, in nanoseconds.
+func SliceCallTree(callTree []*nodetree.Node, start, end uint64) []*nodetree.Node {
+	return sliceCallTree(&callTree, &[]examples.Interval{{Start: start, End: end}})
+}
+
 func sliceCallTree(callTree *[]*nodetree.Node, intervals *[]examples.Interval) []*nodetree.Node {
 	slicedTree := make([]*nodetree.Node, 0)
 	for _, node := range *callTree {
@@ -0,0 +1,466 @@
+package flamegraph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+	"unsafe"
+
+	"gocloud.dev/blob"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/getsentry/vroom/internal/chunk"
+	"github.com/getsentry/vroom/internal/examples"
+	"github.com/getsentry/vroom/internal/nodetree"
+	"github.com/getsentry/vroom/internal/speedscope"
+	"github.com/getsentry/vroom/internal/storageutil"
+)
+
+const (
+	// DefaultTimelineFunctions is the number of functions weighted in each
+	// bucket when not set.
+	DefaultTimelineFunctions = 10
+	// MaxTimelineFunctions is the highest number of functions one can
+	// request.
+	MaxTimelineFunctions = 100
+	// MaxTimelineBuckets is the highest number of buckets of a timeline.
+	MaxTimelineBuckets = 1000
+	// MaxTimelineFlamegraphBuckets is the highest number of buckets of a
+	// timeline with a flamegraph per bucket.
+	MaxTimelineFlamegraphBuckets = 100
+)
+
+var (
+	ErrInvalidTimelineRange = errors.New("end has to be after start")
+	ErrInvalidBucketSize    = errors.New("bucket_size has to be positive")
+	ErrTooManyBuckets       = fmt.Errorf(
+		"a timeline can't have more than %d buckets, or %d with flamegraphs",
+		MaxTimelineBuckets,
+		MaxTimelineFlamegraphBuckets,
+	)
+	ErrInvalidTopFunctions = fmt.Errorf("top_functions has to be between 0 and %d", MaxTimelineFunctions)
+
+	timelineFunctionSize = int64(unsafe.Sizeof(timelineFunction{}))
+)
+
+type (
+	// TimelineOptions controls the time range and the buckets of a
+	// timeline. Timestamps and sizes are in nanoseconds.
+	TimelineOptions struct {
+		Start      uint64 `json:"start,string"`
+		End        uint64 `json:"end,string"`
+		BucketSize uint64 `json:"bucket_size,string"`
+		// TopFunctions is the number of functions, the ones with the most
+		// self time over the whole range, weighted in each bucket.
+		TopFunctions int `json:"top_functions"`
+		// Flamegraphs adds a flamegraph of each bucket, pruned with the
+		// flamegraph options.
+		Flamegraphs bool `json:"flamegraphs"`
+	}
+
+	// Timeline is the self time of the top functions over consecutive
+	// buckets of time.
+	Timeline struct {
+		Start      uint64                    `json:"start,string"`
+		End        uint64                    `json:"end,string"`
+		BucketSize uint64                    `json:"bucket_size,string"`
+		Functions  []TimelineFunction        `json:"functions"`
+		Buckets    []TimelineBucket          `json:"buckets"`
+		Partial    *speedscope.PartialResult `json:"partial,omitempty"`
+	}
+
+	TimelineFunction struct {
+		Name          string `json:"name"`
+		Package       string `json:"package"`
+		Fingerprint   uint32 `json:"fingerprint"`
+		IsApplication bool   `json:"is_application"`
+		SelfTimeNS    uint64 `json:"self_time_ns"`
+	}
+
+	TimelineBucket struct {
+		Start uint64 `json:"start,string"`
+		// DurationNS is the sampled time in the bucket, summed over threads.
+		DurationNS uint64 `json:"duration_ns"`
+		// Weights are the self time, in nanoseconds, of each function of
+		// the timeline in this bucket.
+		Weights    []uint64           `json:"weights"`
+		Flamegraph *speedscope.Output `json:"flamegraph,omitempty"`
+	}
+
+	functionKey struct {
+		name        string
+		packageName string
+	}
+
+	// timelineFunction accumulates the self time of a function per bucket.
+	// Self times are signed since the time of the children is subtracted
+	// from their parent's one. Only what describes the function is kept,
+	// not the node it was first seen in, so call trees aren't held until
+	// the end of the request.
+	timelineFunction struct {
+		name          string
+		packageName   string
+		fingerprint   uint32
+		isApplication bool
+		buckets       []int64
+	}
+
+	timeline struct {
+		opts        TimelineOptions
+		numBuckets  int
+		durations   []uint64
+		functions   map[functionKey]*timelineFunction
+		flamegraphs [][]*nodetree.Node
+	}
+)
+
+// Validate returns an error if the range can't be split in buckets or if
+// there are too many of them.
+func (o TimelineOptions) Validate() error {
+	if o.End <= o.Start {
+		return ErrInvalidTimelineRange
+	}
+	if o.BucketSize == 0 {
+		return ErrInvalidBucketSize
+	}
+	if o.TopFunctions < 0 || o.TopFunctions > MaxTimelineFunctions {
+		return ErrInvalidTopFunctions
+	}
+	maxBuckets := MaxTimelineBuckets
+	if o.Flamegraphs {
+		maxBuckets = MaxTimelineFlamegraphBuckets
+	}
+	if o.numBuckets() > uint64(maxBuckets) {
+		return ErrTooManyBuckets
+	}
+	return nil
+}
+
+func (o TimelineOptions) numBuckets() uint64 {
+	n := (o.End - o.Start) / o.BucketSize
+	if (o.End-o.Start)%o.BucketSize != 0 {
+		n++
+	}
+	return n
+}
+
+func (o TimelineOptions) topFunctions() int {
+	if o.TopFunctions == 0 {
+		return DefaultTimelineFunctions
+	}
+	return o.TopFunctions
+}
+
+// GetTimelineFromCandidates splits the time range of the options in buckets
+// and aggregates the self time of each function of the continuous profile
+// candidates per bucket. A partial result is returned when the memory budget
+// was exceeded.
+func GetTimelineFromCandidates(
+	ctx context.Context,
+	storage *blob.Bucket,
+	organizationID uint64,
+	candidates []examples.ContinuousProfileCandidate,
+	jobs chan storageutil.ReadJob,
+	timelineOpts TimelineOptions,
+	opts Options,
+	span *sentry.Span,
+) (Timeline, error) {
+	hub := sentry.GetHubFromContext(ctx)
+	t := newTimeline(timelineOpts)
+	budget := newMemoryBudget(opts.MemoryBudget, len(candidates))
+
+	// Reads still queued are canceled once the budget is exceeded.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan storageutil.ReadJobResult)
+	defer close(results)
+	go func() {
+		dispatchSpan := span.StartChild("dispatch candidates")
+		dispatchSpan.SetData("continuous_candidates", len(candidates))
+		for _, candidate := range candidates {
+			jobs <- chunk.CallTreesReadJob{
+				Ctx:            ctx,
+				OrganizationID: organizationID,
+				ProjectID:      candidate.ProjectID,
+				ProfilerID:     candidate.ProfilerID,
+				ChunkID:        candidate.ChunkID,
+				TransactionID:  candidate.TransactionID,
+				ThreadID:       candidate.ThreadID,
+				Start:          candidate.Start,
+				End:            candidate.End,
+				Storage:        storage,
+				Result:         results,
+			}
+		}
+		dispatchSpan.Finish()
+	}()
+
+	timelineSpan := span.StartChild("processing candidates")
+	for range candidates {
+		res := <-results
+
+		if budget.exceeded() {
+			budget.skip(1)
+			continue
+		}
+
+		err := res.Error()
+		if err != nil {
+			if errors.Is(err, storageutil.ErrObjectNotFound) ||
+				errors.Is(err, context.Canceled) ||
+				errors.Is(err, context.DeadlineExceeded) {
+				// Like flamegraphs, the timeline is built with the chunks
+				// downloaded before the deadline.
+				continue
+			}
+			if hub != nil {
+				hub.CaptureException(err)
+			}
+			continue
+		}
+
+		result, ok := res.(chunk.CallTreesReadJobResult)
+		if !ok {
+			// This should never happen
+			return Timeline{}, errors.New("unexpected result from storage")
+		}
+		for threadID, callTree := range result.CallTrees {
+			example := examples.NewExampleFromProfilerChunk(
+				result.Chunk.GetProjectID(),
+				result.Chunk.GetProfilerID(),
+				result.Chunk.GetID(),
+				result.TransactionID,
+				&threadID,
+				result.Start,
+				result.End,
+			)
+			budget.add(t.addCallTree(callTree, result.Start, result.End, example))
+		}
+		if budget.exceeded() {
+			cancel()
+		}
+	}
+	timelineSpan.SetData("candidates_skipped", budget.skipped)
+	timelineSpan.Finish()
+
+	serializeSpan := span.StartChild("serialize")
+	defer serializeSpan.Finish()
+
+	out := t.toTimeline(ctx, opts)
+	out.Partial = budget.partialResult()
+	return out, nil
+}
+
+func newTimeline(opts TimelineOptions) *timeline {
+	numBuckets := int(opts.numBuckets())
+	t := &timeline{
+		opts:       opts,
+		numBuckets: numBuckets,
+		durations:  make([]uint64, numBuckets),
+		functions:  make(map[functionKey]*timelineFunction),
+	}
+	if opts.Flamegraphs {
+		t.flamegraphs = make([][]*nodetree.Node, numBuckets)
+	}
+	return t
+}
+
+// bucket returns the interval of the bucket i.
+func (t *timeline) bucket(i int) examples.Interval {
+	start := t.opts.Start + uint64(i)*t.opts.BucketSize
+	return examples.Interval{
+		Start: start,
+		End:   min(start+t.opts.BucketSize, t.opts.End),
+	}
+}
+
+// bucketRange returns the indices of the first and last buckets
+// overlapping with [start, end).
+func (t *timeline) bucketRange(start, end uint64) (int, int, bool) {
+	start, end = max(start, t.opts.Start), min(end, t.opts.End)
+	if end <= start {
+		return 0, 0, false
+	}
+	first := int((start - t.opts.Start) / t.opts.BucketSize)
+	last := int((end - 1 - t.opts.Start) / t.opts.BucketSize)
+	return first, last, true
+}
+
+// addCallTree adds the self time of the functions of a call tree, only
+// keeping what happened between start and end when they're set, and returns
+// an estimate of the bytes it added to the timeline.
+func (t *timeline) addCallTree(
+	callTree []*nodetree.Node,
+	start, end uint64,
+	example examples.ExampleMetadata,
+) int64 {
+	if start == 0 || end == 0 {
+		start, end = 0, math.MaxUint64
+	}
+	for _, root := range callTree {
+		first, last, ok := t.bucketRange(max(root.StartNS, start), min(root.EndNS, end))
+		if !ok {
+			continue
+		}
+		for i := first; i <= last; i++ {
+			interval := t.clip(i, start, end)
+			t.durations[i] += overlappingDuration(root, &interval)
+		}
+	}
+	added := t.addSelfTimes(callTree, start, end)
+	if t.flamegraphs == nil {
+		return added
+	}
+	annotate := annotateWithProfileExample(example)
+	for i := range t.flamegraphs {
+		interval := t.clip(i, start, end)
+		if interval.End <= interval.Start {
+			continue
+		}
+		sliced := copyCallTreeInterval(callTree, interval)
+		if len(sliced) == 0 {
+			continue
+		}
+		added += addCallTreeToFlamegraph(&t.flamegraphs[i], sliced, annotate, noDiffSide)
+	}
+	return added
+}
+
+// clip returns the interval of the bucket i within start and end.
+func (t *timeline) clip(i int, start, end uint64) examples.Interval {
+	b := t.bucket(i)
+	return examples.Interval{Start: max(b.Start, start), End: min(b.End, end)}
+}
+
+// addSelfTimes adds the time spent in each node, minus the time spent in its
+// children, to the buckets of its function.
+func (t *timeline) addSelfTimes(nodes []*nodetree.Node, start, end uint64) int64 {
+	var added int64
+	for _, n := range nodes {
+		first, last, ok := t.bucketRange(max(n.StartNS, start), min(n.EndNS, end))
+		if !ok {
+			continue
+		}
+		key := functionKey{name: n.Name, packageName: n.Package}
+		f, exists := t.functions[key]
+		if !exists {
+			f = &timelineFunction{
+				name:          n.Name,
+				packageName:   n.Package,
+				fingerprint:   n.Frame.Fingerprint(),
+				isApplication: n.IsApplication,
+				buckets:       make([]int64, t.numBuckets),
+			}
+			t.functions[key] = f
+			added += timelineFunctionSize + int64(len(n.Name)+len(n.Package)+t.numBuckets*8)
+		}
+		for i := first; i <= last; i++ {
+			interval := t.clip(i, start, end)
+			f.buckets[i] += int64(overlappingDuration(n, &interval))
+			for _, c := range n.Children {
+				f.buckets[i] -= int64(overlappingDuration(c, &interval))
+			}
+		}
+		added += t.addSelfTimes(n.Children, start, end)
+	}
+	return added
+}
+
+// toTimeline keeps the functions with the most self time and serializes the
+// flamegraphs of the buckets.
+func (t *timeline) toTimeline(ctx context.Context, opts Options) Timeline {
+	functions := make([]TimelineFunction, 0, len(t.functions))
+	weights := make([][]int64, 0, len(t.functions))
+	for _, f := range t.functions {
+		var selfTime int64
+		for _, w := range f.buckets {
+			selfTime += max(w, 0)
+		}
+		if selfTime == 0 {
+			continue
+		}
+		functions = append(functions, TimelineFunction{
+			Name:          f.name,
+			Package:       f.packageName,
+			Fingerprint:   f.fingerprint,
+			IsApplication: f.isApplication,
+			SelfTimeNS:    uint64(selfTime),
+		})
+		weights = append(weights, f.buckets)
+	}
+	indices := make([]int, len(functions))
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.SliceStable(indices, func(i, j int) bool {
+		a, b := functions[indices[i]], functions[indices[j]]
+		if a.SelfTimeNS != b.SelfTimeNS {
+			return a.SelfTimeNS > b.SelfTimeNS
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Package < b.Package
+	})
+	if len(indices) > t.opts.topFunctions() {
+		indices = indices[:t.opts.topFunctions()]
+	}
+
+	out := Timeline{
+		Start:      t.opts.Start,
+		End:        t.opts.End,
+		BucketSize: t.opts.BucketSize,
+		Functions:  make([]TimelineFunction, 0, len(indices)),
+		Buckets:    make([]TimelineBucket, t.numBuckets),
+	}
+	for _, i := range indices {
+		out.Functions = append(out.Functions, functions[i])
+	}
+	for b := range out.Buckets {
+		bucket := TimelineBucket{
+			Start:      t.bucket(b).Start,
+			DurationNS: t.durations[b],
+			Weights:    make([]uint64, 0, len(indices)),
+		}
+		for _, i := range indices {
+			bucket.Weights = append(bucket.Weights, uint64(max(weights[i][b], 0)))
+		}
+		if t.flamegraphs != nil {
+			sp := toSpeedscope(ctx, pruneTree(t.flamegraphs[b], opts), opts.maxSamples(), 0)
+			bucket.Flamegraph = &sp
+		}
+		out.Buckets[b] = bucket
+	}
+	return out
+}
+
+// copyCallTreeInterval returns a copy of the parts of a call tree
+// overlapping with the interval. Unlike sliceCallTree, the call tree is left
+// untouched so it can be sliced for every bucket.
+func copyCallTreeInterval(callTree []*nodetree.Node, interval examples.Interval) []*nodetree.Node {
+	var sliced []*nodetree.Node
+	for _, node := range callTree {
+		duration := overlappingDuration(node, &interval)
+		if duration == 0 {
+			continue
+		}
+		n := node.ShallowCopyWithoutChildren()
+		n.SampleCount = min(int(math.Ceil(float64(duration)/float64(time.Millisecond*10))), node.SampleCount)
+		n.DurationNS = duration
+		// The durations of the whole call don't apply to the slice and
+		// examples are added per bucket.
+		n.Durations = nil
+		n.Profiles = make(map[examples.ExampleMetadata]struct{})
+		n.Children = copyCallTreeInterval(node.Children, interval)
+		n.SelfTimeNS = duration
+		for _, c := range n.Children {
+			n.SelfTimeNS -= min(c.DurationNS, n.SelfTimeNS)
+		}
+		sliced = append(sliced, n)
+	}
+	return sliced
+}
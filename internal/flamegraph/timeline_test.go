@@ -0,0 +1,213 @@
+package flamegraph
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/getsentry/vroom/internal/examples"
+	"github.com/getsentry/vroom/internal/frame"
+	"github.com/getsentry/vroom/internal/nodetree"
+	"github.com/getsentry/vroom/internal/testutil"
+)
+
+func timelineCallTree() []*nodetree.Node {
+	return []*nodetree.Node{
+		{
+			Name:          "main",
+			StartNS:       0,
+			EndNS:         40,
+			DurationNS:    40,
+			SampleCount:   4,
+			IsApplication: true,
+			Frame:         frame.Frame{Function: "main"},
+			Profiles:      make(map[examples.ExampleMetadata]struct{}),
+			Children: []*nodetree.Node{
+				{
+					Name:        "work",
+					Package:     "lib",
+					StartNS:     10,
+					EndNS:       35,
+					DurationNS:  25,
+					SampleCount: 3,
+					Frame:       frame.Frame{Function: "work", Package: "lib"},
+					Profiles:    make(map[examples.ExampleMetadata]struct{}),
+				},
+			},
+		},
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       TimelineOptions
+		start, end uint64
+		want       Timeline
+	}{
+		{
+			name: "self time per bucket",
+			opts: TimelineOptions{Start: 0, End: 40, BucketSize: 20},
+			want: Timeline{
+				End:        40,
+				BucketSize: 20,
+				Functions: []TimelineFunction{
+					{
+						Name:        "work",
+						Package:     "lib",
+						Fingerprint: frame.Frame{Function: "work", Package: "lib"}.Fingerprint(),
+						SelfTimeNS:  25,
+					},
+					{
+						Name:          "main",
+						Fingerprint:   frame.Frame{Function: "main"}.Fingerprint(),
+						IsApplication: true,
+						SelfTimeNS:    15,
+					},
+				},
+				Buckets: []TimelineBucket{
+					{Start: 0, DurationNS: 20, Weights: []uint64{10, 10}},
+					{Start: 20, DurationNS: 20, Weights: []uint64{15, 5}},
+				},
+			},
+		},
+		{
+			name:  "candidate interval and top functions",
+			opts:  TimelineOptions{Start: 0, End: 40, BucketSize: 20, TopFunctions: 1},
+			start: 25,
+			end:   40,
+			want: Timeline{
+				End:        40,
+				BucketSize: 20,
+				Functions: []TimelineFunction{
+					{
+						Name:        "work",
+						Package:     "lib",
+						Fingerprint: frame.Frame{Function: "work", Package: "lib"}.Fingerprint(),
+						SelfTimeNS:  10,
+					},
+				},
+				Buckets: []TimelineBucket{
+					{Start: 0, Weights: []uint64{0}},
+					{Start: 20, DurationNS: 15, Weights: []uint64{10}},
+				},
+			},
+		},
+		{
+			name: "last bucket shorter than the others",
+			opts: TimelineOptions{Start: 30, End: 45, BucketSize: 10},
+			want: Timeline{
+				Start:      30,
+				End:        45,
+				BucketSize: 10,
+				Functions: []TimelineFunction{
+					{
+						Name:          "main",
+						Fingerprint:   frame.Frame{Function: "main"}.Fingerprint(),
+						IsApplication: true,
+						SelfTimeNS:    5,
+					},
+					{
+						Name:        "work",
+						Package:     "lib",
+						Fingerprint: frame.Frame{Function: "work", Package: "lib"}.Fingerprint(),
+						SelfTimeNS:  5,
+					},
+				},
+				Buckets: []TimelineBucket{
+					{Start: 30, DurationNS: 10, Weights: []uint64{5, 5}},
+					{Start: 40, Weights: []uint64{0, 0}},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tl := newTimeline(test.opts)
+			tl.addCallTree(timelineCallTree(), test.start, test.end, examples.ExampleMetadata{})
+			got := tl.toTimeline(context.Background(), Options{})
+			if diff := testutil.Diff(got, test.want); diff != "" {
+				t.Fatalf("Result mismatch: got - want +\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTimelineFlamegraphs(t *testing.T) {
+	callTree := timelineCallTree()
+	example := examples.ExampleMetadata{ProfilerID: "1", ChunkID: "2"}
+	tl := newTimeline(TimelineOptions{Start: 0, End: 40, BucketSize: 20, Flamegraphs: true})
+	tl.addCallTree(callTree, 0, 0, example)
+
+	if len(tl.flamegraphs) != 2 {
+		t.Fatalf("expected a flamegraph per bucket, got %d", len(tl.flamegraphs))
+	}
+	main := tl.flamegraphs[1][0]
+	if main.DurationNS != 20 || main.SelfTimeNS != 5 {
+		t.Fatalf("expected main to last 20ns with 5ns of self time, got %d and %d", main.DurationNS, main.SelfTimeNS)
+	}
+	work := main.Children[0]
+	if work.DurationNS != 15 {
+		t.Fatalf("expected work to last 15ns, got %d", work.DurationNS)
+	}
+	if _, exists := work.Profiles[example]; !exists {
+		t.Fatal("expected work to be annotated with the example")
+	}
+	if callTree[0].DurationNS != 40 || len(callTree[0].Profiles) != 0 {
+		t.Fatal("expected the call tree to be left untouched")
+	}
+
+	got := tl.toTimeline(context.Background(), Options{})
+	for _, b := range got.Buckets {
+		if b.Flamegraph == nil {
+			t.Fatalf("expected a flamegraph for the bucket starting at %d", b.Start)
+		}
+	}
+}
+
+func TestTimelineOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		opts TimelineOptions
+		want error
+	}{
+		{
+			name: "valid",
+			opts: TimelineOptions{Start: 1, End: 3601, BucketSize: 60},
+		},
+		{
+			name: "empty range",
+			opts: TimelineOptions{Start: 10, End: 10, BucketSize: 1},
+			want: ErrInvalidTimelineRange,
+		},
+		{
+			name: "no bucket size",
+			opts: TimelineOptions{Start: 0, End: 10},
+			want: ErrInvalidBucketSize,
+		},
+		{
+			name: "too many functions",
+			opts: TimelineOptions{Start: 0, End: 10, BucketSize: 1, TopFunctions: MaxTimelineFunctions + 1},
+			want: ErrInvalidTopFunctions,
+		},
+		{
+			name: "too many buckets",
+			opts: TimelineOptions{Start: 0, End: MaxTimelineBuckets + 1, BucketSize: 1},
+			want: ErrTooManyBuckets,
+		},
+		{
+			name: "too many buckets with flamegraphs",
+			opts: TimelineOptions{Start: 0, End: MaxTimelineFlamegraphBuckets + 1, BucketSize: 1, Flamegraphs: true},
+			want: ErrTooManyBuckets,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.opts.Validate(); !errors.Is(err, test.want) {
+				t.Fatalf("expected %v, got %v", test.want, err)
+			}
+		})
+	}
+}
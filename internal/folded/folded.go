@@ -0,0 +1,118 @@
+package folded
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/getsentry/vroom/internal/nodetree"
+)
+
+// ContentType is the content type of collapsed stacks.
+const ContentType = "text/plain; charset=utf-8"
+
+// Weight selects the value written after each stack.
+type Weight int
+
+const (
+	// WeightSampleCount weighs each stack by its number of samples.
+	WeightSampleCount Weight = iota
+	// WeightDuration weighs each stack by its duration in nanoseconds.
+	WeightDuration
+)
+
+type stacks map[string]uint64
+
+// separatorReplacer replaces the characters used by the format as
+// separators in frame names.
+var separatorReplacer = strings.NewReplacer(";", ":", "\n", " ", "\r", " ")
+
+// WriteCallTrees writes the call trees of a profile or a chunk, keyed by
+// thread ID, as collapsed stacks. Identical stacks from different threads are
+// merged together.
+func WriteCallTrees[T comparable](
+	w io.Writer,
+	callTrees map[T][]*nodetree.Node,
+	weight Weight,
+) error {
+	s := make(stacks)
+	for _, trees := range callTrees {
+		for _, root := range trees {
+			s.addNode(root, make([]string, 0, 128), weight)
+		}
+	}
+	return s.write(w)
+}
+
+// WriteFlamegraph writes an aggregated flamegraph tree as collapsed stacks.
+func WriteFlamegraph(w io.Writer, trees []*nodetree.Node, weight Weight) error {
+	s := make(stacks)
+	for _, root := range trees {
+		s.addNode(root, make([]string, 0, 128), weight)
+	}
+	return s.write(w)
+}
+
+// addNode records the weight spent in the node itself, then visits its
+// children. stack holds the frame names from the root to the parent node.
+func (s stacks) addNode(n *nodetree.Node, stack []string, weight Weight) {
+	stack = append(stack, frameName(n))
+
+	var value, childrenValue uint64
+	switch weight {
+	case WeightDuration:
+		value = n.DurationNS
+		for _, c := range n.Children {
+			childrenValue += c.DurationNS
+		}
+	default:
+		value = uint64(max(n.SampleCount, 0))
+		for _, c := range n.Children {
+			childrenValue += uint64(max(c.SampleCount, 0))
+		}
+	}
+	for _, c := range n.Children {
+		s.addNode(c, stack, weight)
+	}
+	if value <= childrenValue {
+		return
+	}
+	s[strings.Join(stack, ";")] += value - childrenValue
+}
+
+// write outputs stacks sorted lexicographically so the output is stable
+// and can be diffed.
+func (s stacks) write(w io.Writer) error {
+	keys := make([]string, 0, len(s))
+	for k := range s {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	bw := bufio.NewWriter(w)
+	for _, k := range keys {
+		if _, err := fmt.Fprintf(bw, "%s %d\n", k, s[k]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// frameName returns the name of the function to use in a stack, prefixed
+// with its package so functions with the same name in different packages
+// aren't merged.
+func frameName(n *nodetree.Node) string {
+	name := n.Name
+	if name == "" {
+		name = "unknown"
+		if n.Frame.InstructionAddr != "" {
+			name = fmt.Sprintf("unknown (%s)", n.Frame.InstructionAddr)
+		}
+	}
+	if n.Package != "" && !strings.HasPrefix(name, n.Package+".") {
+		name = n.Package + "." + name
+	}
+	return separatorReplacer.Replace(name)
+}
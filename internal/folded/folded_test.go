@@ -0,0 +1,111 @@
+package folded
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/getsentry/vroom/internal/frame"
+	"github.com/getsentry/vroom/internal/nodetree"
+	"github.com/getsentry/vroom/internal/testutil"
+)
+
+func TestWriteCallTrees(t *testing.T) {
+	newNode := func(name string, sampleCount int, durationNS uint64, children ...*nodetree.Node) *nodetree.Node {
+		return &nodetree.Node{
+			Name:        name,
+			SampleCount: sampleCount,
+			DurationNS:  durationNS,
+			Frame:       frame.Frame{Function: name},
+			Children:    children,
+		}
+	}
+	callTrees := map[uint64][]*nodetree.Node{
+		1: {
+			newNode("main", 4, 40,
+				newNode("a", 2, 20, newNode("b;c", 1, 10)),
+				newNode("", 1, 10),
+			),
+		},
+		2: {
+			newNode("main", 2, 20, newNode("a", 2, 20)),
+		},
+	}
+
+	tests := []struct {
+		name   string
+		weight Weight
+		want   string
+	}{
+		{
+			name:   "sample count",
+			weight: WeightSampleCount,
+			want: strings.Join([]string{
+				"main 1",
+				"main;a 3",
+				"main;a;b:c 1",
+				"main;unknown 1",
+				"",
+			}, "\n"),
+		},
+		{
+			name:   "duration",
+			weight: WeightDuration,
+			want: strings.Join([]string{
+				"main 10",
+				"main;a 30",
+				"main;a;b:c 10",
+				"main;unknown 10",
+				"",
+			}, "\n"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := WriteCallTrees(&b, callTrees, test.weight); err != nil {
+				t.Fatalf("couldn't write stacks: %v", err)
+			}
+			if diff := testutil.Diff(b.String(), test.want); diff != "" {
+				t.Fatalf("Result mismatch: got - want +\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFrameName(t *testing.T) {
+	tests := []struct {
+		name string
+		node nodetree.Node
+		want string
+	}{
+		{
+			name: "without package",
+			node: nodetree.Node{Name: "main"},
+			want: "main",
+		},
+		{
+			name: "with package",
+			node: nodetree.Node{Name: "__init__", Package: "app.models"},
+			want: "app.models.__init__",
+		},
+		{
+			name: "already qualified",
+			node: nodetree.Node{Name: "main.run", Package: "main"},
+			want: "main.run",
+		},
+		{
+			name: "unknown",
+			node: nodetree.Node{Package: "libsystem", Frame: frame.Frame{InstructionAddr: "0x10"}},
+			want: "libsystem.unknown (0x10)",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := frameName(&test.node); got != test.want {
+				t.Fatalf("expected %q, got %q", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package frame
+
+import (
+	"strings"
+
+	"github.com/ianlancetaylor/demangle"
+
+	"github.com/getsentry/vroom/internal/platform"
+)
+
+// demanglePlatforms are the platforms with native frames some SDKs send
+// without demangling them.
+var demanglePlatforms = map[platform.Platform]struct{}{
+	platform.Cocoa: {},
+	platform.Rust:  {},
+}
+
+// swiftPrefixes are the prefixes of Swift 5 ($s), Swift 4.2 ($S) and
+// Swift 4 (_T0) symbols.
+var swiftPrefixes = []string{"_$s", "$s", "_$S", "$S", "_T0"}
+
+// demangle replaces a mangled function name, or the mangled symbol of a frame
+// without a function, with its demangled name.
+func (f *Frame) demangle() {
+	if _, exists := demanglePlatforms[f.Platform]; !exists {
+		return
+	}
+	if name, ok := demangleSymbol(f.Function); ok {
+		f.Function = name
+		return
+	}
+	if f.Function != "" {
+		return
+	}
+	if name, ok := demangleSymbol(f.Symbol); ok {
+		f.Function = name
+	}
+}
+
+// demangleSymbol demangles Rust (legacy and v0), Itanium C++ and Swift
+// symbols. Like symbolicator, only the name is kept, without parameters, the
+// Rust hash or clone suffixes, so the same function always gets the same
+// name.
+func demangleSymbol(symbol string) (string, bool) {
+	for _, prefix := range swiftPrefixes {
+		if strings.HasPrefix(symbol, prefix) {
+			return demangleSwift(symbol[len(prefix):])
+		}
+	}
+	// Mach-O symbols have an extra leading underscore.
+	if strings.HasPrefix(symbol, "__Z") || strings.HasPrefix(symbol, "__R") {
+		symbol = symbol[1:]
+	}
+	if !strings.HasPrefix(symbol, "_Z") && !strings.HasPrefix(symbol, "_R") {
+		return "", false
+	}
+	name, err := demangle.ToString(symbol, demangle.NoParams, demangle.NoClones)
+	if err != nil || name == "" {
+		return "", false
+	}
+	return name, true
+}
+
+// swiftContextKinds are the kinds of the nominal types a Swift symbol is
+// nested into.
+var swiftContextKinds = map[byte]struct{}{
+	'C': {}, // class
+	'O': {}, // enum
+	'P': {}, // protocol
+	'V': {}, // struct
+}
+
+// swiftEntityKinds map the suffix of a Swift symbol to what it is, named
+// entities being a function when it has no kind name.
+var swiftEntityKinds = []struct {
+	suffix string
+	name   string
+	named  bool
+}{
+	{suffix: "F", named: true},
+	{suffix: "vg", name: "getter", named: true},
+	{suffix: "vs", name: "setter", named: true},
+	{suffix: "vM", name: "modify", named: true},
+	{suffix: "fC", name: "init"},
+	{suffix: "fc", name: "init"},
+	{suffix: "fD", name: "deinit"},
+	{suffix: "fd", name: "deinit"},
+}
+
+// demangleSwift decodes the module, nominal types and name of Swift functions,
+// accessors, initializers and deinitializers, leaving out argument and return
+// types. Symbols using substitutions in their names, closures and thunks
+// aren't supported and stay mangled.
+func demangleSwift(symbol string) (string, bool) {
+	// Identical functions merged by the compiler keep the name of the first
+	// one.
+	symbol = strings.TrimSuffix(symbol, "Tm")
+	module, rest, ok := swiftIdentifier(symbol)
+	if !ok {
+		return "", false
+	}
+	parts := []string{module}
+	var name string
+	for {
+		identifier, next, ok := swiftIdentifier(rest)
+		if !ok {
+			break
+		}
+		rest = next
+		if rest != "" {
+			if _, exists := swiftContextKinds[rest[0]]; exists {
+				parts = append(parts, identifier)
+				rest = rest[1:]
+				continue
+			}
+		}
+		name = identifier
+		break
+	}
+	if strings.HasPrefix(rest, "E") {
+		// An extension declared in another module.
+		return "", false
+	}
+	for _, kind := range swiftEntityKinds {
+		if !strings.HasSuffix(rest, kind.suffix) {
+			continue
+		}
+		if kind.named {
+			if name == "" {
+				return "", false
+			}
+			parts = append(parts, name)
+		} else if name != "" || len(parts) == 1 {
+			// Initializers and deinitializers belong to a type.
+			return "", false
+		}
+		if kind.name != "" {
+			parts = append(parts, kind.name)
+		}
+		return strings.Join(parts, "."), true
+	}
+	return "", false
+}
+
+// swiftIdentifier reads an identifier prefixed by its length. Word
+// substitutions, starting with 0, aren't supported.
+func swiftIdentifier(s string) (string, string, bool) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i == 0 || s[0] == '0' {
+		return "", s, false
+	}
+	n := 0
+	for _, c := range s[:i] {
+		n = n*10 + int(c-'0')
+		if n > len(s) {
+			return "", s, false
+		}
+	}
+	if i+n > len(s) {
+		return "", s, false
+	}
+	return s[i : i+n], s[i+n:], true
+}
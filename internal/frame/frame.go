@@ -179,6 +179,22 @@ func (f Frame) IsJavaScriptApplicationFrame() bool {
 	return !javascriptSystemPackagePathRegexp.MatchString(f.Path)
 }
 
+// NeedsSourceMap returns true for a browser or Node frame with a position in
+// a file that wasn't resolved to its original source yet. p is the platform
+// of the profile, for frames without a platform.
+func (f Frame) NeedsSourceMap(p platform.Platform) bool {
+	if f.Platform != "" {
+		p = f.Platform
+	}
+	if p != platform.JavaScript && p != platform.Node {
+		return false
+	}
+	if f.IsReactNative || (f.Data.JsSymbolicated != nil && *f.Data.JsSymbolicated) {
+		return false
+	}
+	return f.Line > 0 && (f.Path != "" || f.File != "")
+}
+
 func (f Frame) IsCocoaApplicationFrame() bool {
 	isMain, _ := f.IsMain()
 	if isMain {
@@ -273,6 +289,10 @@ var fullyQualifiedNameFormatters = map[platform.Platform]func(f Frame) string{
 	// module/package name, and concatenate it with the function name.
 	platform.Python: makeJoinedNameFormatter("."),
 	platform.Node:   makeJoinedNameFormatter("."),
+
+	// Go functions are qualified by their import path, which is their
+	// module.
+	platform.Go: goFormatter,
 }
 
 func (f Frame) FullyQualifiedName(p platform.Platform) string {
@@ -309,6 +329,8 @@ func (f *Frame) SetInApp(p platform.Platform) {
 		isApplication = f.IsPythonApplicationFrame()
 	case platform.PHP:
 		isApplication = f.IsPHPApplicationFrame()
+	case platform.Go:
+		isApplication = f.IsGoApplicationFrame()
 	}
 	f.InApp = &isApplication
 }
@@ -336,5 +358,9 @@ func (f *Frame) Normalize(p platform.Platform) {
 	// Call order is important since SetInApp uses Status and Platform
 	f.SetStatus()
 	f.SetPlatform(p)
+	f.demangle()
+	if f.Platform == platform.Go {
+		f.splitGoFunction()
+	}
 	f.SetInApp(p)
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/getsentry/vroom/internal/platform"
+	"github.com/getsentry/vroom/internal/testutil"
 )
 
 func frameType(isApplication bool) string {
@@ -328,6 +329,211 @@ func TestIsPHPApplicationFrame(t *testing.T) {
 	}
 }
 
+func TestIsGoApplicationFrame(t *testing.T) {
+	tests := []struct {
+		name          string
+		frame         Frame
+		isApplication bool
+	}{
+		{
+			name:          "main package",
+			frame:         Frame{Module: "main", Function: "handler"},
+			isApplication: true,
+		},
+		{
+			name:          "qualified function of a module",
+			frame:         Frame{Function: "github.com/acme/api/internal/store.(*DB).Query"},
+			isApplication: true,
+		},
+		{
+			name:          "runtime",
+			frame:         Frame{Function: "runtime.mallocgc"},
+			isApplication: false,
+		},
+		{
+			name:          "standard library",
+			frame:         Frame{Module: "encoding/json", Function: "Unmarshal"},
+			isApplication: false,
+		},
+		{
+			name: "goroot",
+			frame: Frame{
+				Module:   "github.com/acme/api",
+				Function: "run",
+				Path:     "/usr/local/go/src/net/http/server.go",
+			},
+			isApplication: false,
+		},
+		{
+			name: "module cache",
+			frame: Frame{
+				Module:   "github.com/lib/pq",
+				Function: "(*conn).query",
+				Path:     "/root/go/pkg/mod/github.com/lib/pq@v1.10.9/conn.go",
+			},
+			isApplication: false,
+		},
+		{
+			name: "gopath",
+			frame: Frame{
+				Module:   "github.com/acme/api",
+				Function: "run",
+				Path:     "/home/dev/go/src/github.com/acme/api/main.go",
+			},
+			isApplication: true,
+		},
+		{
+			name:          "sentry sdk",
+			frame:         Frame{Module: "github.com/getsentry/sentry-go", Function: "(*Hub).Flush"},
+			isApplication: false,
+		},
+		{
+			name:          "c function",
+			frame:         Frame{Function: "__libc_read", Package: "/lib/x86_64-linux-gnu/libc.so.6"},
+			isApplication: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if isApplication := tt.frame.IsGoApplicationFrame(); isApplication != tt.isApplication {
+				t.Fatalf(
+					"Expected %s frame but got %s frame",
+					frameType(tt.isApplication),
+					frameType(isApplication),
+				)
+			}
+		})
+	}
+}
+
+func TestNormalizeGoFrame(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame Frame
+		want  Frame
+	}{
+		{
+			name:  "qualified method",
+			frame: Frame{Function: "github.com/acme/api.(*Server).Serve"},
+			want: Frame{
+				Function: "(*Server).Serve",
+				Module:   "github.com/acme/api",
+				InApp:    &testutil.True,
+				Platform: platform.Go,
+			},
+		},
+		{
+			name:  "generic function",
+			frame: Frame{Function: "slices.SortFunc[go.shape.[]github.com/acme/api.Item]"},
+			want: Frame{
+				Function: "SortFunc[go.shape.[]github.com/acme/api.Item]",
+				Module:   "slices",
+				InApp:    &testutil.False,
+				Platform: platform.Go,
+			},
+		},
+		{
+			name:  "already split",
+			frame: Frame{Function: "(*conn).serve", Module: "net/http"},
+			want: Frame{
+				Function: "(*conn).serve",
+				Module:   "net/http",
+				InApp:    &testutil.False,
+				Platform: platform.Go,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.frame.Normalize(platform.Go)
+			if diff := testutil.Diff(tt.frame, tt.want); diff != "" {
+				t.Fatalf("Result mismatch: got - want +\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNormalizeDemangle(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform platform.Platform
+		frame    Frame
+		want     string
+	}{
+		{
+			name:     "rust legacy",
+			platform: platform.Rust,
+			frame:    Frame{Function: "_ZN3std2rt10lang_start17h0123456789abcdefE"},
+			want:     "std::rt::lang_start",
+		},
+		{
+			name:     "rust v0",
+			platform: platform.Rust,
+			frame:    Frame{Function: "_RNvMs_NtCs4fqI2P2rA04_4core3fmtNtB4_9Formatter3pad"},
+			want:     "<core::fmt::Formatter>::pad",
+		},
+		{
+			name:     "c++ with a mach-o underscore",
+			platform: platform.Cocoa,
+			frame:    Frame{Function: "__ZNK3foo3BarIiE3bazEv.cold"},
+			want:     "foo::Bar<int>::baz",
+		},
+		{
+			name:     "mangled symbol without a function",
+			platform: platform.Cocoa,
+			frame:    Frame{Symbol: "_Z3fooi"},
+			want:     "foo",
+		},
+		{
+			name:     "swift method",
+			platform: platform.Cocoa,
+			frame:    Frame{Function: "$s4main3FooC3bar1xySi_tF"},
+			want:     "main.Foo.bar",
+		},
+		{
+			name:     "swift merged getter",
+			platform: platform.Cocoa,
+			frame:    Frame{Function: "_$s4main3FooV5countSivgTm"},
+			want:     "main.Foo.count.getter",
+		},
+		{
+			name:     "swift initializer",
+			platform: platform.Cocoa,
+			frame:    Frame{Function: "$s4main3FooVACycfC"},
+			want:     "main.Foo.init",
+		},
+		{
+			name:     "swift word substitution",
+			platform: platform.Cocoa,
+			frame:    Frame{Function: "$s4main3FooC04viewB0yyF"},
+			want:     "$s4main3FooC04viewB0yyF",
+		},
+		{
+			name:     "already demangled",
+			platform: platform.Cocoa,
+			frame:    Frame{Function: "-[UIApplication run]", Symbol: "_Z3fooi"},
+			want:     "-[UIApplication run]",
+		},
+		{
+			name:     "not a native platform",
+			platform: platform.Python,
+			frame:    Frame{Function: "_Z3fooi"},
+			want:     "_Z3fooi",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.frame.Normalize(tt.platform)
+			if tt.frame.Function != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, tt.frame.Function)
+			}
+		})
+	}
+}
+
 func TestWriteToHash(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -510,6 +716,16 @@ func TestFullyQualifiedName(t *testing.T) {
 			},
 			expected: "threading.Condition.wait",
 		},
+		{
+			name:     "go",
+			platform: platform.Go,
+			frame: Frame{
+				Module:   "net/http",
+				Package:  "/usr/bin/server",
+				Function: "(*conn).serve",
+			},
+			expected: "net/http.(*conn).serve",
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,183 @@
+package frame
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// goSystemPathRegex matches files from the module cache and from GOROOT,
+	// where the standard library is in a directory without a dot, unlike
+	// the code in GOPATH.
+	goSystemPathRegex = regexp.MustCompile(`(?i)(^|/)(pkg/mod/|(go|go-?[0-9][^/]*|libexec)/src/[^/.]+/)`)
+
+	// goStdlib holds the top level directories of the standard library.
+	goStdlib = map[string]struct{}{
+		"archive":   {},
+		"bufio":     {},
+		"builtin":   {},
+		"bytes":     {},
+		"cmp":       {},
+		"compress":  {},
+		"container": {},
+		"context":   {},
+		"crypto":    {},
+		"database":  {},
+		"debug":     {},
+		"embed":     {},
+		"encoding":  {},
+		"errors":    {},
+		"expvar":    {},
+		"flag":      {},
+		"fmt":       {},
+		"go":        {},
+		"hash":      {},
+		"html":      {},
+		"image":     {},
+		"index":     {},
+		"internal":  {},
+		"io":        {},
+		"iter":      {},
+		"log":       {},
+		"maps":      {},
+		"math":      {},
+		"mime":      {},
+		"net":       {},
+		"os":        {},
+		"path":      {},
+		"plugin":    {},
+		"reflect":   {},
+		"regexp":    {},
+		"runtime":   {},
+		"slices":    {},
+		"sort":      {},
+		"strconv":   {},
+		"strings":   {},
+		"structs":   {},
+		"sync":      {},
+		"syscall":   {},
+		"testing":   {},
+		"text":      {},
+		"time":      {},
+		"unicode":   {},
+		"unique":    {},
+		"unsafe":    {},
+		"vendor":    {},
+		"weak":      {},
+	}
+
+	// goSystemModulePrefixes are modules outside of the standard library
+	// still considered system code.
+	goSystemModulePrefixes = []string{
+		"github.com/getsentry/sentry-go",
+		"golang.org/x/",
+	}
+
+	// goSchedulerFunctions are the functions of the runtime running while a
+	// goroutine or a thread waits for work.
+	goSchedulerFunctions = map[string]struct{}{
+		"runtime.epollwait":                          {},
+		"runtime.findRunnable":                       {},
+		"runtime.findrunnable":                       {},
+		"runtime.futex":                              {},
+		"runtime.futexsleep":                         {},
+		"runtime.gopark":                             {},
+		"runtime.goparkunlock":                       {},
+		"runtime.goschedImpl":                        {},
+		"runtime.gosched_m":                          {},
+		"runtime.kevent":                             {},
+		"runtime.mPark":                              {},
+		"runtime.mcall":                              {},
+		"runtime.mstart":                             {},
+		"runtime.mstart0":                            {},
+		"runtime.mstart1":                            {},
+		"runtime.netpoll":                            {},
+		"runtime.notesleep":                          {},
+		"runtime.notetsleep":                         {},
+		"runtime.notetsleepg":                        {},
+		"runtime.osyield":                            {},
+		"runtime.park_m":                             {},
+		"runtime.pthread_cond_timedwait_relative_np": {},
+		"runtime.pthread_cond_wait":                  {},
+		"runtime.schedule":                           {},
+		"runtime.semasleep":                          {},
+		"runtime.stopm":                              {},
+		"runtime.usleep":                             {},
+	}
+)
+
+const goExitFunction = "runtime.goexit"
+
+// goPackage returns the import path of the package of a fully qualified Go
+// function, like net/http for net/http.(*conn).serve.
+func goPackage(function string) string {
+	// Type parameters can contain import paths.
+	name := function
+	if i := strings.IndexByte(name, '['); i != -1 {
+		name = name[:i]
+	}
+	start := strings.LastIndexByte(name, '/') + 1
+	dot := strings.IndexByte(name[start:], '.')
+	if dot <= 0 || name[start] == '(' {
+		return ""
+	}
+	return name[:start+dot]
+}
+
+// splitGoFunction moves the package of a fully qualified function to the
+// module, like the Go SDK reports its frames.
+func (f *Frame) splitGoFunction() {
+	if f.Module != "" {
+		return
+	}
+	pkg := goPackage(f.Function)
+	if pkg == "" {
+		return
+	}
+	f.Module = pkg
+	f.Function = f.Function[len(pkg)+1:]
+}
+
+func goFormatter(f Frame) string {
+	if f.Module == "" {
+		return f.Function
+	}
+	return f.Module + "." + f.Function
+}
+
+func (f Frame) IsGoApplicationFrame() bool {
+	for _, p := range []string{f.Path, f.File} {
+		if goSystemPathRegex.MatchString(strings.ReplaceAll(p, "\\", "/")) {
+			return false
+		}
+	}
+	pkg := f.Module
+	if pkg == "" {
+		pkg = goPackage(f.Function)
+	}
+	// Functions without a package aren't Go functions, they come from C
+	// libraries or the kernel.
+	if pkg == "" {
+		return false
+	}
+	for _, prefix := range goSystemModulePrefixes {
+		if strings.HasPrefix(pkg, prefix) {
+			return false
+		}
+	}
+	_, isStdlib := goStdlib[strings.SplitN(pkg, "/", 2)[0]]
+	return !isStdlib
+}
+
+// IsGoSchedulerFrame returns true if the frame is a function of the runtime
+// scheduler, on stacks of idle goroutines and threads.
+func (f Frame) IsGoSchedulerFrame() bool {
+	_, exists := goSchedulerFunctions[goFormatter(f)]
+	return exists
+}
+
+// IsGoExitFrame returns true if the frame is the root frame of every
+// goroutine.
+func (f Frame) IsGoExitFrame() bool {
+	return goFormatter(f) == goExitFunction
+}
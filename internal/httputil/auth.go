@@ -0,0 +1,373 @@
+package httputil
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/julienschmidt/httprouter"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// KeyIDHeader, TimestampHeader and SignatureHeader carry the signature
+	// of a request signed with a shared secret, the key ID being the ID of
+	// the client.
+	KeyIDHeader     = "X-Vroom-Key-Id"
+	TimestampHeader = "X-Vroom-Timestamp"
+	SignatureHeader = "X-Vroom-Signature"
+
+	// DefaultMaxClockSkew is how old or how far in the future a signed
+	// request can be when not set.
+	DefaultMaxClockSkew = 5 * time.Minute
+
+	// DefaultMaxBodyBytes is the largest body of a signed request when not
+	// set, since it's read in memory before its signature is checked.
+	DefaultMaxBodyBytes = 50 << 20
+
+	// signaturePruneInterval is how often the signatures of requests older
+	// than the clock skew are forgotten.
+	signaturePruneInterval = time.Minute
+
+	// AllOrganizations gives a client access to every organization and to
+	// the routes not scoped to an organization.
+	AllOrganizations = "*"
+
+	organizationIDParam = "organization_id"
+)
+
+var (
+	ErrNoClients             = errors.New("no clients")
+	ErrMissingCredentials    = errors.New("missing client certificate or request signature")
+	ErrUnknownKey            = errors.New("unknown key id")
+	ErrInvalidTimestamp      = errors.New("invalid or expired timestamp")
+	ErrInvalidSignature      = errors.New("invalid signature")
+	ErrReplayedRequest       = errors.New("request was already received")
+	ErrUnknownCertificate    = errors.New("client certificate doesn't match any client")
+	ErrOrganizationForbidden = errors.New("client can't access this organization")
+)
+
+type (
+	// AuthConfig lists the clients allowed to call vroom and the
+	// organizations each of them can access.
+	AuthConfig struct {
+		MaxClockSkew time.Duration `yaml:"max_clock_skew"`
+		MaxBodyBytes int64         `yaml:"max_body_bytes"`
+		Clients      []AuthClient  `yaml:"clients"`
+	}
+
+	// AuthClient is identified by the shared secret signing its requests or
+	// by a name of its client certificate, a common name, DNS name or URI.
+	AuthClient struct {
+		ID               string   `yaml:"id"`
+		Secret           string   `yaml:"secret"`
+		CertificateNames []string `yaml:"certificate_names"`
+		// Organizations are organization IDs or * for all of them.
+		Organizations []string `yaml:"organizations"`
+	}
+
+	// Authenticator checks who is calling a route and if they can access
+	// the organization in its path. The signatures seen within the clock
+	// skew are kept so a signed request can't be sent again.
+	Authenticator struct {
+		maxClockSkew time.Duration
+		maxBodyBytes int64
+		clients      map[string]*authClient
+		certificates map[string]*authClient
+		now          func() time.Time
+
+		mu         sync.Mutex
+		signatures map[string]time.Time
+		nextPrune  time.Time
+	}
+
+	authClient struct {
+		id               string
+		secret           []byte
+		allOrganizations bool
+		organizations    map[uint64]struct{}
+	}
+
+	authClientKey struct{}
+)
+
+// LoadAuthConfig reads the clients from the YAML or JSON file at path.
+func LoadAuthConfig(path string) (AuthConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return AuthConfig{}, err
+	}
+	var c AuthConfig
+	d := yaml.NewDecoder(bytes.NewReader(b))
+	d.KnownFields(true)
+	err = d.Decode(&c)
+	if err != nil {
+		return AuthConfig{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// NewAuthenticator validates the config and indexes the clients by ID and
+// certificate name.
+func NewAuthenticator(c AuthConfig) (*Authenticator, error) {
+	if len(c.Clients) == 0 {
+		return nil, ErrNoClients
+	}
+	a := &Authenticator{
+		maxClockSkew: c.MaxClockSkew,
+		maxBodyBytes: c.MaxBodyBytes,
+		clients:      make(map[string]*authClient),
+		certificates: make(map[string]*authClient),
+		now:          time.Now,
+		signatures:   make(map[string]time.Time),
+	}
+	if a.maxClockSkew <= 0 {
+		a.maxClockSkew = DefaultMaxClockSkew
+	}
+	if a.maxBodyBytes <= 0 {
+		a.maxBodyBytes = DefaultMaxBodyBytes
+	}
+	for i, client := range c.Clients {
+		if client.ID == "" {
+			return nil, fmt.Errorf("client %d: id is missing", i)
+		}
+		if _, exists := a.clients[client.ID]; exists {
+			return nil, fmt.Errorf("client %d: duplicate id %s", i, client.ID)
+		}
+		if client.Secret == "" && len(client.CertificateNames) == 0 {
+			return nil, fmt.Errorf("client %s: a secret or a certificate name is required", client.ID)
+		}
+		ac := &authClient{
+			id:            client.ID,
+			secret:        []byte(client.Secret),
+			organizations: make(map[uint64]struct{}),
+		}
+		for _, o := range client.Organizations {
+			if o == AllOrganizations {
+				ac.allOrganizations = true
+				continue
+			}
+			organizationID, err := strconv.ParseUint(o, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("client %s: invalid organization %q", client.ID, o)
+			}
+			ac.organizations[organizationID] = struct{}{}
+		}
+		for _, name := range client.CertificateNames {
+			if _, exists := a.certificates[name]; exists {
+				return nil, fmt.Errorf("client %s: certificate name %s is already used", client.ID, name)
+			}
+			a.certificates[name] = ac
+		}
+		a.clients[client.ID] = ac
+	}
+	return a, nil
+}
+
+// Authenticate only calls handler when the request comes from a known client
+// allowed to access the organization in the path. A verified client
+// certificate identifies the client first, a request signature otherwise.
+// Routes without an organization require access to all organizations.
+func (a *Authenticator) Authenticate(handler http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		hub := sentry.GetHubFromContext(ctx)
+
+		client, err := a.identify(w, r)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			WriteError(w, http.StatusRequestEntityTooLarge, Error{
+				Code:    ErrorCodeInvalidBody,
+				Message: fmt.Sprintf("body is larger than %d bytes", maxBytesErr.Limit),
+			})
+			return
+		}
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, Error{
+				Code:    ErrorCodeUnauthorized,
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if hub != nil {
+			hub.Scope().SetTag("client_id", client.id)
+		}
+
+		rawOrganizationID := httprouter.ParamsFromContext(ctx).ByName(organizationIDParam)
+		if !client.canAccess(rawOrganizationID) {
+			WriteError(w, http.StatusForbidden, Error{
+				Code:      ErrorCodeForbidden,
+				Message:   ErrOrganizationForbidden.Error(),
+				Parameter: organizationIDParam,
+			})
+			return
+		}
+
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(ctx, authClientKey{}, client.id)))
+	}
+}
+
+// ClientFromContext returns the ID of the client authenticated for the
+// request.
+func ClientFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(authClientKey{}).(string)
+	return id, ok
+}
+
+func (a *Authenticator) identify(w http.ResponseWriter, r *http.Request) (*authClient, error) {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		for _, name := range certificateNames(r.TLS.VerifiedChains[0][0]) {
+			if client, exists := a.certificates[name]; exists {
+				return client, nil
+			}
+		}
+		if r.Header.Get(SignatureHeader) == "" {
+			return nil, ErrUnknownCertificate
+		}
+	}
+
+	keyID := r.Header.Get(KeyIDHeader)
+	if keyID == "" || r.Header.Get(SignatureHeader) == "" {
+		return nil, ErrMissingCredentials
+	}
+	client, exists := a.clients[keyID]
+	if !exists || len(client.secret) == 0 {
+		return nil, ErrUnknownKey
+	}
+
+	rawTimestamp := r.Header.Get(TimestampHeader)
+	timestamp, err := strconv.ParseInt(rawTimestamp, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidTimestamp
+	}
+	skew := a.now().Sub(time.Unix(timestamp, 0))
+	if skew > a.maxClockSkew || skew < -a.maxClockSkew {
+		return nil, ErrInvalidTimestamp
+	}
+
+	signature, err := hex.DecodeString(r.Header.Get(SignatureHeader))
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = http.MaxBytesReader(w, r.Body, a.maxBodyBytes)
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(signature, sign(client.secret, r.Method, r.URL.RequestURI(), rawTimestamp, body)) {
+		return nil, ErrInvalidSignature
+	}
+	if !a.rememberSignature(keyID, signature, time.Unix(timestamp, 0).Add(a.maxClockSkew)) {
+		return nil, ErrReplayedRequest
+	}
+	return client, nil
+}
+
+// rememberSignature returns false when the signature was already seen. It's
+// kept until expiresAt, when its timestamp is too old to be accepted anyway.
+func (a *Authenticator) rememberSignature(keyID string, signature []byte, expiresAt time.Time) bool {
+	now := a.now()
+	key := keyID + ":" + string(signature)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if now.After(a.nextPrune) {
+		for k, t := range a.signatures {
+			if now.After(t) {
+				delete(a.signatures, k)
+			}
+		}
+		a.nextPrune = now.Add(signaturePruneInterval)
+	}
+	if t, exists := a.signatures[key]; exists && !now.After(t) {
+		return false
+	}
+	a.signatures[key] = expiresAt
+	return true
+}
+
+func (c *authClient) canAccess(rawOrganizationID string) bool {
+	if c.allOrganizations {
+		return true
+	}
+	if rawOrganizationID == "" {
+		return false
+	}
+	organizationID, err := strconv.ParseUint(rawOrganizationID, 10, 64)
+	if err != nil {
+		return false
+	}
+	_, exists := c.organizations[organizationID]
+	return exists
+}
+
+// SignRequest adds the headers authenticating a request with a shared
+// secret. The body is read and replaced so the request can still be sent.
+func SignRequest(r *http.Request, keyID string, secret []byte, now time.Time) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	r.Header.Set(KeyIDHeader, keyID)
+	r.Header.Set(TimestampHeader, timestamp)
+	r.Header.Set(SignatureHeader, hex.EncodeToString(sign(secret, r.Method, r.URL.RequestURI(), timestamp, body)))
+	return nil
+}
+
+// sign returns the HMAC-SHA256 of the method, the path with its query, the
+// timestamp and the SHA-256 of the body, separated by new lines.
+func sign(secret []byte, method, uri, timestamp string, body []byte) []byte {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(method))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(uri))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(hex.EncodeToString(bodyHash[:])))
+	return mac.Sum(nil)
+}
+
+// readBody reads the body of a request and replaces it with a reader on the
+// same bytes.
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	_ = r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+func certificateNames(c *x509.Certificate) []string {
+	names := make([]string, 0, 1+len(c.DNSNames)+len(c.URIs))
+	if c.Subject.CommonName != "" {
+		names = append(names, c.Subject.CommonName)
+	}
+	names = append(names, c.DNSNames...)
+	for _, u := range c.URIs {
+		names = append(names, u.String())
+	}
+	return names
+}
@@ -0,0 +1,255 @@
+package httputil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+var testNow = time.Unix(1700000000, 0)
+
+func newTestAuthenticator(t *testing.T) *Authenticator {
+	t.Helper()
+	a, err := NewAuthenticator(AuthConfig{
+		Clients: []AuthClient{
+			{ID: "sentry", Secret: "secret", Organizations: []string{"1", "2"}},
+			{ID: "admin", Secret: "admin-secret", Organizations: []string{AllOrganizations}},
+			{ID: "relay", CertificateNames: []string{"relay.internal"}, Organizations: []string{"3"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("couldn't create authenticator: %v", err)
+	}
+	a.now = func() time.Time { return testNow }
+	return a
+}
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		prepare  func(r *http.Request)
+		wantCode int
+		wantID   string
+	}{
+		{
+			name: "signed request",
+			path: "/organizations/1/projects/1/raw_profiles",
+			body: `{"event_id":"1"}`,
+			prepare: func(r *http.Request) {
+				_ = SignRequest(r, "sentry", []byte("secret"), testNow)
+			},
+			wantCode: http.StatusOK,
+			wantID:   "sentry",
+		},
+		{
+			name: "body changed after signing",
+			path: "/organizations/1/projects/1/raw_profiles",
+			body: `{"event_id":"1"}`,
+			prepare: func(r *http.Request) {
+				_ = SignRequest(r, "sentry", []byte("secret"), testNow)
+				r.Body = http.NoBody
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "wrong secret",
+			path: "/organizations/1/projects/1/raw_profiles",
+			prepare: func(r *http.Request) {
+				_ = SignRequest(r, "sentry", []byte("other"), testNow)
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "expired timestamp",
+			path: "/organizations/1/projects/1/raw_profiles",
+			prepare: func(r *http.Request) {
+				_ = SignRequest(r, "sentry", []byte("secret"), testNow.Add(-time.Hour))
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "unknown key",
+			path: "/organizations/1/projects/1/raw_profiles",
+			prepare: func(r *http.Request) {
+				_ = SignRequest(r, "unknown", []byte("secret"), testNow)
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "no credentials",
+			path:     "/organizations/1/projects/1/raw_profiles",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "forbidden organization",
+			path: "/organizations/3/projects/1/raw_profiles",
+			prepare: func(r *http.Request) {
+				_ = SignRequest(r, "sentry", []byte("secret"), testNow)
+			},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name: "route without organization",
+			path: "/cache/stats",
+			prepare: func(r *http.Request) {
+				_ = SignRequest(r, "sentry", []byte("secret"), testNow)
+			},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name: "all organizations",
+			path: "/cache/stats",
+			prepare: func(r *http.Request) {
+				_ = SignRequest(r, "admin", []byte("admin-secret"), testNow)
+			},
+			wantCode: http.StatusOK,
+			wantID:   "admin",
+		},
+		{
+			name: "client certificate",
+			path: "/organizations/3/projects/1/raw_profiles",
+			prepare: func(r *http.Request) {
+				r.TLS = testConnectionState(&x509.Certificate{DNSNames: []string{"relay.internal"}})
+			},
+			wantCode: http.StatusOK,
+			wantID:   "relay",
+		},
+		{
+			name: "unknown client certificate",
+			path: "/organizations/3/projects/1/raw_profiles",
+			prepare: func(r *http.Request) {
+				r.TLS = testConnectionState(&x509.Certificate{Subject: pkix.Name{CommonName: "other"}})
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	a := newTestAuthenticator(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var gotID, gotBody string
+			router := httprouter.New()
+			handler := a.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotID, _ = ClientFromContext(r.Context())
+				b, _ := io.ReadAll(r.Body)
+				gotBody = string(b)
+			}))
+			router.Handler(http.MethodPost, "/organizations/:organization_id/projects/:project_id/raw_profiles", handler)
+			router.Handler(http.MethodPost, "/cache/stats", handler)
+
+			r := httptest.NewRequest(http.MethodPost, test.path, strings.NewReader(test.body))
+			if test.prepare != nil {
+				test.prepare(r)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != test.wantCode {
+				t.Fatalf("expected status %d, got %d: %s", test.wantCode, w.Code, w.Body.String())
+			}
+			if gotID != test.wantID {
+				t.Fatalf("expected client %q, got %q", test.wantID, gotID)
+			}
+			if test.wantCode == http.StatusOK && gotBody != test.body {
+				t.Fatalf("expected body %q, got %q", test.body, gotBody)
+			}
+		})
+	}
+}
+
+func TestAuthenticateReplayedRequest(t *testing.T) {
+	a := newTestAuthenticator(t)
+	handler := a.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func(now, signedAt time.Time) int {
+		a.now = func() time.Time { return now }
+		r := httptest.NewRequest(http.MethodPost, "/cache/stats", strings.NewReader(`{}`))
+		_ = SignRequest(r, "admin", []byte("admin-secret"), signedAt)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := send(testNow, testNow); code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	if code := send(testNow.Add(time.Minute), testNow); code != http.StatusUnauthorized {
+		t.Fatalf("expected the replayed request to be rejected, got %d", code)
+	}
+	// Once a request expired, its signature is forgotten.
+	later := testNow.Add(DefaultMaxClockSkew + 2*signaturePruneInterval)
+	if code := send(later, later); code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	if len(a.signatures) != 1 {
+		t.Fatalf("expected expired signatures to be pruned, got %d signatures", len(a.signatures))
+	}
+}
+
+func TestAuthenticateBodyTooLarge(t *testing.T) {
+	a, err := NewAuthenticator(AuthConfig{
+		MaxBodyBytes: 4,
+		Clients:      []AuthClient{{ID: "admin", Secret: "admin-secret", Organizations: []string{AllOrganizations}}},
+	})
+	if err != nil {
+		t.Fatalf("couldn't create authenticator: %v", err)
+	}
+	a.now = func() time.Time { return testNow }
+	handler := a.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest(http.MethodPost, "/cache/stats", strings.NewReader(`{"a":1}`))
+	_ = SignRequest(r, "admin", []byte("admin-secret"), testNow)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+	}
+}
+
+func TestNewAuthenticatorErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		clients []AuthClient
+		wantErr error
+	}{
+		{name: "no clients", wantErr: ErrNoClients},
+		{name: "missing id", clients: []AuthClient{{Secret: "secret"}}},
+		{name: "missing credentials", clients: []AuthClient{{ID: "a"}}},
+		{name: "duplicate id", clients: []AuthClient{{ID: "a", Secret: "s"}, {ID: "a", Secret: "s"}}},
+		{name: "invalid organization", clients: []AuthClient{{ID: "a", Secret: "s", Organizations: []string{"org"}}}},
+		{
+			name: "duplicate certificate name",
+			clients: []AuthClient{
+				{ID: "a", CertificateNames: []string{"c"}},
+				{ID: "b", CertificateNames: []string{"c"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewAuthenticator(AuthConfig{Clients: test.clients})
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+				t.Fatalf("expected %v, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func testConnectionState(c *x509.Certificate) *tls.ConnectionState {
+	return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{c}}}
+}
@@ -0,0 +1,53 @@
+package httputil
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ErrorCode tells clients why a request failed without parsing the message.
+type ErrorCode string
+
+const (
+	ErrorCodeInvalidID        ErrorCode = "invalid_id"
+	ErrorCodeInvalidParameter ErrorCode = "invalid_parameter"
+	ErrorCodeMissingParameter ErrorCode = "missing_parameter"
+	ErrorCodeInvalidBody      ErrorCode = "invalid_body"
+	ErrorCodeIDMismatch       ErrorCode = "id_mismatch"
+	ErrorCodeNotFound         ErrorCode = "not_found"
+	ErrorCodeAlreadyExists    ErrorCode = "already_exists"
+	ErrorCodeNoChunks         ErrorCode = "no_chunks"
+	ErrorCodeMixedChunkTypes  ErrorCode = "mixed_chunk_types"
+	ErrorCodeStorageTimeout   ErrorCode = "storage_timeout"
+	ErrorCodeStorageError     ErrorCode = "storage_error"
+	ErrorCodeInternalError    ErrorCode = "internal_error"
+	ErrorCodeUnauthorized     ErrorCode = "unauthorized"
+	ErrorCodeForbidden        ErrorCode = "forbidden"
+)
+
+type (
+	// Error describes a failed request. Parameter is the path parameter, query
+	// parameter or body field at fault, if any.
+	Error struct {
+		Code      ErrorCode `json:"code"`
+		Message   string    `json:"message"`
+		Parameter string    `json:"parameter,omitempty"`
+	}
+
+	// ErrorResponse is the body of every error response.
+	ErrorResponse struct {
+		Error Error `json:"error"`
+	}
+)
+
+// WriteError writes the status and the error as JSON in the response.
+func WriteError(w http.ResponseWriter, status int, e Error) {
+	b, err := json.Marshal(ErrorResponse{Error: e})
+	if err != nil {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,130 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/getsentry/vroom/internal/frame"
+)
+
+var ErrInvalidCPUProfileNode = errors.New("cpuprofile: sample references an unknown node")
+
+type (
+	// cpuProfile is a profile recorded by the V8 sampling profiler.
+	// Timestamps and time deltas are in microseconds.
+	cpuProfile struct {
+		Nodes      []cpuProfileNode `json:"nodes"`
+		StartTime  int64            `json:"startTime"`
+		EndTime    int64            `json:"endTime"`
+		Samples    []int            `json:"samples"`
+		TimeDeltas []int64          `json:"timeDeltas"`
+	}
+
+	cpuProfileNode struct {
+		ID        int             `json:"id"`
+		CallFrame cpuProfileFrame `json:"callFrame"`
+		Children  []int           `json:"children"`
+		Parent    *int            `json:"parent"`
+	}
+
+	// cpuProfileFrame has 0-based line and column numbers.
+	cpuProfileFrame struct {
+		FunctionName string `json:"functionName"`
+		URL          string `json:"url"`
+		LineNumber   int    `json:"lineNumber"`
+		ColumnNumber int    `json:"columnNumber"`
+	}
+)
+
+// cpuProfileIdleNodes are the nodes V8 adds when no JavaScript is running,
+// samples on them have an empty stack.
+var cpuProfileIdleNodes = map[string]struct{}{
+	"(root)":    {},
+	"(idle)":    {},
+	"(program)": {},
+}
+
+// importCPUProfile reads a single-threaded profile whose start time is
+// relative to an arbitrary clock, so samples are moved to start at the start
+// of the profile.
+func importCPUProfile(r io.Reader, o Options) (*builder, error) {
+	var p cpuProfile
+	if err := json.NewDecoder(r).Decode(&p); err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[int]cpuProfileNode, len(p.Nodes))
+	parents := make(map[int]int, len(p.Nodes))
+	for _, n := range p.Nodes {
+		nodes[n.ID] = n
+		for _, c := range n.Children {
+			parents[c] = n.ID
+		}
+		if n.Parent != nil {
+			parents[n.ID] = *n.Parent
+		}
+	}
+
+	b := newBuilder()
+	b.setThreadName(defaultThreadID, defaultThreadName)
+	stacks := make(map[int][]frame.Frame)
+	ts := seconds(o.Start)
+	for i, id := range p.Samples {
+		if i < len(p.TimeDeltas) {
+			ts += (time.Duration(p.TimeDeltas[i]) * time.Microsecond).Seconds()
+		}
+		frames, exists := stacks[id]
+		if !exists {
+			if _, exists := nodes[id]; !exists {
+				return nil, ErrInvalidCPUProfileNode
+			}
+			frames = cpuProfileStack(nodes, parents, id)
+			stacks[id] = frames
+		}
+		b.addSampleAt(defaultThreadID, ts, frames)
+	}
+	if len(p.Samples) > 0 && p.EndTime > p.StartTime {
+		t := b.thread(defaultThreadID)
+		end := seconds(o.Start) + (time.Duration(p.EndTime-p.StartTime) * time.Microsecond).Seconds()
+		if end > t.last {
+			t.end = end
+		}
+	}
+	return b, nil
+}
+
+// cpuProfileStack returns the frames from the node to the root.
+func cpuProfileStack(nodes map[int]cpuProfileNode, parents map[int]int, id int) []frame.Frame {
+	var frames []frame.Frame
+	// Walking up is bounded by the number of nodes in case of a cycle.
+	for i := 0; i <= len(nodes); i++ {
+		n, exists := nodes[id]
+		if !exists {
+			break
+		}
+		if _, idle := cpuProfileIdleNodes[n.CallFrame.FunctionName]; !idle {
+			f := frame.Frame{
+				Function: n.CallFrame.FunctionName,
+				Path:     n.CallFrame.URL,
+			}
+			if f.Function == "" {
+				f.Function = "(anonymous)"
+			}
+			if n.CallFrame.LineNumber >= 0 {
+				f.Line = uint32(n.CallFrame.LineNumber + 1)
+			}
+			if n.CallFrame.ColumnNumber >= 0 {
+				f.Column = uint32(n.CallFrame.ColumnNumber + 1)
+			}
+			frames = append(frames, f)
+		}
+		parent, exists := parents[id]
+		if !exists {
+			break
+		}
+		id = parent
+	}
+	return frames
+}
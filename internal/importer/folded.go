@@ -0,0 +1,51 @@
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getsentry/vroom/internal/frame"
+)
+
+// importFolded reads collapsed stacks, the root frame first and frames
+// separated by semicolons, followed by a sample count. Stacks are laid out one
+// after the other, each sample lasting the sample interval.
+func importFolded(r io.Reader, o Options) (*builder, error) {
+	b := newBuilder()
+	b.setThreadName(defaultThreadID, defaultThreadName)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var lineNum int
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		if i == -1 {
+			return nil, fmt.Errorf("folded: missing sample count on line %d", lineNum)
+		}
+		count, err := strconv.ParseUint(line[i+1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("folded: invalid sample count on line %d", lineNum)
+		}
+		if count == 0 {
+			continue
+		}
+		names := strings.Split(strings.TrimSpace(line[:i]), ";")
+		frames := make([]frame.Frame, 0, len(names))
+		for j := len(names) - 1; j >= 0; j-- {
+			frames = append(frames, frame.Frame{Function: names[j]})
+		}
+		b.addSampleFor(defaultThreadID, o.Start, time.Duration(count)*o.SampleInterval, frames)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
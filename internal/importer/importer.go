@@ -0,0 +1,248 @@
+// Package importer converts profiles recorded without a Sentry SDK to sample
+// chunks, so they go through the same call trees, flamegraphs and function
+// metrics as the chunks sent by SDKs.
+package importer
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getsentry/vroom/internal/chunk"
+	"github.com/getsentry/vroom/internal/frame"
+	"github.com/getsentry/vroom/internal/platform"
+	"github.com/getsentry/vroom/internal/sample"
+)
+
+// Format is the format of an imported profile.
+type Format string
+
+const (
+	// FormatPprof is a profile.proto, gzipped or not.
+	FormatPprof Format = "pprof"
+	// FormatPerf is the output of perf script with call graphs.
+	FormatPerf Format = "perf"
+	// FormatCPUProfile is a Chrome DevTools or Node.js .cpuprofile.
+	FormatCPUProfile Format = "cpuprofile"
+	// FormatFolded is collapsed stacks, a stack and a sample count per line.
+	FormatFolded Format = "folded"
+
+	// DefaultSampleInterval is the duration of a sample when the profile
+	// only counts samples.
+	DefaultSampleInterval = 10 * time.Millisecond
+
+	// chunkVersion is the version of the sample chunks produced.
+	chunkVersion = "2"
+
+	// defaultThreadID is the thread of the samples of profiles without
+	// threads, named like a main thread.
+	defaultThreadID   = "1"
+	defaultThreadName = "main"
+)
+
+var (
+	ErrInvalidFormat = errors.New("format has to be one of pprof, perf, cpuprofile or folded")
+	ErrNoSamples     = errors.New("profile has no samples")
+)
+
+// Validate returns an error if the format is unknown.
+func (f Format) Validate() error {
+	switch f {
+	case FormatPprof, FormatPerf, FormatCPUProfile, FormatFolded:
+		return nil
+	}
+	return ErrInvalidFormat
+}
+
+// Options describes what a profile doesn't record.
+type Options struct {
+	// Platform is the platform of the chunk, used to normalize its frames.
+	Platform platform.Platform
+	// Start is when the profile started, used when the profile doesn't
+	// record it.
+	Start time.Time
+	// SampleInterval is the duration of a sample for profiles counting
+	// samples. DefaultSampleInterval is used when not set.
+	SampleInterval time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.SampleInterval <= 0 {
+		o.SampleInterval = DefaultSampleInterval
+	}
+	if o.Start.IsZero() {
+		o.Start = time.Now()
+	}
+	return o
+}
+
+// Import reads a profile in the given format and returns a sample chunk with
+// its frames, stacks, samples and thread metadata. IDs, organization and
+// project are left for the caller to set.
+func Import(f Format, r io.Reader, o Options) (chunk.SampleChunk, error) {
+	o = o.withDefaults()
+	var (
+		b   *builder
+		err error
+	)
+	switch f {
+	case FormatPprof:
+		b, err = importPprof(r, o)
+	case FormatPerf:
+		b, err = importPerf(r, o)
+	case FormatCPUProfile:
+		b, err = importCPUProfile(r, o)
+	case FormatFolded:
+		b, err = importFolded(r, o)
+	default:
+		return chunk.SampleChunk{}, ErrInvalidFormat
+	}
+	if err != nil {
+		return chunk.SampleChunk{}, err
+	}
+	if len(b.data.Samples) == 0 {
+		return chunk.SampleChunk{}, ErrNoSamples
+	}
+	b.finish(o.SampleInterval)
+	return chunk.SampleChunk{
+		Platform: o.Platform,
+		Profile:  b.data,
+		Version:  chunkVersion,
+	}, nil
+}
+
+type (
+	// builder deduplicates frames and stacks while samples are added.
+	builder struct {
+		data    chunk.SampleData
+		frames  map[frame.Frame]int
+		stacks  map[string]int
+		threads map[string]*threadState
+		order   []string
+	}
+
+	threadState struct {
+		// end is where the next sample of a thread with weighted samples
+		// starts, zero when samples have timestamps.
+		end       float64
+		last      float64
+		previous  float64
+		lastStack int
+		count     int
+	}
+)
+
+func newBuilder() *builder {
+	return &builder{
+		data: chunk.SampleData{
+			Frames:         []frame.Frame{},
+			Samples:        []chunk.Sample{},
+			Stacks:         [][]int{},
+			ThreadMetadata: make(map[string]sample.ThreadMetadata),
+		},
+		frames:  make(map[frame.Frame]int),
+		stacks:  make(map[string]int),
+		threads: make(map[string]*threadState),
+	}
+}
+
+// setThreadName names a thread, the first name given is kept.
+func (b *builder) setThreadName(threadID, name string) {
+	if _, exists := b.data.ThreadMetadata[threadID]; exists || name == "" {
+		return
+	}
+	b.data.ThreadMetadata[threadID] = sample.ThreadMetadata{Name: name}
+}
+
+// stack returns the ID of a stack, leaf frame first.
+func (b *builder) stack(frames []frame.Frame) int {
+	ids := make([]int, 0, len(frames))
+	var key strings.Builder
+	for _, f := range frames {
+		id, exists := b.frames[f]
+		if !exists {
+			id = len(b.data.Frames)
+			b.data.Frames = append(b.data.Frames, f)
+			b.frames[f] = id
+		}
+		ids = append(ids, id)
+		key.WriteString(strconv.Itoa(id))
+		key.WriteByte(',')
+	}
+	if id, exists := b.stacks[key.String()]; exists {
+		return id
+	}
+	id := len(b.data.Stacks)
+	b.data.Stacks = append(b.data.Stacks, ids)
+	b.stacks[key.String()] = id
+	return id
+}
+
+func (b *builder) thread(threadID string) *threadState {
+	t, exists := b.threads[threadID]
+	if !exists {
+		t = &threadState{}
+		b.threads[threadID] = t
+		b.order = append(b.order, threadID)
+	}
+	return t
+}
+
+// addSampleAt adds a sample taken at ts, in seconds.
+func (b *builder) addSampleAt(threadID string, ts float64, frames []frame.Frame) {
+	t := b.thread(threadID)
+	stackID := b.stack(frames)
+	b.data.Samples = append(b.data.Samples, chunk.Sample{
+		StackID:   stackID,
+		ThreadID:  threadID,
+		Timestamp: ts,
+	})
+	t.previous, t.last = t.last, ts
+	t.lastStack = stackID
+	t.count++
+}
+
+// addSampleFor adds a sample lasting d after the previous sample of the
+// thread, for profiles aggregating samples without timestamps.
+func (b *builder) addSampleFor(threadID string, start time.Time, d time.Duration, frames []frame.Frame) {
+	t := b.thread(threadID)
+	if t.end == 0 {
+		t.end = seconds(start)
+	}
+	ts := t.end
+	b.addSampleAt(threadID, ts, frames)
+	t.end = ts + d.Seconds()
+}
+
+// finish adds a sample at the end of each thread. The last sample of a
+// thread only marks the end of the previous one so it repeats the last
+// stack. Without a known end, the last sample lasts as long as the previous
+// one or the sample interval.
+func (b *builder) finish(interval time.Duration) {
+	for _, threadID := range b.order {
+		t := b.threads[threadID]
+		end := t.end
+		if end <= t.last {
+			gap := interval.Seconds()
+			if t.count > 1 && t.last > t.previous {
+				gap = t.last - t.previous
+			}
+			end = t.last + gap
+		}
+		b.data.Samples = append(b.data.Samples, chunk.Sample{
+			StackID:   t.lastStack,
+			ThreadID:  threadID,
+			Timestamp: end,
+		})
+	}
+	sort.SliceStable(b.data.Samples, func(i, j int) bool {
+		return b.data.Samples[i].Timestamp < b.data.Samples[j].Timestamp
+	})
+}
+
+func seconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
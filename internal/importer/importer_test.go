@@ -0,0 +1,251 @@
+package importer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/getsentry/vroom/internal/chunk"
+	"github.com/getsentry/vroom/internal/frame"
+	"github.com/getsentry/vroom/internal/sample"
+	"github.com/getsentry/vroom/internal/testutil"
+)
+
+var testOptions = Options{
+	Start:          time.Unix(100, 0),
+	SampleInterval: 250 * time.Millisecond,
+}
+
+func TestImport(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		input  string
+		want   chunk.SampleData
+	}{
+		{
+			name:   "folded",
+			format: FormatFolded,
+			input: strings.Join([]string{
+				"main;a;b 2",
+				"main;a 1",
+				"",
+				"main;c 0",
+			}, "\n"),
+			want: chunk.SampleData{
+				Frames: []frame.Frame{
+					{Function: "b"},
+					{Function: "a"},
+					{Function: "main"},
+				},
+				Stacks: [][]int{
+					{0, 1, 2},
+					{1, 2},
+				},
+				Samples: []chunk.Sample{
+					{StackID: 0, ThreadID: "1", Timestamp: 100},
+					{StackID: 1, ThreadID: "1", Timestamp: 100.5},
+					{StackID: 1, ThreadID: "1", Timestamp: 100.75},
+				},
+				ThreadMetadata: map[string]sample.ThreadMetadata{
+					"1": {Name: "main"},
+				},
+			},
+		},
+		{
+			name:   "perf script",
+			format: FormatPerf,
+			input: strings.Join([]string{
+				"# header",
+				"app 10/11 [000] 10.000000:     250000 cpu-clock:",
+				"\t    55d0 work+0x10 (/usr/bin/app)",
+				"\t    55a0 main+0x20 (/usr/bin/app)",
+				"",
+				"app 10/11 [000] 10.250000:     250000 cpu-clock:",
+				"\t    7f00 [unknown] ([unknown])",
+				"\t    55a0 main+0x24 (/usr/bin/app)",
+				"",
+				"worker 10/12 [001] 10.250000:     250000 cpu-clock:",
+				"\t    55a0 main+0x20 (/usr/bin/app)",
+			}, "\n"),
+			want: chunk.SampleData{
+				Frames: []frame.Frame{
+					{Function: "work", Package: "/usr/bin/app"},
+					{Function: "main", Package: "/usr/bin/app"},
+					{InstructionAddr: "0x7f00"},
+				},
+				Stacks: [][]int{
+					{0, 1},
+					{2, 1},
+					{1},
+				},
+				Samples: []chunk.Sample{
+					{StackID: 0, ThreadID: "11", Timestamp: 100},
+					{StackID: 1, ThreadID: "11", Timestamp: 100.25},
+					{StackID: 2, ThreadID: "12", Timestamp: 100.25},
+					{StackID: 1, ThreadID: "11", Timestamp: 100.5},
+					{StackID: 2, ThreadID: "12", Timestamp: 100.5},
+				},
+				ThreadMetadata: map[string]sample.ThreadMetadata{
+					"11": {Name: "app"},
+					"12": {Name: "worker"},
+				},
+			},
+		},
+		{
+			name:   "cpuprofile",
+			format: FormatCPUProfile,
+			input: `{
+				"nodes": [
+					{"id": 1, "callFrame": {"functionName": "(root)", "url": "", "lineNumber": -1, "columnNumber": -1}, "children": [2, 4]},
+					{"id": 2, "callFrame": {"functionName": "", "url": "file:///app/index.js", "lineNumber": 0, "columnNumber": 0}, "children": [3]},
+					{"id": 3, "callFrame": {"functionName": "work", "url": "file:///app/index.js", "lineNumber": 9, "columnNumber": 4}},
+					{"id": 4, "callFrame": {"functionName": "(idle)", "url": "", "lineNumber": -1, "columnNumber": -1}}
+				],
+				"startTime": 1000,
+				"endTime": 1001000,
+				"samples": [3, 4, 2],
+				"timeDeltas": [0, 250000, 250000]
+			}`,
+			want: chunk.SampleData{
+				Frames: []frame.Frame{
+					{Function: "work", Path: "file:///app/index.js", Line: 10, Column: 5},
+					{Function: "(anonymous)", Path: "file:///app/index.js", Line: 1, Column: 1},
+				},
+				Stacks: [][]int{
+					{0, 1},
+					{},
+					{1},
+				},
+				Samples: []chunk.Sample{
+					{StackID: 0, ThreadID: "1", Timestamp: 100},
+					{StackID: 1, ThreadID: "1", Timestamp: 100.25},
+					{StackID: 2, ThreadID: "1", Timestamp: 100.5},
+					{StackID: 2, ThreadID: "1", Timestamp: 101},
+				},
+				ThreadMetadata: map[string]sample.ThreadMetadata{
+					"1": {Name: "main"},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := Import(test.format, strings.NewReader(test.input), testOptions)
+			if err != nil {
+				t.Fatalf("couldn't import profile: %v", err)
+			}
+			if c.Version != chunkVersion {
+				t.Fatalf("expected version %q, got %q", chunkVersion, c.Version)
+			}
+			if err := c.Validate(); err != nil {
+				t.Fatalf("invalid chunk: %v", err)
+			}
+			if diff := testutil.Diff(c.Profile, test.want); diff != "" {
+				t.Fatalf("Result mismatch: got - want +\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestImportPprof(t *testing.T) {
+	mapping := &profile.Mapping{ID: 1, File: "/usr/bin/app"}
+	mainFunction := &profile.Function{ID: 1, Name: "main.main", Filename: "main.go"}
+	workFunction := &profile.Function{ID: 2, Name: "main.work", Filename: "work.go"}
+	inlinedFunction := &profile.Function{ID: 3, Name: "main.inlined", Filename: "work.go"}
+	mainLocation := &profile.Location{
+		ID:      1,
+		Mapping: mapping,
+		Line:    []profile.Line{{Function: mainFunction, Line: 3}},
+	}
+	workLocation := &profile.Location{
+		ID:      2,
+		Mapping: mapping,
+		Line: []profile.Line{
+			{Function: inlinedFunction, Line: 12},
+			{Function: workFunction, Line: 7},
+		},
+	}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "samples", Unit: "count"},
+			{Type: "cpu", Unit: "nanoseconds"},
+		},
+		TimeNanos: int64(200 * time.Second),
+		Mapping:   []*profile.Mapping{mapping},
+		Function:  []*profile.Function{mainFunction, workFunction, inlinedFunction},
+		Location:  []*profile.Location{mainLocation, workLocation},
+		Sample: []*profile.Sample{
+			{
+				Location: []*profile.Location{workLocation, mainLocation},
+				Value:    []int64{2, int64(500 * time.Millisecond)},
+			},
+			{
+				Location: []*profile.Location{mainLocation},
+				Value:    []int64{1, int64(250 * time.Millisecond)},
+				Label:    map[string][]string{"thread_name": {"worker"}},
+				NumLabel: map[string][]int64{"thread_id": {2}},
+			},
+		},
+	}
+	var b bytes.Buffer
+	if err := p.Write(&b); err != nil {
+		t.Fatalf("couldn't write profile: %v", err)
+	}
+
+	c, err := Import(FormatPprof, &b, testOptions)
+	if err != nil {
+		t.Fatalf("couldn't import profile: %v", err)
+	}
+	want := chunk.SampleData{
+		Frames: []frame.Frame{
+			{Function: "main.inlined", File: "work.go", Line: 12, Package: "/usr/bin/app"},
+			{Function: "main.work", File: "work.go", Line: 7, Package: "/usr/bin/app"},
+			{Function: "main.main", File: "main.go", Line: 3, Package: "/usr/bin/app"},
+		},
+		Stacks: [][]int{
+			{0, 1, 2},
+			{2},
+		},
+		Samples: []chunk.Sample{
+			{StackID: 0, ThreadID: "1", Timestamp: 200},
+			{StackID: 1, ThreadID: "2", Timestamp: 200},
+			{StackID: 1, ThreadID: "2", Timestamp: 200.25},
+			{StackID: 0, ThreadID: "1", Timestamp: 200.5},
+		},
+		ThreadMetadata: map[string]sample.ThreadMetadata{
+			"1": {Name: "main"},
+			"2": {Name: "worker"},
+		},
+	}
+	if diff := testutil.Diff(c.Profile, want); diff != "" {
+		t.Fatalf("Result mismatch: got - want +\n%s", diff)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		input  string
+	}{
+		{name: "unknown format", format: "json", input: ""},
+		{name: "no samples", format: FormatFolded, input: "main 0\n"},
+		{name: "missing count", format: FormatFolded, input: "main;a\n"},
+		{name: "invalid perf sample", format: FormatPerf, input: "not a sample\n"},
+		{name: "unknown cpuprofile node", format: FormatCPUProfile, input: `{"nodes": [], "samples": [1]}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Import(test.format, strings.NewReader(test.input), testOptions)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/getsentry/vroom/internal/frame"
+)
+
+var (
+	// perfSampleRegex matches the first line of a sample: the command, the
+	// process and thread IDs, the CPU and the timestamp in seconds.
+	perfSampleRegex = regexp.MustCompile(`^(\S.*?)\s+(\d+)(?:/(\d+))?\s+(?:\[\d+\]\s+)?(\d+\.\d+):`)
+	// perfFrameRegex matches a frame of a sample: the address, the symbol
+	// and the object it belongs to.
+	perfFrameRegex = regexp.MustCompile(`^\s+([0-9a-fA-F]+)\s+(.+?)(?:\s+\((.*)\))?$`)
+	// perfOffsetRegex matches the offset perf adds to a symbol.
+	perfOffsetRegex = regexp.MustCompile(`\+0x[0-9a-fA-F]+$`)
+)
+
+const perfUnknownSymbol = "[unknown]"
+
+// importPerf reads samples from perf script, separated by empty lines.
+// Timestamps are relative to the boot so they're moved to start at the start
+// of the profile.
+func importPerf(r io.Reader, o Options) (*builder, error) {
+	b := newBuilder()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var (
+		first    float64
+		hasFirst bool
+		inSample bool
+		threadID string
+		ts       float64
+		frames   []frame.Frame
+		lineNum  int
+	)
+	flush := func() {
+		if inSample {
+			if !hasFirst {
+				first, hasFirst = ts, true
+			}
+			start := seconds(o.Start)
+			b.addSampleAt(threadID, start+ts-first, frames)
+		}
+		inSample = false
+		frames = nil
+	}
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if inSample {
+			m := perfFrameRegex.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("perf: invalid frame on line %d", lineNum)
+			}
+			frames = append(frames, perfFrame(m[1], m[2], m[3]))
+			continue
+		}
+		m := perfSampleRegex.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("perf: invalid sample on line %d", lineNum)
+		}
+		var err error
+		ts, err = strconv.ParseFloat(m[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("perf: invalid timestamp on line %d", lineNum)
+		}
+		threadID = m[2]
+		if m[3] != "" {
+			threadID = m[3]
+		}
+		b.setThreadName(threadID, m[1])
+		inSample = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return b, nil
+}
+
+// perfFrame returns a frame for a symbol, or for its address when perf
+// couldn't symbolicate it.
+func perfFrame(address, symbol, object string) frame.Frame {
+	var f frame.Frame
+	if object != perfUnknownSymbol {
+		f.Package = object
+	}
+	if symbol == perfUnknownSymbol {
+		f.InstructionAddr = "0x" + strings.ToLower(address)
+		return f
+	}
+	f.Function = perfOffsetRegex.ReplaceAllString(symbol, "")
+	return f
+}
@@ -0,0 +1,126 @@
+package importer
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/getsentry/vroom/internal/frame"
+)
+
+const (
+	// pprofThreadIDLabel and pprofThreadNameLabel are the labels telling the
+	// thread of a sample, samples without them are on the main thread.
+	pprofThreadIDLabel   = "thread_id"
+	pprofThreadNameLabel = "thread_name"
+
+	pprofUnitNanoseconds = "nanoseconds"
+)
+
+// importPprof lays the samples of each thread out one after the other from
+// the start of the profile, each lasting the time it measures.
+func importPprof(r io.Reader, o Options) (*builder, error) {
+	p, err := profile.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	start := o.Start
+	if p.TimeNanos != 0 {
+		start = time.Unix(0, p.TimeNanos)
+	}
+	duration := pprofDuration(p, o.SampleInterval)
+
+	b := newBuilder()
+	for _, s := range p.Sample {
+		d := duration(s)
+		if d <= 0 {
+			continue
+		}
+		threadID, threadName := pprofThread(s)
+		b.setThreadName(threadID, threadName)
+		frames := make([]frame.Frame, 0, len(s.Location))
+		for _, l := range s.Location {
+			frames = append(frames, pprofFrames(l)...)
+		}
+		b.addSampleFor(threadID, start, d, frames)
+	}
+	return b, nil
+}
+
+// pprofDuration returns how to get the duration of a sample. Values in
+// nanoseconds, like CPU time, are used as is while counts are multiplied by
+// the period or the sample interval.
+func pprofDuration(p *profile.Profile, interval time.Duration) func(*profile.Sample) time.Duration {
+	index := -1
+	for i, st := range p.SampleType {
+		if st.Unit != pprofUnitNanoseconds {
+			continue
+		}
+		if index == -1 || st.Type == p.DefaultSampleType {
+			index = i
+		}
+	}
+	if index != -1 {
+		return func(s *profile.Sample) time.Duration {
+			return time.Duration(s.Value[index])
+		}
+	}
+	if p.PeriodType != nil && p.PeriodType.Unit == pprofUnitNanoseconds && p.Period > 0 {
+		interval = time.Duration(p.Period)
+	}
+	return func(s *profile.Sample) time.Duration {
+		if len(s.Value) == 0 {
+			return 0
+		}
+		return time.Duration(s.Value[0]) * interval
+	}
+}
+
+func pprofThread(s *profile.Sample) (string, string) {
+	threadID := defaultThreadID
+	if ids := s.NumLabel[pprofThreadIDLabel]; len(ids) > 0 {
+		threadID = strconv.FormatInt(ids[0], 10)
+	} else if ids := s.Label[pprofThreadIDLabel]; len(ids) > 0 {
+		threadID = ids[0]
+	}
+	if names := s.Label[pprofThreadNameLabel]; len(names) > 0 {
+		return threadID, names[0]
+	}
+	if threadID == defaultThreadID {
+		return threadID, defaultThreadName
+	}
+	return threadID, ""
+}
+
+// pprofFrames returns the frames of a location, the inlined functions first
+// like in the location.
+func pprofFrames(l *profile.Location) []frame.Frame {
+	var pkg string
+	if l.Mapping != nil {
+		pkg = l.Mapping.File
+	}
+	if len(l.Line) == 0 {
+		return []frame.Frame{
+			{
+				InstructionAddr: fmt.Sprintf("0x%x", l.Address),
+				Package:         pkg,
+			},
+		}
+	}
+	frames := make([]frame.Frame, 0, len(l.Line))
+	for _, line := range l.Line {
+		f := frame.Frame{Package: pkg}
+		if line.Line > 0 {
+			f.Line = uint32(line.Line)
+		}
+		if line.Function != nil {
+			f.Function = line.Function.Name
+			f.File = line.Function.Filename
+		}
+		frames = append(frames, f)
+	}
+	return frames
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"errors"
+	"hash/fnv"
+	"sort"
+
+	"github.com/getsentry/vroom/internal/examples"
+	"github.com/getsentry/vroom/internal/nodetree"
+)
+
+type (
+	// AggregationKey sets how functions are grouped by an aggregator.
+	AggregationKey string
+
+	// SortBy sets the order of the metrics returned by an aggregator, the
+	// highest values first.
+	SortBy string
+)
+
+const (
+	// KeyFingerprint aggregates each function on its own.
+	KeyFingerprint AggregationKey = "fingerprint"
+	// KeyPackage aggregates all the functions of a package together. Calls
+	// made from the same package are part of the outer call and only count
+	// once in the durations of the package.
+	KeyPackage AggregationKey = "package"
+	// KeyPackageAndThread aggregates the functions of a package running on
+	// the same thread together.
+	KeyPackageAndThread AggregationKey = "package_thread"
+
+	SortBySelfTime  SortBy = "self_time"
+	SortByTotalTime SortBy = "total_time"
+	SortByCount     SortBy = "count"
+	SortByP95       SortBy = "p95"
+)
+
+var (
+	ErrInvalidAggregationKey = errors.New("aggregation key has to be one of fingerprint, package or package_thread")
+	ErrInvalidSortBy         = errors.New("sort has to be one of self_time, total_time, count or p95")
+)
+
+// Validate returns an error if the key is unknown. An empty key aggregates
+// by fingerprint.
+func (k AggregationKey) Validate() error {
+	switch k {
+	case "", KeyFingerprint, KeyPackage, KeyPackageAndThread:
+		return nil
+	}
+	return ErrInvalidAggregationKey
+}
+
+// Validate returns an error if the sort order is unknown. An empty sort
+// order sorts by self time.
+func (s SortBy) Validate() error {
+	switch s {
+	case "", SortBySelfTime, SortByTotalTime, SortByCount, SortByP95:
+		return nil
+	}
+	return ErrInvalidSortBy
+}
+
+// aggregate returns the key a function is aggregated under and the function
+// to aggregate. When aggregating by package, the function name is dropped and
+// the fingerprint is the one of the key.
+func (k AggregationKey) aggregate(f nodetree.CallTreeFunction) (uint32, nodetree.CallTreeFunction) {
+	switch k {
+	case KeyPackage:
+		f.Function = ""
+		f.ThreadID = ""
+		f.Fingerprint = hashKey(f.Package)
+	case KeyPackageAndThread:
+		f.Function = ""
+		f.Fingerprint = hashKey(f.Package, f.ThreadID)
+	}
+	return f.Fingerprint, f
+}
+
+// hashKey is cast to an uint32 like frame fingerprints.
+func hashKey(parts ...string) uint32 {
+	h := fnv.New64()
+	for i, p := range parts {
+		if i > 0 {
+			h.Write([]byte{':'})
+		}
+		h.Write([]byte(p))
+	}
+	return uint32(h.Sum64())
+}
+
+func sortMetrics(metrics []examples.FunctionMetrics, by SortBy) {
+	sort.Slice(metrics, func(i, j int) bool {
+		switch by {
+		case SortByTotalTime:
+			if metrics[i].Sum != metrics[j].Sum {
+				return metrics[i].Sum > metrics[j].Sum
+			}
+		case SortByCount:
+			if metrics[i].Count != metrics[j].Count {
+				return metrics[i].Count > metrics[j].Count
+			}
+		case SortByP95:
+			if metrics[i].P95 != metrics[j].P95 {
+				return metrics[i].P95 > metrics[j].P95
+			}
+		}
+		if metrics[i].SumSelfTime != metrics[j].SumSelfTime {
+			return metrics[i].SumSelfTime > metrics[j].SumSelfTime
+		}
+		return metrics[i].Sum > metrics[j].Sum
+	})
+}
@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/getsentry/vroom/internal/examples"
+	"github.com/getsentry/vroom/internal/nodetree"
+	"github.com/getsentry/vroom/internal/testutil"
+)
+
+func TestAggregatorKeys(t *testing.T) {
+	functions := []nodetree.CallTreeFunction{
+		{
+			Function:      "a",
+			Package:       "foo",
+			Fingerprint:   0,
+			ThreadID:      "1",
+			DurationsNS:   []uint64{10},
+			SumDurationNS: 10,
+			SumSelfTimeNS: 10,
+			SampleCount:   2,
+		},
+		{
+			Function:      "b",
+			Package:       "foo",
+			Fingerprint:   1,
+			ThreadID:      "2",
+			DurationsNS:   []uint64{30},
+			SumDurationNS: 30,
+			SumSelfTimeNS: 20,
+			SampleCount:   3,
+		},
+		{
+			Function:      "c",
+			Package:       "bar",
+			Fingerprint:   2,
+			ThreadID:      "1",
+			DurationsNS:   []uint64{5},
+			SumDurationNS: 5,
+			SumSelfTimeNS: 5,
+			SampleCount:   4,
+		},
+	}
+	example := examples.ExampleMetadata{ProfileID: "1"}
+
+	tests := []struct {
+		name   string
+		key    AggregationKey
+		sortBy SortBy
+		want   []examples.FunctionMetrics
+	}{
+		{
+			name:   "package sorted by self time",
+			key:    KeyPackage,
+			sortBy: SortBySelfTime,
+			want: []examples.FunctionMetrics{
+				{
+					Package:     "foo",
+					Fingerprint: hashKey("foo"),
+					P75:         30,
+					P95:         30,
+					P99:         30,
+					Avg:         20,
+					Sum:         40,
+					SumSelfTime: 30,
+					Count:       5,
+					Worst:       example,
+					Examples:    []examples.ExampleMetadata{example},
+				},
+				{
+					Package:     "bar",
+					Fingerprint: hashKey("bar"),
+					P75:         5,
+					P95:         5,
+					P99:         5,
+					Avg:         5,
+					Sum:         5,
+					SumSelfTime: 5,
+					Count:       4,
+					Worst:       example,
+					Examples:    []examples.ExampleMetadata{example},
+				},
+			},
+		},
+		{
+			name:   "package and thread sorted by count",
+			key:    KeyPackageAndThread,
+			sortBy: SortByCount,
+			want: []examples.FunctionMetrics{
+				{
+					Package:     "bar",
+					Fingerprint: hashKey("bar", "1"),
+					P75:         5,
+					P95:         5,
+					P99:         5,
+					Avg:         5,
+					Sum:         5,
+					SumSelfTime: 5,
+					Count:       4,
+					Worst:       example,
+					Examples:    []examples.ExampleMetadata{example},
+					ThreadID:    "1",
+				},
+				{
+					Package:     "foo",
+					Fingerprint: hashKey("foo", "2"),
+					P75:         30,
+					P95:         30,
+					P99:         30,
+					Avg:         30,
+					Sum:         30,
+					SumSelfTime: 20,
+					Count:       3,
+					Worst:       example,
+					Examples:    []examples.ExampleMetadata{example},
+					ThreadID:    "2",
+				},
+				{
+					Package:     "foo",
+					Fingerprint: hashKey("foo", "1"),
+					P75:         10,
+					P95:         10,
+					P99:         10,
+					Avg:         10,
+					Sum:         10,
+					SumSelfTime: 10,
+					Count:       2,
+					Worst:       example,
+					Examples:    []examples.ExampleMetadata{example},
+					ThreadID:    "1",
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ma := NewAggregator(100, 5, 0)
+			ma.Key = test.key
+			ma.SortBy = test.sortBy
+			ma.AddFunctions(functions, example)
+			if diff := testutil.Diff(ma.ToMetrics(), test.want); diff != "" {
+				t.Fatalf("Result mismatch: got - want +\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAggregationOptionsValidate(t *testing.T) {
+	if err := AggregationKey("function").Validate(); err != ErrInvalidAggregationKey {
+		t.Fatalf("expected %v, got %v", ErrInvalidAggregationKey, err)
+	}
+	if err := SortBy("p50").Validate(); err != ErrInvalidSortBy {
+		t.Fatalf("expected %v, got %v", ErrInvalidSortBy, err)
+	}
+	if err := KeyPackageAndThread.Validate(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
@@ -5,9 +5,16 @@ import (
 	"math"
 	"sort"
 	"strconv"
+	"unsafe"
 
 	"github.com/getsentry/vroom/internal/examples"
 	"github.com/getsentry/vroom/internal/nodetree"
+	"github.com/getsentry/vroom/internal/quantile"
+)
+
+var (
+	functionSize = int64(unsafe.Sizeof(nodetree.CallTreeFunction{}) + unsafe.Sizeof(FunctionsMetadata{}))
+	exampleSize  = int64(unsafe.Sizeof(examples.ExampleMetadata{}))
 )
 
 type (
@@ -15,6 +22,9 @@ type (
 		MaxVal   uint64
 		Worst    examples.ExampleMetadata
 		Examples []examples.ExampleMetadata
+		// Durations holds the durations of all the calls to the function in
+		// a sketch so memory doesn't grow with the number of calls.
+		Durations *quantile.Sketch
 	}
 
 	Aggregator struct {
@@ -25,6 +35,10 @@ type (
 		MaxNumOfExamples  uint
 		CallTreeFunctions map[uint32]nodetree.CallTreeFunction
 		FunctionsMetadata map[uint32]FunctionsMetadata
+		// Key groups functions by fingerprint when empty.
+		Key AggregationKey
+		// SortBy sorts metrics by self time when empty.
+		SortBy SortBy
 	}
 )
 
@@ -38,44 +52,64 @@ func NewAggregator(MaxUniqueFunctions uint, MaxNumOfExamples uint, MinDepth uint
 	}
 }
 
-func (ma *Aggregator) AddFunctions(functions []nodetree.CallTreeFunction, resultMetadata examples.ExampleMetadata) {
+// AddFunctions aggregates functions and returns an estimate of the bytes the
+// aggregator grew by.
+func (ma *Aggregator) AddFunctions(functions []nodetree.CallTreeFunction, resultMetadata examples.ExampleMetadata) int64 {
+	var added int64
 	for _, f := range functions {
-		if fn, ok := ma.CallTreeFunctions[f.Fingerprint]; ok {
+		key, f := ma.Key.aggregate(f)
+		if fn, ok := ma.CallTreeFunctions[key]; ok {
 			fn.SampleCount += f.SampleCount
-			fn.DurationsNS = append(fn.DurationsNS, f.DurationsNS...)
 			fn.SumDurationNS += f.SumDurationNS
 			fn.SumSelfTimeNS += f.SumSelfTimeNS
-			funcMetadata := ma.FunctionsMetadata[f.Fingerprint]
+			fn.InApp = fn.InApp || f.InApp
+			funcMetadata := ma.FunctionsMetadata[key]
+			sketchSize := funcMetadata.Durations.SizeBytes()
+			for _, d := range f.DurationsNS {
+				funcMetadata.Durations.Add(d)
+			}
+			added += int64(funcMetadata.Durations.SizeBytes() - sketchSize)
 			if f.SumSelfTimeNS > funcMetadata.MaxVal {
 				funcMetadata.MaxVal = f.SumSelfTimeNS
 				funcMetadata.Worst = resultMetadata
 			}
-			if len(funcMetadata.Examples) < int(ma.MaxNumOfExamples) {
+			// Functions aggregated under the same key come from the same
+			// example, it's only added once.
+			lastExample := funcMetadata.Examples[len(funcMetadata.Examples)-1]
+			if len(funcMetadata.Examples) < int(ma.MaxNumOfExamples) && lastExample != resultMetadata {
 				funcMetadata.Examples = append(funcMetadata.Examples, resultMetadata)
+				added += exampleSize
 			}
-			ma.FunctionsMetadata[f.Fingerprint] = funcMetadata
-			ma.CallTreeFunctions[f.Fingerprint] = fn
+			ma.FunctionsMetadata[key] = funcMetadata
+			ma.CallTreeFunctions[key] = fn
 		} else {
-			ma.CallTreeFunctions[f.Fingerprint] = f
-			ma.FunctionsMetadata[f.Fingerprint] = FunctionsMetadata{
-				MaxVal:   f.SumSelfTimeNS,
-				Worst:    resultMetadata,
-				Examples: []examples.ExampleMetadata{resultMetadata},
+			durations := quantile.Of(f.DurationsNS...)
+			f.DurationsNS = nil
+			ma.CallTreeFunctions[key] = f
+			ma.FunctionsMetadata[key] = FunctionsMetadata{
+				MaxVal:    f.SumSelfTimeNS,
+				Worst:     resultMetadata,
+				Examples:  []examples.ExampleMetadata{resultMetadata},
+				Durations: durations,
 			}
+			added += functionSize + exampleSize + int64(durations.SizeBytes()+len(f.Function)+len(f.Package)+len(f.ThreadID))
 		}
 	}
+	return added
 }
 
 func (ma *Aggregator) ToMetrics() []examples.FunctionMetrics {
 	metrics := make([]examples.FunctionMetrics, 0, len(ma.CallTreeFunctions))
 
 	for _, f := range ma.CallTreeFunctions {
-		sort.Slice(f.DurationsNS, func(i, j int) bool {
-			return f.DurationsNS[i] < f.DurationsNS[j]
-		})
-		p75, _ := Quantile(f.DurationsNS, 0.75)
-		p95, _ := Quantile(f.DurationsNS, 0.95)
-		p99, _ := Quantile(f.DurationsNS, 0.99)
+		durations := ma.FunctionsMetadata[f.Fingerprint].Durations
+		p75, _ := durations.Quantile(0.75)
+		p95, _ := durations.Quantile(0.95)
+		p99, _ := durations.Quantile(0.99)
+		var threadID string
+		if ma.Key == KeyPackageAndThread {
+			threadID = f.ThreadID
+		}
 		metrics = append(metrics, examples.FunctionMetrics{
 			Name:        f.Function,
 			Package:     f.Package,
@@ -84,20 +118,16 @@ func (ma *Aggregator) ToMetrics() []examples.FunctionMetrics {
 			P75:         p75,
 			P95:         p95,
 			P99:         p99,
-			Avg:         float64(f.SumDurationNS) / float64(len(f.DurationsNS)),
+			Avg:         float64(f.SumDurationNS) / float64(durations.Count()),
 			Sum:         f.SumDurationNS,
 			SumSelfTime: f.SumSelfTimeNS,
 			Count:       uint64(f.SampleCount),
 			Worst:       ma.FunctionsMetadata[f.Fingerprint].Worst,
 			Examples:    ma.FunctionsMetadata[f.Fingerprint].Examples,
+			ThreadID:    threadID,
 		})
 	}
-	sort.Slice(metrics, func(i, j int) bool {
-		if metrics[i].SumSelfTime != metrics[j].SumSelfTime {
-			return metrics[i].SumSelfTime > metrics[j].SumSelfTime
-		}
-		return metrics[i].Sum > metrics[j].Sum
-	})
+	sortMetrics(metrics, ma.SortBy)
 	if len(metrics) > int(ma.MaxUniqueFunctions) {
 		metrics = metrics[:ma.MaxUniqueFunctions]
 	}
@@ -134,12 +164,7 @@ func ExtractFunctionsFromCallTrees[T comparable](
 ) []nodetree.CallTreeFunction {
 	functions := make(map[uint32]nodetree.CallTreeFunction, 0)
 	for tid, callTreesForThread := range callTrees {
-		threadID := ""
-		if t, ok := any(tid).(string); ok {
-			threadID = t
-		} else if t, ok := any(tid).(uint64); ok {
-			threadID = strconv.FormatUint(t, 10)
-		}
+		threadID := threadIDString(tid)
 		for _, callTree := range callTreesForThread {
 			callTree.CollectFunctions(functions, threadID, 0, minDepth)
 		}
@@ -148,6 +173,50 @@ func ExtractFunctionsFromCallTrees[T comparable](
 	return mergeAndSortFunctions(functions)
 }
 
+// ExtractPackagesFromCallTrees returns a function without a name for each
+// package of the call trees. Its self time is the sum of the self time of
+// its functions while its durations only come from the calls into the
+// package, calls nested in the same package not being counted twice.
+func ExtractPackagesFromCallTrees[T comparable](
+	callTrees map[T][]*nodetree.Node,
+	minDepth uint,
+) []nodetree.CallTreeFunction {
+	functions := make(map[uint32]nodetree.CallTreeFunction)
+	packages := make(map[string]nodetree.CallTreeFunction)
+	for tid, callTreesForThread := range callTrees {
+		threadID := threadIDString(tid)
+		for _, callTree := range callTreesForThread {
+			callTree.CollectFunctions(functions, threadID, 0, minDepth)
+			callTree.CollectPackages(packages, threadID, minDepth)
+		}
+	}
+
+	for _, f := range functions {
+		p, ok := packages[f.Package]
+		if !ok {
+			continue
+		}
+		p.SumSelfTimeNS += f.SumSelfTimeNS
+		packages[f.Package] = p
+	}
+
+	byFingerprint := make(map[uint32]nodetree.CallTreeFunction, len(packages))
+	for _, p := range packages {
+		p.Fingerprint = hashKey(p.Package)
+		byFingerprint[p.Fingerprint] = p
+	}
+	return mergeAndSortFunctions(byFingerprint)
+}
+
+func threadIDString[T comparable](tid T) string {
+	if t, ok := any(tid).(string); ok {
+		return t
+	} else if t, ok := any(tid).(uint64); ok {
+		return strconv.FormatUint(t, 10)
+	}
+	return ""
+}
+
 func mergeAndSortFunctions(
 	functions map[uint32]nodetree.CallTreeFunction,
 ) []nodetree.CallTreeFunction {
@@ -5,7 +5,10 @@ import (
 	"testing"
 
 	"github.com/getsentry/vroom/internal/examples"
+	"github.com/getsentry/vroom/internal/frame"
 	"github.com/getsentry/vroom/internal/nodetree"
+	"github.com/getsentry/vroom/internal/platform"
+	"github.com/getsentry/vroom/internal/quantile"
 	"github.com/getsentry/vroom/internal/testutil"
 )
 
@@ -41,27 +44,27 @@ func TestAggregatorAddFunctions(t *testing.T) {
 						Function:      "a",
 						Fingerprint:   0,
 						SumSelfTimeNS: 80,
-						DurationsNS:   []uint64{10, 5, 25, 10, 5, 25},
 						SumDurationNS: 80,
 					},
 					1: {
 						Function:      "b",
 						Fingerprint:   1,
 						SumSelfTimeNS: 210,
-						DurationsNS:   []uint64{45, 60, 45, 60},
 						SumDurationNS: 210,
 					},
 				},
 				FunctionsMetadata: map[uint32]FunctionsMetadata{
 					0: {
-						MaxVal:   40,
-						Worst:    examples.ExampleMetadata{ProfileID: "1"},
-						Examples: []examples.ExampleMetadata{{ProfileID: "1"}, {ProfileID: "2"}},
+						MaxVal:    40,
+						Worst:     examples.ExampleMetadata{ProfileID: "1"},
+						Examples:  []examples.ExampleMetadata{{ProfileID: "1"}, {ProfileID: "2"}},
+						Durations: quantile.Of(10, 5, 25, 10, 5, 25),
 					},
 					1: {
-						MaxVal:   105,
-						Worst:    examples.ExampleMetadata{ProfileID: "1"},
-						Examples: []examples.ExampleMetadata{{ProfileID: "1"}, {ProfileID: "2"}},
+						MaxVal:    105,
+						Worst:     examples.ExampleMetadata{ProfileID: "1"},
+						Examples:  []examples.ExampleMetadata{{ProfileID: "1"}, {ProfileID: "2"}},
+						Durations: quantile.Of(45, 60, 45, 60),
 					},
 				}, // end want
 			},
@@ -94,7 +97,6 @@ func TestAggregatorToMetrics(t *testing.T) {
 					0: {
 						Function:      "a",
 						Fingerprint:   0,
-						DurationsNS:   []uint64{1, 2, 3, 4, 10, 8, 7, 11, 20},
 						SumDurationNS: 66,
 						SumSelfTimeNS: 66,
 						SampleCount:   2,
@@ -102,7 +104,6 @@ func TestAggregatorToMetrics(t *testing.T) {
 					1: {
 						Function:      "b",
 						Fingerprint:   1,
-						DurationsNS:   []uint64{1, 2, 3, 4, 10, 8, 7, 11, 20},
 						SumDurationNS: 66,
 						SumSelfTimeNS: 66,
 						SampleCount:   2,
@@ -110,14 +111,16 @@ func TestAggregatorToMetrics(t *testing.T) {
 				}, // end callTreeFunctions
 				FunctionsMetadata: map[uint32]FunctionsMetadata{
 					0: {
-						MaxVal:   66,
-						Worst:    examples.ExampleMetadata{ProfileID: "1"},
-						Examples: []examples.ExampleMetadata{{ProfileID: "1"}, {ProfileID: "2"}},
+						MaxVal:    66,
+						Worst:     examples.ExampleMetadata{ProfileID: "1"},
+						Examples:  []examples.ExampleMetadata{{ProfileID: "1"}, {ProfileID: "2"}},
+						Durations: quantile.Of(1, 2, 3, 4, 10, 8, 7, 11, 20),
 					},
 					1: {
-						MaxVal:   66,
-						Worst:    examples.ExampleMetadata{ProfileID: "3"},
-						Examples: []examples.ExampleMetadata{{ProfileID: "1"}, {ProfileID: "3"}},
+						MaxVal:    66,
+						Worst:     examples.ExampleMetadata{ProfileID: "3"},
+						Examples:  []examples.ExampleMetadata{{ProfileID: "1"}, {ProfileID: "3"}},
+						Durations: quantile.Of(1, 2, 3, 4, 10, 8, 7, 11, 20),
 					},
 				}, // end functionsMetadata
 			}, // end Aggregator
@@ -162,3 +165,82 @@ func TestAggregatorToMetrics(t *testing.T) {
 		}
 	}
 }
+
+func TestExtractPackagesFromCallTrees(t *testing.T) {
+	newFrame := func(function, pkg string) frame.Frame {
+		return frame.Frame{Function: function, Package: pkg, Platform: platform.Python}
+	}
+	callTrees := map[string][]*nodetree.Node{
+		"1": {
+			{
+				DurationNS:    40,
+				SampleCount:   4,
+				IsApplication: true,
+				Frame:         newFrame("a", "foo"),
+				Children: []*nodetree.Node{
+					{
+						DurationNS:    30,
+						SampleCount:   3,
+						IsApplication: true,
+						Frame:         newFrame("b", "foo"),
+						Children: []*nodetree.Node{
+							{
+								DurationNS:    20,
+								SampleCount:   2,
+								IsApplication: true,
+								Frame:         newFrame("c", "bar"),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// foo.b is called from foo.a, its duration is already part of foo.
+	want := []nodetree.CallTreeFunction{
+		{
+			Fingerprint:   hashKey("foo"),
+			Package:       "foo",
+			InApp:         true,
+			DurationsNS:   []uint64{40},
+			SumDurationNS: 40,
+			SumSelfTimeNS: 20,
+			SampleCount:   4,
+			ThreadID:      "1",
+		},
+		{
+			Fingerprint:   hashKey("bar"),
+			Package:       "bar",
+			InApp:         true,
+			DurationsNS:   []uint64{20},
+			SumDurationNS: 20,
+			SumSelfTimeNS: 20,
+			SampleCount:   2,
+			ThreadID:      "1",
+		},
+	}
+	if diff := testutil.Diff(ExtractPackagesFromCallTrees(callTrees, 0), want); diff != "" {
+		t.Fatalf("Result mismatch: got - want +\n%s", diff)
+	}
+}
+
+func TestAggregatorAddFunctionsSize(t *testing.T) {
+	functions := []nodetree.CallTreeFunction{
+		{Function: "a", Fingerprint: 0, DurationsNS: []uint64{10}, SumDurationNS: 10, SumSelfTimeNS: 10},
+		{Function: "b", Fingerprint: 1, DurationsNS: []uint64{20}, SumDurationNS: 20, SumSelfTimeNS: 20},
+	}
+	example := examples.ExampleMetadata{ProfileID: "1"}
+
+	ma := NewAggregator(100, 5, 0)
+	added := ma.AddFunctions(functions, example)
+	if added < 2*functionSize {
+		t.Fatalf("expected at least the size of 2 functions, got %d", added)
+	}
+	// Functions already aggregated for the same example only grow their
+	// sketches.
+	added = ma.AddFunctions(functions, example)
+	if added >= functionSize {
+		t.Fatalf("expected less than the size of a function, got %d", added)
+	}
+}
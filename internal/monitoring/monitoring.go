@@ -0,0 +1,111 @@
+package monitoring
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "vroom"
+
+const (
+	// StageDecode is the time to unmarshal a profile or a chunk.
+	StageDecode = "decode"
+	// StageCallTrees is the time to build the call trees of a profile or a
+	// chunk.
+	StageCallTrees = "call_trees"
+)
+
+var (
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of HTTP requests by route.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"route", "method", "code"})
+
+	// ReadWorkers is the number of workers reading objects from storage.
+	ReadWorkers = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "read_workers",
+		Help:      "Number of workers reading objects from storage.",
+	})
+
+	// ReadWorkersBusy is the number of workers currently running a read job.
+	ReadWorkersBusy = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "read_workers_busy",
+		Help:      "Number of workers currently running a read job.",
+	})
+
+	// StorageReadDuration is the time to download and decompress an object,
+	// and to decode it when it's decoded while it's read.
+	StorageReadDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_read_duration_seconds",
+		Help:      "Duration of reads from storage, decompression and streamed decoding included.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"backend"})
+
+	// StorageReadBytes is the number of compressed bytes read from storage.
+	StorageReadBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_read_bytes_total",
+		Help:      "Compressed bytes read from storage.",
+	}, []string{"backend"})
+
+	// ProcessingDuration is the time spent in each processing stage of a
+	// profile or a chunk.
+	ProcessingDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "processing_duration_seconds",
+		Help:      "Duration of processing stages by kind of payload.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"stage", "kind"})
+
+	// OccurrencesQueued counts the occurrences queued to be sent to Kafka.
+	// The writer is asynchronous, they may not be delivered yet.
+	OccurrencesQueued = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "occurrences_queued_total",
+		Help:      "Occurrences queued to be sent to Kafka by category and platform.",
+	}, []string{"category", "platform"})
+)
+
+// Handler serves the metrics in the Prometheus format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// InstrumentRoute observes the duration of requests handled by a route.
+// The route is the path pattern and not the path to keep a low cardinality.
+func InstrumentRoute(route string, handler http.Handler) http.HandlerFunc {
+	observer := requestDuration.MustCurryWith(prometheus.Labels{"route": route})
+	return promhttp.InstrumentHandlerDuration(observer, handler)
+}
+
+// ObserveStage records the time spent in a processing stage since start.
+func ObserveStage(stage, kind string, start time.Time) {
+	ProcessingDuration.WithLabelValues(stage, kind).Observe(time.Since(start).Seconds())
+}
+
+// RegisterGaugeFunc registers a gauge whose value is computed on scrape.
+func RegisterGaugeFunc(name, help string, f func() float64) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, f))
+}
+
+// RegisterCounterFunc registers a counter whose value is computed on scrape.
+func RegisterCounterFunc(name, help string, f func() float64) {
+	prometheus.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, f))
+}
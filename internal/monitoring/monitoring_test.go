@@ -0,0 +1,30 @@
+package monitoring
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInstrumentRoute(t *testing.T) {
+	handler := InstrumentRoute("/organizations/:organization_id/flamegraph", http.HandlerFunc(
+		func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		},
+	))
+	handler.ServeHTTP(
+		httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodPost, "/organizations/1/flamegraph", nil),
+	)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	want := `vroom_http_request_duration_seconds_count{code="418",method="post",route="/organizations/:organization_id/flamegraph"} 1`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Fatalf("expected the metrics to contain %q, got:\n%s", want, rec.Body.String())
+	}
+}
@@ -2,14 +2,19 @@ package nodetree
 
 import (
 	"hash"
+	"maps"
 	"strings"
+	"unsafe"
 
 	"github.com/getsentry/vroom/internal/examples"
 	"github.com/getsentry/vroom/internal/frame"
 	"github.com/getsentry/vroom/internal/platform"
+	"github.com/getsentry/vroom/internal/quantile"
 )
 
 var (
+	nodeSize = int64(unsafe.Sizeof(Node{}))
+
 	obfuscationSupportedPlatforms = map[platform.Platform]struct{}{
 		platform.Android: {},
 		platform.Java:    {},
@@ -40,13 +45,23 @@ type (
 		Package       string  `json:"package"`
 		Path          string  `json:"path,omitempty"`
 
-		DurationsNS []uint64                              `json:"-"`
+		// Durations is only set on nodes merging several calls, like in a
+		// flamegraph.
+		Durations   *quantile.Sketch                      `json:"-"`
 		EndNS       uint64                                `json:"-"`
 		Frame       frame.Frame                           `json:"-"`
 		Occurrence  uint32                                `json:"-"`
 		SampleCount int                                   `json:"-"`
 		StartNS     uint64                                `json:"-"`
 		Profiles    map[examples.ExampleMetadata]struct{} `json:"profiles,omitempty"`
+		Diff        *DiffWeights                          `json:"-"`
+	}
+
+	// DiffWeights holds the sample count contributed by each side of a
+	// differential flamegraph to a node.
+	DiffWeights struct {
+		BaselineSampleCount int
+		TargetSampleCount   int
 	}
 )
 
@@ -71,7 +86,6 @@ func NodeFromFrame(f frame.Frame, start, end, fingerprint uint64) *Node {
 	}
 	if n.EndNS > n.StartNS {
 		n.DurationNS = n.EndNS - n.StartNS
-		n.DurationsNS = []uint64{n.DurationNS}
 	}
 	return &n
 }
@@ -124,12 +138,57 @@ func (n *Node) ShallowCopyWithoutChildren() *Node {
 		Profiles:      n.Profiles,
 		DurationNS:    n.DurationNS,
 		SelfTimeNS:    n.SelfTimeNS,
-		DurationsNS:   n.DurationsNS,
+		Durations:     n.Durations.Clone(),
 	}
 
 	return &clone
 }
 
+// DeepCopy returns a copy of the node and its children, which can be
+// modified without changing the original tree.
+func (n *Node) DeepCopy() *Node {
+	clone := *n
+	clone.Durations = n.Durations.Clone()
+	if n.Diff != nil {
+		diff := *n.Diff
+		clone.Diff = &diff
+	}
+	if n.Profiles != nil {
+		clone.Profiles = maps.Clone(n.Profiles)
+	}
+	if n.Children != nil {
+		clone.Children = DeepCopyTrees(n.Children)
+	}
+	return &clone
+}
+
+// SizeBytes returns an estimate of the memory used by a node without its
+// children and its profiles.
+func (n *Node) SizeBytes() int64 {
+	return nodeSize +
+		int64(len(n.Name)+len(n.Package)+len(n.Path)) +
+		int64(n.Durations.SizeBytes())
+}
+
+// DeepCopyTrees returns a copy of call trees, which can be modified without
+// changing the original ones.
+func DeepCopyTrees(trees []*Node) []*Node {
+	copies := make([]*Node, len(trees))
+	for i, n := range trees {
+		copies[i] = n.DeepCopy()
+	}
+	return copies
+}
+
+// TreeSizeBytes returns an estimate of the memory used by call trees.
+func TreeSizeBytes(trees []*Node) int64 {
+	var size int64
+	for _, n := range trees {
+		size += n.SizeBytes() + TreeSizeBytes(n.Children)
+	}
+	return size
+}
+
 func (n *Node) Update(timestamp uint64) {
 	n.SampleCount++
 	n.SetDuration(timestamp)
@@ -143,7 +202,19 @@ func (n *Node) ToFrame() frame.Frame {
 func (n *Node) SetDuration(t uint64) {
 	n.EndNS = t
 	n.DurationNS = n.EndNS - n.StartNS
-	n.DurationsNS = []uint64{n.DurationNS}
+}
+
+// AddDurations records the durations of src in the sketch of n. A node
+// without a sketch is a single call lasting DurationNS.
+func (n *Node) AddDurations(src *Node) {
+	if n.Durations == nil {
+		n.Durations = quantile.New()
+	}
+	if src.Durations != nil {
+		n.Durations.Merge(src.Durations)
+		return
+	}
+	n.Durations.Add(src.DurationNS)
 }
 
 func (n *Node) WriteToHash(h hash.Hash) {
@@ -276,6 +347,52 @@ func (n *Node) CollectFunctions(
 	return applicationDurationNS, n.DurationNS - applicationDurationNS
 }
 
+// CollectPackages walks the node tree and writes the duration and the sample
+// count of each call into a package to the `results` parameter, keyed by
+// package. A call made while the same package is already on the stack is
+// part of the outer call and isn't counted again, so a package's duration
+// is never more than the time it was on the stack. Self times are left to
+// `CollectFunctions`.
+func (n *Node) CollectPackages(
+	results map[string]CallTreeFunction,
+	threadID string,
+	minDepth uint,
+) {
+	n.collectPackages(results, threadID, 0, minDepth, make(map[string]bool))
+}
+
+func (n *Node) collectPackages(
+	results map[string]CallTreeFunction,
+	threadID string,
+	nodeDepth uint,
+	minDepth uint,
+	onStack map[string]bool,
+) {
+	pkg := n.Frame.ModuleOrPackage()
+	counted := nodeDepth >= minDepth && shouldAggregateFrame(n.Frame) && !onStack[pkg]
+	if counted {
+		function, exists := results[pkg]
+		if !exists {
+			function = CallTreeFunction{
+				Package:  pkg,
+				ThreadID: threadID,
+			}
+		}
+		function.InApp = function.InApp || n.IsApplication
+		function.DurationsNS = append(function.DurationsNS, n.DurationNS)
+		function.SumDurationNS += n.DurationNS
+		function.SampleCount += n.SampleCount
+		results[pkg] = function
+		onStack[pkg] = true
+	}
+	for _, child := range n.Children {
+		child.collectPackages(results, threadID, nodeDepth+1, minDepth, onStack)
+	}
+	if counted {
+		delete(onStack, pkg)
+	}
+}
+
 func shouldAggregateFrame(frame frame.Frame) bool {
 	frameFunction := frame.Function
 
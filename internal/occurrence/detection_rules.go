@@ -0,0 +1,180 @@
+package occurrence
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/getsentry/vroom/internal/platform"
+)
+
+type (
+	// DetectionRule describes a function to detect in profiles of a platform.
+	DetectionRule struct {
+		Platform          platform.Platform `yaml:"platform"`
+		Package           string            `yaml:"package"`
+		Function          string            `yaml:"function"`
+		Category          Category          `yaml:"category"`
+		DurationThreshold time.Duration     `yaml:"duration_threshold"`
+		SampleThreshold   int               `yaml:"sample_threshold"`
+		ActiveThreadOnly  bool              `yaml:"active_thread_only"`
+	}
+
+	detectionRules struct {
+		Rules []DetectionRule `yaml:"rules"`
+	}
+
+	// detectionRuleGroup identifies rules sharing the same options, compiled
+	// into the same DetectFrameOptions.
+	detectionRuleGroup struct {
+		Platform          platform.Platform
+		DurationThreshold time.Duration
+		SampleThreshold   int
+		ActiveThreadOnly  bool
+	}
+)
+
+var (
+	ErrNoDetectionRules = errors.New("no detection rules")
+
+	//go:embed detection_rules.yaml
+	defaultDetectionRules []byte
+
+	defaultDetectFrameJobs = mustCompileDetectionRules(defaultDetectionRules)
+)
+
+// DefaultDetectionRules returns the compiled detection rules embedded in
+// vroom. They're shared and mustn't be modified.
+func DefaultDetectionRules() map[platform.Platform][]DetectFrameOptions {
+	return defaultDetectFrameJobs
+}
+
+// LoadDetectionRules compiles the detection rules in the YAML or JSON file at
+// path, to be used instead of the default ones.
+func LoadDetectionRules(path string) (map[platform.Platform][]DetectFrameOptions, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := ParseDetectionRules(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return CompileDetectionRules(rules), nil
+}
+
+// ParseDetectionRules decodes and validates detection rules. Since JSON is
+// valid YAML, both formats are accepted.
+func ParseDetectionRules(b []byte) ([]DetectionRule, error) {
+	var r detectionRules
+	d := yaml.NewDecoder(bytes.NewReader(b))
+	d.KnownFields(true)
+	err := d.Decode(&r)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Rules) == 0 {
+		return nil, ErrNoDetectionRules
+	}
+	seen := make(map[detectionRuleGroup]map[nodeKey]struct{})
+	for i, rule := range r.Rules {
+		err := rule.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		g := rule.group()
+		if _, exists := seen[g]; !exists {
+			seen[g] = make(map[nodeKey]struct{})
+		}
+		k := nodeKey{Package: rule.Package, Function: rule.Function}
+		if _, exists := seen[g][k]; exists {
+			return nil, fmt.Errorf("rule %d: duplicate rule for %s %s", i, rule.Package, rule.Function)
+		}
+		seen[g][k] = struct{}{}
+	}
+	return r.Rules, nil
+}
+
+// Validate checks the rule can be compiled and matched.
+func (r DetectionRule) Validate() error {
+	if !r.Platform.IsKnown() {
+		return fmt.Errorf("unknown platform %q", r.Platform)
+	}
+	if r.Function == "" {
+		return errors.New("function is missing")
+	}
+	if _, exists := issueTitles[r.Category]; !exists || r.Category == FrameDrop {
+		return fmt.Errorf("unknown category %q", r.Category)
+	}
+	if r.DurationThreshold < 0 {
+		return errors.New("duration threshold can't be negative")
+	}
+	if r.SampleThreshold < 0 {
+		return errors.New("sample threshold can't be negative")
+	}
+	return nil
+}
+
+func (r DetectionRule) group() detectionRuleGroup {
+	return detectionRuleGroup{
+		Platform:          r.Platform,
+		DurationThreshold: r.DurationThreshold,
+		SampleThreshold:   r.SampleThreshold,
+		ActiveThreadOnly:  r.ActiveThreadOnly,
+	}
+}
+
+// CompileDetectionRules groups rules sharing the same options into the
+// options used to detect frames, in the order they first appear.
+func CompileDetectionRules(rules []DetectionRule) map[platform.Platform][]DetectFrameOptions {
+	groups := make([]detectionRuleGroup, 0)
+	functionsByGroup := make(map[detectionRuleGroup]map[string]map[string]Category)
+	for _, r := range rules {
+		g := r.group()
+		functionsByPackage, exists := functionsByGroup[g]
+		if !exists {
+			functionsByPackage = make(map[string]map[string]Category)
+			functionsByGroup[g] = functionsByPackage
+			groups = append(groups, g)
+		}
+		if _, exists := functionsByPackage[r.Package]; !exists {
+			functionsByPackage[r.Package] = make(map[string]Category)
+		}
+		functionsByPackage[r.Package][r.Function] = r.Category
+	}
+
+	jobs := make(map[platform.Platform][]DetectFrameOptions)
+	for _, g := range groups {
+		var options DetectFrameOptions
+		if g.Platform == platform.Android {
+			options = DetectAndroidFrameOptions{
+				ActiveThreadOnly:   g.ActiveThreadOnly,
+				DurationThreshold:  g.DurationThreshold,
+				FunctionsByPackage: functionsByGroup[g],
+				SampleThreshold:    g.SampleThreshold,
+			}
+		} else {
+			options = DetectExactFrameOptions{
+				ActiveThreadOnly:   g.ActiveThreadOnly,
+				DurationThreshold:  g.DurationThreshold,
+				FunctionsByPackage: functionsByGroup[g],
+				SampleThreshold:    g.SampleThreshold,
+			}
+		}
+		jobs[g.Platform] = append(jobs[g.Platform], options)
+	}
+	return jobs
+}
+
+func mustCompileDetectionRules(b []byte) map[platform.Platform][]DetectFrameOptions {
+	rules, err := ParseDetectionRules(b)
+	if err != nil {
+		panic(fmt.Sprintf("invalid default detection rules: %v", err))
+	}
+	return CompileDetectionRules(rules)
+}
@@ -0,0 +1,286 @@
+package occurrence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getsentry/vroom/internal/platform"
+	"github.com/getsentry/vroom/internal/testutil"
+)
+
+func TestParseDetectionRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []DetectionRule
+		wantErr bool
+	}{
+		{
+			name: "yaml",
+			input: `
+rules:
+  - platform: python
+    package: acme.orm
+    function: Query.all
+    category: sql
+    duration_threshold: 40ms
+    sample_threshold: 2
+    active_thread_only: true
+`,
+			want: []DetectionRule{
+				{
+					Platform:          platform.Python,
+					Package:           "acme.orm",
+					Function:          "Query.all",
+					Category:          SQL,
+					DurationThreshold: 40 * time.Millisecond,
+					SampleThreshold:   2,
+					ActiveThreadOnly:  true,
+				},
+			},
+		},
+		{
+			name:  "json",
+			input: `{"rules": [{"platform": "node", "package": "acme", "function": "parse", "category": "json_decode"}]}`,
+			want: []DetectionRule{
+				{
+					Platform: platform.Node,
+					Package:  "acme",
+					Function: "parse",
+					Category: JSONDecode,
+				},
+			},
+		},
+		{
+			name:    "no rules",
+			input:   `rules: []`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			input:   `{"rules": [{"platform": "node", "package": "acme", "function": "parse", "category": "json_decode", "threshold": 1}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown platform",
+			input:   `{"rules": [{"platform": "cobol", "package": "acme", "function": "parse", "category": "json_decode"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown category",
+			input:   `{"rules": [{"platform": "node", "package": "acme", "function": "parse", "category": "slow"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "missing function",
+			input:   `{"rules": [{"platform": "node", "package": "acme", "category": "json_decode"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "negative threshold",
+			input:   `{"rules": [{"platform": "node", "package": "acme", "function": "parse", "category": "json_decode", "sample_threshold": -1}]}`,
+			wantErr: true,
+		},
+		{
+			name: "duplicate rule",
+			input: `{"rules": [
+				{"platform": "node", "package": "acme", "function": "parse", "category": "json_decode"},
+				{"platform": "node", "package": "acme", "function": "parse", "category": "json_encode"}
+			]}`,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules, err := ParseDetectionRules([]byte(test.input))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("expected error: %v, got: %v", test.wantErr, err)
+			}
+			if diff := testutil.Diff(rules, test.want); diff != "" {
+				t.Fatalf("Result mismatch: got - want +\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCompileDetectionRules(t *testing.T) {
+	rules := []DetectionRule{
+		{Platform: platform.Android, Package: "com.acme", Function: "com.acme.Json.parse", Category: JSONDecode, ActiveThreadOnly: true},
+		{Platform: platform.Node, Package: "acme", Function: "parse", Category: JSONDecode, ActiveThreadOnly: true},
+		{Platform: platform.Node, Package: "acme", Function: "stringify", Category: JSONEncode, ActiveThreadOnly: true},
+		{Platform: platform.Node, Package: "acme", Function: "query", Category: SQL, DurationThreshold: time.Second},
+	}
+	want := map[platform.Platform][]DetectFrameOptions{
+		platform.Android: {
+			DetectAndroidFrameOptions{
+				ActiveThreadOnly: true,
+				FunctionsByPackage: map[string]map[string]Category{
+					"com.acme": {"com.acme.Json.parse": JSONDecode},
+				},
+			},
+		},
+		platform.Node: {
+			DetectExactFrameOptions{
+				ActiveThreadOnly: true,
+				FunctionsByPackage: map[string]map[string]Category{
+					"acme": {"parse": JSONDecode, "stringify": JSONEncode},
+				},
+			},
+			DetectExactFrameOptions{
+				DurationThreshold: time.Second,
+				FunctionsByPackage: map[string]map[string]Category{
+					"acme": {"query": SQL},
+				},
+			},
+		},
+	}
+	if diff := testutil.Diff(CompileDetectionRules(rules), want); diff != "" {
+		t.Fatalf("Result mismatch: got - want +\n%s", diff)
+	}
+}
+
+func TestDefaultGoDetectionRules(t *testing.T) {
+	want := []DetectFrameOptions{
+		DetectExactFrameOptions{
+			DurationThreshold: 40 * time.Millisecond,
+			SampleThreshold:   4,
+			FunctionsByPackage: map[string]map[string]Category{
+				"syscall": {
+					"Syscall":  BlockingSyscall,
+					"Syscall6": BlockingSyscall,
+					"Read":     BlockingSyscall,
+					"Write":    BlockingSyscall,
+					"Fsync":    BlockingSyscall,
+				},
+				"os": {
+					"ReadFile":      FileRead,
+					"WriteFile":     FileWrite,
+					"(*File).Read":  FileRead,
+					"(*File).Write": FileWrite,
+					"(*File).Sync":  FileWrite,
+				},
+				"encoding/json": {
+					"Marshal":           JSONEncode,
+					"MarshalIndent":     JSONEncode,
+					"(*Encoder).Encode": JSONEncode,
+					"Unmarshal":         JSONDecode,
+					"(*Decoder).Decode": JSONDecode,
+				},
+				"regexp": {
+					"Compile":                         Regex,
+					"MustCompile":                     Regex,
+					"MatchString":                     Regex,
+					"(*Regexp).FindAllString":         Regex,
+					"(*Regexp).FindAllStringSubmatch": Regex,
+					"(*Regexp).FindStringSubmatch":    Regex,
+					"(*Regexp).MatchString":           Regex,
+					"(*Regexp).ReplaceAllString":      Regex,
+				},
+			},
+		},
+	}
+	if diff := testutil.Diff(DefaultDetectionRules()[platform.Go], want); diff != "" {
+		t.Fatalf("Result mismatch: got - want +\n%s", diff)
+	}
+}
+
+func TestDefaultDetectionRulesMatchGolden(t *testing.T) {
+	rules, err := ParseDetectionRules(defaultDetectionRules)
+	if err != nil {
+		t.Fatalf("couldn't parse the default rules: %v", err)
+	}
+	got := CompileDetectionRules(rules)
+	// Go rules were added once the rules were moved to YAML, they're checked
+	// by TestDefaultGoDetectionRules.
+	delete(got, platform.Go)
+	if diff := testutil.Diff(got, goldenDetectFrameJobs); diff != "" {
+		t.Fatalf("Result mismatch: got - want +\n%s", diff)
+	}
+}
+
+func TestDefaultDetectionRules(t *testing.T) {
+	type rule struct {
+		ActiveThreadOnly  bool
+		DurationThreshold time.Duration
+		SampleThreshold   int
+		Category          Category
+	}
+	tests := []struct {
+		platform platform.Platform
+		pkg      string
+		function string
+		want     rule
+	}{
+		{platform.Node, "node:fs", "readFileSync", rule{
+			ActiveThreadOnly: true,
+			Category:         FileRead,
+		}},
+		{platform.Node, "", "addSourceContext", rule{
+			DurationThreshold: 100 * time.Millisecond,
+			Category:          SourceContext,
+		}},
+		{platform.Cocoa, "AppleJPEG", "applejpeg_decode_image_all", rule{
+			ActiveThreadOnly:  true,
+			DurationThreshold: 16 * time.Millisecond,
+			SampleThreshold:   4,
+			Category:          ImageDecode,
+		}},
+		{platform.Cocoa, "libsqlite3.dylib", "sqlite3_blob_read", rule{
+			ActiveThreadOnly:  true,
+			DurationThreshold: 16 * time.Millisecond,
+			SampleThreshold:   4,
+			Category:          SQL,
+		}},
+		{platform.Cocoa, "UIKit", "-[UINib instantiateWithOwner:options:]", rule{
+			ActiveThreadOnly:  true,
+			DurationThreshold: 16 * time.Millisecond,
+			SampleThreshold:   4,
+			Category:          ViewInflation,
+		}},
+		{platform.Android, "com.google.gson", "com.google.gson.Gson.fromJson", rule{
+			ActiveThreadOnly:  true,
+			DurationThreshold: 40 * time.Millisecond,
+			Category:          JSONDecode,
+		}},
+		{platform.Android, "java.util.regex", "java.util.regex.Matcher.matches", rule{
+			ActiveThreadOnly:  true,
+			DurationThreshold: 40 * time.Millisecond,
+			Category:          Regex,
+		}},
+		{platform.Android, "kotlinx.coroutines", "kotlinx.coroutines.AwaitAll.await", rule{
+			ActiveThreadOnly:  true,
+			DurationThreshold: 40 * time.Millisecond,
+			Category:          ThreadWait,
+		}},
+	}
+
+	rules := DefaultDetectionRules()
+	for _, test := range tests {
+		t.Run(string(test.platform)+"/"+test.function, func(t *testing.T) {
+			var got []rule
+			for _, options := range rules[test.platform] {
+				var r rule
+				var functionsByPackage map[string]map[string]Category
+				switch o := options.(type) {
+				case DetectExactFrameOptions:
+					if test.platform == platform.Android {
+						t.Fatalf("expected Android options, got %T", o)
+					}
+					r = rule{o.ActiveThreadOnly, o.DurationThreshold, o.SampleThreshold, ""}
+					functionsByPackage = o.FunctionsByPackage
+				case DetectAndroidFrameOptions:
+					r = rule{o.ActiveThreadOnly, o.DurationThreshold, o.SampleThreshold, ""}
+					functionsByPackage = o.FunctionsByPackage
+				}
+				if category, exists := functionsByPackage[test.pkg][test.function]; exists {
+					r.Category = category
+					got = append(got, r)
+				}
+			}
+			if diff := testutil.Diff(got, []rule{test.want}); diff != "" {
+				t.Fatalf("Result mismatch: got - want +\n%s", diff)
+			}
+		})
+	}
+}
@@ -1,13 +1,26 @@
 package occurrence
 
 import (
+	"time"
+
+	"github.com/getsentry/vroom/internal/chunk"
 	"github.com/getsentry/vroom/internal/nodetree"
+	"github.com/getsentry/vroom/internal/platform"
 	"github.com/getsentry/vroom/internal/profile"
 )
 
-func Find(p profile.Profile, callTrees map[uint64][]*nodetree.Node) []*Occurrence {
+// Find detects occurrences in a transaction profile with the compiled
+// detection rules, the default ones being used when nil.
+func Find(
+	p profile.Profile,
+	callTrees map[uint64][]*nodetree.Node,
+	rules map[platform.Platform][]DetectFrameOptions,
+) []*Occurrence {
+	if rules == nil {
+		rules = defaultDetectFrameJobs
+	}
 	var occurrences []*Occurrence
-	if jobs, exists := detectFrameJobs[p.Platform()]; exists {
+	if jobs, exists := rules[p.Platform()]; exists {
 		for _, metadata := range jobs {
 			detectFrame(p, callTrees, metadata, &occurrences)
 		}
@@ -15,3 +28,65 @@ func Find(p profile.Profile, callTrees map[uint64][]*nodetree.Node) []*Occurrenc
 	findFrameDropCause(p, callTrees, &occurrences)
 	return occurrences
 }
+
+// FindInChunk detects occurrences in a continuous profile chunk like Find.
+// The main thread is looked up in the chunk since there's no active thread.
+func FindInChunk(
+	c chunk.Chunk,
+	callTrees map[string][]*nodetree.Node,
+	rules map[platform.Platform][]DetectFrameOptions,
+) ([]*Occurrence, error) {
+	if rules == nil {
+		rules = defaultDetectFrameJobs
+	}
+	mainThreadID := c.MainThreadID()
+	var nodes []nodeInfo
+	if jobs, exists := rules[c.GetPlatform()]; exists {
+		for _, options := range jobs {
+			for _, ni := range detectFrameInCallTrees(callTrees, mainThreadID, options) {
+				nodes = append(nodes, ni)
+			}
+		}
+	}
+
+	chunkMeasurements, err := c.GetMeasurements()
+	if err != nil {
+		return nil, err
+	}
+	if frameDrops, exists := chunkMeasurements["frozen_frame_renders"]; exists {
+		if mainThreadCallTrees, exists := callTrees[mainThreadID]; exists {
+			frozenFrames := make([]frozenFrameStats, 0, len(frameDrops.Values))
+			for _, mv := range frameDrops.Values {
+				frozenFrames = append(frozenFrames, newFrozenFrameStats(uint64(mv.Timestamp*1e9), mv.Value))
+			}
+			nodes = append(nodes, findFrameDropCauseNodes(mainThreadCallTrees, frozenFrames)...)
+		}
+	}
+
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+
+	m := occurrenceMetadata{
+		DebugMeta:      c.GetDebugMeta(),
+		DurationNS:     uint64((c.EndTimestamp() - c.StartTimestamp()) * 1e9),
+		Environment:    c.GetEnvironment(),
+		OrganizationID: c.GetOrganizationID(),
+		Platform:       c.GetPlatform(),
+		ProjectID:      c.GetProjectID(),
+		Received:       time.Unix(0, int64(c.GetReceived()*1e9)).UTC(),
+		Release:        c.GetRelease(),
+		Timestamp:      time.Unix(0, int64(c.StartTimestamp()*1e9)).UTC(),
+		EvidenceData: map[string]interface{}{
+			"chunk_id":    c.GetID(),
+			"profiler_id": c.GetProfilerID(),
+		},
+	}
+	occurrences := make([]*Occurrence, 0, len(nodes))
+	for _, ni := range nodes {
+		// Chunks aren't tied to a transaction, the function is the culprit.
+		m.Culprit = ni.Node.Name
+		occurrences = append(occurrences, newOccurrence(m, ni))
+	}
+	return occurrences, nil
+}
@@ -0,0 +1,205 @@
+package occurrence
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/getsentry/vroom/internal/chunk"
+	"github.com/getsentry/vroom/internal/frame"
+	"github.com/getsentry/vroom/internal/platform"
+	"github.com/getsentry/vroom/internal/sample"
+	"github.com/getsentry/vroom/internal/testutil"
+)
+
+func TestFindInChunk(t *testing.T) {
+	c := chunk.New(&chunk.SampleChunk{
+		ID:             "0432a0a4c25f4697bf9f0a2fcbe6a814",
+		ProfilerID:     "71f3d1f3b2f44d0a9b4e2f5c6d7e8f90",
+		OrganizationID: 1,
+		ProjectID:      2,
+		Platform:       platform.Node,
+		Release:        "1.0",
+		Profile: chunk.SampleData{
+			Frames: []frame.Frame{
+				{Function: "main", Module: "app"},
+				{Function: "readFileSync", Module: "node:fs"},
+			},
+			Samples: []chunk.Sample{
+				{StackID: 0, ThreadID: "1", Timestamp: 10.0},
+				{StackID: 0, ThreadID: "1", Timestamp: 10.01},
+				{StackID: 0, ThreadID: "2", Timestamp: 10.0},
+				{StackID: 0, ThreadID: "2", Timestamp: 10.01},
+				{StackID: 0, ThreadID: "1", Timestamp: 10.02},
+				{StackID: 0, ThreadID: "2", Timestamp: 10.02},
+			},
+			Stacks: [][]int{{1, 0}},
+			ThreadMetadata: map[string]sample.ThreadMetadata{
+				"1": {Name: "worker"},
+				"2": {Name: "main"},
+			},
+		},
+	})
+
+	if tid := c.MainThreadID(); tid != "2" {
+		t.Fatalf("expected main thread 2, got %q", tid)
+	}
+
+	callTrees, err := c.CallTrees(nil)
+	if err != nil {
+		t.Fatalf("couldn't generate call trees: %v", err)
+	}
+	occurrences, err := FindInChunk(c, callTrees, DefaultDetectionRules())
+	if err != nil {
+		t.Fatalf("couldn't find occurrences: %v", err)
+	}
+	if len(occurrences) != 1 {
+		t.Fatalf("expected 1 occurrence, got %d", len(occurrences))
+	}
+
+	o := occurrences[0]
+	if o.IssueTitle != issueTitles[FileRead].IssueTitle || o.Subtitle != "readFileSync" {
+		t.Fatalf("unexpected occurrence: %s %s", o.IssueTitle, o.Subtitle)
+	}
+	if o.Event.ProjectID != 2 || o.Event.Release != "1.0" || o.Event.Timestamp.Unix() != 10 {
+		t.Fatalf("unexpected event: %+v", o.Event)
+	}
+	if o.EvidenceData["chunk_id"] != "0432a0a4c25f4697bf9f0a2fcbe6a814" ||
+		o.EvidenceData["profiler_id"] != "71f3d1f3b2f44d0a9b4e2f5c6d7e8f90" {
+		t.Fatalf("unexpected evidence data: %+v", o.EvidenceData)
+	}
+
+	occurrences, err = FindInChunk(c, callTrees, map[platform.Platform][]DetectFrameOptions{})
+	if err != nil {
+		t.Fatalf("couldn't find occurrences: %v", err)
+	}
+	if len(occurrences) != 0 {
+		t.Fatalf("expected the rules passed to be used, got %d occurrences", len(occurrences))
+	}
+}
+
+func TestFindInChunkFrameDrop(t *testing.T) {
+	c := chunk.New(&chunk.SampleChunk{
+		ID:             "5f7d2b9c1e3a4c6d8b0a2e4f6c8d0b1a",
+		ProfilerID:     "9e8d7c6b5a4f4e3d2c1b0a9f8e7d6c5b",
+		OrganizationID: 1,
+		ProjectID:      2,
+		Platform:       platform.Cocoa,
+		Measurements:   json.RawMessage(`{"frozen_frame_renders":{"unit":"nanosecond","values":[{"timestamp":10.2,"value":200000000}]}}`),
+		Profile: chunk.SampleData{
+			Frames: []frame.Frame{
+				{Function: "main", InApp: &testutil.False},
+				{Function: "-[ViewController viewDidLoad]", InApp: &testutil.True},
+			},
+			Samples: []chunk.Sample{
+				{StackID: 0, ThreadID: "259", Timestamp: 10.0},
+				{StackID: 0, ThreadID: "259", Timestamp: 10.1},
+				{StackID: 0, ThreadID: "259", Timestamp: 10.2},
+			},
+			Stacks: [][]int{{1, 0}},
+			ThreadMetadata: map[string]sample.ThreadMetadata{
+				"259": {Name: "com.apple.main-thread"},
+			},
+		},
+	})
+
+	callTrees, err := c.CallTrees(nil)
+	if err != nil {
+		t.Fatalf("couldn't generate call trees: %v", err)
+	}
+	occurrences, err := FindInChunk(c, callTrees, DefaultDetectionRules())
+	if err != nil {
+		t.Fatalf("couldn't find occurrences: %v", err)
+	}
+	if len(occurrences) != 1 {
+		t.Fatalf("expected 1 occurrence, got %d", len(occurrences))
+	}
+	o := occurrences[0]
+	if o.IssueTitle != issueTitles[FrameDrop].IssueTitle || o.Subtitle != "-[ViewController viewDidLoad]" {
+		t.Fatalf("unexpected occurrence: %s %s", o.IssueTitle, o.Subtitle)
+	}
+}
+
+func TestFindInChunkWithoutMainThread(t *testing.T) {
+	c := chunk.New(&chunk.SampleChunk{
+		ID:             "0432a0a4c25f4697bf9f0a2fcbe6a814",
+		ProfilerID:     "71f3d1f3b2f44d0a9b4e2f5c6d7e8f90",
+		OrganizationID: 1,
+		ProjectID:      2,
+		Platform:       platform.Node,
+		Measurements:   json.RawMessage(`{"frozen_frame_renders":{"unit":"nanosecond","values":[{"timestamp":10.02,"value":20000000}]}}`),
+		Profile: chunk.SampleData{
+			Frames: []frame.Frame{
+				{Function: "main", Module: "app"},
+				{Function: "readFileSync", Module: "node:fs"},
+			},
+			Samples: []chunk.Sample{
+				{StackID: 0, ThreadID: "1", Timestamp: 10.0},
+				{StackID: 0, ThreadID: "1", Timestamp: 10.01},
+				{StackID: 0, ThreadID: "1", Timestamp: 10.02},
+			},
+			Stacks: [][]int{{1, 0}},
+			ThreadMetadata: map[string]sample.ThreadMetadata{
+				"1": {Name: "worker"},
+			},
+		},
+	})
+
+	if tid := c.MainThreadID(); tid != "" {
+		t.Fatalf("expected no main thread, got %q", tid)
+	}
+	callTrees, err := c.CallTrees(nil)
+	if err != nil {
+		t.Fatalf("couldn't generate call trees: %v", err)
+	}
+	occurrences, err := FindInChunk(c, callTrees, DefaultDetectionRules())
+	if err != nil {
+		t.Fatalf("couldn't find occurrences: %v", err)
+	}
+	if len(occurrences) != 0 {
+		t.Fatalf("expected no occurrence without a main thread, got %d", len(occurrences))
+	}
+}
+
+func TestMainThreadID(t *testing.T) {
+	tests := []struct {
+		name    string
+		threads map[string]sample.ThreadMetadata
+		want    string
+	}{
+		{
+			name:    "node and go",
+			threads: map[string]sample.ThreadMetadata{"1": {Name: "worker"}, "2": {Name: "main"}},
+			want:    "2",
+		},
+		{
+			name:    "python",
+			threads: map[string]sample.ThreadMetadata{"140": {Name: "MainThread"}, "141": {Name: "Thread-1"}},
+			want:    "140",
+		},
+		{
+			name:    "cocoa",
+			threads: map[string]sample.ThreadMetadata{"259": {Name: "com.apple.main-thread"}, "260": {Name: "com.apple.uikit.eventfetch-thread"}},
+			want:    "259",
+		},
+		{
+			name:    "several main threads",
+			threads: map[string]sample.ThreadMetadata{"3": {Name: "main"}, "2": {Name: "MainThread"}},
+			want:    "2",
+		},
+		{
+			name:    "no main thread",
+			threads: map[string]sample.ThreadMetadata{"1": {Name: "worker"}, "2": {Name: "Main"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := chunk.New(&chunk.SampleChunk{
+				Profile: chunk.SampleData{ThreadMetadata: test.threads},
+			})
+			if tid := c.MainThreadID(); tid != test.want {
+				t.Fatalf("expected main thread %q, got %q", test.want, tid)
+			}
+		})
+	}
+}
@@ -72,8 +72,20 @@ func findFrameDropCause(
 	if !exists {
 		return
 	}
+	frozenFrames := make([]frozenFrameStats, 0, len(frameDrops.Values))
 	for _, mv := range frameDrops.Values {
-		stats := newFrozenFrameStats(mv.ElapsedSinceStartNs, mv.Value)
+		frozenFrames = append(frozenFrames, newFrozenFrameStats(mv.ElapsedSinceStartNs, mv.Value))
+	}
+	for _, ni := range findFrameDropCauseNodes(callTrees, frozenFrames) {
+		*occurrences = append(*occurrences, NewOccurrence(p, ni))
+	}
+}
+
+// findFrameDropCauseNodes returns the node most likely responsible for each
+// frozen frame, if any.
+func findFrameDropCauseNodes(callTrees []*nodetree.Node, frozenFrames []frozenFrameStats) []nodeInfo {
+	var nodes []nodeInfo
+	for _, stats := range frozenFrames {
 		for _, root := range callTrees {
 			st := make([]*nodetree.Node, 0, profile.MaxStackDepth)
 			cause := findFrameDropCauseFrame(
@@ -99,17 +111,15 @@ func findFrameDropCause(
 			if unknownFramesCount >= float64(len(stackTrace))*unknownFramesInTheStackThreshold {
 				continue
 			}
-			*occurrences = append(
-				*occurrences,
-				NewOccurrence(p, nodeInfo{
-					Category:   FrameDrop,
-					Node:       *cause.n,
-					StackTrace: stackTrace,
-				}),
-			)
+			nodes = append(nodes, nodeInfo{
+				Category:   FrameDrop,
+				Node:       *cause.n,
+				StackTrace: stackTrace,
+			})
 			break
 		}
 	}
+	return nodes
 }
 
 func findFrameDropCauseFrame(
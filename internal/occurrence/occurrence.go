@@ -78,6 +78,23 @@ type (
 		Type       Type
 	}
 
+	// occurrenceMetadata holds the metadata of a profile or a chunk needed
+	// to create an occurrence.
+	occurrenceMetadata struct {
+		Culprit        string
+		DebugMeta      debugmeta.DebugMeta
+		DurationNS     uint64
+		Environment    string
+		EvidenceData   map[string]interface{}
+		OrganizationID uint64
+		Platform       platform.Platform
+		ProjectID      uint64
+		Received       time.Time
+		Release        string
+		Tags           map[string]string
+		Timestamp      time.Time
+	}
+
 	Category string
 )
 
@@ -110,6 +127,7 @@ const (
 var issueTitles = map[Category]CategoryMetadata{
 	Base64Decode:     {IssueTitle: "Base64 Decode on Main Thread"},
 	Base64Encode:     {IssueTitle: "Base64 Encode on Main Thread"},
+	BlockingSyscall:  {IssueTitle: "Blocking Syscall on Hot Path"},
 	Compression:      {IssueTitle: "Compression on Main Thread"},
 	CoreDataBlock:    {IssueTitle: "Object Context operation on Main Thread", Type: CoreDataType},
 	CoreDataMerge:    {IssueTitle: "Object Context operation on Main Thread", Type: CoreDataType},
@@ -140,6 +158,27 @@ var issueTitles = map[Category]CategoryMetadata{
 // NewOccurrence returns an Occurrence struct populated with info.
 func NewOccurrence(p profile.Profile, ni nodeInfo) *Occurrence {
 	t := p.Transaction()
+	return newOccurrence(occurrenceMetadata{
+		Culprit:        t.Name,
+		DebugMeta:      p.DebugMeta(),
+		DurationNS:     p.DurationNS(),
+		Environment:    p.Environment(),
+		OrganizationID: p.OrganizationID(),
+		Platform:       p.Platform(),
+		ProjectID:      p.ProjectID(),
+		Received:       p.Received(),
+		Release:        p.Release(),
+		Tags:           p.TransactionTags(),
+		Timestamp:      p.Timestamp(),
+		EvidenceData: map[string]interface{}{
+			"transaction_id":   t.ID,
+			"transaction_name": t.Name,
+			ProfileID:          p.ID(),
+		},
+	}, ni)
+}
+
+func newOccurrence(m occurrenceMetadata, ni nodeInfo) *Occurrence {
 	var title IssueTitle
 	var issueType Type
 	cm, exists := issueTitles[ni.Category]
@@ -150,7 +189,7 @@ func NewOccurrence(p profile.Profile, ni nodeInfo) *Occurrence {
 		issueType = NoneType
 		title = IssueTitle(fmt.Sprintf("%v issue detected", ni.Category))
 	}
-	pf := p.Platform()
+	pf := m.Platform
 	switch pf {
 	case platform.Android:
 		pf = platform.Java
@@ -161,40 +200,40 @@ func NewOccurrence(p profile.Profile, ni nodeInfo) *Occurrence {
 		)
 	}
 	h := md5.New()
-	_, _ = io.WriteString(h, strconv.FormatUint(p.ProjectID(), 10))
+	_, _ = io.WriteString(h, strconv.FormatUint(m.ProjectID, 10))
 	_, _ = io.WriteString(h, string(title))
 	_, _ = io.WriteString(h, strconv.Itoa(int(issueType)))
 	_, _ = io.WriteString(h, ni.Node.Frame.ModuleOrPackage())
 	_, _ = io.WriteString(h, ni.Node.Name)
 	fingerprint := fmt.Sprintf("%x", h.Sum(nil))
-	tags := p.TransactionTags()
+	tags := m.Tags
 	if tags == nil {
 		tags = make(map[string]string)
 	}
 	return &Occurrence{
-		Culprit:       t.Name,
+		Culprit:       m.Culprit,
 		DetectionTime: time.Now().UTC(),
 		Event: Event{
-			DebugMeta:      p.DebugMeta(),
-			Environment:    p.Environment(),
+			DebugMeta:      m.DebugMeta,
+			Environment:    m.Environment,
 			ID:             eventID(),
-			OrganizationID: p.OrganizationID(),
+			OrganizationID: m.OrganizationID,
 			Platform:       pf,
-			ProjectID:      p.ProjectID(),
-			Received:       p.Received(),
-			Release:        p.Release(),
+			ProjectID:      m.ProjectID,
+			Received:       m.Received,
+			Release:        m.Release,
 			StackTrace:     StackTrace{Frames: ni.StackTrace},
 			Tags:           tags,
-			Timestamp:      p.Timestamp(),
+			Timestamp:      m.Timestamp,
 		},
-		EvidenceData:    generateEvidenceData(p, ni),
-		EvidenceDisplay: generateEvidenceDisplay(p, ni),
+		EvidenceData:    generateEvidenceData(m, ni),
+		EvidenceDisplay: generateEvidenceDisplay(m, ni),
 		Fingerprint:     []string{fingerprint},
 		ID:              eventID(),
 		IssueTitle:      title,
 		Level:           "info",
 		PayloadType:     OccurrencePayload,
-		ProjectID:       p.ProjectID(),
+		ProjectID:       m.ProjectID,
 		Subtitle:        ni.Node.Name,
 		Type:            issueType,
 		category:        ni.Category,
@@ -203,6 +242,12 @@ func NewOccurrence(p profile.Profile, ni nodeInfo) *Occurrence {
 	}
 }
 
+// Category returns the category of the frame detected, it's empty for
+// occurrences not coming from frame detection.
+func (o *Occurrence) Category() Category {
+	return o.category
+}
+
 func FromRegressedFunction(
 	pf platform.Platform,
 	regressed RegressedFunction,
@@ -302,23 +347,22 @@ func normalizeAndroidStackTrace(st []frame.Frame) {
 	}
 }
 
-func generateEvidenceData(p profile.Profile, ni nodeInfo) map[string]interface{} {
-	t := p.Transaction()
+func generateEvidenceData(m occurrenceMetadata, ni nodeInfo) map[string]interface{} {
 	evidenceData := map[string]interface{}{
 		"frame_duration_ns":   ni.Node.DurationNS,
 		"frame_module":        ni.Node.Frame.Module,
 		"frame_name":          ni.Node.Name,
 		"frame_package":       ni.Node.Frame.Package,
-		"profile_duration_ns": p.DurationNS(),
+		"profile_duration_ns": m.DurationNS,
 		"template_name":       "profile",
-		"transaction_id":      t.ID,
-		"transaction_name":    t.Name,
-		ProfileID:             p.ID(),
+	}
+	for k, v := range m.EvidenceData {
+		evidenceData[k] = v
 	}
 	switch ni.Category {
 	case FrameDrop:
 	default:
-		switch p.Platform() {
+		switch m.Platform {
 		case platform.Android:
 			evidenceData["sample_count"] = ni.Node.SampleCount
 		}
@@ -326,7 +370,7 @@ func generateEvidenceData(p profile.Profile, ni nodeInfo) map[string]interface{}
 	return evidenceData
 }
 
-func generateEvidenceDisplay(p profile.Profile, ni nodeInfo) []Evidence {
+func generateEvidenceDisplay(m occurrenceMetadata, ni nodeInfo) []Evidence {
 	evidenceDisplay := []Evidence{
 		{
 			Important: true,
@@ -342,9 +386,9 @@ func generateEvidenceDisplay(p profile.Profile, ni nodeInfo) []Evidence {
 	case FrameDrop:
 	default:
 		nodeDuration := time.Duration(ni.Node.DurationNS).Round(10 * time.Microsecond)
-		profilePercentage := float64(ni.Node.DurationNS*100) / float64(p.DurationNS())
+		profilePercentage := float64(ni.Node.DurationNS*100) / float64(m.DurationNS)
 		var duration string
-		switch p.Platform() {
+		switch m.Platform {
 		case platform.Android:
 			duration = fmt.Sprintf(
 				"%s (%0.2f%% of the profile)",
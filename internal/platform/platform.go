@@ -5,6 +5,7 @@ type Platform string
 const (
 	Android    Platform = "android"
 	Cocoa      Platform = "cocoa"
+	Go         Platform = "go"
 	Java       Platform = "java"
 	JavaScript Platform = "javascript"
 	Node       Platform = "node"
@@ -12,3 +13,12 @@ const (
 	Python     Platform = "python"
 	Rust       Platform = "rust"
 )
+
+// IsKnown returns true when vroom knows how to process the platform.
+func (p Platform) IsKnown() bool {
+	switch p {
+	case Android, Cocoa, Go, Java, JavaScript, Node, PHP, Python, Rust:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,232 @@
+package pprof
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/getsentry/vroom/internal/frame"
+	"github.com/getsentry/vroom/internal/nodetree"
+)
+
+// ContentType is the content type of a gzipped profile.proto.
+const ContentType = "application/x-protobuf"
+
+type (
+	functionKey struct {
+		name     string
+		filename string
+		pkg      string
+	}
+
+	locationKey struct {
+		function        functionKey
+		line            uint32
+		column          uint32
+		instructionAddr string
+	}
+
+	builder struct {
+		p         *profile.Profile
+		functions map[functionKey]*profile.Function
+		locations map[locationKey]*profile.Location
+		mappings  map[string]*profile.Mapping
+	}
+)
+
+func newBuilder() *builder {
+	return &builder{
+		p: &profile.Profile{
+			SampleType: []*profile.ValueType{
+				{Type: "samples", Unit: "count"},
+				{Type: "wall", Unit: "nanoseconds"},
+			},
+			DefaultSampleType: "wall",
+			PeriodType:        &profile.ValueType{Type: "wall", Unit: "nanoseconds"},
+		},
+		functions: make(map[functionKey]*profile.Function),
+		locations: make(map[locationKey]*profile.Location),
+		mappings:  make(map[string]*profile.Mapping),
+	}
+}
+
+// FromCallTrees converts the call trees of a profile or a chunk, keyed by
+// thread ID, into a pprof profile. Each sample is labeled with its thread ID.
+func FromCallTrees[T comparable](
+	callTrees map[T][]*nodetree.Node,
+	start time.Time,
+	durationNS uint64,
+) *profile.Profile {
+	threadIDs := make([]string, 0, len(callTrees))
+	treesByThreadID := make(map[string][]*nodetree.Node, len(callTrees))
+	for tid, trees := range callTrees {
+		threadID := fmt.Sprint(tid)
+		threadIDs = append(threadIDs, threadID)
+		treesByThreadID[threadID] = trees
+	}
+	sort.Strings(threadIDs)
+
+	b := newBuilder()
+	for _, threadID := range threadIDs {
+		labels := map[string][]string{"thread_id": {threadID}}
+		for _, root := range treesByThreadID[threadID] {
+			b.addNode(root, make([]*profile.Location, 0, 128), labels)
+		}
+	}
+	if !start.IsZero() {
+		b.p.TimeNanos = start.UnixNano()
+	}
+	b.p.DurationNanos = int64(durationNS)
+	return b.p
+}
+
+// FromFlamegraph converts an aggregated flamegraph tree into a pprof profile.
+func FromFlamegraph(trees []*nodetree.Node) *profile.Profile {
+	b := newBuilder()
+	for _, root := range trees {
+		b.addNode(root, make([]*profile.Location, 0, 128), nil)
+	}
+	return b.p
+}
+
+// addNode emits a sample for the time spent in the node itself, then visits
+// its children. stack holds the locations from the root to the parent node.
+func (b *builder) addNode(
+	n *nodetree.Node,
+	stack []*profile.Location,
+	labels map[string][]string,
+) {
+	f := n.ToFrame()
+	stack = append(stack, b.location(f))
+
+	sampleCount := n.SampleCount
+	durationNS := n.DurationNS
+	for _, c := range n.Children {
+		b.addNode(c, stack, labels)
+		sampleCount -= c.SampleCount
+		if durationNS > c.DurationNS {
+			durationNS -= c.DurationNS
+		} else {
+			durationNS = 0
+		}
+	}
+	if sampleCount <= 0 && durationNS == 0 {
+		return
+	}
+
+	// pprof expects the leaf location first.
+	locations := make([]*profile.Location, len(stack))
+	for i, l := range stack {
+		locations[len(stack)-1-i] = l
+	}
+	sampleLabels := map[string][]string{
+		"in_app": {strconv.FormatBool(n.IsApplication)},
+	}
+	for k, v := range labels {
+		sampleLabels[k] = v
+	}
+	b.p.Sample = append(b.p.Sample, &profile.Sample{
+		Location: locations,
+		Value:    []int64{int64(max(sampleCount, 0)), int64(durationNS)},
+		Label:    sampleLabels,
+	})
+}
+
+func (b *builder) location(f frame.Frame) *profile.Location {
+	fk := functionKey{
+		name:     f.Function,
+		filename: filename(f),
+		pkg:      f.ModuleOrPackage(),
+	}
+	lk := locationKey{
+		function:        fk,
+		line:            f.Line,
+		column:          f.Column,
+		instructionAddr: f.InstructionAddr,
+	}
+	if l, exists := b.locations[lk]; exists {
+		return l
+	}
+	l := &profile.Location{
+		ID:      uint64(len(b.p.Location) + 1),
+		Mapping: b.mapping(f),
+		Address: parseAddress(f.InstructionAddr),
+		Line: []profile.Line{
+			{
+				Function: b.function(fk, f),
+				Line:     int64(f.Line),
+				Column:   int64(f.Column),
+			},
+		},
+	}
+	b.locations[lk] = l
+	b.p.Location = append(b.p.Location, l)
+	return l
+}
+
+func (b *builder) function(fk functionKey, f frame.Frame) *profile.Function {
+	if fn, exists := b.functions[fk]; exists {
+		return fn
+	}
+	name := f.Function
+	if name == "" {
+		name = "unknown"
+		if f.InstructionAddr != "" {
+			name = fmt.Sprintf("unknown (%s)", f.InstructionAddr)
+		}
+	}
+	systemName := f.Symbol
+	if systemName == "" {
+		systemName = name
+	}
+	fn := &profile.Function{
+		ID:         uint64(len(b.p.Function) + 1),
+		Name:       name,
+		SystemName: systemName,
+		Filename:   fk.filename,
+	}
+	b.functions[fk] = fn
+	b.p.Function = append(b.p.Function, fn)
+	return fn
+}
+
+// mapping returns a mapping per package so viewers can group and filter
+// frames by the library they belong to.
+func (b *builder) mapping(f frame.Frame) *profile.Mapping {
+	pkg := f.ModuleOrPackage()
+	if m, exists := b.mappings[pkg]; exists {
+		return m
+	}
+	m := &profile.Mapping{
+		ID:             uint64(len(b.p.Mapping) + 1),
+		File:           pkg,
+		HasFunctions:   true,
+		HasFilenames:   true,
+		HasLineNumbers: true,
+	}
+	b.mappings[pkg] = m
+	b.p.Mapping = append(b.p.Mapping, m)
+	return m
+}
+
+func filename(f frame.Frame) string {
+	if f.Path != "" {
+		return f.Path
+	}
+	return f.File
+}
+
+func parseAddress(addr string) uint64 {
+	if addr == "" {
+		return 0
+	}
+	a, err := strconv.ParseUint(strings.TrimPrefix(addr, "0x"), 16, 64)
+	if err != nil {
+		return 0
+	}
+	return a
+}
@@ -0,0 +1,107 @@
+package pprof
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/getsentry/vroom/internal/frame"
+	"github.com/getsentry/vroom/internal/nodetree"
+	"github.com/getsentry/vroom/internal/testutil"
+)
+
+func TestFromCallTrees(t *testing.T) {
+	callTrees := map[uint64][]*nodetree.Node{
+		1: {
+			{
+				DurationNS:    30,
+				SampleCount:   3,
+				IsApplication: true,
+				Frame: frame.Frame{
+					Function: "a",
+					Package:  "/usr/lib/libapp.so",
+					Path:     "/src/a.c",
+					Line:     12,
+					InApp:    &testutil.True,
+				},
+				Children: []*nodetree.Node{
+					{
+						DurationNS:  20,
+						SampleCount: 2,
+						Frame: frame.Frame{
+							Function:        "b",
+							Package:         "/usr/lib/libsystem.so",
+							InstructionAddr: "0x10",
+							InApp:           &testutil.False,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	p := FromCallTrees(callTrees, time.Unix(10, 0), 30)
+
+	var b bytes.Buffer
+	if err := p.Write(&b); err != nil {
+		t.Fatalf("couldn't write the profile: %v", err)
+	}
+	parsed, err := profile.Parse(&b)
+	if err != nil {
+		t.Fatalf("couldn't parse the profile: %v", err)
+	}
+
+	type sample struct {
+		Stack    []string
+		Mappings []string
+		Values   []int64
+		InApp    string
+		ThreadID string
+	}
+	got := make([]sample, 0, len(parsed.Sample))
+	for _, s := range parsed.Sample {
+		var stack, mappings []string
+		for _, l := range s.Location {
+			stack = append(stack, l.Line[0].Function.Name)
+			mappings = append(mappings, l.Mapping.File)
+		}
+		got = append(got, sample{
+			Stack:    stack,
+			Mappings: mappings,
+			Values:   s.Value,
+			InApp:    s.Label["in_app"][0],
+			ThreadID: s.Label["thread_id"][0],
+		})
+	}
+	want := []sample{
+		{
+			Stack:    []string{"b", "a"},
+			Mappings: []string{"libsystem", "libapp"},
+			Values:   []int64{2, 20},
+			InApp:    "false",
+			ThreadID: "1",
+		},
+		{
+			Stack:    []string{"a"},
+			Mappings: []string{"libapp"},
+			Values:   []int64{1, 10},
+			InApp:    "true",
+			ThreadID: "1",
+		},
+	}
+	if diff := testutil.Diff(got, want); diff != "" {
+		t.Fatalf("Result mismatch: got - want +\n%s", diff)
+	}
+
+	if parsed.TimeNanos != int64(10*time.Second) || parsed.DurationNanos != 30 {
+		t.Fatalf("unexpected time range: %d %d", parsed.TimeNanos, parsed.DurationNanos)
+	}
+	if l := parsed.Location[1]; l.Address != 0x10 {
+		t.Fatalf("unexpected address: %x", l.Address)
+	}
+	if fn := parsed.Function[0]; fn.Filename != "/src/a.c" || parsed.Location[0].Line[0].Line != 12 {
+		t.Fatalf("unexpected function: %+v", fn)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"hash/fnv"
 	"math"
 	"path"
+	"slices"
 	"strings"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 	"github.com/getsentry/vroom/internal/nodetree"
 	"github.com/getsentry/vroom/internal/packageutil"
 	"github.com/getsentry/vroom/internal/platform"
+	"github.com/getsentry/vroom/internal/proguard"
 	"github.com/getsentry/vroom/internal/speedscope"
 )
 
@@ -311,7 +313,9 @@ func (p Android) CallTrees() map[uint64][]*nodetree.Node {
 }
 
 func (p Android) CallTreesWithMaxDepth(maxDepth int) map[uint64][]*nodetree.Node {
-	// in case wall-clock.secs is not monotonic, "fix" it
+	// in case wall-clock.secs is not monotonic, "fix" it, on a copy of the
+	// events since profiles read from the cache are shared
+	p.Events = slices.Clone(p.Events)
 	p.FixSamplesTime()
 
 	var activeThreadID uint64
@@ -459,12 +463,72 @@ func (p *Android) NormalizeMethods(pi profileInterface) {
 	}
 }
 
+// Deobfuscate rewrites the methods not deobfuscated upstream with a mapping
+// and sets their deobfuscation status. Methods inlined by R8 are listed in
+// their inline frames, the outermost first.
+func (p *Android) Deobfuscate(m *proguard.Mapping) {
+	for i := range p.Methods {
+		method := &p.Methods[i]
+		if method.ClassName == "" || method.Data.DeobfuscationStatus != "" {
+			continue
+		}
+		frames, ok := m.Remap(method.ClassName, method.Name, method.SourceLine)
+		if !ok {
+			className, exists := m.Class(method.ClassName)
+			if !exists {
+				method.Data.DeobfuscationStatus = proguard.StatusMissing
+				continue
+			}
+			if sourceFile := m.SourceFile(method.ClassName); sourceFile != "" {
+				method.SourceFile = sourceFile
+			}
+			method.ClassName = className
+			method.Signature = m.Signature(method.Signature)
+			method.Data.DeobfuscationStatus = proguard.StatusPartial
+			continue
+		}
+		if len(frames) > 1 {
+			method.InlineFrames = make([]AndroidMethod, 0, len(frames))
+			for _, f := range frames {
+				inlineMethod := androidMethodFromFrame(f)
+				inlineMethod.ID = method.ID
+				inlineMethod.Platform = method.Platform
+				method.InlineFrames = append(method.InlineFrames, inlineMethod)
+			}
+		}
+		outermost := androidMethodFromFrame(frames[0])
+		method.ClassName = outermost.ClassName
+		method.Name = outermost.Name
+		method.Signature = outermost.Signature
+		if outermost.SourceFile != "" {
+			method.SourceFile = outermost.SourceFile
+		}
+		if outermost.SourceLine != 0 {
+			method.SourceLine = outermost.SourceLine
+		}
+		method.Data.DeobfuscationStatus = proguard.StatusDeobfuscated
+	}
+}
+
+func androidMethodFromFrame(f proguard.Frame) AndroidMethod {
+	return AndroidMethod{
+		ClassName:  f.ClassName,
+		Data:       Data{DeobfuscationStatus: proguard.StatusDeobfuscated},
+		Name:       f.Method,
+		Signature:  f.Signature,
+		SourceFile: f.SourceFile,
+		SourceLine: f.Line,
+	}
+}
+
 func (p Android) Speedscope() (speedscope.Output, error) {
 	return p.SpeedscopeWithMaxDepth(MaxStackDepth)
 }
 
 func (p Android) SpeedscopeWithMaxDepth(maxDepth int) (speedscope.Output, error) {
-	// in case wall-clock.secs is not monotonic, "fix" it
+	// in case wall-clock.secs is not monotonic, "fix" it, on a copy of the
+	// events since profiles read from the cache are shared
+	p.Events = slices.Clone(p.Events)
 	p.FixSamplesTime()
 
 	frames := make([]speedscope.Frame, 0)
@@ -1,6 +1,7 @@
 package profile
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/getsentry/vroom/internal/frame"
 	"github.com/getsentry/vroom/internal/nodetree"
+	"github.com/getsentry/vroom/internal/proguard"
 	"github.com/getsentry/vroom/internal/speedscope"
 	"github.com/getsentry/vroom/internal/testutil"
 )
@@ -567,7 +569,6 @@ func TestCallTrees(t *testing.T) {
 				1: {
 					{
 						DurationNS:    1000,
-						DurationsNS:   []uint64{1000},
 						IsApplication: true,
 						EndNS:         2000,
 						StartNS:       1000,
@@ -584,7 +585,6 @@ func TestCallTrees(t *testing.T) {
 						Children: []*nodetree.Node{
 							{
 								DurationNS:    1000,
-								DurationsNS:   []uint64{1000},
 								IsApplication: true,
 								Name:          "class2.method2()",
 								Package:       "class2",
@@ -603,7 +603,6 @@ func TestCallTrees(t *testing.T) {
 					},
 					{
 						DurationNS:    0,
-						DurationsNS:   []uint64{0},
 						IsApplication: true,
 						Name:          "class1.method1()",
 						Package:       "class1",
@@ -629,7 +628,6 @@ func TestCallTrees(t *testing.T) {
 				1: {
 					{
 						DurationNS:    2000,
-						DurationsNS:   []uint64{2000},
 						IsApplication: true,
 						EndNS:         3000,
 						Occurrence:    1,
@@ -646,7 +644,6 @@ func TestCallTrees(t *testing.T) {
 						Children: []*nodetree.Node{
 							{
 								DurationNS:    1000,
-								DurationsNS:   []uint64{1000},
 								IsApplication: true,
 								EndNS:         2500,
 								Occurrence:    1,
@@ -663,7 +660,6 @@ func TestCallTrees(t *testing.T) {
 								Children: []*nodetree.Node{
 									{
 										DurationNS:    500,
-										DurationsNS:   []uint64{500},
 										IsApplication: true,
 										EndNS:         2250,
 										Occurrence:    1,
@@ -693,7 +689,6 @@ func TestCallTrees(t *testing.T) {
 				1: {
 					{
 						DurationNS:    1000,
-						DurationsNS:   []uint64{1000},
 						IsApplication: true,
 						EndNS:         2000,
 						StartNS:       1000,
@@ -991,3 +986,85 @@ func TestAddTimeDelta(t *testing.T) {
 		})
 	}
 }
+
+func TestDeobfuscate(t *testing.T) {
+	m, err := proguard.Parse(strings.NewReader(`io.sentry.sample.Worker -> a.b:
+# {"id":"sourceFile","fileName":"Worker.kt"}
+    1:1:void io.sentry.sample.Util.log(java.lang.String):7:7 -> a
+    1:1:void run():30 -> a
+    void stop() -> b
+    void stop(int) -> b
+`))
+	if err != nil {
+		t.Fatalf("couldn't parse mapping: %v", err)
+	}
+	p := Android{
+		Methods: []AndroidMethod{
+			{ID: 1, ClassName: "a.b", Name: "a", Signature: "()V", SourceLine: 1},
+			{ID: 2, ClassName: "a.b", Name: "b", Signature: "(La/b;)V"},
+			{ID: 3, ClassName: "a.z", Name: "a", Signature: "()V"},
+			{
+				ID:        4,
+				ClassName: "io.sentry.sample.MainActivity",
+				Name:      "onCreate",
+				Data:      Data{DeobfuscationStatus: proguard.StatusDeobfuscated},
+			},
+		},
+	}
+	p.Deobfuscate(m)
+
+	want := []AndroidMethod{
+		{
+			ID:         1,
+			ClassName:  "io.sentry.sample.Worker",
+			Name:       "run",
+			Signature:  "()V",
+			SourceFile: "Worker.kt",
+			SourceLine: 30,
+			Data:       Data{DeobfuscationStatus: proguard.StatusDeobfuscated},
+			InlineFrames: []AndroidMethod{
+				{
+					ID:         1,
+					ClassName:  "io.sentry.sample.Worker",
+					Name:       "run",
+					Signature:  "()V",
+					SourceFile: "Worker.kt",
+					SourceLine: 30,
+					Data:       Data{DeobfuscationStatus: proguard.StatusDeobfuscated},
+				},
+				{
+					ID:         1,
+					ClassName:  "io.sentry.sample.Util",
+					Name:       "log",
+					Signature:  "(Ljava/lang/String;)V",
+					SourceLine: 7,
+					Data:       Data{DeobfuscationStatus: proguard.StatusDeobfuscated},
+				},
+			},
+		},
+		{
+			ID:         2,
+			ClassName:  "io.sentry.sample.Worker",
+			Name:       "b",
+			Signature:  "(Lio/sentry/sample/Worker;)V",
+			SourceFile: "Worker.kt",
+			Data:       Data{DeobfuscationStatus: proguard.StatusPartial},
+		},
+		{
+			ID:        3,
+			ClassName: "a.z",
+			Name:      "a",
+			Signature: "()V",
+			Data:      Data{DeobfuscationStatus: proguard.StatusMissing},
+		},
+		{
+			ID:        4,
+			ClassName: "io.sentry.sample.MainActivity",
+			Name:      "onCreate",
+			Data:      Data{DeobfuscationStatus: proguard.StatusDeobfuscated},
+		},
+	}
+	if diff := testutil.Diff(p.Methods, want); diff != "" {
+		t.Fatalf("Result mismatch: got - want +\n%s", diff)
+	}
+}
@@ -327,6 +327,22 @@ func (p *LegacyProfile) Normalize() {
 	}
 }
 
+// Validate checks the profile has a trace and, for React Native profiles,
+// the JS profile only references existing stacks and frames.
+func (p LegacyProfile) Validate() error {
+	if p.Trace == nil {
+		return ErrProfileHasNoTrace
+	}
+	if len(p.JsProfile) == 0 {
+		return nil
+	}
+	st, err := unmarshalSampleProfile(p.JsProfile)
+	if err != nil {
+		return ErrReactHasInvalidJsTrace
+	}
+	return st.Profile.Validate()
+}
+
 func (p LegacyProfile) GetRelease() string {
 	return FormatVersion(p.VersionName, p.VersionCode)
 }
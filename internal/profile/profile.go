@@ -11,6 +11,7 @@ import (
 	"github.com/getsentry/vroom/internal/nodetree"
 	"github.com/getsentry/vroom/internal/options"
 	"github.com/getsentry/vroom/internal/platform"
+	"github.com/getsentry/vroom/internal/proguard"
 	"github.com/getsentry/vroom/internal/sample"
 	"github.com/getsentry/vroom/internal/speedscope"
 	"github.com/getsentry/vroom/internal/transaction"
@@ -38,6 +39,7 @@ type (
 		IsSampleFormat() bool
 		Metadata() metadata.Metadata
 		Normalize()
+		Validate() error
 		Speedscope() (speedscope.Output, error)
 		StoragePath() string
 		IsSampled() bool
@@ -128,10 +130,47 @@ func (p *Profile) Platform() platform.Platform {
 	return p.profile.GetPlatform()
 }
 
+// MappingID returns the ID of the ProGuard mapping of an Android profile, if
+// any.
+func (p *Profile) MappingID() string {
+	lp, ok := p.profile.(*LegacyProfile)
+	if !ok {
+		return ""
+	}
+	if _, ok := lp.Trace.(*Android); !ok {
+		return ""
+	}
+	return proguard.MappingID(lp.BuildID, lp.DebugMeta)
+}
+
+// Deobfuscate rewrites the methods of an Android profile with a mapping.
+func (p *Profile) Deobfuscate(m *proguard.Mapping) {
+	lp, ok := p.profile.(*LegacyProfile)
+	if !ok {
+		return
+	}
+	if t, ok := lp.Trace.(*Android); ok {
+		t.Deobfuscate(m)
+	}
+}
+
+// SymbolicateJavaScript calls symbolicate on the frames of a browser or Node
+// profile needing a source map.
+func (p *Profile) SymbolicateJavaScript(symbolicate func(*frame.Frame) error) error {
+	if sp, ok := p.profile.(*sample.Profile); ok {
+		return sp.SymbolicateJavaScript(symbolicate)
+	}
+	return nil
+}
+
 func (p *Profile) Normalize() {
 	p.profile.Normalize()
 }
 
+func (p *Profile) Validate() error {
+	return p.profile.Validate()
+}
+
 func (p *Profile) Transaction() transaction.Transaction {
 	return p.profile.GetTransaction()
 }
@@ -2,7 +2,11 @@ package profile
 
 import (
 	"context"
+	"encoding/json"
+	"io"
+	"time"
 
+	"github.com/getsentry/vroom/internal/monitoring"
 	"github.com/getsentry/vroom/internal/nodetree"
 	"github.com/getsentry/vroom/internal/storageutil"
 	"gocloud.dev/blob"
@@ -19,22 +23,37 @@ type (
 	}
 
 	ReadJobResult struct {
-		Err     error
-		Profile *Profile
+		Err       error
+		Profile   *Profile
+		ProfileID string
 	}
 )
 
-func (job ReadJob) Read() {
-	var profile Profile
+func (job ReadJob) Read(cache *storageutil.Cache) {
+	profile, err := readProfile(job, cache)
 
-	err := storageutil.UnmarshalCompressed(
-		job.Ctx,
-		job.Storage,
-		StoragePath(job.OrganizationID, job.ProjectID, job.ProfileID),
-		&profile,
-	)
+	job.Result <- ReadJobResult{Profile: profile, ProfileID: job.ProfileID, Err: err}
+}
 
-	job.Result <- ReadJobResult{Profile: &profile, Err: err}
+// readProfile reads a profile from the cache or the bucket. The profile can
+// be shared with other reads and mustn't be modified.
+func readProfile(job ReadJob, cache *storageutil.Cache) (*Profile, error) {
+	objectName := StoragePath(job.OrganizationID, job.ProjectID, job.ProfileID)
+	v, _, err := storageutil.ReadDecoded(job.Ctx, cache, job.Storage, objectName, objectName, decodeProfile)
+	return v, err
+}
+
+// decodeProfile decodes a profile as it's read. The decoded profile takes about
+// as much memory as its JSON, counted by storageutil.ReadDecoded.
+func decodeProfile(r io.Reader) (*Profile, int64, error) {
+	var profile Profile
+	start := time.Now()
+	err := json.NewDecoder(r).Decode(&profile)
+	monitoring.ObserveStage(monitoring.StageDecode, "profile", start)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &profile, 0, nil
 }
 
 func (result ReadJobResult) Error() error {
@@ -49,30 +68,61 @@ type (
 		CallTrees map[uint64][]*nodetree.Node
 		Profile   *Profile
 	}
-)
 
-func (job CallTreesReadJob) Read() {
-	var profile Profile
+	// callTreesEntry is what the cache keeps for a CallTreesReadJob, the
+	// call trees being computed once.
+	callTreesEntry struct {
+		profile   *Profile
+		callTrees map[uint64][]*nodetree.Node
+	}
+)
 
-	err := storageutil.UnmarshalCompressed(
+func (job CallTreesReadJob) Read(cache *storageutil.Cache) {
+	objectName := StoragePath(job.OrganizationID, job.ProjectID, job.ProfileID)
+	entry, shared, err := storageutil.ReadDecoded(
 		job.Ctx,
+		cache,
 		job.Storage,
-		StoragePath(job.OrganizationID, job.ProjectID, job.ProfileID),
-		&profile,
+		objectName,
+		objectName+"#calltrees",
+		decodeCallTrees,
 	)
-
 	if err != nil {
 		job.Result <- CallTreesReadJobResult{Err: err}
 		return
 	}
 
-	callTrees, err := profile.CallTrees()
-
+	// Call trees are modified when aggregated, each read of cached ones gets
+	// its own copy.
+	callTrees := entry.callTrees
+	if shared {
+		callTrees = make(map[uint64][]*nodetree.Node, len(entry.callTrees))
+		for threadID, trees := range entry.callTrees {
+			callTrees[threadID] = nodetree.DeepCopyTrees(trees)
+		}
+	}
 	job.Result <- CallTreesReadJobResult{
 		CallTrees: callTrees,
-		Profile:   &profile,
-		Err:       err,
+		Profile:   entry.profile,
+	}
+}
+
+func decodeCallTrees(r io.Reader) (callTreesEntry, int64, error) {
+	profile, size, err := decodeProfile(r)
+	if err != nil {
+		return callTreesEntry{}, 0, err
+	}
+
+	start := time.Now()
+	callTrees, err := profile.CallTrees()
+	monitoring.ObserveStage(monitoring.StageCallTrees, "profile", start)
+	if err != nil {
+		return callTreesEntry{}, 0, err
+	}
+	for _, trees := range callTrees {
+		size += nodetree.TreeSizeBytes(trees)
 	}
+	return callTreesEntry{profile: profile, callTrees: callTrees}, size, nil
 }
 
 func (result CallTreesReadJobResult) Error() error {
@@ -0,0 +1,55 @@
+package proguard
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"gocloud.dev/blob"
+
+	"github.com/getsentry/vroom/internal/debugmeta"
+	"github.com/getsentry/vroom/internal/storageutil"
+)
+
+var ErrMappingNotFound = errors.New("proguard: mapping not found")
+
+// Loader reads mappings from a bucket, a directory being opened as a file://
+// bucket, and keeps the most recently used ones parsed. A mapping is stored
+// as <id>.txt, the ID being lowercase.
+type Loader struct {
+	loader *storageutil.Loader[*Mapping]
+}
+
+// NewLoader returns a loader keeping up to maxMappings parsed mappings.
+func NewLoader(bucket *blob.Bucket, maxMappings int) *Loader {
+	return &Loader{loader: storageutil.NewLoader(bucket, maxMappings, Parse)}
+}
+
+// Load returns the mapping with this ID or ErrMappingNotFound.
+func (l *Loader) Load(ctx context.Context, id string) (*Mapping, error) {
+	m, err := l.loader.Load(ctx, strings.ToLower(id)+".txt")
+	if errors.Is(err, storageutil.ErrObjectNotFound) {
+		return nil, ErrMappingNotFound
+	}
+	return m, err
+}
+
+// MappingID returns the ID of the mapping of an Android profile or chunk, its
+// build ID or the ID of its proguard debug image.
+func MappingID(buildID string, dm debugmeta.DebugMeta) string {
+	if buildID != "" {
+		return buildID
+	}
+	for _, image := range dm.Images {
+		if image.Type != "proguard" {
+			continue
+		}
+		if image.UUID != "" {
+			return image.UUID
+		}
+		if image.DebugID != "" {
+			return image.DebugID
+		}
+	}
+	return ""
+}
@@ -0,0 +1,341 @@
+// Package proguard deobfuscates Java and Kotlin frames with the mapping files
+// written by ProGuard and R8 when they shrink an Android application.
+package proguard
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Deobfuscation statuses of Android methods.
+const (
+	StatusDeobfuscated = "deobfuscated"
+	// StatusPartial is set when only the class is found.
+	StatusPartial = "partial"
+	StatusMissing = "missing"
+)
+
+var ErrEmptyMapping = errors.New("proguard: mapping has no classes")
+
+type (
+	// Mapping maps obfuscated classes and methods to their original names.
+	Mapping struct {
+		classes map[string]*class
+	}
+
+	class struct {
+		name       string
+		sourceFile string
+		methods    map[string][]member
+	}
+
+	// member is a method line of a mapping, like
+	// "1:3:void run(int):10:12 -> a". Members sharing the same obfuscated line
+	// range are inlined into each other, the innermost first.
+	member struct {
+		startLine         uint32
+		endLine           uint32
+		className         string
+		name              string
+		returnType        string
+		arguments         string
+		originalStartLine uint32
+		originalEndLine   uint32
+	}
+
+	// Frame is an original frame.
+	Frame struct {
+		ClassName  string
+		Method     string
+		Signature  string
+		SourceFile string
+		Line       uint32
+	}
+)
+
+// Parse reads a mapping file. Fields and comments, except the ones giving the
+// source file of a class, are ignored.
+func Parse(r io.Reader) (*Mapping, error) {
+	m := &Mapping{classes: make(map[string]*class)}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var current *class
+	var lineNum int
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			continue
+		case strings.HasPrefix(trimmed, "#"):
+			if current != nil {
+				current.sourceFile = sourceFileFromComment(trimmed, current.sourceFile)
+			}
+			continue
+		case line[0] != ' ' && line[0] != '\t':
+			original, obfuscated, ok := strings.Cut(strings.TrimSuffix(trimmed, ":"), " -> ")
+			if !ok {
+				return nil, fmt.Errorf("proguard: invalid class mapping on line %d", lineNum)
+			}
+			current = &class{
+				name:    original,
+				methods: make(map[string][]member),
+			}
+			m.classes[obfuscated] = current
+		default:
+			if current == nil {
+				return nil, fmt.Errorf("proguard: member outside of a class on line %d", lineNum)
+			}
+			if !strings.Contains(trimmed, "(") {
+				// A field.
+				continue
+			}
+			obfuscated, mem, err := parseMember(trimmed)
+			if err != nil {
+				return nil, fmt.Errorf("proguard: %w on line %d", err, lineNum)
+			}
+			current.methods[obfuscated] = append(current.methods[obfuscated], mem)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(m.classes) == 0 {
+		return nil, ErrEmptyMapping
+	}
+	return m, nil
+}
+
+// parseMember parses [startLine:endLine:]returnType [class.]name(arguments)
+// [:originalStartLine[:originalEndLine]] -> obfuscatedName.
+func parseMember(s string) (string, member, error) {
+	var mem member
+	s, obfuscated, ok := strings.Cut(s, " -> ")
+	if !ok {
+		return "", mem, errors.New("invalid method mapping")
+	}
+	open := strings.IndexByte(s, '(')
+	closing := strings.LastIndexByte(s, ')')
+	if open == -1 || closing < open {
+		return "", mem, errors.New("invalid method arguments")
+	}
+	mem.arguments = s[open+1 : closing]
+
+	head := s[:open]
+	if lines := strings.Split(head, ":"); len(lines) == 3 {
+		start, err := strconv.ParseUint(lines[0], 10, 32)
+		if err != nil {
+			return "", mem, errors.New("invalid line range")
+		}
+		end, err := strconv.ParseUint(lines[1], 10, 32)
+		if err != nil {
+			return "", mem, errors.New("invalid line range")
+		}
+		mem.startLine, mem.endLine = uint32(start), uint32(end)
+		head = lines[2]
+	}
+	returnType, name, ok := strings.Cut(head, " ")
+	if !ok {
+		return "", mem, errors.New("missing return type")
+	}
+	mem.returnType = returnType
+	if i := strings.LastIndexByte(name, '.'); i != -1 {
+		mem.className, name = name[:i], name[i+1:]
+	}
+	mem.name = name
+
+	if tail := s[closing+1:]; strings.HasPrefix(tail, ":") {
+		lines := strings.Split(tail[1:], ":")
+		start, err := strconv.ParseUint(lines[0], 10, 32)
+		if err != nil {
+			return "", mem, errors.New("invalid original line")
+		}
+		mem.originalStartLine, mem.originalEndLine = uint32(start), uint32(start)
+		if len(lines) > 1 {
+			end, err := strconv.ParseUint(lines[1], 10, 32)
+			if err != nil {
+				return "", mem, errors.New("invalid original line")
+			}
+			mem.originalEndLine = uint32(end)
+		}
+	} else if mem.startLine != 0 {
+		// Without original lines, lines weren't changed.
+		mem.originalStartLine, mem.originalEndLine = mem.startLine, mem.endLine
+	}
+	return strings.TrimSpace(obfuscated), mem, nil
+}
+
+// sourceFileFromComment reads R8 metadata like
+// # {"id":"sourceFile","fileName":"Main.kt"}.
+func sourceFileFromComment(comment, sourceFile string) string {
+	var metadata struct {
+		ID       string `json:"id"`
+		FileName string `json:"fileName"`
+	}
+	err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(comment, "#"))), &metadata)
+	if err != nil || metadata.ID != "sourceFile" {
+		return sourceFile
+	}
+	return metadata.FileName
+}
+
+// Class returns the original name of a class.
+func (m *Mapping) Class(obfuscated string) (string, bool) {
+	c, exists := m.classes[obfuscated]
+	if !exists {
+		return "", false
+	}
+	return c.name, true
+}
+
+// SourceFile returns the source file of a class, if the mapping has it.
+func (m *Mapping) SourceFile(obfuscated string) string {
+	if c, exists := m.classes[obfuscated]; exists {
+		return c.sourceFile
+	}
+	return ""
+}
+
+// Remap returns the original frames of a method, the outermost first, and
+// false when the method can't be found or is ambiguous. With a line of 0, a
+// method is only found if all its mappings have the same original name.
+func (m *Mapping) Remap(className, method string, line uint32) ([]Frame, bool) {
+	c, exists := m.classes[className]
+	if !exists {
+		return nil, false
+	}
+	members := c.methods[method]
+	if len(members) == 0 {
+		return nil, false
+	}
+
+	if line > 0 {
+		var frames []Frame
+		for _, mem := range members {
+			if mem.startLine <= line && line <= mem.endLine {
+				frames = append(frames, c.frame(mem, line))
+			}
+		}
+		if len(frames) > 0 {
+			reverse(frames)
+			return frames, true
+		}
+	}
+
+	// Without a line, only the outermost member of each line range is what
+	// the runtime sees and they all have to be the same method.
+	var outermost []member
+	for i, mem := range members {
+		next := i + 1
+		if next < len(members) && mem.startLine != 0 &&
+			members[next].startLine == mem.startLine && members[next].endLine == mem.endLine {
+			continue
+		}
+		outermost = append(outermost, mem)
+	}
+	first := outermost[0]
+	for _, mem := range outermost[1:] {
+		if mem.className != first.className || mem.name != first.name || mem.arguments != first.arguments {
+			return nil, false
+		}
+	}
+	f := c.frame(first, 0)
+	f.Line = 0
+	return []Frame{f}, true
+}
+
+func (c *class) frame(mem member, line uint32) Frame {
+	f := Frame{
+		ClassName:  c.name,
+		Method:     mem.name,
+		Signature:  descriptor(mem.arguments, mem.returnType),
+		SourceFile: c.sourceFile,
+		Line:       mem.originalStartLine,
+	}
+	if mem.className != "" && mem.className != c.name {
+		f.ClassName = mem.className
+		f.SourceFile = ""
+	}
+	if mem.originalEndLine > mem.originalStartLine && line >= mem.startLine {
+		f.Line = mem.originalStartLine + line - mem.startLine
+	}
+	return f
+}
+
+// Signature replaces obfuscated class names in a JVM method descriptor like
+// (La/b;I)V with their original names.
+func (m *Mapping) Signature(signature string) string {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(signature, 'L')
+		if start == -1 {
+			break
+		}
+		end := strings.IndexByte(signature[start:], ';')
+		if end == -1 {
+			break
+		}
+		end += start
+		b.WriteString(signature[:start+1])
+		name := strings.ReplaceAll(signature[start+1:end], "/", ".")
+		if original, exists := m.Class(name); exists {
+			name = original
+		}
+		b.WriteString(strings.ReplaceAll(name, ".", "/"))
+		b.WriteByte(';')
+		signature = signature[end+1:]
+	}
+	b.WriteString(signature)
+	return b.String()
+}
+
+var primitiveDescriptors = map[string]string{
+	"boolean": "Z",
+	"byte":    "B",
+	"char":    "C",
+	"double":  "D",
+	"float":   "F",
+	"int":     "I",
+	"long":    "J",
+	"short":   "S",
+	"void":    "V",
+}
+
+// descriptor returns the JVM descriptor of a method from the Java types of
+// its arguments and return type.
+func descriptor(arguments, returnType string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	if arguments != "" {
+		for _, argument := range strings.Split(arguments, ",") {
+			b.WriteString(typeDescriptor(strings.TrimSpace(argument)))
+		}
+	}
+	b.WriteByte(')')
+	b.WriteString(typeDescriptor(returnType))
+	return b.String()
+}
+
+func typeDescriptor(t string) string {
+	var prefix strings.Builder
+	for strings.HasSuffix(t, "[]") {
+		prefix.WriteByte('[')
+		t = strings.TrimSuffix(t, "[]")
+	}
+	if d, exists := primitiveDescriptors[t]; exists {
+		return prefix.String() + d
+	}
+	return prefix.String() + "L" + strings.ReplaceAll(t, ".", "/") + ";"
+}
+
+func reverse(frames []Frame) {
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+}
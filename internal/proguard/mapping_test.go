@@ -0,0 +1,221 @@
+package proguard
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gocloud.dev/blob"
+	_ "gocloud.dev/blob/fileblob"
+
+	"github.com/getsentry/vroom/internal/debugmeta"
+	"github.com/getsentry/vroom/internal/testutil"
+)
+
+const testMapping = `# compiler: R8
+io.sentry.sample.MainActivity -> io.sentry.sample.MainActivity:
+# {"id":"sourceFile","fileName":"MainActivity.kt"}
+    int counter -> a
+    1:1:void <init>():12:12 -> <init>
+    1:4:void onCreate(android.os.Bundle):20:23 -> onCreate
+io.sentry.sample.Worker -> a.b:
+# {"id":"sourceFile","fileName":"Worker.kt"}
+    1:1:java.lang.String format(int[]):40:40 -> a
+    1:1:void run(io.sentry.sample.Worker):30 -> a
+    2:2:void io.sentry.sample.Util.log(java.lang.String):7:7 -> a
+    2:2:void run(io.sentry.sample.Worker):31 -> a
+    3:5:void run(io.sentry.sample.Worker):32:34 -> a
+    void stop() -> b
+    void stop(int) -> b
+io.sentry.sample.Util -> a.c:
+`
+
+func TestRemap(t *testing.T) {
+	m, err := Parse(strings.NewReader(testMapping))
+	if err != nil {
+		t.Fatalf("couldn't parse mapping: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		className string
+		method    string
+		line      uint32
+		want      []Frame
+		wantOK    bool
+	}{
+		{
+			name:      "unobfuscated class with original lines",
+			className: "io.sentry.sample.MainActivity",
+			method:    "onCreate",
+			line:      3,
+			want: []Frame{
+				{
+					ClassName:  "io.sentry.sample.MainActivity",
+					Method:     "onCreate",
+					Signature:  "(Landroid/os/Bundle;)V",
+					SourceFile: "MainActivity.kt",
+					Line:       22,
+				},
+			},
+			wantOK: true,
+		},
+		{
+			name:      "inlined frames",
+			className: "a.b",
+			method:    "a",
+			line:      2,
+			want: []Frame{
+				{
+					ClassName:  "io.sentry.sample.Worker",
+					Method:     "run",
+					Signature:  "(Lio/sentry/sample/Worker;)V",
+					SourceFile: "Worker.kt",
+					Line:       31,
+				},
+				{
+					ClassName: "io.sentry.sample.Util",
+					Method:    "log",
+					Signature: "(Ljava/lang/String;)V",
+					Line:      7,
+				},
+			},
+			wantOK: true,
+		},
+		{
+			name:      "line in a range",
+			className: "a.b",
+			method:    "a",
+			line:      4,
+			want: []Frame{
+				{
+					ClassName:  "io.sentry.sample.Worker",
+					Method:     "run",
+					Signature:  "(Lio/sentry/sample/Worker;)V",
+					SourceFile: "Worker.kt",
+					Line:       33,
+				},
+			},
+			wantOK: true,
+		},
+		{
+			name:      "no line with a single outer method",
+			className: "a.b",
+			method:    "a",
+			want: []Frame{
+				{
+					ClassName:  "io.sentry.sample.Worker",
+					Method:     "run",
+					Signature:  "(Lio/sentry/sample/Worker;)V",
+					SourceFile: "Worker.kt",
+				},
+			},
+			wantOK: true,
+		},
+		{
+			name:      "ambiguous overloads",
+			className: "a.b",
+			method:    "b",
+		},
+		{
+			name:      "unknown method",
+			className: "a.b",
+			method:    "z",
+		},
+		{
+			name:      "unknown class",
+			className: "a.z",
+			method:    "a",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := m.Remap(test.className, test.method, test.line)
+			if ok != test.wantOK {
+				t.Fatalf("expected %v, got %v", test.wantOK, ok)
+			}
+			if diff := testutil.Diff(got, test.want); diff != "" {
+				t.Fatalf("Result mismatch: got - want +\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSignature(t *testing.T) {
+	m, err := Parse(strings.NewReader(testMapping))
+	if err != nil {
+		t.Fatalf("couldn't parse mapping: %v", err)
+	}
+	got := m.Signature("(La/b;[La/c;ILjava/lang/String;)La/b;")
+	want := "(Lio/sentry/sample/Worker;[Lio/sentry/sample/Util;ILjava/lang/String;)Lio/sentry/sample/Worker;"
+	if got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "empty", input: "# only a comment\n"},
+		{name: "member without a class", input: "    void run() -> a\n"},
+		{name: "invalid class", input: "io.sentry.Main\n"},
+		{name: "invalid line range", input: "a -> b:\n    x:1:void run() -> a\n"},
+		{name: "parenthesis only in the obfuscated name", input: "a.B -> c:\n    int foo -> b(\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(test.input))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestLoader(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "8f4b0a6a-3e5b-4b8c-9a8e-0f1d2c3b4a59.txt"), []byte(testMapping), 0o600)
+	if err != nil {
+		t.Fatalf("couldn't write mapping: %v", err)
+	}
+	bucket, err := blob.OpenBucket(context.Background(), "file://"+dir)
+	if err != nil {
+		t.Fatalf("couldn't open bucket: %v", err)
+	}
+	defer bucket.Close()
+
+	l := NewLoader(bucket, 1)
+	m, err := l.Load(context.Background(), "8F4B0A6A-3E5B-4B8C-9A8E-0F1D2C3B4A59")
+	if err != nil {
+		t.Fatalf("couldn't load mapping: %v", err)
+	}
+	if again, _ := l.Load(context.Background(), "8f4b0a6a-3e5b-4b8c-9a8e-0f1d2c3b4a59"); again != m {
+		t.Fatal("expected the cached mapping")
+	}
+	_, err = l.Load(context.Background(), "missing")
+	if !errors.Is(err, ErrMappingNotFound) {
+		t.Fatalf("expected ErrMappingNotFound, got %v", err)
+	}
+}
+
+func TestMappingID(t *testing.T) {
+	dm := debugmeta.DebugMeta{
+		Images: []debugmeta.Image{
+			{Type: "macho", UUID: "a"},
+			{Type: "proguard", UUID: "b"},
+		},
+	}
+	if id := MappingID("", dm); id != "b" {
+		t.Fatalf("expected b, got %s", id)
+	}
+	if id := MappingID("c", dm); id != "c" {
+		t.Fatalf("expected c, got %s", id)
+	}
+}
@@ -0,0 +1,223 @@
+package quantile
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"unsafe"
+)
+
+const (
+	// RelativeAccuracy is the maximum relative error of a quantile.
+	RelativeAccuracy = 0.01
+	// maxBins bounds the memory used by a sketch. When exceeded, the lowest
+	// bins are collapsed and low quantiles lose accuracy.
+	maxBins = 2048
+)
+
+var (
+	gamma    = (1 + RelativeAccuracy) / (1 - RelativeAccuracy)
+	logGamma = math.Log(gamma)
+
+	binSize    = int(unsafe.Sizeof(bin{}))
+	sketchSize = int(unsafe.Sizeof(Sketch{}))
+
+	ErrEmptySketch     = errors.New("cannot compute percentile from empty list")
+	ErrInvalidQuantile = errors.New("q must be a value between 0 and 1.0")
+)
+
+type (
+	// Sketch is a DDSketch of durations. Values are counted in bins growing
+	// exponentially so each quantile is returned with a relative error of at
+	// most RelativeAccuracy, whatever the number of values added. Sketches
+	// can be merged without losing accuracy.
+	Sketch struct {
+		// bins are sorted by index.
+		bins  []bin
+		zeros uint64
+		count uint64
+		min   uint64
+		max   uint64
+	}
+
+	bin struct {
+		index int32
+		count uint64
+	}
+)
+
+// New returns an empty sketch.
+func New() *Sketch {
+	return &Sketch{}
+}
+
+// Of returns a sketch holding values.
+func Of(values ...uint64) *Sketch {
+	s := New()
+	for _, v := range values {
+		s.Add(v)
+	}
+	return s
+}
+
+// Add adds a value to the sketch.
+func (s *Sketch) Add(v uint64) {
+	if s.count == 0 || v < s.min {
+		s.min = v
+	}
+	if v > s.max {
+		s.max = v
+	}
+	s.count++
+	if v == 0 {
+		s.zeros++
+		return
+	}
+	index := binIndex(v)
+	i := sort.Search(len(s.bins), func(i int) bool {
+		return s.bins[i].index >= index
+	})
+	if i < len(s.bins) && s.bins[i].index == index {
+		s.bins[i].count++
+		return
+	}
+	s.bins = append(s.bins, bin{})
+	copy(s.bins[i+1:], s.bins[i:])
+	s.bins[i] = bin{index: index, count: 1}
+	s.collapse()
+}
+
+// Merge adds all the values of o to the sketch.
+func (s *Sketch) Merge(o *Sketch) {
+	if o == nil || o.count == 0 {
+		return
+	}
+	if s.count == 0 || o.min < s.min {
+		s.min = o.min
+	}
+	if o.max > s.max {
+		s.max = o.max
+	}
+	s.count += o.count
+	s.zeros += o.zeros
+
+	merged := make([]bin, 0, len(s.bins)+len(o.bins))
+	i, j := 0, 0
+	for i < len(s.bins) && j < len(o.bins) {
+		switch {
+		case s.bins[i].index < o.bins[j].index:
+			merged = append(merged, s.bins[i])
+			i++
+		case s.bins[i].index > o.bins[j].index:
+			merged = append(merged, o.bins[j])
+			j++
+		default:
+			merged = append(merged, bin{
+				index: s.bins[i].index,
+				count: s.bins[i].count + o.bins[j].count,
+			})
+			i++
+			j++
+		}
+	}
+	merged = append(merged, s.bins[i:]...)
+	merged = append(merged, o.bins[j:]...)
+	s.bins = merged
+	s.collapse()
+}
+
+// collapse merges the lowest bins together when there are too many.
+func (s *Sketch) collapse() {
+	if len(s.bins) <= maxBins {
+		return
+	}
+	excess := len(s.bins) - maxBins
+	for _, b := range s.bins[:excess] {
+		s.bins[excess].count += b.count
+	}
+	s.bins = append(s.bins[:0], s.bins[excess:]...)
+}
+
+// Quantile returns the value at quantile q. Like with a sorted slice of
+// values, it's the value at index ceil(count * q) - 1.
+func (s *Sketch) Quantile(q float64) (uint64, error) {
+	if s == nil || s.count == 0 {
+		return 0, ErrEmptySketch
+	}
+	if q <= 0 || q > 1.0 {
+		return 0, ErrInvalidQuantile
+	}
+	rank := uint64(math.Ceil(float64(s.count)*q)) - 1
+	if rank < s.zeros {
+		return 0, nil
+	}
+	seen := s.zeros
+	for _, b := range s.bins {
+		seen += b.count
+		if rank < seen {
+			return s.clamp(binValue(b.index)), nil
+		}
+	}
+	return s.max, nil
+}
+
+// Count returns the number of values added.
+func (s *Sketch) Count() uint64 {
+	if s == nil {
+		return 0
+	}
+	return s.count
+}
+
+// Clone returns a copy of the sketch, nil if s is nil.
+func (s *Sketch) Clone() *Sketch {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	c.bins = append([]bin(nil), s.bins...)
+	return &c
+}
+
+// SizeBytes returns an estimate of the memory used by the sketch.
+func (s *Sketch) SizeBytes() int {
+	if s == nil {
+		return 0
+	}
+	return sketchSize + cap(s.bins)*binSize
+}
+
+// Equal returns true when both sketches hold the same values.
+func (s *Sketch) Equal(o *Sketch) bool {
+	if s == nil || o == nil {
+		return s == o
+	}
+	if s.count != o.count || s.zeros != o.zeros || s.min != o.min || s.max != o.max {
+		return false
+	}
+	if len(s.bins) != len(o.bins) {
+		return false
+	}
+	for i := range s.bins {
+		if s.bins[i] != o.bins[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Sketch) clamp(v uint64) uint64 {
+	return min(max(v, s.min), s.max)
+}
+
+// binIndex returns the index of the bin holding v, the bin holding values
+// in (gamma^(index-1), gamma^index].
+func binIndex(v uint64) int32 {
+	return int32(math.Ceil(math.Log(float64(v)) / logGamma))
+}
+
+// binValue returns the value of a bin with the lowest relative error for
+// all the values it holds.
+func binValue(index int32) uint64 {
+	return uint64(math.Round(2 * math.Pow(gamma, float64(index)) / (gamma + 1)))
+}
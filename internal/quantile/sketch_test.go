@@ -0,0 +1,94 @@
+package quantile
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func exactQuantile(values []uint64, q float64) uint64 {
+	return values[int(math.Ceil(float64(len(values))*q))-1]
+}
+
+func TestSketchQuantile(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []uint64
+	}{
+		{
+			name:   "small values",
+			values: []uint64{1, 2, 3, 4, 10, 8, 7, 11, 20},
+		},
+		{
+			name:   "zeros",
+			values: []uint64{0, 0, 0, 5},
+		},
+		{
+			name:   "single value",
+			values: []uint64{123456789},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := Of(test.values...)
+			sorted := append([]uint64(nil), test.values...)
+			sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+			for _, q := range []float64{0.5, 0.75, 0.95, 0.99, 1} {
+				got, err := s.Quantile(q)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := exactQuantile(sorted, q); got != want {
+					t.Fatalf("p%v: expected %d, got %d", q*100, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSketchRelativeAccuracy(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	values := make([]uint64, 0, 100000)
+	a, b := New(), New()
+	for i := 0; i < cap(values); i++ {
+		v := uint64(r.ExpFloat64() * 1e7)
+		values = append(values, v)
+		// Merging two halves has to give the same result as one sketch.
+		if i%2 == 0 {
+			a.Add(v)
+		} else {
+			b.Add(v)
+		}
+	}
+	a.Merge(b)
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	if a.Count() != uint64(len(values)) {
+		t.Fatalf("expected %d values, got %d", len(values), a.Count())
+	}
+	for _, q := range []float64{0.5, 0.75, 0.95, 0.99} {
+		got, err := a.Quantile(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := exactQuantile(values, q)
+		if e := math.Abs(float64(got)-float64(want)) / float64(want); e > RelativeAccuracy {
+			t.Fatalf("p%v: expected %d with a relative error of %v, got %d", q*100, want, RelativeAccuracy, got)
+		}
+	}
+	if len(a.bins) > maxBins {
+		t.Fatalf("expected at most %d bins, got %d", maxBins, len(a.bins))
+	}
+}
+
+func TestSketchEmpty(t *testing.T) {
+	var s *Sketch
+	if _, err := s.Quantile(0.5); err != ErrEmptySketch {
+		t.Fatalf("expected %v, got %v", ErrEmptySketch, err)
+	}
+	if _, err := Of(1).Quantile(0); err != ErrInvalidQuantile {
+		t.Fatalf("expected %v, got %v", ErrInvalidQuantile, err)
+	}
+}
@@ -0,0 +1,220 @@
+package regression
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/getsentry/vroom/internal/examples"
+	"github.com/getsentry/vroom/internal/occurrence"
+)
+
+const (
+	// DefaultMinPointsPerSide is the number of points required on each side
+	// of a breakpoint when not set.
+	DefaultMinPointsPerSide = 3
+	// DefaultMaxPValue is the highest p-value of a regression when not set.
+	DefaultMaxPValue = 0.01
+	// DefaultMinChange is the lowest relative change of a regression when
+	// not set, 0.1 being a 10% increase.
+	DefaultMinChange = 0.1
+)
+
+var (
+	ErrInvalidMinPointsPerSide = errors.New("min_points_per_side has to be at least 2")
+	ErrInvalidMaxPValue        = errors.New("max_p_value has to be between 0 and 1")
+	ErrInvalidMinChange        = errors.New("min_change can't be negative")
+)
+
+type (
+	// Point is the aggregated duration of a function, like its p95, over a
+	// time bucket starting at Timestamp.
+	Point struct {
+		Timestamp uint64  `json:"timestamp"`
+		Value     float64 `json:"value"`
+		// Example is a profile where the function ran during the bucket.
+		Example examples.ExampleMetadata `json:"example"`
+	}
+
+	// Series is the durations of a function over time.
+	Series struct {
+		ProjectID   uint64  `json:"project_id"`
+		Fingerprint uint32  `json:"fingerprint"`
+		Points      []Point `json:"points"`
+	}
+
+	// SeriesKey identifies the series of a function in a project, the same
+	// function being tracked separately in each project.
+	SeriesKey struct {
+		ProjectID   uint64
+		Fingerprint uint32
+	}
+
+	// Options controls which breakpoints are reported as regressions.
+	Options struct {
+		// MinPointsPerSide is the number of points required before and
+		// after a breakpoint.
+		MinPointsPerSide int `json:"min_points_per_side"`
+		// MaxPValue is the highest p-value of the t-test comparing both
+		// sides of a breakpoint.
+		MaxPValue float64 `json:"max_p_value"`
+		// MinChange is the lowest increase of the mean relative to the mean
+		// before the breakpoint.
+		MinChange float64 `json:"min_change"`
+	}
+
+	breakpoint struct {
+		index  int
+		before float64
+		after  float64
+		tValue float64
+		pValue float64
+	}
+)
+
+// Validate returns an error if the options are out of bounds.
+func (o Options) Validate() error {
+	if o.MinPointsPerSide < 0 || o.MinPointsPerSide == 1 {
+		return ErrInvalidMinPointsPerSide
+	}
+	if o.MaxPValue < 0 || o.MaxPValue > 1 {
+		return ErrInvalidMaxPValue
+	}
+	if o.MinChange < 0 {
+		return ErrInvalidMinChange
+	}
+	return nil
+}
+
+func (o Options) withDefaults() Options {
+	if o.MinPointsPerSide == 0 {
+		o.MinPointsPerSide = DefaultMinPointsPerSide
+	}
+	if o.MaxPValue == 0 {
+		o.MaxPValue = DefaultMaxPValue
+	}
+	if o.MinChange == 0 {
+		o.MinChange = DefaultMinChange
+	}
+	return o
+}
+
+// AddMetrics adds the p95 of the functions of a project aggregated over the
+// time bucket starting at timestamp to their series.
+func AddMetrics(
+	series map[SeriesKey]*Series,
+	projectID uint64,
+	timestamp uint64,
+	metrics []examples.FunctionMetrics,
+) {
+	for _, m := range metrics {
+		key := SeriesKey{ProjectID: projectID, Fingerprint: m.Fingerprint}
+		s, ok := series[key]
+		if !ok {
+			s = &Series{
+				ProjectID:   projectID,
+				Fingerprint: m.Fingerprint,
+			}
+			series[key] = s
+		}
+		s.Points = append(s.Points, Point{
+			Timestamp: timestamp,
+			Value:     float64(m.P95),
+			Example:   m.Worst,
+		})
+	}
+}
+
+// Merge returns one series per key, with the points of all the series
+// sharing it, in the order each key first appears.
+func Merge(series ...[]Series) []Series {
+	merged := []Series{}
+	indexes := make(map[SeriesKey]int)
+	for _, list := range series {
+		for _, s := range list {
+			key := SeriesKey{ProjectID: s.ProjectID, Fingerprint: s.Fingerprint}
+			i, ok := indexes[key]
+			if !ok {
+				indexes[key] = len(merged)
+				merged = append(merged, Series{
+					ProjectID:   s.ProjectID,
+					Fingerprint: s.Fingerprint,
+				})
+				i = len(merged) - 1
+			}
+			merged[i].Points = append(merged[i].Points, s.Points...)
+		}
+	}
+	return merged
+}
+
+// Detect looks for a regression in each series and returns the regressed
+// functions, ready to be turned into occurrences.
+func Detect(organizationID uint64, series []Series, o Options) []occurrence.RegressedFunction {
+	o = o.withDefaults()
+	regressed := []occurrence.RegressedFunction{}
+	for _, s := range series {
+		points := make([]Point, len(s.Points))
+		copy(points, s.Points)
+		sort.Slice(points, func(i, j int) bool {
+			return points[i].Timestamp < points[j].Timestamp
+		})
+		b, ok := findBreakpoint(points, o)
+		if !ok {
+			continue
+		}
+		regressed = append(regressed, occurrence.RegressedFunction{
+			OrganizationID:           organizationID,
+			ProjectID:                s.ProjectID,
+			Example:                  worstExample(points[b.index:]),
+			Fingerprint:              s.Fingerprint,
+			AbsolutePercentageChange: math.Abs(b.after-b.before) / b.before,
+			AggregateRange1:          b.before,
+			AggregateRange2:          b.after,
+			Breakpoint:               points[b.index].Timestamp,
+			TrendDifference:          b.after - b.before,
+			TrendPercentage:          b.after / b.before,
+			UnweightedPValue:         b.pValue,
+			UnweightedTValue:         b.tValue,
+		})
+	}
+	return regressed
+}
+
+// findBreakpoint sweeps the points and runs a Welch's t-test between the
+// points before and after each of them. The split with the highest t-value
+// is the breakpoint, reported if it's significant and large enough.
+func findBreakpoint(points []Point, o Options) (breakpoint, bool) {
+	values := make([]float64, len(points))
+	for i, p := range points {
+		values[i] = p.Value
+	}
+	best := breakpoint{tValue: math.Inf(-1)}
+	for i := o.MinPointsPerSide; i <= len(values)-o.MinPointsPerSide; i++ {
+		t, p := welchTTest(values[:i], values[i:])
+		if t <= best.tValue {
+			continue
+		}
+		before, _ := meanAndVariance(values[:i])
+		after, _ := meanAndVariance(values[i:])
+		best = breakpoint{index: i, before: before, after: after, tValue: t, pValue: p}
+	}
+	if math.IsInf(best.tValue, -1) || best.before <= 0 {
+		return best, false
+	}
+	if best.pValue > o.MaxPValue || (best.after-best.before)/best.before < o.MinChange {
+		return best, false
+	}
+	return best, true
+}
+
+// worstExample returns the example of the slowest point.
+func worstExample(points []Point) examples.ExampleMetadata {
+	worst := points[0]
+	for _, p := range points[1:] {
+		if p.Value > worst.Value {
+			worst = p
+		}
+	}
+	return worst.Example
+}
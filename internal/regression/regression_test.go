@@ -0,0 +1,146 @@
+package regression
+
+import (
+	"testing"
+
+	"github.com/getsentry/vroom/internal/examples"
+)
+
+func newSeries(values ...float64) Series {
+	points := make([]Point, 0, len(values))
+	for i, v := range values {
+		points = append(points, Point{
+			Timestamp: uint64(1000 + i*60),
+			Value:     v,
+			Example:   examples.ExampleMetadata{ProjectID: 2, ProfileID: string(rune('a' + i))},
+		})
+	}
+	return Series{ProjectID: 2, Fingerprint: 42, Points: points}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name       string
+		series     Series
+		options    Options
+		regressed  bool
+		breakpoint uint64
+		example    string
+	}{
+		{
+			name:       "step increase",
+			series:     newSeries(100, 102, 98, 101, 99, 100, 150, 152, 149, 151, 155, 148),
+			regressed:  true,
+			breakpoint: 1360,
+			example:    "k",
+		},
+		{
+			name:   "flat",
+			series: newSeries(100, 102, 98, 101, 99, 100, 101, 99, 100, 102, 98, 100),
+		},
+		{
+			name:   "step decrease",
+			series: newSeries(150, 152, 149, 151, 155, 148, 100, 102, 98, 101, 99, 100),
+		},
+		{
+			name:    "increase below the minimum change",
+			series:  newSeries(100, 102, 98, 101, 99, 100, 150, 152, 149, 151, 155, 148),
+			options: Options{MinChange: 1},
+		},
+		{
+			name:   "not enough points",
+			series: newSeries(100, 100, 150, 150),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			regressed := Detect(1, []Series{test.series}, test.options)
+			if !test.regressed {
+				if len(regressed) != 0 {
+					t.Fatalf("expected no regression, got %+v", regressed)
+				}
+				return
+			}
+			if len(regressed) != 1 {
+				t.Fatalf("expected a regression, got %d", len(regressed))
+			}
+			r := regressed[0]
+			if r.OrganizationID != 1 || r.ProjectID != 2 || r.Fingerprint != 42 {
+				t.Fatalf("unexpected function %+v", r)
+			}
+			if r.Breakpoint != test.breakpoint {
+				t.Fatalf("expected breakpoint %d, got %d", test.breakpoint, r.Breakpoint)
+			}
+			if r.Example.ProfileID != test.example {
+				t.Fatalf("expected example %s, got %s", test.example, r.Example.ProfileID)
+			}
+			if r.AggregateRange2 <= r.AggregateRange1 || r.UnweightedPValue > DefaultMaxPValue {
+				t.Fatalf("unexpected statistics %+v", r)
+			}
+		})
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		err     error
+	}{
+		{name: "defaults", options: Options{}},
+		{name: "one point per side", options: Options{MinPointsPerSide: 1}, err: ErrInvalidMinPointsPerSide},
+		{name: "p-value above 1", options: Options{MaxPValue: 2}, err: ErrInvalidMaxPValue},
+		{name: "negative change", options: Options{MinChange: -1}, err: ErrInvalidMinChange},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.options.Validate(); err != test.err {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestAddMetrics(t *testing.T) {
+	series := make(map[SeriesKey]*Series)
+	AddMetrics(series, 2, 1000, []examples.FunctionMetrics{{Fingerprint: 42, P95: 100}})
+	AddMetrics(series, 3, 1000, []examples.FunctionMetrics{{Fingerprint: 42, P95: 200}})
+	AddMetrics(series, 2, 1060, []examples.FunctionMetrics{{Fingerprint: 42, P95: 110}})
+
+	if len(series) != 2 {
+		t.Fatalf("expected a series per project, got %d", len(series))
+	}
+	s := series[SeriesKey{ProjectID: 2, Fingerprint: 42}]
+	if s == nil || s.ProjectID != 2 || len(s.Points) != 2 || s.Points[1].Value != 110 {
+		t.Fatalf("unexpected series %+v", s)
+	}
+	s = series[SeriesKey{ProjectID: 3, Fingerprint: 42}]
+	if s == nil || s.ProjectID != 3 || len(s.Points) != 1 || s.Points[0].Value != 200 {
+		t.Fatalf("unexpected series %+v", s)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	caller := newSeries(100, 102)
+	other := Series{ProjectID: 3, Fingerprint: 42, Points: []Point{{Timestamp: 1000, Value: 200}}}
+	buckets := []Series{
+		{ProjectID: 2, Fingerprint: 42, Points: []Point{{Timestamp: 1120, Value: 150}}},
+		other,
+	}
+
+	merged := Merge([]Series{caller}, buckets)
+	if len(merged) != 2 {
+		t.Fatalf("expected a series per key, got %d", len(merged))
+	}
+	if merged[0].ProjectID != 2 || len(merged[0].Points) != 3 || merged[0].Points[2].Value != 150 {
+		t.Fatalf("unexpected series %+v", merged[0])
+	}
+	if merged[1].ProjectID != 3 || len(merged[1].Points) != 1 {
+		t.Fatalf("unexpected series %+v", merged[1])
+	}
+	if len(caller.Points) != 2 {
+		t.Fatalf("expected the series to not be modified, got %+v", caller)
+	}
+}
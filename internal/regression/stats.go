@@ -0,0 +1,125 @@
+package regression
+
+import (
+	"math"
+)
+
+// welchTTest returns the t-value of Welch's t-test between two samples and
+// the one-sided p-value of the second sample having a higher mean.
+func welchTTest(before, after []float64) (float64, float64) {
+	m1, v1 := meanAndVariance(before)
+	m2, v2 := meanAndVariance(after)
+	n1, n2 := float64(len(before)), float64(len(after))
+
+	se1, se2 := v1/n1, v2/n2
+	se := se1 + se2
+	if se == 0 {
+		// Both samples are constant, the difference is certain. The t-value
+		// is kept finite so it can be serialized.
+		switch {
+		case m2 > m1:
+			return math.MaxFloat64, 0
+		case m2 < m1:
+			return -math.MaxFloat64, 1
+		default:
+			return 0, 0.5
+		}
+	}
+	t := (m2 - m1) / math.Sqrt(se)
+	df := se * se / (se1*se1/(n1-1) + se2*se2/(n2-1))
+	return t, studentTSurvival(t, df)
+}
+
+// meanAndVariance returns the mean and the unbiased variance of values.
+func meanAndVariance(values []float64) (float64, float64) {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	if len(values) < 2 {
+		return mean, 0
+	}
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	return mean, squares / float64(len(values)-1)
+}
+
+// studentTSurvival returns P(T > t) for a Student's t distribution with df
+// degrees of freedom.
+func studentTSurvival(t, df float64) float64 {
+	p := 0.5 * regularizedIncompleteBeta(df/(df+t*t), df/2, 0.5)
+	if t < 0 {
+		return 1 - p
+	}
+	return p
+}
+
+// regularizedIncompleteBeta returns I_x(a, b), evaluated with a continued
+// fraction as described in Numerical Recipes.
+func regularizedIncompleteBeta(x, a, b float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	// The continued fraction converges quickly on this side only.
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(x, a, b) / a
+	}
+	return 1 - front*betaContinuedFraction(1-x, b, a)/b
+}
+
+func betaContinuedFraction(x, a, b float64) float64 {
+	const (
+		maxIterations = 200
+		epsilon       = 1e-14
+		tiny          = 1e-300
+	)
+	c := 1.0
+	d := 1 - (a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m <= maxIterations; m++ {
+		fm := float64(m)
+		// Even step.
+		num := fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm))
+		d = 1 + num*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + num/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+		// Odd step.
+		num = -(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1))
+		d = 1 + num*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + num/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+	return h
+}
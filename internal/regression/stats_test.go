@@ -0,0 +1,41 @@
+package regression
+
+import (
+	"math"
+	"testing"
+)
+
+func TestStudentTSurvival(t *testing.T) {
+	tests := []struct {
+		name string
+		t    float64
+		df   float64
+		want float64
+	}{
+		{name: "zero", t: 0, df: 10, want: 0.5},
+		{name: "positive", t: 2, df: 10, want: 0.036694},
+		{name: "negative", t: -2, df: 10, want: 0.963306},
+		{name: "large df", t: 1.96, df: 1e6, want: 0.024998},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := studentTSurvival(test.t, test.df)
+			if math.Abs(got-test.want) > 1e-5 {
+				t.Fatalf("expected %f, got %f", test.want, got)
+			}
+		})
+	}
+}
+
+func TestWelchTTest(t *testing.T) {
+	before := []float64{19.8, 20.4, 19.6, 17.8, 18.5, 18.9, 18.3, 18.9, 19.5, 22.0}
+	after := []float64{28.2, 26.6, 20.1, 23.3, 25.2, 22.1, 17.7, 27.6, 20.6, 13.7}
+	tValue, pValue := welchTTest(before, after)
+	if math.Abs(tValue-2.0740) > 1e-3 {
+		t.Fatalf("expected a t-value of 2.0740, got %f", tValue)
+	}
+	if math.Abs(pValue-0.0321) > 1e-3 {
+		t.Fatalf("expected a p-value of 0.0321, got %f", pValue)
+	}
+}
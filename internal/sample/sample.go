@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"hash/fnv"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -190,11 +191,23 @@ func (p Profile) GetDurationNS() uint64 {
 	return p.Trace.Samples[maxSampleIndex].ElapsedSinceStartNS - p.Trace.Samples[0].ElapsedSinceStartNS
 }
 
+// sortedSamples returns samples sorted by time. Unsorted samples are sorted in
+// a copy since profiles read from the cache are shared.
+func sortedSamples(samples []Sample) []Sample {
+	less := func(i, j int) bool {
+		return samples[i].ElapsedSinceStartNS < samples[j].ElapsedSinceStartNS
+	}
+	if sort.SliceIsSorted(samples, less) {
+		return samples
+	}
+	samples = slices.Clone(samples)
+	sort.SliceStable(samples, less)
+	return samples
+}
+
 // CallTrees generates call trees from samples.
 func (p Profile) CallTrees() (map[uint64][]*nodetree.Node, error) {
-	sort.SliceStable(p.Trace.Samples, func(i, j int) bool {
-		return p.Trace.Samples[i].ElapsedSinceStartNS < p.Trace.Samples[j].ElapsedSinceStartNS
-	})
+	p.Trace.Samples = sortedSamples(p.Trace.Samples)
 
 	activeThreadID := p.Transaction.ActiveThreadID
 	treesByThreadID := make(map[uint64][]*nodetree.Node)
@@ -286,9 +299,9 @@ func (p *Profile) IsSampleFormat() bool {
 }
 
 func (p *Profile) Speedscope() (speedscope.Output, error) {
-	sort.SliceStable(p.Trace.Samples, func(i, j int) bool {
-		return p.Trace.Samples[i].ElapsedSinceStartNS < p.Trace.Samples[j].ElapsedSinceStartNS
-	})
+	sorted := *p
+	sorted.Trace.Samples = sortedSamples(p.Trace.Samples)
+	p = &sorted
 
 	threadIDToProfile := make(map[uint64]*speedscope.SampledProfile)
 	addressToFrameIndex := make(map[string]int)
@@ -322,6 +335,18 @@ func (p *Profile) Speedscope() (speedscope.Output, error) {
 		speedscopeProfile.EndValue = sample.ElapsedSinceStartNS
 		threadIDToPreviousTimestampNS[sample.ThreadID] = sample.ElapsedSinceStartNS
 
+		if m, exists := p.Trace.QueueMetadata[sample.QueueAddress]; exists {
+			if speedscopeProfile.Queues == nil {
+				speedscopeProfile.Queues = make(map[string]speedscope.Queue)
+			}
+			q, exists := speedscopeProfile.Queues[sample.QueueAddress]
+			if !exists {
+				q = speedscope.Queue{Label: m.Label, StartNS: sample.ElapsedSinceStartNS}
+			}
+			q.EndNS = sample.ElapsedSinceStartNS
+			speedscopeProfile.Queues[sample.QueueAddress] = q
+		}
+
 		samp := make([]int, 0, len(stack))
 		for i := len(stack) - 1; i >= 0; i-- {
 			fr := p.Trace.Frames[stack[i]]
@@ -426,6 +451,22 @@ func (p *Profile) Metadata() metadata.Metadata {
 	}
 }
 
+// SymbolicateJavaScript calls symbolicate on every frame needing a source
+// map and returns the first error, the other frames being symbolicated
+// anyway.
+func (p *Profile) SymbolicateJavaScript(symbolicate func(*frame.Frame) error) error {
+	var firstErr error
+	for i := range p.Trace.Frames {
+		if !p.Trace.Frames[i].NeedsSourceMap(p.Platform) {
+			continue
+		}
+		if err := symbolicate(&p.Trace.Frames[i]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
 func (p *Profile) Normalize() {
 	for i := range p.Trace.Frames {
 		f := p.Trace.Frames[i]
@@ -437,11 +478,19 @@ func (p *Profile) Normalize() {
 		p.Trace.trimCocoaStacks()
 	} else if p.Platform == platform.Python {
 		p.Trace.trimPythonStacks()
+	} else if p.Platform == platform.Go {
+		p.Trace.trimGoStacks()
 	}
 
 	p.Trace.ReplaceIdleStacks()
 }
 
+// Validate checks the samples only reference existing stacks and the stacks
+// only reference existing frames.
+func (p *Profile) Validate() error {
+	return p.Trace.Validate()
+}
+
 func (p *Profile) GetOptions() options.Options {
 	return p.Options
 }
@@ -575,6 +624,31 @@ func (s Stack) IsActive() bool {
 	return len(s) != 0
 }
 
+func (t Trace) Validate() error {
+	return ValidateIndexes(t.Stacks, t.Frames, t.Samples, func(s Sample) int {
+		return s.StackID
+	})
+}
+
+// ValidateIndexes checks the samples only reference existing stacks and the
+// stacks only reference existing frames, stackID returning the stack of a
+// sample.
+func ValidateIndexes[S any, T ~[]int](stacks []T, frames []frame.Frame, samples []S, stackID func(S) int) error {
+	for _, s := range samples {
+		if id := stackID(s); id < 0 || len(stacks) <= id {
+			return ErrInvalidStackID
+		}
+	}
+	for _, stack := range stacks {
+		for _, frameID := range stack {
+			if frameID < 0 || len(frames) <= frameID {
+				return ErrInvalidFrameID
+			}
+		}
+	}
+	return nil
+}
+
 func (t Trace) CollectFrames(stackID int) []frame.Frame {
 	stack := t.Stacks[stackID]
 	frames := make([]frame.Frame, 0, len(stack))
@@ -666,6 +740,43 @@ func (t *Trace) trimPythonStacks() {
 	}
 }
 
+// trimGoStacks removes the root frame of goroutines and the scheduler frames
+// at the top of the stacks of parked goroutines. Stacks only made of
+// scheduler frames become empty so the thread is considered idle.
+func (t *Trace) trimGoStacks() {
+	exits := make(map[int]struct{})
+	schedulers := make(map[int]struct{})
+	for i, f := range t.Frames {
+		if f.IsGoExitFrame() {
+			exits[i] = struct{}{}
+		} else if f.IsGoSchedulerFrame() {
+			schedulers[i] = struct{}{}
+		}
+	}
+
+	// We do nothing if there are no runtime frames
+	if len(exits) == 0 && len(schedulers) == 0 {
+		return
+	}
+
+	for si, s := range t.Stacks {
+		l := len(s)
+		if l > 0 {
+			if _, exists := exits[s[l-1]]; exists {
+				l--
+			}
+		}
+		i := 0
+		for i < l {
+			if _, exists := schedulers[s[i]]; !exists {
+				break
+			}
+			i++
+		}
+		t.Stacks[si] = s[i:l]
+	}
+}
+
 func (p RawProfile) GetTransactionMetadata() transaction.Metadata {
 	return p.TransactionMetadata
 }
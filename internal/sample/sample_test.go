@@ -1,12 +1,14 @@
 package sample
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/getsentry/vroom/internal/examples"
 	"github.com/getsentry/vroom/internal/frame"
 	"github.com/getsentry/vroom/internal/nodetree"
 	"github.com/getsentry/vroom/internal/platform"
+	"github.com/getsentry/vroom/internal/speedscope"
 	"github.com/getsentry/vroom/internal/testutil"
 	"github.com/getsentry/vroom/internal/transaction"
 )
@@ -379,7 +381,6 @@ func TestCallTrees(t *testing.T) {
 				1: {
 					{
 						DurationNS:    40,
-						DurationsNS:   []uint64{40},
 						EndNS:         50,
 						Fingerprint:   15444731332182868858,
 						IsApplication: true,
@@ -392,7 +393,6 @@ func TestCallTrees(t *testing.T) {
 						Children: []*nodetree.Node{
 							{
 								DurationNS:    40,
-								DurationsNS:   []uint64{40},
 								EndNS:         50,
 								StartNS:       10,
 								Fingerprint:   14164357600995800812,
@@ -405,7 +405,6 @@ func TestCallTrees(t *testing.T) {
 								Children: []*nodetree.Node{
 									{
 										DurationNS:    10,
-										DurationsNS:   []uint64{10},
 										EndNS:         50,
 										Fingerprint:   9531802423075301657,
 										IsApplication: true,
@@ -449,7 +448,6 @@ func TestCallTrees(t *testing.T) {
 				1: {
 					{
 						DurationNS:    30,
-						DurationsNS:   []uint64{30},
 						EndNS:         40,
 						Fingerprint:   15444731332182868858,
 						IsApplication: true,
@@ -462,7 +460,6 @@ func TestCallTrees(t *testing.T) {
 						Children: []*nodetree.Node{
 							{
 								DurationNS:    30,
-								DurationsNS:   []uint64{30},
 								EndNS:         40,
 								Fingerprint:   14164357600995800812,
 								IsApplication: true,
@@ -506,7 +503,6 @@ func TestCallTrees(t *testing.T) {
 				1: {
 					{
 						DurationNS:    10,
-						DurationsNS:   []uint64{10},
 						EndNS:         20,
 						Fingerprint:   15444731332182868858,
 						IsApplication: true,
@@ -519,7 +515,6 @@ func TestCallTrees(t *testing.T) {
 					},
 					{
 						DurationNS:    10,
-						DurationsNS:   []uint64{10},
 						EndNS:         30,
 						Fingerprint:   15444731332182868859,
 						IsApplication: true,
@@ -1263,7 +1258,6 @@ func TestCallTreesFingerprintPerPlatform(t *testing.T) {
 				0: {
 					{
 						DurationNS:    10,
-						DurationsNS:   []uint64{10},
 						EndNS:         10,
 						Fingerprint:   1628006971372193492,
 						IsApplication: false,
@@ -1319,7 +1313,6 @@ func TestCallTreesFingerprintPerPlatform(t *testing.T) {
 				0: {
 					{
 						DurationNS:    10,
-						DurationsNS:   []uint64{10},
 						EndNS:         10,
 						Fingerprint:   1628006971372193492,
 						IsApplication: true,
@@ -1377,7 +1370,6 @@ func TestCallTreesFingerprintPerPlatform(t *testing.T) {
 				0: {
 					{
 						DurationNS:    10,
-						DurationsNS:   []uint64{10},
 						EndNS:         10,
 						Fingerprint:   12857020554704472368,
 						IsApplication: false,
@@ -1414,3 +1406,129 @@ func TestCallTreesFingerprintPerPlatform(t *testing.T) {
 		})
 	}
 }
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		trace Trace
+		want  error
+	}{
+		{
+			name: "valid",
+			trace: Trace{
+				Frames:  []frame.Frame{{Function: "main"}},
+				Samples: []Sample{{StackID: 0}},
+				Stacks:  []Stack{{0}},
+			},
+		},
+		{
+			name: "unknown stack",
+			trace: Trace{
+				Frames:  []frame.Frame{{Function: "main"}},
+				Samples: []Sample{{StackID: 1}},
+				Stacks:  []Stack{{0}},
+			},
+			want: ErrInvalidStackID,
+		},
+		{
+			name: "negative stack",
+			trace: Trace{
+				Samples: []Sample{{StackID: -1}},
+				Stacks:  []Stack{{}},
+			},
+			want: ErrInvalidStackID,
+		},
+		{
+			name: "unknown frame",
+			trace: Trace{
+				Frames:  []frame.Frame{{Function: "main"}},
+				Samples: []Sample{{StackID: 0}},
+				Stacks:  []Stack{{0, 1}},
+			},
+			want: ErrInvalidFrameID,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.trace.Validate(); !errors.Is(err, test.want) {
+				t.Fatalf("expected %v, got %v", test.want, err)
+			}
+		})
+	}
+}
+
+func TestSymbolicateJavaScriptContinuesAfterError(t *testing.T) {
+	p := Profile{
+		RawProfile: RawProfile{
+			Platform: platform.JavaScript,
+			Trace: Trace{
+				Frames: []frame.Frame{
+					{Function: "a", Path: "broken.js", Line: 1},
+					{Function: "b", Path: "main.js", Line: 1},
+				},
+			},
+		},
+	}
+	errBroken := errors.New("broken source map")
+	err := p.SymbolicateJavaScript(func(f *frame.Frame) error {
+		if f.Path == "broken.js" {
+			return errBroken
+		}
+		f.Function = "render"
+		return nil
+	})
+	if !errors.Is(err, errBroken) {
+		t.Fatalf("expected %v, got %v", errBroken, err)
+	}
+	if p.Trace.Frames[1].Function != "render" {
+		t.Fatalf("expected the other frames to be symbolicated, got %+v", p.Trace.Frames[1])
+	}
+}
+
+func TestSpeedscopeQueues(t *testing.T) {
+	p := Profile{
+		RawProfile: RawProfile{
+			Platform: platform.Cocoa,
+			Transaction: transaction.Transaction{
+				ActiveThreadID: 1,
+			},
+			Trace: Trace{
+				Frames: []frame.Frame{
+					{Function: "main", InApp: &testutil.True, Platform: platform.Cocoa},
+				},
+				Samples: []Sample{
+					{StackID: 0, ThreadID: 1, ElapsedSinceStartNS: 0},
+					{StackID: 0, ThreadID: 2, ElapsedSinceStartNS: 10, QueueAddress: "0x1"},
+					{StackID: 0, ThreadID: 2, ElapsedSinceStartNS: 30, QueueAddress: "0x1"},
+					{StackID: 0, ThreadID: 1, ElapsedSinceStartNS: 40},
+				},
+				Stacks: []Stack{{0}},
+				QueueMetadata: map[string]QueueMetadata{
+					"0x1": {Label: "com.example.queue"},
+				},
+			},
+		},
+	}
+
+	output, err := p.Speedscope()
+	if err != nil {
+		t.Fatal(err)
+	}
+	queues := make(map[uint64]map[string]speedscope.Queue)
+	for _, profile := range output.Profiles {
+		sp, ok := profile.(*speedscope.SampledProfile)
+		if !ok {
+			t.Fatalf("expected a sampled profile, got %T", profile)
+		}
+		queues[sp.ThreadID] = sp.Queues
+	}
+	// Threads without a known queue don't get the field.
+	want := map[uint64]map[string]speedscope.Queue{
+		1: nil,
+		2: {"0x1": {Label: "com.example.queue", StartNS: 10, EndNS: 30}},
+	}
+	if diff := testutil.Diff(queues, want); diff != "" {
+		t.Fatalf("Result mismatch: got - want +\n%s", diff)
+	}
+}
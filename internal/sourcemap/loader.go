@@ -0,0 +1,106 @@
+package sourcemap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"gocloud.dev/blob"
+
+	"github.com/getsentry/vroom/internal/frame"
+	"github.com/getsentry/vroom/internal/storageutil"
+)
+
+var ErrSourceMapNotFound = errors.New("sourcemap: source map not found")
+
+type (
+	// Loader reads source maps from the bucket of profiles and keeps the most
+	// recently used ones parsed.
+	Loader struct {
+		loader *storageutil.Loader[*Map]
+	}
+
+	// Symbolicator resolves the frames of a release.
+	Symbolicator struct {
+		ctx            context.Context
+		loader         *Loader
+		organizationID uint64
+		projectID      uint64
+		release        string
+	}
+)
+
+// StoragePath returns where the source map of a minified file of a release is
+// stored, next to the profiles of the project. The file is its URL or path,
+// only its path being kept.
+func StoragePath(organizationID, projectID uint64, release, file string) string {
+	if u, err := url.Parse(file); err == nil {
+		file = u.Path
+	}
+	file = strings.TrimPrefix(path.Clean("/"+file), "/")
+	return fmt.Sprintf(
+		"%d/%d/sourcemaps/%s/%s.map",
+		organizationID,
+		projectID,
+		url.PathEscape(release),
+		url.PathEscape(file),
+	)
+}
+
+// NewLoader returns a loader keeping up to maxMaps parsed source maps.
+func NewLoader(bucket *blob.Bucket, maxMaps int) *Loader {
+	return &Loader{loader: storageutil.NewLoader(bucket, maxMaps, Parse)}
+}
+
+// Load returns the source map stored at key or ErrSourceMapNotFound.
+func (l *Loader) Load(ctx context.Context, key string) (*Map, error) {
+	m, err := l.loader.Load(ctx, key)
+	if errors.Is(err, storageutil.ErrObjectNotFound) {
+		return nil, ErrSourceMapNotFound
+	}
+	return m, err
+}
+
+// Symbolicator returns a symbolicator for the frames of a release.
+func (l *Loader) Symbolicator(ctx context.Context, organizationID, projectID uint64, release string) *Symbolicator {
+	return &Symbolicator{
+		ctx:            ctx,
+		loader:         l,
+		organizationID: organizationID,
+		projectID:      projectID,
+		release:        release,
+	}
+}
+
+// Symbolicate rewrites the function, file, line and column of a minified frame
+// when its source map is found. Frames without a source map are left as is.
+func (s *Symbolicator) Symbolicate(f *frame.Frame) error {
+	file := f.Path
+	if file == "" {
+		file = f.File
+	}
+	m, err := s.loader.Load(s.ctx, StoragePath(s.organizationID, s.projectID, s.release, file))
+	if err != nil {
+		if errors.Is(err, ErrSourceMapNotFound) {
+			return nil
+		}
+		return err
+	}
+	t, ok := m.Lookup(f.Line, f.Column)
+	if !ok {
+		return nil
+	}
+	if t.Name != "" {
+		f.Function = t.Name
+	}
+	f.Path = t.Source
+	f.File = path.Base(t.Source)
+	f.Line = t.Line
+	f.Column = t.Column
+	symbolicated := true
+	f.Data.JsSymbolicated = &symbolicated
+	return nil
+}
@@ -0,0 +1,243 @@
+// Package sourcemap resolves minified JavaScript positions to their original
+// source with version 3 source maps.
+package sourcemap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrUnsupportedVersion = errors.New("sourcemap: only version 3 is supported")
+	ErrInvalidMappings    = errors.New("sourcemap: invalid mappings")
+)
+
+type (
+	// Map is a parsed source map, or an index map made of sections.
+	Map struct {
+		sources  []string
+		names    []string
+		lines    [][]segment
+		sections []section
+	}
+
+	section struct {
+		line   uint32
+		column uint32
+		m      *Map
+	}
+
+	// segment has 0-based columns and lines, and -1 for a missing source
+	// or name.
+	segment struct {
+		column       uint32
+		source       int
+		sourceLine   uint32
+		sourceColumn uint32
+		name         int
+	}
+
+	// Token is an original position with 1-based line and column.
+	Token struct {
+		Source string
+		Line   uint32
+		Column uint32
+		Name   string
+	}
+
+	rawMap struct {
+		Version    int          `json:"version"`
+		SourceRoot string       `json:"sourceRoot"`
+		Sources    []string     `json:"sources"`
+		Names      []string     `json:"names"`
+		Mappings   string       `json:"mappings"`
+		Sections   []rawSection `json:"sections"`
+	}
+
+	rawSection struct {
+		Offset struct {
+			Line   uint32 `json:"line"`
+			Column uint32 `json:"column"`
+		} `json:"offset"`
+		Map *rawMap `json:"map"`
+	}
+)
+
+// Parse reads a source map.
+func Parse(r io.Reader) (*Map, error) {
+	var raw rawMap
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("sourcemap: %w", err)
+	}
+	return newMap(raw)
+}
+
+func newMap(raw rawMap) (*Map, error) {
+	if raw.Version != 3 {
+		return nil, ErrUnsupportedVersion
+	}
+	m := &Map{names: raw.Names}
+	if len(raw.Sections) > 0 {
+		for _, s := range raw.Sections {
+			if s.Map == nil {
+				return nil, errors.New("sourcemap: sections have to embed their map")
+			}
+			sm, err := newMap(*s.Map)
+			if err != nil {
+				return nil, err
+			}
+			m.sections = append(m.sections, section{line: s.Offset.Line, column: s.Offset.Column, m: sm})
+		}
+		return m, nil
+	}
+	m.sources = make([]string, 0, len(raw.Sources))
+	for _, s := range raw.Sources {
+		if raw.SourceRoot != "" && !strings.Contains(s, "://") && !strings.HasPrefix(s, "/") {
+			s = strings.TrimSuffix(raw.SourceRoot, "/") + "/" + s
+		}
+		m.sources = append(m.sources, s)
+	}
+	lines, err := decodeMappings(raw.Mappings, len(m.sources), len(m.names))
+	if err != nil {
+		return nil, err
+	}
+	m.lines = lines
+	return m, nil
+}
+
+// decodeMappings decodes the base64 VLQ mappings, a line of segments per
+// generated line separated by semicolons.
+func decodeMappings(mappings string, numSources, numNames int) ([][]segment, error) {
+	var (
+		lines        [][]segment
+		source       int
+		sourceLine   int
+		sourceColumn int
+		name         int
+	)
+	for _, rawLine := range strings.Split(mappings, ";") {
+		var column int
+		var line []segment
+		for _, rawSegment := range strings.Split(rawLine, ",") {
+			if rawSegment == "" {
+				continue
+			}
+			fields, err := decodeVLQ(rawSegment)
+			if err != nil {
+				return nil, err
+			}
+			column += fields[0]
+			s := segment{column: uint32(column), source: -1, name: -1}
+			switch len(fields) {
+			case 1:
+			case 4, 5:
+				source += fields[1]
+				sourceLine += fields[2]
+				sourceColumn += fields[3]
+				if source < 0 || source >= numSources || sourceLine < 0 || sourceColumn < 0 {
+					return nil, ErrInvalidMappings
+				}
+				s.source = source
+				s.sourceLine = uint32(sourceLine)
+				s.sourceColumn = uint32(sourceColumn)
+				if len(fields) == 5 {
+					name += fields[4]
+					if name < 0 || name >= numNames {
+						return nil, ErrInvalidMappings
+					}
+					s.name = name
+				}
+			default:
+				return nil, ErrInvalidMappings
+			}
+			if column < 0 {
+				return nil, ErrInvalidMappings
+			}
+			line = append(line, s)
+		}
+		sort.SliceStable(line, func(i, j int) bool { return line[i].column < line[j].column })
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+const base64Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+func decodeVLQ(s string) ([]int, error) {
+	var (
+		fields []int
+		value  int
+		shift  uint
+	)
+	for i := 0; i < len(s); i++ {
+		digit := strings.IndexByte(base64Alphabet, s[i])
+		if digit == -1 || shift > 30 {
+			return nil, ErrInvalidMappings
+		}
+		value += (digit & 31) << shift
+		if digit&32 != 0 {
+			shift += 5
+			continue
+		}
+		if value&1 != 0 {
+			fields = append(fields, -(value >> 1))
+		} else {
+			fields = append(fields, value>>1)
+		}
+		value, shift = 0, 0
+	}
+	if shift != 0 {
+		return nil, ErrInvalidMappings
+	}
+	return fields, nil
+}
+
+// Lookup returns the original position of a 1-based generated line and
+// column, the closest segment at or before the column on the same line.
+func (m *Map) Lookup(line, column uint32) (Token, bool) {
+	if line == 0 {
+		return Token{}, false
+	}
+	if column == 0 {
+		column = 1
+	}
+	if len(m.sections) > 0 {
+		i := sort.Search(len(m.sections), func(i int) bool {
+			s := m.sections[i]
+			return s.line > line-1 || (s.line == line-1 && s.column > column-1)
+		}) - 1
+		if i < 0 {
+			return Token{}, false
+		}
+		s := m.sections[i]
+		if s.line == line-1 {
+			column -= s.column
+		}
+		return s.m.Lookup(line-s.line, column)
+	}
+
+	if int(line) > len(m.lines) {
+		return Token{}, false
+	}
+	segments := m.lines[line-1]
+	i := sort.Search(len(segments), func(i int) bool {
+		return segments[i].column > column-1
+	}) - 1
+	if i < 0 || segments[i].source == -1 {
+		return Token{}, false
+	}
+	s := segments[i]
+	t := Token{
+		Source: m.sources[s.source],
+		Line:   s.sourceLine + 1,
+		Column: s.sourceColumn + 1,
+	}
+	if s.name != -1 {
+		t.Name = m.names[s.name]
+	}
+	return t, true
+}
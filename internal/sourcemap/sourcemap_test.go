@@ -0,0 +1,175 @@
+package sourcemap
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gocloud.dev/blob"
+	_ "gocloud.dev/blob/fileblob"
+
+	"github.com/getsentry/vroom/internal/frame"
+	"github.com/getsentry/vroom/internal/testutil"
+)
+
+const testSourceMap = `{
+	"version": 3,
+	"sourceRoot": "webpack:///",
+	"sources": ["src/app.ts"],
+	"names": ["render"],
+	"mappings": "AAAA,IAAIA;AACA,UAAU"
+}`
+
+func TestLookup(t *testing.T) {
+	m, err := Parse(strings.NewReader(testSourceMap))
+	if err != nil {
+		t.Fatalf("couldn't parse source map: %v", err)
+	}
+	index, err := Parse(strings.NewReader(`{
+		"version": 3,
+		"sections": [{"offset": {"line": 10, "column": 0}, "map": ` + testSourceMap + `}]
+	}`))
+	if err != nil {
+		t.Fatalf("couldn't parse index map: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		m      *Map
+		line   uint32
+		column uint32
+		want   Token
+		wantOK bool
+	}{
+		{
+			name:   "first segment",
+			m:      m,
+			line:   1,
+			column: 1,
+			want:   Token{Source: "webpack:///src/app.ts", Line: 1, Column: 1},
+			wantOK: true,
+		},
+		{
+			name:   "segment with a name",
+			m:      m,
+			line:   1,
+			column: 6,
+			want:   Token{Source: "webpack:///src/app.ts", Line: 1, Column: 5, Name: "render"},
+			wantOK: true,
+		},
+		{
+			name:   "relative fields across lines",
+			m:      m,
+			line:   2,
+			column: 12,
+			want:   Token{Source: "webpack:///src/app.ts", Line: 2, Column: 15},
+			wantOK: true,
+		},
+		{
+			name: "line past the end",
+			m:    m,
+			line: 3,
+		},
+		{
+			name:   "section",
+			m:      index,
+			line:   11,
+			column: 6,
+			want:   Token{Source: "webpack:///src/app.ts", Line: 1, Column: 5, Name: "render"},
+			wantOK: true,
+		},
+		{
+			name: "before the first section",
+			m:    index,
+			line: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := test.m.Lookup(test.line, test.column)
+			if ok != test.wantOK {
+				t.Fatalf("expected %v, got %v", test.wantOK, ok)
+			}
+			if diff := testutil.Diff(got, test.want); diff != "" {
+				t.Fatalf("Result mismatch: got - want +\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "version 2", input: `{"version": 2, "mappings": ""}`},
+		{name: "invalid base64", input: `{"version": 3, "sources": ["a.js"], "mappings": "A!AA"}`},
+		{name: "unknown source", input: `{"version": 3, "sources": ["a.js"], "mappings": "ACAA"}`},
+		{name: "truncated value", input: `{"version": 3, "sources": ["a.js"], "mappings": "AAAg"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(test.input))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestSymbolicate(t *testing.T) {
+	dir := t.TempDir()
+	key := StoragePath(1, 2, "app@1.0.0", "https://example.com/static/js/main.js?v=3")
+	if key != "1/2/sourcemaps/app@1.0.0/static%2Fjs%2Fmain.js.map" {
+		t.Fatalf("unexpected storage path %s", key)
+	}
+	err := os.MkdirAll(filepath.Join(dir, "1", "2", "sourcemaps", "app@1.0.0"), 0o755)
+	if err != nil {
+		t.Fatalf("couldn't create directory: %v", err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "1", "2", "sourcemaps", "app@1.0.0", "static%2Fjs%2Fmain.js.map"), []byte(testSourceMap), 0o600)
+	if err != nil {
+		t.Fatalf("couldn't write source map: %v", err)
+	}
+	bucket, err := blob.OpenBucket(context.Background(), "file://"+dir)
+	if err != nil {
+		t.Fatalf("couldn't open bucket: %v", err)
+	}
+	defer bucket.Close()
+
+	s := NewLoader(bucket, 1).Symbolicator(context.Background(), 1, 2, "app@1.0.0")
+	f := frame.Frame{
+		Function: "a",
+		Path:     "https://example.com/static/js/main.js?v=3",
+		File:     "main.js",
+		Line:     1,
+		Column:   6,
+	}
+	if err := s.Symbolicate(&f); err != nil {
+		t.Fatalf("couldn't symbolicate frame: %v", err)
+	}
+	symbolicated := true
+	want := frame.Frame{
+		Function: "render",
+		Path:     "webpack:///src/app.ts",
+		File:     "app.ts",
+		Line:     1,
+		Column:   5,
+		Data:     frame.Data{JsSymbolicated: &symbolicated},
+	}
+	if diff := testutil.Diff(f, want); diff != "" {
+		t.Fatalf("Result mismatch: got - want +\n%s", diff)
+	}
+
+	missing := frame.Frame{Function: "b", Path: "https://example.com/other.js", Line: 1}
+	if err := s.Symbolicate(&missing); err != nil {
+		t.Fatalf("expected a missing source map to be skipped, got %v", err)
+	}
+	if missing.Function != "b" || missing.Data.JsSymbolicated != nil {
+		t.Fatalf("expected the frame to be left as is, got %+v", missing)
+	}
+}
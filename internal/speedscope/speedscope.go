@@ -10,6 +10,7 @@ import (
 	"github.com/getsentry/vroom/internal/measurements"
 	"github.com/getsentry/vroom/internal/options"
 	"github.com/getsentry/vroom/internal/platform"
+	"github.com/getsentry/vroom/internal/quantile"
 	"github.com/getsentry/vroom/internal/timeutil"
 	"github.com/getsentry/vroom/internal/transaction"
 )
@@ -39,14 +40,21 @@ type (
 	}
 
 	FrameInfo struct {
-		Count       uint32   `json:"count"`
-		Weight      uint64   `json:"weight"`
-		SumDuration uint64   `json:"sumDuration"`
-		SumSelfTime uint64   `json:"sumSelfTime"`
-		DurationsNS []uint64 `json:"-"`
-		P75Duration uint64   `json:"p75Duration"`
-		P95Duration uint64   `json:"p95Duration"`
-		P99Duration uint64   `json:"p99Duration"`
+		Count       uint32           `json:"count"`
+		Weight      uint64           `json:"weight"`
+		SumDuration uint64           `json:"sumDuration"`
+		SumSelfTime uint64           `json:"sumSelfTime"`
+		Durations   *quantile.Sketch `json:"-"`
+		P75Duration uint64           `json:"p75Duration"`
+		P95Duration uint64           `json:"p95Duration"`
+		P99Duration uint64           `json:"p99Duration"`
+
+		// Only set on differential flamegraphs, in samples like the
+		// baseline and target weights of the sampled profile. The delta is
+		// reported even when it's 0.
+		BaselineWeight uint64 `json:"baselineWeight,omitempty"`
+		TargetWeight   uint64 `json:"targetWeight,omitempty"`
+		WeightDelta    *int64 `json:"weightDelta,omitempty"`
 	}
 
 	Event struct {
@@ -87,6 +95,8 @@ type (
 		Weights           []uint64         `json:"weights"`
 		SampleDurationsNs []uint64         `json:"sample_durations_ns"`
 		SampleCounts      []uint64         `json:"sample_counts,omitempty"`
+		BaselineWeights   []uint64         `json:"baseline_weights,omitempty"`
+		TargetWeights     []uint64         `json:"target_weights,omitempty"`
 	}
 
 	SharedData struct {
@@ -115,6 +125,15 @@ type (
 		TransactionName    string                      `json:"transactionName"`
 		Version            string                      `json:"version,omitempty"`
 		Metrics            *[]examples.FunctionMetrics `json:"metrics"`
+		Partial            *PartialResult              `json:"partial,omitempty"`
+	}
+
+	// PartialResult is set when only some of the candidates of a flamegraph
+	// were aggregated.
+	PartialResult struct {
+		Reason              string `json:"reason"`
+		CandidatesProcessed int    `json:"candidatesProcessed"`
+		CandidatesTotal     int    `json:"candidatesTotal"`
 	}
 
 	ProfileMetadata struct {
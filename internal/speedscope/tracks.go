@@ -0,0 +1,128 @@
+package speedscope
+
+import (
+	"sort"
+)
+
+type (
+	// Track is the timeline of a thread: the stack running at each point in
+	// time and the queues the thread served.
+	Track struct {
+		ThreadID     uint64
+		Name         string
+		IsMainThread bool
+		Priority     int
+		Samples      []TrackSample
+		Queues       []Queue
+	}
+
+	// TrackSample is a stack running from StartNS for DurationNS. Stack
+	// holds frame indexes, root frame first.
+	TrackSample struct {
+		StartNS    uint64
+		DurationNS uint64
+		Stack      []int
+	}
+)
+
+// Tracks returns the timeline of each thread of the profile, the main
+// thread first and then by thread ID. Sampled profiles have a sample per
+// stack sampled while evented profiles have a sample each time the stack
+// changes.
+func (o Output) Tracks() []Track {
+	tracks := make([]Track, 0, len(o.Profiles))
+	for i, p := range o.Profiles {
+		switch p := p.(type) {
+		case *SampledProfile:
+			tracks = append(tracks, sampledTrack(*p))
+		case SampledProfile:
+			tracks = append(tracks, sampledTrack(p))
+		case *EventedProfile:
+			// Evented profiles don't flag the main thread, it's the active
+			// profile.
+			tracks = append(tracks, eventedTrack(*p, i == o.ActiveProfileIndex))
+		case EventedProfile:
+			tracks = append(tracks, eventedTrack(p, i == o.ActiveProfileIndex))
+		}
+	}
+	sort.SliceStable(tracks, func(i, j int) bool {
+		if tracks[i].IsMainThread != tracks[j].IsMainThread {
+			return tracks[i].IsMainThread
+		}
+		return tracks[i].ThreadID < tracks[j].ThreadID
+	})
+	return tracks
+}
+
+func sampledTrack(p SampledProfile) Track {
+	t := Track{
+		ThreadID:     p.ThreadID,
+		Name:         p.Name,
+		IsMainThread: p.IsMainThread,
+		Priority:     p.Priority,
+		Samples:      make([]TrackSample, 0, len(p.Samples)),
+	}
+	ts := p.StartValue
+	for i, stack := range p.Samples {
+		var weight uint64
+		if i < len(p.Weights) {
+			weight = p.Weights[i]
+		}
+		t.Samples = append(t.Samples, TrackSample{
+			StartNS:    ts,
+			DurationNS: weight,
+			Stack:      stack,
+		})
+		ts += weight
+	}
+	queues := make([]string, 0, len(p.Queues))
+	for address := range p.Queues {
+		queues = append(queues, address)
+	}
+	sort.Strings(queues)
+	for _, address := range queues {
+		t.Queues = append(t.Queues, p.Queues[address])
+	}
+	return t
+}
+
+func eventedTrack(p EventedProfile, isMainThread bool) Track {
+	t := Track{
+		ThreadID:     p.ThreadID,
+		Name:         p.Name,
+		IsMainThread: isMainThread,
+	}
+	var stack []int
+	for i, e := range p.Events {
+		switch e.Type {
+		case EventTypeOpenFrame:
+			stack = append(stack, e.Frame)
+		case EventTypeCloseFrame:
+			// Frames are closed in order but a trace can end with frames
+			// closed out of order, the last matching frame is closed.
+			for j := len(stack) - 1; j >= 0; j-- {
+				if stack[j] == e.Frame {
+					stack = append(stack[:j], stack[j+1:]...)
+					break
+				}
+			}
+		}
+		// Events at the same time are applied together.
+		if i+1 < len(p.Events) && p.Events[i+1].At == e.At {
+			continue
+		}
+		end := p.EndValue
+		if i+1 < len(p.Events) {
+			end = p.Events[i+1].At
+		}
+		if len(stack) == 0 || end <= e.At {
+			continue
+		}
+		t.Samples = append(t.Samples, TrackSample{
+			StartNS:    e.At,
+			DurationNS: end - e.At,
+			Stack:      append([]int(nil), stack...),
+		})
+	}
+	return t
+}
@@ -0,0 +1,102 @@
+package speedscope
+
+import (
+	"testing"
+
+	"github.com/getsentry/vroom/internal/testutil"
+)
+
+func TestTracks(t *testing.T) {
+	tests := []struct {
+		name   string
+		output Output
+		want   []Track
+	}{
+		{
+			name: "sampled profiles with the main thread first",
+			output: Output{
+				Profiles: []interface{}{
+					&SampledProfile{
+						ThreadID:   2,
+						Name:       "worker",
+						StartValue: 10,
+						Samples:    [][]int{{0}, {0, 1}},
+						Weights:    []uint64{10, 20},
+						Queues: map[string]Queue{
+							"0x2": {Label: "b", StartNS: 20, EndNS: 30},
+							"0x1": {Label: "a", StartNS: 10, EndNS: 20},
+						},
+					},
+					&SampledProfile{
+						ThreadID:     3,
+						IsMainThread: true,
+						Priority:     31,
+						Samples:      [][]int{{0}},
+						Weights:      []uint64{5},
+					},
+				},
+			},
+			want: []Track{
+				{
+					ThreadID:     3,
+					IsMainThread: true,
+					Priority:     31,
+					Samples: []TrackSample{
+						{StartNS: 0, DurationNS: 5, Stack: []int{0}},
+					},
+				},
+				{
+					ThreadID: 2,
+					Name:     "worker",
+					Samples: []TrackSample{
+						{StartNS: 10, DurationNS: 10, Stack: []int{0}},
+						{StartNS: 20, DurationNS: 20, Stack: []int{0, 1}},
+					},
+					Queues: []Queue{
+						{Label: "a", StartNS: 10, EndNS: 20},
+						{Label: "b", StartNS: 20, EndNS: 30},
+					},
+				},
+			},
+		},
+		{
+			name: "evented profile",
+			output: Output{
+				ActiveProfileIndex: 0,
+				Profiles: []interface{}{
+					EventedProfile{
+						ThreadID: 1,
+						EndValue: 40,
+						Events: []Event{
+							{Type: EventTypeOpenFrame, Frame: 0, At: 0},
+							{Type: EventTypeOpenFrame, Frame: 1, At: 10},
+							{Type: EventTypeCloseFrame, Frame: 1, At: 20},
+							{Type: EventTypeOpenFrame, Frame: 2, At: 20},
+							{Type: EventTypeCloseFrame, Frame: 2, At: 30},
+							{Type: EventTypeCloseFrame, Frame: 0, At: 30},
+						},
+					},
+				},
+			},
+			want: []Track{
+				{
+					ThreadID:     1,
+					IsMainThread: true,
+					Samples: []TrackSample{
+						{StartNS: 0, DurationNS: 10, Stack: []int{0}},
+						{StartNS: 10, DurationNS: 10, Stack: []int{0, 1}},
+						{StartNS: 20, DurationNS: 10, Stack: []int{0, 2}},
+					},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := testutil.Diff(test.output.Tracks(), test.want); diff != "" {
+				t.Fatalf("Result mismatch: got - want +\n%s", diff)
+			}
+		})
+	}
+}
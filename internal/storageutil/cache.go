@@ -0,0 +1,332 @@
+package storageutil
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"gocloud.dev/blob"
+)
+
+type (
+	// Cache keeps objects read from the bucket. The memory tier holds them
+	// decoded, along with what was computed from them like call trees, so a
+	// hit skips decoding. Decoded values are shared between reads and
+	// mustn't be modified. Objects are expected to be immutable once written
+	// so entries never have to be invalidated, they are only evicted when a
+	// tier is full. Writes only enforce it on GCS, an object overwritten in
+	// another bucket can be served stale.
+	//
+	// The memory tier is sized by an estimate of the memory used by the
+	// decoded values and evicts the least recently used ones. When a
+	// directory is set, the decompressed bytes of objects are also written
+	// to disk and the disk tier is checked before going to the bucket.
+	Cache struct {
+		mu     sync.Mutex
+		memory *lru
+
+		diskMu sync.Mutex
+		disk   *lru
+		dir    string
+
+		hits      atomic.Uint64
+		diskHits  atomic.Uint64
+		misses    atomic.Uint64
+		evictions atomic.Uint64
+	}
+
+	// CacheStats holds the counters of a cache since it was created.
+	CacheStats struct {
+		Hits         uint64 `json:"hits"`
+		DiskHits     uint64 `json:"disk_hits"`
+		Misses       uint64 `json:"misses"`
+		Evictions    uint64 `json:"evictions"`
+		Items        int    `json:"items"`
+		Bytes        int64  `json:"bytes"`
+		DiskItems    int    `json:"disk_items"`
+		DiskBytes    int64  `json:"disk_bytes"`
+		MaxBytes     int64  `json:"max_bytes"`
+		MaxDiskBytes int64  `json:"max_disk_bytes"`
+	}
+
+	lru struct {
+		maxBytes int64
+		size     int64
+		ll       *list.List
+		items    map[string]*list.Element
+	}
+
+	lruEntry struct {
+		key   string
+		value any
+		size  int64
+	}
+)
+
+// NewCache returns a cache keeping up to maxBytes of decoded values in
+// memory. When dir is not empty, up to maxDiskBytes of objects are kept in
+// this directory as well and the objects already there are reused.
+func NewCache(maxBytes int64, dir string, maxDiskBytes int64) (*Cache, error) {
+	c := Cache{
+		memory: newLRU(maxBytes),
+	}
+	if dir == "" {
+		return &c, nil
+	}
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	c.dir = dir
+	c.disk = newLRU(maxDiskBytes)
+	err = c.loadDisk()
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ReadDecoded returns the value cached under key or reads the object from
+// the disk tier or the bucket and caches what decode returns, a value and an
+// estimate of the memory it uses on top of the JSON it was decoded from.
+// Several values can be decoded from the same object under different keys. A
+// nil cache reads from the bucket directly. Objects are decoded while they're
+// read unless the disk tier needs their bytes.
+//
+// ReadDecoded also reports whether the value is shared with other reads
+// through the cache, in which case it mustn't be modified.
+func ReadDecoded[T any](
+	ctx context.Context,
+	c *Cache,
+	b *blob.Bucket,
+	objectName string,
+	key string,
+	decode func(r io.Reader) (T, int64, error),
+) (T, bool, error) {
+	var zero T
+	if c == nil {
+		v, _, err := decodeCompressed(ctx, b, objectName, decode)
+		return v, false, err
+	}
+	if v, ok := c.getMemory(key); ok {
+		return v.(T), true, nil
+	}
+	v, size, err := decodeCached(ctx, c, b, objectName, decode)
+	if err != nil {
+		return zero, false, err
+	}
+	return v, c.addToMemory(key, v, size), nil
+}
+
+// Stats returns the counters and the size of the cache.
+func (c *Cache) Stats() CacheStats {
+	s := CacheStats{
+		Hits:      c.hits.Load(),
+		DiskHits:  c.diskHits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+	}
+	c.mu.Lock()
+	s.Items = c.memory.ll.Len()
+	s.Bytes = c.memory.size
+	s.MaxBytes = c.memory.maxBytes
+	c.mu.Unlock()
+	if c.disk != nil {
+		c.diskMu.Lock()
+		s.DiskItems = c.disk.ll.Len()
+		s.DiskBytes = c.disk.size
+		s.MaxDiskBytes = c.disk.maxBytes
+		c.diskMu.Unlock()
+	}
+	return s
+}
+
+func (c *Cache) getMemory(key string) (any, bool) {
+	c.mu.Lock()
+	v, ok := c.memory.get(key)
+	c.mu.Unlock()
+	if ok {
+		c.hits.Add(1)
+	}
+	return v, ok
+}
+
+// decodeCached decodes an object read from the disk tier or from the
+// bucket, in which case it's written to the disk tier. Without a disk tier,
+// the object is decoded while it's read from the bucket.
+func decodeCached[T any](
+	ctx context.Context,
+	c *Cache,
+	b *blob.Bucket,
+	objectName string,
+	decode func(r io.Reader) (T, int64, error),
+) (T, int64, error) {
+	if c.disk == nil {
+		c.misses.Add(1)
+		return decodeCompressed(ctx, b, objectName, decode)
+	}
+	var zero T
+	data, err := c.readCompressed(ctx, b, objectName)
+	if err != nil {
+		return zero, 0, err
+	}
+	v, size, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return zero, 0, err
+	}
+	return v, size + int64(len(data)), nil
+}
+
+// readCompressed returns the decompressed bytes of an object from the disk
+// tier or reads them from the bucket and writes them to the disk tier.
+func (c *Cache) readCompressed(ctx context.Context, b *blob.Bucket, objectName string) ([]byte, error) {
+	name := diskName(objectName)
+	c.diskMu.Lock()
+	_, ok := c.disk.get(name)
+	c.diskMu.Unlock()
+	if ok {
+		// The file could have been evicted in the meantime, it's a miss
+		// then.
+		data, err := os.ReadFile(filepath.Join(c.dir, name))
+		if err == nil {
+			c.diskHits.Add(1)
+			return data, nil
+		}
+	}
+	c.misses.Add(1)
+	data, err := readCompressed(ctx, b, objectName)
+	if err != nil {
+		return nil, err
+	}
+	c.addToDisk(name, data)
+	return data, nil
+}
+
+func (c *Cache) addToDisk(name string, data []byte) {
+	if int64(len(data)) > c.disk.maxBytes {
+		return
+	}
+	err := writeFileAtomically(filepath.Join(c.dir, name), data)
+	if err != nil {
+		return
+	}
+	c.diskMu.Lock()
+	evicted := c.disk.add(name, nil, int64(len(data)))
+	c.diskMu.Unlock()
+	c.removeFiles(evicted)
+}
+
+// addToMemory adds a value to the memory tier and returns false when it's
+// too big to be added.
+func (c *Cache) addToMemory(key string, v any, size int64) bool {
+	c.mu.Lock()
+	evicted := c.memory.add(key, v, size)
+	c.mu.Unlock()
+	c.evictions.Add(uint64(len(evicted)))
+	return size <= c.memory.maxBytes
+}
+
+func (c *Cache) removeFiles(names []string) {
+	for _, name := range names {
+		_ = os.Remove(filepath.Join(c.dir, name))
+	}
+}
+
+// diskName returns the name of the file holding an object on disk. Object
+// names contain slashes so they're hashed.
+func diskName(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+// loadDisk indexes the files left in the directory by a previous process,
+// the least recently modified ones being evicted first.
+func (c *Cache) loadDisk() error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	files := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		if !e.Type().IsRegular() || len(e.Name()) != sha256.Size*2 {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, info)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	for _, f := range files {
+		c.removeFiles(c.disk.add(f.Name(), nil, f.Size()))
+	}
+	return nil
+}
+
+func writeFileAtomically(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func newLRU(maxBytes int64) *lru {
+	return &lru{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (l *lru) get(key string) (any, bool) {
+	e, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	l.ll.MoveToFront(e)
+	return e.Value.(*lruEntry).value, true
+}
+
+// add adds an entry and returns the keys evicted to make room for it. An
+// entry bigger than the cache is not added.
+func (l *lru) add(key string, value any, size int64) []string {
+	if size > l.maxBytes {
+		return nil
+	}
+	if e, ok := l.items[key]; ok {
+		l.ll.MoveToFront(e)
+		return nil
+	}
+	l.items[key] = l.ll.PushFront(&lruEntry{key: key, value: value, size: size})
+	l.size += size
+	var evicted []string
+	for l.size > l.maxBytes {
+		e := l.ll.Back()
+		entry := e.Value.(*lruEntry)
+		l.ll.Remove(e)
+		delete(l.items, entry.key)
+		l.size -= entry.size
+		evicted = append(evicted, entry.key)
+	}
+	return evicted
+}
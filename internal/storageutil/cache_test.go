@@ -0,0 +1,169 @@
+package storageutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/getsentry/vroom/internal/testutil"
+)
+
+func TestCacheUnmarshalCompressed(t *testing.T) {
+	ctx := context.Background()
+	objectName := uuid.New().String()
+	originalData := Profile{Samples: []int{1, 2, 3}, Frames: []int{4, 5}}
+	err := CompressedWrite(ctx, fileBlobBucket, objectName, originalData)
+	if err != nil {
+		t.Fatalf("we should be able to write: %s", err.Error())
+	}
+
+	tests := []struct {
+		name     string
+		maxBytes int64
+		disk     bool
+		stats    CacheStats
+	}{
+		{
+			name:     "memory",
+			maxBytes: 1 << 20,
+			stats:    CacheStats{Hits: 1, Misses: 1, Items: 1, Bytes: 35, MaxBytes: 1 << 20},
+		},
+		{
+			name:     "disk",
+			maxBytes: 1,
+			disk:     true,
+			stats: CacheStats{
+				DiskHits:     1,
+				Misses:       1,
+				DiskItems:    1,
+				DiskBytes:    35,
+				MaxBytes:     1,
+				MaxDiskBytes: 1 << 20,
+			},
+		},
+		{
+			name:  "object too big",
+			stats: CacheStats{Misses: 2},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var dir string
+			if test.disk {
+				dir = t.TempDir()
+			}
+			c, err := NewCache(test.maxBytes, dir, 1<<20)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 2; i++ {
+				p, _, err := ReadDecoded(ctx, c, fileBlobBucket, objectName, objectName, decodeProfile)
+				if err != nil {
+					t.Fatalf("we should be able to read: %s", err.Error())
+				}
+				if diff := testutil.Diff(p, originalData); diff != "" {
+					t.Fatalf("Result mismatch: got - want +\n%s", diff)
+				}
+			}
+			if diff := testutil.Diff(c.Stats(), test.stats); diff != "" {
+				t.Fatalf("Result mismatch: got - want +\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCacheNotFound(t *testing.T) {
+	c, err := NewCache(1<<20, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objectName := uuid.New().String()
+	_, _, err = ReadDecoded(context.Background(), c, fileBlobBucket, objectName, objectName, decodeProfile)
+	if !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("expecting an error of ErrObjectNotFound, instead got %v", err)
+	}
+	if s := c.Stats(); s.Items != 0 {
+		t.Fatalf("missing objects shouldn't be cached, got %d items", s.Items)
+	}
+}
+
+func TestCacheReusesDisk(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewCache(0, dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.addToDisk(diskName("a"), []byte("data"))
+
+	c, err = NewCache(0, dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := c.readCompressed(context.Background(), fileBlobBucket, "a")
+	if err != nil || string(data) != "data" {
+		t.Fatalf("expected the object written by the previous cache, got %q: %v", data, err)
+	}
+	if s := c.Stats(); s.DiskHits != 1 {
+		t.Fatalf("expected a disk hit, got %+v", s)
+	}
+}
+
+func TestCacheDecodesOnce(t *testing.T) {
+	ctx := context.Background()
+	objectName := uuid.New().String()
+	err := CompressedWrite(ctx, fileBlobBucket, objectName, Profile{Samples: []int{1}})
+	if err != nil {
+		t.Fatalf("we should be able to write: %s", err.Error())
+	}
+	c, err := NewCache(1<<20, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded int
+	decode := func(r io.Reader) (*Profile, int64, error) {
+		decoded++
+		p, size, err := decodeProfile(r)
+		return &p, size, err
+	}
+	first, shared, err := ReadDecoded(ctx, c, fileBlobBucket, objectName, objectName, decode)
+	if err != nil || !shared {
+		t.Fatalf("expected a value shared through the cache, got %v: %v", shared, err)
+	}
+	second, _, err := ReadDecoded(ctx, c, fileBlobBucket, objectName, objectName, decode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded != 1 || first != second {
+		t.Fatalf("expected the decoded value to be reused, decoded %d times", decoded)
+	}
+
+	_, shared, err = ReadDecoded(ctx, nil, fileBlobBucket, objectName, objectName, decode)
+	if err != nil || shared {
+		t.Fatalf("expected a value read without the cache to not be shared, got %v: %v", shared, err)
+	}
+}
+
+func decodeProfile(r io.Reader) (Profile, int64, error) {
+	var p Profile
+	err := json.NewDecoder(r).Decode(&p)
+	return p, 0, err
+}
+
+func TestLRUEviction(t *testing.T) {
+	l := newLRU(10)
+	l.add("a", nil, 4)
+	l.add("b", nil, 4)
+	l.get("a")
+	evicted := l.add("c", nil, 4)
+	if diff := testutil.Diff(evicted, []string{"b"}); diff != "" {
+		t.Fatalf("Result mismatch: got - want +\n%s", diff)
+	}
+	if evicted := l.add("d", nil, 11); evicted != nil || l.size != 8 {
+		t.Fatalf("entries bigger than the cache shouldn't be added")
+	}
+}
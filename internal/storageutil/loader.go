@@ -0,0 +1,166 @@
+package storageutil
+
+import (
+	"container/list"
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+)
+
+const (
+	// FailureTTL is how long an object missing or failing to parse isn't
+	// read again.
+	FailureTTL = 5 * time.Minute
+
+	// maxLoaderFailures is the number of failed objects a loader remembers.
+	maxLoaderFailures = 1024
+)
+
+type (
+	// Loader reads objects from a bucket, parses them and keeps the most
+	// recently used ones parsed. Objects missing or failing to parse are
+	// remembered for FailureTTL, the oldest failures being forgotten first
+	// when there are too many, so they aren't read again for every profile.
+	// Errors reading the bucket aren't remembered.
+	Loader[T any] struct {
+		bucket      *blob.Bucket
+		parse       func(io.Reader) (T, error)
+		maxItems    int
+		maxFailures int
+
+		mu       sync.Mutex
+		items    *list.List
+		index    map[string]*list.Element
+		failures *list.List
+		failed   map[string]*list.Element
+		now      func() time.Time
+	}
+
+	loaderEntry[T any] struct {
+		key   string
+		value T
+	}
+
+	loaderFailure struct {
+		key       string
+		err       error
+		expiresAt time.Time
+	}
+
+	// loaderReader records the errors reading an object, to tell them apart
+	// from the errors parsing it.
+	loaderReader struct {
+		r   io.Reader
+		err error
+	}
+)
+
+// NewLoader returns a loader keeping up to maxItems objects parsed with parse.
+func NewLoader[T any](bucket *blob.Bucket, maxItems int, parse func(io.Reader) (T, error)) *Loader[T] {
+	return &Loader[T]{
+		bucket:      bucket,
+		parse:       parse,
+		maxItems:    max(maxItems, 1),
+		maxFailures: maxLoaderFailures,
+		items:       list.New(),
+		index:       make(map[string]*list.Element),
+		failures:    list.New(),
+		failed:      make(map[string]*list.Element),
+		now:         time.Now,
+	}
+}
+
+// Load returns the parsed object at key, ErrObjectNotFound when it doesn't
+// exist or the error parsing it.
+func (l *Loader[T]) Load(ctx context.Context, key string) (T, error) {
+	var zero T
+	l.mu.Lock()
+	if e, exists := l.index[key]; exists {
+		l.items.MoveToFront(e)
+		l.mu.Unlock()
+		return e.Value.(*loaderEntry[T]).value, nil
+	}
+	if e, exists := l.failed[key]; exists {
+		f := e.Value.(*loaderFailure)
+		if l.now().Before(f.expiresAt) {
+			l.mu.Unlock()
+			return zero, f.err
+		}
+		l.failures.Remove(e)
+		delete(l.failed, key)
+	}
+	l.mu.Unlock()
+
+	r, err := l.bucket.NewReader(ctx, key, nil)
+	if err != nil {
+		if gcerrors.Code(err) == gcerrors.NotFound {
+			l.fail(key, ErrObjectNotFound)
+			return zero, ErrObjectNotFound
+		}
+		return zero, err
+	}
+	defer r.Close()
+	lr := &loaderReader{r: r}
+	v, err := l.parse(lr)
+	if lr.err != nil && lr.err != io.EOF {
+		return zero, lr.err
+	}
+	if err != nil {
+		l.fail(key, err)
+		return zero, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, exists := l.failed[key]; exists {
+		l.failures.Remove(e)
+		delete(l.failed, key)
+	}
+	if e, exists := l.index[key]; exists {
+		return e.Value.(*loaderEntry[T]).value, nil
+	}
+	l.index[key] = l.items.PushFront(&loaderEntry[T]{key: key, value: v})
+	for l.items.Len() > l.maxItems {
+		e := l.items.Back()
+		l.items.Remove(e)
+		delete(l.index, e.Value.(*loaderEntry[T]).key)
+	}
+	return v, nil
+}
+
+// fail remembers the error of an object. Failures all live as long, so the
+// oldest ones are at the back and expire first.
+func (l *Loader[T]) fail(key string, err error) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, exists := l.failed[key]; exists {
+		l.failures.Remove(e)
+	}
+	l.failed[key] = l.failures.PushFront(&loaderFailure{
+		key:       key,
+		err:       err,
+		expiresAt: now.Add(FailureTTL),
+	})
+	for l.failures.Len() > 0 {
+		e := l.failures.Back()
+		f := e.Value.(*loaderFailure)
+		if l.failures.Len() <= l.maxFailures && now.Before(f.expiresAt) {
+			break
+		}
+		l.failures.Remove(e)
+		delete(l.failed, f.key)
+	}
+}
+
+func (r *loaderReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil {
+		r.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,104 @@
+package storageutil
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var errCorruptObject = errors.New("corrupt object")
+
+func newTestLoader(maxItems int) (*Loader[string], *int) {
+	parsed := 0
+	l := NewLoader(fileBlobBucket, maxItems, func(r io.Reader) (string, error) {
+		parsed++
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return "", err
+		}
+		if string(b) == "corrupt" {
+			return "", errCorruptObject
+		}
+		return string(b), nil
+	})
+	return l, &parsed
+}
+
+func writeTestObject(t *testing.T, value string) string {
+	t.Helper()
+
+	key := uuid.New().String()
+	err := fileBlobBucket.WriteAll(context.Background(), key, []byte(value), nil)
+	if err != nil {
+		t.Fatalf("couldn't write the object: %v", err)
+	}
+	return key
+}
+
+func TestLoaderKeepsRecentObjects(t *testing.T) {
+	ctx := context.Background()
+	l, parsed := newTestLoader(1)
+	a := writeTestObject(t, "a")
+	b := writeTestObject(t, "b")
+
+	for _, key := range []string{a, a, b, a} {
+		if _, err := l.Load(ctx, key); err != nil {
+			t.Fatalf("couldn't load %s: %v", key, err)
+		}
+	}
+	if *parsed != 3 {
+		t.Fatalf("expected a to be parsed again once evicted, got %d parses", *parsed)
+	}
+}
+
+func TestLoaderRemembersFailures(t *testing.T) {
+	ctx := context.Background()
+	l, parsed := newTestLoader(1)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	corrupt := writeTestObject(t, "corrupt")
+	for i := 0; i < 2; i++ {
+		if _, err := l.Load(ctx, corrupt); !errors.Is(err, errCorruptObject) {
+			t.Fatalf("expected %v, got %v", errCorruptObject, err)
+		}
+	}
+	if *parsed != 1 {
+		t.Fatalf("expected the corrupt object to be parsed once, got %d parses", *parsed)
+	}
+
+	missing := uuid.New().String()
+	if _, err := l.Load(ctx, missing); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("expected %v, got %v", ErrObjectNotFound, err)
+	}
+	err := fileBlobBucket.WriteAll(ctx, missing, []byte("found"), nil)
+	if err != nil {
+		t.Fatalf("couldn't write the object: %v", err)
+	}
+	if _, err := l.Load(ctx, missing); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("expected the missing object to be remembered, got %v", err)
+	}
+
+	now = now.Add(FailureTTL)
+	v, err := l.Load(ctx, missing)
+	if err != nil || v != "found" {
+		t.Fatalf("expected the object to be read again once expired, got %q and %v", v, err)
+	}
+}
+
+func TestLoaderBoundsFailures(t *testing.T) {
+	ctx := context.Background()
+	l, _ := newTestLoader(1)
+	l.maxFailures = 2
+
+	for i := 0; i < 3; i++ {
+		_, _ = l.Load(ctx, uuid.New().String())
+	}
+	if len(l.failed) != 2 || l.failures.Len() != 2 {
+		t.Fatalf("expected 2 failures, got %d", len(l.failed))
+	}
+}
@@ -5,16 +5,28 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net/url"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/pierrec/lz4/v4"
 	"gocloud.dev/blob"
 	"gocloud.dev/gcerrors"
+
+	"github.com/getsentry/vroom/internal/monitoring"
+)
+
+var (
+	// ErrObjectNotFound indicates an object was not found.
+	ErrObjectNotFound = errors.New("object not found")
+	// ErrObjectExists indicates an object wasn't written since it already
+	// exists.
+	ErrObjectExists = errors.New("object already exists")
 )
 
-// ErrObjectNotFound indicates an object was not found.
-var ErrObjectNotFound = errors.New("object not found")
+const readTimeout = 5 * time.Second
 
 // CompressedWrite compresses and writes data to Google Cloud Storage.
 func CompressedWrite(ctx context.Context, b *blob.Bucket, objectName string, d interface{}) error {
@@ -43,15 +55,25 @@ func CompressedWrite(ctx context.Context, b *blob.Bucket, objectName string, d i
 	if err != nil {
 		cancel()
 		ow.Close()
-		return err
+		return writeError(objectName, err)
 	}
 	err = zw.Close()
 	if err != nil {
 		cancel()
 		ow.Close()
-		return err
+		return writeError(objectName, err)
 	}
-	return ow.Close()
+	return writeError(objectName, ow.Close())
+}
+
+// writeError returns ErrObjectExists when the write precondition failed,
+// meaning the object was already written.
+func writeError(objectName string, err error) error {
+	switch gcerrors.Code(err) {
+	case gcerrors.AlreadyExists, gcerrors.FailedPrecondition:
+		return fmt.Errorf("%w: %s", ErrObjectExists, objectName)
+	}
+	return err
 }
 
 // UnmarshalCompressed reads compressed JSON data from GCS and unmarshals it.
@@ -61,29 +83,109 @@ func UnmarshalCompressed(
 	objectName string,
 	d interface{},
 ) error {
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	_, _, err := decodeCompressed(ctx, b, objectName, func(r io.Reader) (struct{}, int64, error) {
+		return struct{}{}, 0, json.NewDecoder(r).Decode(d)
+	})
+	return err
+}
+
+// readCompressed reads and decompresses an object from the bucket.
+func readCompressed(ctx context.Context, b *blob.Bucket, objectName string) ([]byte, error) {
+	data, _, err := decodeCompressed(ctx, b, objectName, func(r io.Reader) ([]byte, int64, error) {
+		data, err := io.ReadAll(r)
+		return data, 0, err
+	})
+	return data, err
+}
+
+// decodeCompressed reads an object from the bucket and decodes it while it's
+// decompressed, so the decompressed bytes are never held in memory at once.
+// It returns the size decode returns plus the number of decompressed bytes.
+// The read duration includes decoding.
+func decodeCompressed[T any](
+	ctx context.Context,
+	b *blob.Bucket,
+	objectName string,
+	decode func(r io.Reader) (T, int64, error),
+) (T, int64, error) {
+	var zero T
+	ctx, cancel := context.WithTimeout(ctx, readTimeout)
 	defer cancel()
 
+	start := time.Now()
 	or, err := b.NewReader(ctx, objectName, nil)
 	if err != nil {
 		if gcerrors.Code(err) == gcerrors.NotFound {
-			return fmt.Errorf("%w: %s", ErrObjectNotFound, objectName)
+			return zero, 0, fmt.Errorf("%w: %s", ErrObjectNotFound, objectName)
 		}
 
-		return err
+		return zero, 0, err
 	}
 	defer or.Close()
-	zr := lz4.NewReader(or)
-	err = json.NewDecoder(zr).Decode(d)
+	r := countingReader{r: lz4.NewReader(or)}
+	v, size, err := decode(&r)
 	if err != nil {
-		return err
+		return zero, 0, err
+	}
+	backend := bucketBackend(b)
+	monitoring.StorageReadDuration.WithLabelValues(backend).Observe(time.Since(start).Seconds())
+	monitoring.StorageReadBytes.WithLabelValues(backend).Add(float64(or.Size()))
+	return v, size + r.n, nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// backends holds the name of the driver behind each bucket opened with
+// OpenBucket, used to label storage metrics.
+var backends sync.Map
+
+// OpenBucket opens the bucket at urlstr and records the name of its driver,
+// taken from the URL scheme.
+func OpenBucket(ctx context.Context, urlstr string) (*blob.Bucket, error) {
+	b, err := blob.OpenBucket(ctx, urlstr)
+	if err != nil {
+		return nil, err
+	}
+	backends.Store(b, backendName(urlstr))
+	return b, nil
+}
+
+// backendName returns the name of the driver of a bucket URL.
+func backendName(urlstr string) string {
+	u, err := url.Parse(urlstr)
+	if err != nil || u.Scheme == "" {
+		return "other"
+	}
+	if u.Scheme == "gs" {
+		return "gcs"
+	}
+	return u.Scheme
+}
+
+// bucketBackend returns the name of the driver behind a bucket, "other" when
+// it wasn't opened with OpenBucket.
+func bucketBackend(b *blob.Bucket) string {
+	if backend, ok := backends.Load(b); ok {
+		return backend.(string)
 	}
-	return nil
+	return "other"
 }
 
 type (
+	// ReadJob reads objects from the bucket, through the cache when it's
+	// not nil.
 	ReadJob interface {
-		Read()
+		Read(cache *Cache)
 	}
 
 	ReadJobResult interface {
@@ -91,8 +193,10 @@ type (
 	}
 )
 
-func ReadWorker(jobs <-chan ReadJob) {
+func ReadWorker(jobs <-chan ReadJob, cache *Cache) {
 	for job := range jobs {
-		job.Read()
+		monitoring.ReadWorkersBusy.Inc()
+		job.Read(cache)
+		monitoring.ReadWorkersBusy.Dec()
 	}
 }
@@ -267,3 +267,24 @@ func BenchmarkJsonIterator(b *testing.B) {
 		}
 	}
 }
+
+func TestBackendName(t *testing.T) {
+	tests := []struct {
+		url     string
+		backend string
+	}{
+		{url: "gs://sentry-profiles", backend: "gcs"},
+		{url: "s3://sentry-profiles?region=us-west-1", backend: "s3"},
+		{url: "azblob://sentry-profiles", backend: "azblob"},
+		{url: "file://./test/gcs/sentry-profiles", backend: "file"},
+		{url: "sentry-profiles", backend: "other"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			if backend := backendName(test.url); backend != test.backend {
+				t.Fatalf("expected %s, got %s", test.backend, backend)
+			}
+		})
+	}
+}